@@ -1,6 +1,8 @@
 package ast
 
 import (
+	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/nicolerobin/monkey/token"
@@ -35,3 +37,589 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. got=%q", program.String())
 	}
 }
+
+func TestModify(t *testing.T) {
+	one := func() Expression {
+		return &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: 1}
+	}
+	two := func() Expression {
+		return &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "2"}, Value: 2}
+	}
+
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok {
+			return node
+		}
+
+		if integer.Value != 1 {
+			return node
+		}
+
+		return two()
+	}
+
+	tests := []struct {
+		input    Node
+		expected Node
+	}{
+		{
+			one(),
+			two(),
+		},
+		{
+			&Program{
+				Statements: []Statement{
+					&ExpressionStatement{Expression: one()},
+				},
+			},
+			&Program{
+				Statements: []Statement{
+					&ExpressionStatement{Expression: two()},
+				},
+			},
+		},
+		{
+			&InfixExpression{Left: one(), Operator: "+", Right: two()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&InfixExpression{Left: two(), Operator: "+", Right: one()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&PrefixExpression{Operator: "-", Right: one()},
+			&PrefixExpression{Operator: "-", Right: two()},
+		},
+		{
+			&IndexExpression{Left: one(), Index: one()},
+			&IndexExpression{Left: two(), Index: two()},
+		},
+		{
+			&MemberExpression{Object: one(), Property: &Identifier{Value: "a"}},
+			&MemberExpression{Object: two(), Property: &Identifier{Value: "a"}},
+		},
+		{
+			&IfExpression{
+				Condition: one(),
+				Consequence: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+				Alternative: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+			},
+			&IfExpression{
+				Condition: two(),
+				Consequence: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+				Alternative: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+			},
+		},
+		{
+			&ReturnStatement{ReturnValue: one()},
+			&ReturnStatement{ReturnValue: two()},
+		},
+		{
+			&LetStatement{Name: &Identifier{Value: "a"}, Value: one()},
+			&LetStatement{Name: &Identifier{Value: "a"}, Value: two()},
+		},
+		{
+			&FunctionLiteral{
+				Parameters: []*Identifier{},
+				Body: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+			},
+			&FunctionLiteral{
+				Parameters: []*Identifier{},
+				Body: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+			},
+		},
+		{
+			&MacroLiteral{
+				Parameters: []*Identifier{},
+				Body: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+			},
+			&MacroLiteral{
+				Parameters: []*Identifier{},
+				Body: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+			},
+		},
+		{
+			&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{one(), two()}},
+			&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{two(), two()}},
+		},
+		{
+			&ArrayLiteral{Elements: []Expression{one(), one()}},
+			&ArrayLiteral{Elements: []Expression{two(), two()}},
+		},
+	}
+
+	for _, tt := range tests {
+		modified := Modify(tt.input, turnOneIntoTwo)
+
+		if modified.String() != tt.expected.String() {
+			t.Errorf("not equal. got=%q, want=%q", modified, tt.expected)
+		}
+	}
+
+	key := one()
+	hashLiteral := &HashLiteral{
+		Pairs: map[Expression]Expression{key: one()},
+		Keys:  []Expression{key},
+	}
+
+	Modify(hashLiteral, turnOneIntoTwo)
+
+	for _, key := range hashLiteral.Keys {
+		if key.(*IntegerLiteral).Value != 2 {
+			t.Errorf("key is not %d, got=%d", 2, key.(*IntegerLiteral).Value)
+		}
+		if hashLiteral.Pairs[key].(*IntegerLiteral).Value != 2 {
+			t.Errorf("value is not %d, got=%d", 2, hashLiteral.Pairs[key].(*IntegerLiteral).Value)
+		}
+	}
+}
+
+func TestCopy(t *testing.T) {
+	key := &StringLiteral{Value: "k"}
+	original := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Name: &Identifier{Value: "f"},
+				Value: &FunctionLiteral{
+					Parameters: []*Identifier{{Value: "x"}},
+					Body: &BlockStatement{
+						Statements: []Statement{
+							&ExpressionStatement{Expression: &InfixExpression{
+								Left:     &Identifier{Token: token.Token{Literal: "x"}, Value: "x"},
+								Operator: "+",
+								Right:    &IntegerLiteral{Token: token.Token{Literal: "1"}, Value: 1},
+							}},
+						},
+					},
+				},
+			},
+			&ExpressionStatement{Expression: &HashLiteral{
+				Pairs: map[Expression]Expression{key: &IntegerLiteral{Token: token.Token{Literal: "1"}, Value: 1}},
+				Keys:  []Expression{key},
+			}},
+		},
+	}
+	before := original.String()
+
+	copied := Copy(original)
+	if copied.String() != before {
+		t.Fatalf("copy differs. got=%q, want=%q", copied, before)
+	}
+
+	Modify(copied, func(node Node) Node {
+		if integer, ok := node.(*IntegerLiteral); ok {
+			integer.Value = 42
+			integer.Token.Literal = "42"
+		}
+		return node
+	})
+	if original.String() != before {
+		t.Errorf("modifying the copy changed the original. got=%q", original)
+	}
+}
+
+// allNodesProgram 返回包含全部节点类型的程序：
+//
+//	import "lib.mk" as lib;
+//	let add = fn(a, b) { return a + b; };
+//	let m = macro(x) { x };
+//	-lib.items[0];
+//	if (true) { add(1, 2) } else { ["s"] };
+//	{"k": false}
+//	fn id(v) { v }
+//	match (xs) { [1, ...r] if r => { r }, {k: y} => { y } }
+func allNodesProgram() *Program {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+	}
+	integer := func(v int64) *IntegerLiteral {
+		return &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: fmt.Sprint(v)}, Value: v}
+	}
+	str := func(v string) *StringLiteral {
+		return &StringLiteral{Token: token.Token{Type: token.STRING, Literal: v}, Value: v}
+	}
+	block := func(statements ...Statement) *BlockStatement {
+		return &BlockStatement{Statements: statements}
+	}
+	key := str("k")
+
+	return &Program{Statements: []Statement{
+		&ImportStatement{Token: token.Token{Literal: "import"}, Path: str("lib.mk"), Alias: ident("lib")},
+		&LetStatement{Token: token.Token{Literal: "let"}, Name: ident("add"), Value: &FunctionLiteral{
+			Token:      token.Token{Literal: "fn"},
+			Parameters: []*Identifier{ident("a"), ident("b")},
+			Defaults:   []Expression{integer(1)},
+			Rest:       ident("rest"),
+			Body: block(&ReturnStatement{
+				Token:       token.Token{Literal: "return"},
+				ReturnValue: &InfixExpression{Left: ident("a"), Operator: "+", Right: ident("b")},
+			}),
+		}},
+		&LetStatement{Token: token.Token{Literal: "let"}, Name: ident("m"), Value: &MacroLiteral{
+			Token:      token.Token{Literal: "macro"},
+			Parameters: []*Identifier{ident("x")},
+			Body:       block(&ExpressionStatement{Expression: ident("x")}),
+		}},
+		&ExpressionStatement{Expression: &PrefixExpression{Operator: "-", Right: &IndexExpression{
+			Left:  &MemberExpression{Object: ident("lib"), Property: ident("items")},
+			Index: integer(0),
+		}}},
+		&ExpressionStatement{Expression: &IfExpression{
+			Condition: &Boolean{Token: token.Token{Literal: "true"}, Value: true},
+			Consequence: block(&ExpressionStatement{Expression: &CallExpression{
+				Function:  ident("add"),
+				Arguments: []Expression{integer(1), &SpreadExpression{Token: token.Token{Literal: "..."}, Value: ident("xs")}},
+			}}),
+			Alternative: block(&ExpressionStatement{Expression: &ArrayLiteral{Elements: []Expression{str("s")}}}),
+		}},
+		&ExpressionStatement{Expression: &HashLiteral{
+			Pairs: map[Expression]Expression{key: &Boolean{Token: token.Token{Literal: "false"}}},
+			Keys:  []Expression{key},
+		}},
+		&FunctionStatement{Token: token.Token{Literal: "fn"}, Name: ident("id"), Function: &FunctionLiteral{
+			Token:      token.Token{Literal: "fn"},
+			Parameters: []*Identifier{ident("v")},
+			Body:       block(&ExpressionStatement{Expression: ident("v")}),
+		}},
+		&ExpressionStatement{Expression: &MatchExpression{
+			Token:   token.Token{Literal: "match"},
+			Subject: ident("xs"),
+			Arms: []*MatchArm{
+				{
+					Token:   token.Token{Literal: "=>"},
+					Pattern: &ArrayPattern{Token: token.Token{Literal: "["}, Elements: []Pattern{integer(1)}, Rest: ident("r")},
+					Guard:   ident("r"),
+					Body:    block(&ExpressionStatement{Expression: ident("r")}),
+				},
+				{
+					Token:   token.Token{Literal: "=>"},
+					Pattern: &HashPattern{Token: token.Token{Literal: "{"}, Pairs: []*HashPatternPair{{Key: ident("k"), Value: ident("y")}}},
+					Body:    block(&ExpressionStatement{Expression: ident("y")}),
+				},
+			},
+		}},
+	}}
+}
+
+func TestInspect(t *testing.T) {
+	expected := []string{
+		"*ast.Program",
+		"*ast.ImportStatement", "*ast.StringLiteral", "*ast.Identifier",
+		"*ast.LetStatement", "*ast.Identifier", "*ast.FunctionLiteral", "*ast.Identifier", "*ast.Identifier",
+		"*ast.IntegerLiteral", "*ast.Identifier", "*ast.BlockStatement", "*ast.ReturnStatement", "*ast.InfixExpression", "*ast.Identifier", "*ast.Identifier",
+		"*ast.LetStatement", "*ast.Identifier", "*ast.MacroLiteral", "*ast.Identifier",
+		"*ast.BlockStatement", "*ast.ExpressionStatement", "*ast.Identifier",
+		"*ast.ExpressionStatement", "*ast.PrefixExpression", "*ast.IndexExpression",
+		"*ast.MemberExpression", "*ast.Identifier", "*ast.Identifier", "*ast.IntegerLiteral",
+		"*ast.ExpressionStatement", "*ast.IfExpression", "*ast.Boolean",
+		"*ast.BlockStatement", "*ast.ExpressionStatement", "*ast.CallExpression",
+		"*ast.Identifier", "*ast.IntegerLiteral", "*ast.SpreadExpression", "*ast.Identifier",
+		"*ast.BlockStatement", "*ast.ExpressionStatement", "*ast.ArrayLiteral", "*ast.StringLiteral",
+		"*ast.ExpressionStatement", "*ast.HashLiteral", "*ast.StringLiteral", "*ast.Boolean",
+		"*ast.FunctionStatement", "*ast.Identifier", "*ast.FunctionLiteral", "*ast.Identifier",
+		"*ast.BlockStatement", "*ast.ExpressionStatement", "*ast.Identifier",
+		"*ast.ExpressionStatement", "*ast.MatchExpression", "*ast.Identifier",
+		"*ast.MatchArm", "*ast.ArrayPattern", "*ast.IntegerLiteral", "*ast.Identifier", "*ast.Identifier",
+		"*ast.BlockStatement", "*ast.ExpressionStatement", "*ast.Identifier",
+		"*ast.MatchArm", "*ast.HashPattern", "*ast.Identifier", "*ast.Identifier",
+		"*ast.BlockStatement", "*ast.ExpressionStatement", "*ast.Identifier",
+	}
+
+	var visited []string
+	depth, maxDepth := 0, 0
+	Inspect(allNodesProgram(), func(node Node) bool {
+		if node == nil {
+			depth--
+			return false
+		}
+		visited = append(visited, fmt.Sprintf("%T", node))
+		depth++
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+		return true
+	})
+
+	if !reflect.DeepEqual(visited, expected) {
+		t.Errorf("wrong visit order.\ngot= %v\nwant=%v", visited, expected)
+	}
+	if depth != 0 {
+		t.Errorf("Visit(nil) calls do not balance, depth=%d", depth)
+	}
+	if maxDepth != 8 {
+		t.Errorf("wrong max depth. got=%d, want=%d", maxDepth, 8)
+	}
+
+	// 全部节点类型都应当被访问到
+	nodeTypes := []Node{
+		&Program{}, &ExpressionStatement{}, &BlockStatement{}, &ReturnStatement{}, &LetStatement{},
+		&ImportStatement{}, &Identifier{}, &IntegerLiteral{}, &StringLiteral{}, &Boolean{},
+		&PrefixExpression{}, &InfixExpression{}, &IndexExpression{}, &MemberExpression{}, &IfExpression{},
+		&FunctionLiteral{}, &MacroLiteral{}, &CallExpression{}, &SpreadExpression{}, &ArrayLiteral{},
+		&HashLiteral{}, &FunctionStatement{}, &MatchExpression{}, &MatchArm{}, &ArrayPattern{},
+		&HashPattern{},
+	}
+	seen := make(map[string]bool)
+	for _, name := range visited {
+		seen[name] = true
+	}
+	for _, node := range nodeTypes {
+		if !seen[fmt.Sprintf("%T", node)] {
+			t.Errorf("%T was not visited", node)
+		}
+
+		// 子节点为nil时直接跳过
+		Walk(inspector(func(Node) bool { return true }), node)
+		Rewrite(node, func(n Node) Node { return n })
+	}
+}
+
+func TestInspectSkipsChildren(t *testing.T) {
+	count := 0
+	Inspect(allNodesProgram(), func(node Node) bool {
+		if node == nil {
+			return false
+		}
+		count++
+		// 不进入函数和宏的内部
+		switch node.(type) {
+		case *FunctionLiteral, *MacroLiteral:
+			return false
+		}
+		return true
+	})
+
+	if count != 56 {
+		t.Errorf("wrong number of visited nodes. got=%d, want=%d", count, 56)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	program := allNodesProgram()
+
+	rewritten := Rewrite(program, func(node Node) Node {
+		switch node := node.(type) {
+		case *Identifier:
+			node.Value = node.Value + "_"
+			node.Token.Literal = node.Value
+		case *IntegerLiteral:
+			return &IntegerLiteral{Token: token.Token{Literal: fmt.Sprint(node.Value * 10)}, Value: node.Value * 10}
+		case *StringLiteral:
+			return &StringLiteral{Token: token.Token{Literal: node.Value + "!"}, Value: node.Value + "!"}
+		case *Boolean:
+			return &Boolean{Token: token.Token{Literal: fmt.Sprint(!node.Value)}, Value: !node.Value}
+		}
+		return node
+	})
+
+	if rewritten != Node(program) {
+		t.Fatalf("Rewrite did not return the program itself")
+	}
+
+	expected := `import "lib.mk!" as lib_;` +
+		`let add_ = fn(a_, b_ = 10, ...rest_) { return (a_ + b_); };` +
+		`let m_ = macro(x_) { x_ };` +
+		`(-(lib_.items_[0]));` +
+		`if (false) { add_(10, ...xs_) } else { ["s!"] };` +
+		`{"k!":true};` +
+		`fn id_(v_) { v_ }` +
+		`match (xs_) { [10, ...r_] if r_ => { r_ }, {k_: y_} => { y_ } }`
+	if program.String() != expected {
+		t.Errorf("wrong program.\ngot= %q\nwant=%q", program.String(), expected)
+	}
+
+	hash := program.Statements[5].(*ExpressionStatement).Expression.(*HashLiteral)
+	value, ok := hash.Pairs[hash.Keys[0]]
+	if !ok || value.String() != "true" {
+		t.Errorf("hash pairs not rebuilt with the rewritten key, got=%v", hash.Pairs)
+	}
+}
+
+func TestRewriteWrongType(t *testing.T) {
+	defer func() {
+		r := recover()
+		expected := "ast.Rewrite: cannot replace *ast.Identifier with *ast.IntegerLiteral in *ast.LetStatement"
+		if r != expected {
+			t.Errorf("wrong panic. want=%q, got=%v", expected, r)
+		}
+	}()
+
+	let := &LetStatement{Name: &Identifier{Value: "a"}, Value: &Identifier{Value: "b"}}
+	Rewrite(let, func(node Node) Node {
+		if _, ok := node.(*Identifier); ok {
+			return &IntegerLiteral{Value: 1}
+		}
+		return node
+	})
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	program := allNodesProgram()
+	n := len(program.Statements) // 追加的语句在decoded中的起始位置
+	program.Statements = append(program.Statements,
+		&LetStatement{Token: token.Token{Literal: "let"}, Exported: true, Name: &Identifier{Value: "e"}, Value: &IfExpression{
+			Condition:   &Boolean{Value: true},
+			Consequence: &BlockStatement{},
+		}},
+		&ReturnStatement{Token: token.Token{Literal: "return"}},
+		&FunctionStatement{
+			Token:    token.Token{Literal: "fn"},
+			Name:     &Identifier{Value: "f"},
+			Function: &FunctionLiteral{Token: token.Token{Literal: "fn"}, Body: &BlockStatement{}},
+			Exported: true,
+		},
+		&LetStatement{
+			Token:    token.Token{Literal: "const"},
+			Constant: true,
+			Pattern: &ArrayPattern{
+				Elements: []Pattern{
+					&Identifier{Value: "a"},
+					&HashPattern{Pairs: []*HashPatternPair{
+						{Key: &Identifier{Value: "b"}, Value: &Identifier{Value: "b"}},
+						{Key: &Identifier{Value: "c"}, Value: &ArrayPattern{Elements: []Pattern{}}},
+					}},
+				},
+				Rest: &Identifier{Value: "rest"},
+			},
+			Value: &Identifier{Value: "xs"},
+		},
+		&ExpressionStatement{Expression: &MatchExpression{
+			Token:   token.Token{Literal: "match"},
+			Subject: &Identifier{Value: "x"},
+			Arms: []*MatchArm{
+				{
+					Pattern: &ArrayPattern{Elements: []Pattern{&IntegerLiteral{Token: token.Token{Literal: "-1"}, Value: -1}, &Identifier{Value: "y"}}},
+					Guard:   &Identifier{Value: "y"},
+					Body:    &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: &Identifier{Value: "y"}}}},
+				},
+				{
+					Pattern: &HashPattern{Pairs: []*HashPatternPair{{Key: &Identifier{Value: "t"}, Value: &StringLiteral{Value: "a"}}}},
+					Body:    &BlockStatement{},
+				},
+				{Pattern: &Identifier{Value: "_"}, Body: &BlockStatement{}},
+			},
+		}},
+	)
+
+	data, err := Encode(program)
+	if err != nil {
+		t.Fatalf("Encode failed: %s", err)
+	}
+	decoded, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+
+	if decoded.String() != program.String() {
+		t.Errorf("round trip changed the program.\ngot= %q\nwant=%q", decoded, program)
+	}
+	again, err := Encode(decoded)
+	if err != nil {
+		t.Fatalf("Encode failed: %s", err)
+	}
+	if string(again) != string(data) {
+		t.Errorf("round trip is not lossless.\ngot= %s\nwant=%s", again, data)
+	}
+
+	let := decoded.(*Program).Statements[n].(*LetStatement)
+	if !let.Exported || let.Value.(*IfExpression).Alternative != nil {
+		t.Errorf("exported flag or nil alternative not preserved: %#v", let)
+	}
+	fn := decoded.(*Program).Statements[n+2].(*FunctionStatement)
+	if !fn.Exported || fn.String() != "export fn f() {  }" {
+		t.Errorf("function statement not preserved: %q", fn)
+	}
+	pattern := decoded.(*Program).Statements[n+3].(*LetStatement)
+	if pattern.Name != nil || !pattern.Constant || pattern.String() != "const [a, {b, c: []}, ...rest] = xs;" {
+		t.Errorf("destructuring let statement not preserved: %q", pattern)
+	}
+	match := decoded.(*Program).Statements[n+4].(*ExpressionStatement).Expression.(*MatchExpression)
+	if match.Arms[1].Guard != nil || match.String() != `match (x) { [-1, y] if y => { y }, {t: "a"} => {  }, _ => {  } }` {
+		t.Errorf("match expression not preserved: %q", match)
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	node := &InfixExpression{
+		Token:    token.Token{Type: token.PLUS, Literal: "+", SourceFile: "a.mk", LineNo: 2, Column: 3},
+		Operator: "+",
+		Left:     &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1", LineNo: 2, Column: 1}, Value: 1},
+		Right:    &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x", LineNo: 2, Column: 5}, Value: "x"},
+	}
+
+	expected := `{"kind":"InfixExpression","token":{"type":"+","literal":"+"},` +
+		`"position":{"file":"a.mk","line":2,"column":3},"operator":"+","children":{` +
+		`"left":{"kind":"IntegerLiteral","token":{"type":"INT","literal":"1"},"position":{"line":2,"column":1},"value":1},` +
+		`"right":{"kind":"Identifier","token":{"type":"IDENT","literal":"x"},"position":{"line":2,"column":5},"value":"x"}}}`
+
+	data, err := Encode(node)
+	if err != nil {
+		t.Fatalf("Encode failed: %s", err)
+	}
+	if string(data) != expected {
+		t.Errorf("wrong JSON.\ngot= %s\nwant=%s", data, expected)
+	}
+}
+
+func TestJSONDecodeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"kind":"Nope"}`, `Nope: unknown node kind "Nope"`},
+		{`{"kind":"Identifier"}`, `Identifier: missing value`},
+		{`{"kind":"IntegerLiteral","value":"1"}`,
+			`IntegerLiteral: invalid value: json: cannot unmarshal string into Go value of type int64`},
+		{`{"kind":"Program","children":{"statements":[{"kind":"Boolean","value":true}]}}`,
+			`Program.statements[0]: expected statement, got *ast.Boolean`},
+		{`{"kind":"LetStatement","children":{"name":{"kind":"StringLiteral","value":"a"}}}`,
+			`LetStatement.name: expected Identifier, got *ast.StringLiteral`},
+		{`{"kind":"HashLiteral","children":{"pairs":[{"key":{"kind":"Boolean","value":true},"value":{"kind":"Nope"}}]}}`,
+			`HashLiteral.pairs[0].value: unknown node kind "Nope"`},
+		{`[]`, `: json: cannot unmarshal array into Go value of type ast.jsonNode`},
+	}
+
+	for _, tt := range tests {
+		_, err := Decode([]byte(tt.input))
+		if err == nil {
+			t.Errorf("expected error for %s", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error for %s.\ngot= %q\nwant=%q", tt.input, err, tt.expected)
+		}
+	}
+}
@@ -21,8 +21,17 @@ func (bs *BlockStatement) TokenLiteral() string {
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
-	for _, s := range bs.Statements {
+	writeStatements(&out, bs.Statements)
+	return out.String()
+}
+
+// writeStatements 依次输出语句，表达式语句之后若还有语句则补充分号，保证输出可以被重新解析
+func writeStatements(out *bytes.Buffer, statements []Statement) {
+	for i, s := range statements {
 		out.WriteString(s.String())
+
+		if _, ok := s.(*ExpressionStatement); ok && i < len(statements)-1 {
+			out.WriteString(";")
+		}
 	}
-	return out.String()
 }
@@ -0,0 +1,209 @@
+package ast
+
+// Copy 返回node的深拷贝，Modify会原地修改节点，需要保留原节点时先拷贝
+func Copy(node Node) Node {
+	switch node := node.(type) {
+	case *Program:
+		c := *node
+		c.Statements = copyStatements(node.Statements)
+		return &c
+	case *ExpressionStatement:
+		c := *node
+		c.Expression = copyExpression(node.Expression)
+		return &c
+	case *BlockStatement:
+		return copyBlock(node)
+	case *ReturnStatement:
+		c := *node
+		c.ReturnValue = copyExpression(node.ReturnValue)
+		return &c
+	case *LetStatement:
+		c := *node
+		c.Name = copyIdentifier(node.Name)
+		c.Pattern = copyPattern(node.Pattern)
+		c.Value = copyExpression(node.Value)
+		return &c
+	case *FunctionStatement:
+		c := *node
+		c.Name = copyIdentifier(node.Name)
+		if node.Function != nil {
+			c.Function = Copy(node.Function).(*FunctionLiteral)
+		}
+		return &c
+	case *ImportStatement:
+		c := *node
+		if node.Path != nil {
+			path := *node.Path
+			c.Path = &path
+		}
+		c.Alias = copyIdentifier(node.Alias)
+		return &c
+	case *Identifier:
+		return copyIdentifier(node)
+	case *MatchExpression:
+		c := *node
+		c.Subject = copyExpression(node.Subject)
+		c.Arms = make([]*MatchArm, len(node.Arms))
+		for i, arm := range node.Arms {
+			c.Arms[i] = Copy(arm).(*MatchArm)
+		}
+		return &c
+	case *MatchArm:
+		c := *node
+		c.Pattern = copyPattern(node.Pattern)
+		c.Guard = copyExpression(node.Guard)
+		c.Body = copyBlock(node.Body)
+		return &c
+	case *ArrayPattern:
+		c := *node
+		c.Elements = make([]Pattern, len(node.Elements))
+		for i, el := range node.Elements {
+			c.Elements[i] = copyPattern(el)
+		}
+		c.Rest = copyIdentifier(node.Rest)
+		return &c
+	case *HashPattern:
+		c := *node
+		c.Pairs = make([]*HashPatternPair, len(node.Pairs))
+		for i, pair := range node.Pairs {
+			c.Pairs[i] = &HashPatternPair{Key: copyIdentifier(pair.Key), Value: copyPattern(pair.Value)}
+		}
+		return &c
+	case *IntegerLiteral:
+		c := *node
+		return &c
+	case *StringLiteral:
+		c := *node
+		return &c
+	case *Boolean:
+		c := *node
+		return &c
+	case *PrefixExpression:
+		c := *node
+		c.Right = copyExpression(node.Right)
+		return &c
+	case *InfixExpression:
+		c := *node
+		c.Left = copyExpression(node.Left)
+		c.Right = copyExpression(node.Right)
+		return &c
+	case *IndexExpression:
+		c := *node
+		c.Left = copyExpression(node.Left)
+		c.Index = copyExpression(node.Index)
+		return &c
+	case *MemberExpression:
+		c := *node
+		c.Object = copyExpression(node.Object)
+		c.Property = copyIdentifier(node.Property)
+		return &c
+	case *IfExpression:
+		c := *node
+		c.Condition = copyExpression(node.Condition)
+		c.Consequence = copyBlock(node.Consequence)
+		c.Alternative = copyBlock(node.Alternative)
+		return &c
+	case *FunctionLiteral:
+		c := *node
+		c.Parameters = copyIdentifiers(node.Parameters)
+		c.Defaults = copyExpressions(node.Defaults)
+		c.Rest = copyIdentifier(node.Rest)
+		c.Body = copyBlock(node.Body)
+		return &c
+	case *MacroLiteral:
+		c := *node
+		c.Parameters = copyIdentifiers(node.Parameters)
+		c.Body = copyBlock(node.Body)
+		return &c
+	case *CallExpression:
+		c := *node
+		c.Function = copyExpression(node.Function)
+		c.Arguments = copyExpressions(node.Arguments)
+		return &c
+	case *SpreadExpression:
+		c := *node
+		c.Value = copyExpression(node.Value)
+		return &c
+	case *ArrayLiteral:
+		c := *node
+		c.Elements = copyExpressions(node.Elements)
+		return &c
+	case *HashLiteral:
+		c := *node
+		c.Pairs = make(map[Expression]Expression, len(node.Pairs))
+		c.Keys = make([]Expression, 0, len(node.Keys))
+		for _, key := range node.Keys {
+			newKey := copyExpression(key)
+			c.Pairs[newKey] = copyExpression(node.Pairs[key])
+			c.Keys = append(c.Keys, newKey)
+		}
+		return &c
+	}
+	return node
+}
+
+func copyExpression(exp Expression) Expression {
+	if exp == nil {
+		return nil
+	}
+	c, _ := Copy(exp).(Expression)
+	return c
+}
+
+func copyExpressions(exps []Expression) []Expression {
+	if exps == nil {
+		return nil
+	}
+	c := make([]Expression, len(exps))
+	for i, exp := range exps {
+		c[i] = copyExpression(exp)
+	}
+	return c
+}
+
+func copyPattern(pattern Pattern) Pattern {
+	if pattern == nil {
+		return nil
+	}
+	c, _ := Copy(pattern).(Pattern)
+	return c
+}
+
+func copyStatements(statements []Statement) []Statement {
+	if statements == nil {
+		return nil
+	}
+	c := make([]Statement, len(statements))
+	for i, statement := range statements {
+		c[i], _ = Copy(statement).(Statement)
+	}
+	return c
+}
+
+func copyBlock(block *BlockStatement) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	c := *block
+	c.Statements = copyStatements(block.Statements)
+	return &c
+}
+
+func copyIdentifier(ident *Identifier) *Identifier {
+	if ident == nil {
+		return nil
+	}
+	c := *ident
+	return &c
+}
+
+func copyIdentifiers(idents []*Identifier) []*Identifier {
+	if idents == nil {
+		return nil
+	}
+	c := make([]*Identifier, len(idents))
+	for i, ident := range idents {
+		c[i] = copyIdentifier(ident)
+	}
+	return c
+}
@@ -9,26 +9,80 @@ import (
 type FunctionLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
+	Defaults   []Expression // 默认值，依次对应最后len(Defaults)个参数
+	Rest       *Identifier  // ...rest参数，以数组接收多余的实参，可以为nil
 	Body       *BlockStatement
 }
 
+// NumRequired 返回没有默认值的参数个数
+func (fl *FunctionLiteral) NumRequired() int {
+	return len(fl.Parameters) - len(fl.Defaults)
+}
+
+// Default 返回第i个参数的默认值，没有默认值时返回nil
+func (fl *FunctionLiteral) Default(i int) Expression {
+	if i < fl.NumRequired() {
+		return nil
+	}
+	return fl.Defaults[i-fl.NumRequired()]
+}
+
 func (fl *FunctionLiteral) expressionNode() {}
 func (fl *FunctionLiteral) TokenLiteral() string {
 	return fl.Token.Literal
 }
 func (fl *FunctionLiteral) String() string {
+	return fl.format("")
+}
+
+// format 输出函数的源码形式，name不为空时输出为具名函数
+func (fl *FunctionLiteral) format(name string) string {
 	var out bytes.Buffer
 
 	params := []string{}
-	for _, p := range fl.Parameters {
-		params = append(params, p.String())
+	for i, p := range fl.Parameters {
+		if d := fl.Default(i); d != nil {
+			params = append(params, p.String()+" = "+d.String())
+		} else {
+			params = append(params, p.String())
+		}
+	}
+	if fl.Rest != nil {
+		params = append(params, "..."+fl.Rest.String())
 	}
 
 	out.WriteString(fl.TokenLiteral())
+	if name != "" {
+		out.WriteString(" " + name)
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
-	out.WriteString(") ")
+	out.WriteString(") { ")
 	out.WriteString(fl.Body.String())
+	out.WriteString(" }")
 
 	return out.String()
 }
+
+// FunctionStatement 具名函数声明，例如fn add(a, b) { a + b }。
+// 名称在所在作用域中提前可见，函数体可以递归调用自身或之后声明的其他函数
+type FunctionStatement struct {
+	Token    token.Token
+	Name     *Identifier
+	Function *FunctionLiteral
+	Exported bool // 是否由export导出，仅允许出现在模块顶层
+}
+
+func (fs *FunctionStatement) statementNode() {}
+func (fs *FunctionStatement) TokenLiteral() string {
+	return fs.Token.Literal
+}
+func (fs *FunctionStatement) String() string {
+	s := fs.Function.format(fs.Name.String())
+	if fs.Exported {
+		s = "export " + s
+	}
+	return s
+}
+
+var _ Statement = &FunctionStatement{}
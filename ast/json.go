@@ -0,0 +1,528 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/nicolerobin/monkey/token"
+)
+
+// jsonNode 节点的JSON表示，各类节点共用同一结构：
+//
+//	{"kind": "InfixExpression", "token": {...}, "position": {...}, "operator": "+",
+//	 "children": {"left": {...}, "right": {...}}}
+//
+// kind为节点的类型名；value保存标识符和字面量的值；children按字段名保存子节点，
+// 列表字段为数组，HashLiteral和HashPattern的pairs为按源码顺序排列的{"key", "value"}数组，值为nil的子节点省略
+type jsonNode struct {
+	Kind     string                     `json:"kind"`
+	Token    *jsonToken                 `json:"token,omitempty"`
+	Position *jsonPosition              `json:"position,omitempty"`
+	Value    json.RawMessage            `json:"value,omitempty"`
+	Operator string                     `json:"operator,omitempty"`
+	Exported bool                       `json:"exported,omitempty"`
+	Constant bool                       `json:"constant,omitempty"`
+	Children map[string]json.RawMessage `json:"children,omitempty"`
+}
+
+type jsonToken struct {
+	Type    token.TokenType `json:"type"`
+	Literal string          `json:"literal"`
+}
+
+type jsonPosition struct {
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+type jsonPair struct {
+	Key   json.RawMessage `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Encode 将节点及其全部子节点编码为JSON，Decode可以无损地还原
+func Encode(node Node) ([]byte, error) {
+	e := &encoder{}
+	data := e.node(node)
+	if e.err != nil {
+		return nil, e.err
+	}
+	return data, nil
+}
+
+type encoder struct {
+	err error // 遇到的第一个错误
+}
+
+func (e *encoder) node(node Node) json.RawMessage {
+	n := &jsonNode{Children: map[string]json.RawMessage{}}
+
+	switch node := node.(type) {
+	case *Program:
+		n.Kind = "Program"
+		encodeList(e, n, "statements", node.Statements)
+	case *ExpressionStatement:
+		n.Kind = "ExpressionStatement"
+		e.setToken(n, node.Token)
+		encodeChild(e, n, "expression", node.Expression)
+	case *BlockStatement:
+		n.Kind = "BlockStatement"
+		e.setToken(n, node.Token)
+		encodeList(e, n, "statements", node.Statements)
+	case *ReturnStatement:
+		n.Kind = "ReturnStatement"
+		e.setToken(n, node.Token)
+		encodeChild(e, n, "returnValue", node.ReturnValue)
+	case *LetStatement:
+		n.Kind = "LetStatement"
+		e.setToken(n, node.Token)
+		n.Exported = node.Exported
+		n.Constant = node.Constant
+		encodeChild(e, n, "name", node.Name)
+		encodeChild(e, n, "pattern", node.Pattern)
+		encodeChild(e, n, "value", node.Value)
+	case *FunctionStatement:
+		n.Kind = "FunctionStatement"
+		e.setToken(n, node.Token)
+		n.Exported = node.Exported
+		encodeChild(e, n, "name", node.Name)
+		encodeChild(e, n, "function", node.Function)
+	case *ImportStatement:
+		n.Kind = "ImportStatement"
+		e.setToken(n, node.Token)
+		encodeChild(e, n, "path", node.Path)
+		encodeChild(e, n, "alias", node.Alias)
+	case *Identifier:
+		n.Kind = "Identifier"
+		e.setToken(n, node.Token)
+		e.setValue(n, node.Value)
+	case *IntegerLiteral:
+		n.Kind = "IntegerLiteral"
+		e.setToken(n, node.Token)
+		e.setValue(n, node.Value)
+	case *StringLiteral:
+		n.Kind = "StringLiteral"
+		e.setToken(n, node.Token)
+		e.setValue(n, node.Value)
+	case *Boolean:
+		n.Kind = "Boolean"
+		e.setToken(n, node.Token)
+		e.setValue(n, node.Value)
+	case *PrefixExpression:
+		n.Kind = "PrefixExpression"
+		e.setToken(n, node.Token)
+		n.Operator = node.Operator
+		encodeChild(e, n, "right", node.Right)
+	case *InfixExpression:
+		n.Kind = "InfixExpression"
+		e.setToken(n, node.Token)
+		n.Operator = node.Operator
+		encodeChild(e, n, "left", node.Left)
+		encodeChild(e, n, "right", node.Right)
+	case *IndexExpression:
+		n.Kind = "IndexExpression"
+		e.setToken(n, node.Token)
+		encodeChild(e, n, "left", node.Left)
+		encodeChild(e, n, "index", node.Index)
+	case *MemberExpression:
+		n.Kind = "MemberExpression"
+		e.setToken(n, node.Token)
+		encodeChild(e, n, "object", node.Object)
+		encodeChild(e, n, "property", node.Property)
+	case *IfExpression:
+		n.Kind = "IfExpression"
+		e.setToken(n, node.Token)
+		encodeChild(e, n, "condition", node.Condition)
+		encodeChild(e, n, "consequence", node.Consequence)
+		encodeChild(e, n, "alternative", node.Alternative)
+	case *FunctionLiteral:
+		n.Kind = "FunctionLiteral"
+		e.setToken(n, node.Token)
+		encodeList(e, n, "parameters", node.Parameters)
+		encodeList(e, n, "defaults", node.Defaults)
+		encodeChild(e, n, "rest", node.Rest)
+		encodeChild(e, n, "body", node.Body)
+	case *MacroLiteral:
+		n.Kind = "MacroLiteral"
+		e.setToken(n, node.Token)
+		encodeList(e, n, "parameters", node.Parameters)
+		encodeChild(e, n, "body", node.Body)
+	case *CallExpression:
+		n.Kind = "CallExpression"
+		e.setToken(n, node.Token)
+		encodeChild(e, n, "function", node.Function)
+		encodeList(e, n, "arguments", node.Arguments)
+	case *SpreadExpression:
+		n.Kind = "SpreadExpression"
+		e.setToken(n, node.Token)
+		encodeChild(e, n, "value", node.Value)
+	case *ArrayLiteral:
+		n.Kind = "ArrayLiteral"
+		e.setToken(n, node.Token)
+		encodeList(e, n, "elements", node.Elements)
+	case *HashLiteral:
+		n.Kind = "HashLiteral"
+		e.setToken(n, node.Token)
+		pairs := make([]jsonPair, 0, len(node.Keys))
+		for _, key := range node.Keys {
+			pairs = append(pairs, jsonPair{Key: e.node(key), Value: e.node(node.Pairs[key])})
+		}
+		e.set(n, "pairs", pairs)
+	case *MatchExpression:
+		n.Kind = "MatchExpression"
+		e.setToken(n, node.Token)
+		encodeChild(e, n, "subject", node.Subject)
+		encodeList(e, n, "arms", node.Arms)
+	case *MatchArm:
+		n.Kind = "MatchArm"
+		e.setToken(n, node.Token)
+		encodeChild(e, n, "pattern", node.Pattern)
+		encodeChild(e, n, "guard", node.Guard)
+		encodeChild(e, n, "body", node.Body)
+	case *ArrayPattern:
+		n.Kind = "ArrayPattern"
+		e.setToken(n, node.Token)
+		encodeList(e, n, "elements", node.Elements)
+		encodeChild(e, n, "rest", node.Rest)
+	case *HashPattern:
+		n.Kind = "HashPattern"
+		e.setToken(n, node.Token)
+		pairs := make([]jsonPair, 0, len(node.Pairs))
+		for _, pair := range node.Pairs {
+			pairs = append(pairs, jsonPair{Key: e.node(pair.Key), Value: e.node(pair.Value)})
+		}
+		e.set(n, "pairs", pairs)
+	default:
+		e.fail(fmt.Errorf("cannot encode node of type %T", node))
+		return json.RawMessage("null")
+	}
+
+	if len(n.Children) == 0 {
+		n.Children = nil
+	}
+	return e.marshal(n)
+}
+
+// setToken 设置节点的词法单元和位置。JSON字符串只能保存合法的UTF-8，含有非法字节的源码无法无损编码
+func (e *encoder) setToken(n *jsonNode, tok token.Token) {
+	if !utf8.ValidString(tok.Literal) {
+		e.fail(fmt.Errorf("%s at %d:%d is not valid UTF-8", n.Kind, tok.LineNo, tok.Column))
+	}
+	n.Token = &jsonToken{Type: tok.Type, Literal: tok.Literal}
+	n.Position = &jsonPosition{File: tok.SourceFile, Line: tok.LineNo, Column: tok.Column}
+}
+
+func (e *encoder) setValue(n *jsonNode, value interface{}) {
+	n.Value = e.marshal(value)
+}
+
+// encodeChild 编码单个子节点，值为nil时省略
+func encodeChild[T Node](e *encoder, n *jsonNode, name string, child T) {
+	if !isNil(child) {
+		n.Children[name] = e.node(child)
+	}
+}
+
+// encodeList 编码子节点列表，nil列表省略，空列表编码为[]
+func encodeList[T Node](e *encoder, n *jsonNode, name string, children []T) {
+	if children == nil {
+		return
+	}
+	items := make([]json.RawMessage, len(children))
+	for i, child := range children {
+		items[i] = e.node(child)
+	}
+	e.set(n, name, items)
+}
+
+func (e *encoder) set(n *jsonNode, name string, value interface{}) {
+	n.Children[name] = e.marshal(value)
+}
+
+func (e *encoder) marshal(value interface{}) json.RawMessage {
+	data, err := json.Marshal(value)
+	if err != nil {
+		e.fail(err)
+		return json.RawMessage("null")
+	}
+	return data
+}
+
+func (e *encoder) fail(err error) {
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+// Decode 将Encode生成的JSON还原为节点
+func Decode(data []byte) (Node, error) {
+	d := &decoder{}
+	node := d.node("", data)
+	if d.err != nil {
+		return nil, d.err
+	}
+	return node, nil
+}
+
+type decoder struct {
+	err error // 遇到的第一个错误
+}
+
+// node 解码一个节点，path为节点在树中的位置，用于错误信息
+func (d *decoder) node(path string, data json.RawMessage) Node {
+	var n jsonNode
+	if err := json.Unmarshal(data, &n); err != nil {
+		d.fail(path, "%s", err)
+		return nil
+	}
+	if path == "" {
+		path = n.Kind
+	}
+
+	tok := token.Token{}
+	if n.Token != nil {
+		tok.Type = n.Token.Type
+		tok.Literal = n.Token.Literal
+	}
+	if n.Position != nil {
+		tok.SourceFile = n.Position.File
+		tok.LineNo = n.Position.Line
+		tok.Column = n.Position.Column
+	}
+	c := children{d: d, path: path, raw: n.Children}
+
+	switch n.Kind {
+	case "Program":
+		return &Program{Statements: c.statements("statements")}
+	case "ExpressionStatement":
+		return &ExpressionStatement{Token: tok, Expression: c.expression("expression")}
+	case "BlockStatement":
+		return &BlockStatement{Token: tok, Statements: c.statements("statements")}
+	case "ReturnStatement":
+		return &ReturnStatement{Token: tok, ReturnValue: c.expression("returnValue")}
+	case "LetStatement":
+		return &LetStatement{
+			Token:    tok,
+			Name:     c.identifier("name"),
+			Pattern:  c.pattern("pattern"),
+			Value:    c.expression("value"),
+			Exported: n.Exported,
+			Constant: n.Constant,
+		}
+	case "FunctionStatement":
+		return &FunctionStatement{
+			Token:    tok,
+			Name:     c.identifier("name"),
+			Function: decodeAs[*FunctionLiteral](c, "function", c.node("function"), "FunctionLiteral"),
+			Exported: n.Exported,
+		}
+	case "ImportStatement":
+		path := decodeAs[*StringLiteral](c, "path", c.node("path"), "StringLiteral")
+		return &ImportStatement{Token: tok, Path: path, Alias: c.identifier("alias")}
+	case "Identifier":
+		ident := &Identifier{Token: tok}
+		d.value(path, n.Value, &ident.Value)
+		return ident
+	case "IntegerLiteral":
+		integer := &IntegerLiteral{Token: tok}
+		d.value(path, n.Value, &integer.Value)
+		return integer
+	case "StringLiteral":
+		str := &StringLiteral{Token: tok}
+		d.value(path, n.Value, &str.Value)
+		return str
+	case "Boolean":
+		boolean := &Boolean{Token: tok}
+		d.value(path, n.Value, &boolean.Value)
+		return boolean
+	case "PrefixExpression":
+		return &PrefixExpression{Token: tok, Operator: n.Operator, Right: c.expression("right")}
+	case "InfixExpression":
+		return &InfixExpression{Token: tok, Operator: n.Operator, Left: c.expression("left"), Right: c.expression("right")}
+	case "IndexExpression":
+		return &IndexExpression{Token: tok, Left: c.expression("left"), Index: c.expression("index")}
+	case "MemberExpression":
+		return &MemberExpression{Token: tok, Object: c.expression("object"), Property: c.identifier("property")}
+	case "IfExpression":
+		return &IfExpression{
+			Token:       tok,
+			Condition:   c.expression("condition"),
+			Consequence: c.block("consequence"),
+			Alternative: c.block("alternative"),
+		}
+	case "FunctionLiteral":
+		return &FunctionLiteral{
+			Token:      tok,
+			Parameters: c.identifiers("parameters"),
+			Defaults:   c.expressions("defaults"),
+			Rest:       c.identifier("rest"),
+			Body:       c.block("body"),
+		}
+	case "MacroLiteral":
+		return &MacroLiteral{Token: tok, Parameters: c.identifiers("parameters"), Body: c.block("body")}
+	case "CallExpression":
+		return &CallExpression{Token: tok, Function: c.expression("function"), Arguments: c.expressions("arguments")}
+	case "SpreadExpression":
+		return &SpreadExpression{Token: tok, Value: c.expression("value")}
+	case "ArrayLiteral":
+		return &ArrayLiteral{Token: tok, Elements: c.expressions("elements")}
+	case "HashLiteral":
+		return c.hash(tok)
+	case "MatchExpression":
+		return &MatchExpression{Token: tok, Subject: c.expression("subject"), Arms: decodeList[*MatchArm](c, "arms", "MatchArm")}
+	case "MatchArm":
+		return &MatchArm{Token: tok, Pattern: c.pattern("pattern"), Guard: c.expression("guard"), Body: c.block("body")}
+	case "ArrayPattern":
+		return &ArrayPattern{Token: tok, Elements: decodeList[Pattern](c, "elements", "pattern"), Rest: c.identifier("rest")}
+	case "HashPattern":
+		return c.hashPattern(tok)
+	default:
+		d.fail(path, "unknown node kind %q", n.Kind)
+		return nil
+	}
+}
+
+// value 解码标识符和字面量的值
+func (d *decoder) value(path string, data json.RawMessage, v interface{}) {
+	if len(data) == 0 {
+		d.fail(path, "missing value")
+		return
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		d.fail(path, "invalid value: %s", err)
+	}
+}
+
+func (d *decoder) fail(path string, format string, args ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...))
+	}
+}
+
+// children 按字段名解码子节点并检查其类型
+type children struct {
+	d    *decoder
+	path string
+	raw  map[string]json.RawMessage
+}
+
+func (c children) node(name string) Node {
+	data, ok := c.raw[name]
+	if !ok {
+		return nil
+	}
+	return c.d.node(c.path+"."+name, data)
+}
+
+func (c children) list(name string) ([]json.RawMessage, bool) {
+	data, ok := c.raw[name]
+	if !ok {
+		return nil, false
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		c.d.fail(c.path+"."+name, "%s", err)
+		return nil, false
+	}
+	return items, true
+}
+
+func (c children) expression(name string) Expression {
+	return decodeAs[Expression](c, name, c.node(name), "expression")
+}
+
+func (c children) identifier(name string) *Identifier {
+	return decodeAs[*Identifier](c, name, c.node(name), "Identifier")
+}
+
+func (c children) pattern(name string) Pattern {
+	return decodeAs[Pattern](c, name, c.node(name), "pattern")
+}
+
+func (c children) block(name string) *BlockStatement {
+	return decodeAs[*BlockStatement](c, name, c.node(name), "BlockStatement")
+}
+
+func (c children) statements(name string) []Statement {
+	return decodeList[Statement](c, name, "statement")
+}
+
+func (c children) expressions(name string) []Expression {
+	return decodeList[Expression](c, name, "expression")
+}
+
+func (c children) identifiers(name string) []*Identifier {
+	return decodeList[*Identifier](c, name, "Identifier")
+}
+
+func (c children) hash(tok token.Token) *HashLiteral {
+	hash := &HashLiteral{Token: tok, Pairs: map[Expression]Expression{}, Keys: []Expression{}}
+
+	data, ok := c.raw["pairs"]
+	if !ok {
+		return hash
+	}
+	var pairs []jsonPair
+	if err := json.Unmarshal(data, &pairs); err != nil {
+		c.d.fail(c.path+".pairs", "%s", err)
+		return hash
+	}
+	for i, pair := range pairs {
+		path := fmt.Sprintf("%s.pairs[%d]", c.path, i)
+		key := decodeAs[Expression](c, fmt.Sprintf("pairs[%d].key", i), c.d.node(path+".key", pair.Key), "expression")
+		value := decodeAs[Expression](c, fmt.Sprintf("pairs[%d].value", i), c.d.node(path+".value", pair.Value), "expression")
+		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
+	}
+	return hash
+}
+
+func (c children) hashPattern(tok token.Token) *HashPattern {
+	pattern := &HashPattern{Token: tok, Pairs: []*HashPatternPair{}}
+
+	data, ok := c.raw["pairs"]
+	if !ok {
+		return pattern
+	}
+	var pairs []jsonPair
+	if err := json.Unmarshal(data, &pairs); err != nil {
+		c.d.fail(c.path+".pairs", "%s", err)
+		return pattern
+	}
+	for i, pair := range pairs {
+		path := fmt.Sprintf("%s.pairs[%d]", c.path, i)
+		key := decodeAs[*Identifier](c, fmt.Sprintf("pairs[%d].key", i), c.d.node(path+".key", pair.Key), "Identifier")
+		value := decodeAs[Pattern](c, fmt.Sprintf("pairs[%d].value", i), c.d.node(path+".value", pair.Value), "pattern")
+		pattern.Pairs = append(pattern.Pairs, &HashPatternPair{Key: key, Value: value})
+	}
+	return pattern
+}
+
+// decodeAs 检查解码出的子节点能否放入对应的字段
+func decodeAs[T Node](c children, name string, node Node, want string) T {
+	var zero T
+	if node == nil {
+		return zero
+	}
+	t, ok := node.(T)
+	if !ok {
+		c.d.fail(c.path+"."+name, "expected %s, got %T", want, node)
+		return zero
+	}
+	return t
+}
+
+func decodeList[T Node](c children, name string, want string) []T {
+	items, ok := c.list(name)
+	if !ok {
+		return nil
+	}
+	nodes := make([]T, len(items))
+	for i, item := range items {
+		itemName := fmt.Sprintf("%s[%d]", name, i)
+		nodes[i] = decodeAs[T](c, itemName, c.d.node(c.path+"."+itemName, item), want)
+	}
+	return nodes
+}
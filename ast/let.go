@@ -6,11 +6,14 @@ import (
 	"github.com/nicolerobin/monkey/token"
 )
 
-// LetStatement let statement
+// LetStatement let statement，Token为const时定义常量
 type LetStatement struct {
-	Token token.Token
-	Name  *Identifier
-	Value Expression
+	Token    token.Token
+	Name     *Identifier
+	Pattern  Pattern // 解构模式，非nil时Name为nil
+	Value    Expression
+	Exported bool // 是否由export导出，仅允许出现在模块顶层
+	Constant bool // 是否为const声明，常量不能在同一作用域中重新定义
 }
 
 func (ls *LetStatement) statementNode() {
@@ -20,8 +23,19 @@ func (ls *LetStatement) statementNode() {
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
-	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String())
+	if ls.Exported {
+		out.WriteString("export ")
+	}
+	if ls.Constant {
+		out.WriteString("const ")
+	} else {
+		out.WriteString(ls.TokenLiteral() + " ")
+	}
+	if ls.Pattern != nil {
+		out.WriteString(ls.Pattern.String())
+	} else {
+		out.WriteString(ls.Name.String())
+	}
 	out.WriteString(" = ")
 
 	if ls.Value != nil {
@@ -0,0 +1,36 @@
+package ast
+
+import (
+	"bytes"
+	"github.com/nicolerobin/monkey/token"
+	"strings"
+)
+
+// MacroLiteral 宏字面量，形如macro(a, b) { ... }，只能出现在顶层的let语句中
+type MacroLiteral struct {
+	Token      token.Token
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (ml *MacroLiteral) expressionNode() {}
+func (ml *MacroLiteral) TokenLiteral() string {
+	return ml.Token.Literal
+}
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range ml.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString(ml.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") { ")
+	out.WriteString(ml.Body.String())
+	out.WriteString(" }")
+
+	return out.String()
+}
@@ -0,0 +1,85 @@
+package ast
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/nicolerobin/monkey/token"
+)
+
+// MatchExpression match表达式：match (value) { pattern if guard => body, ... }，
+// 依次尝试各个分支，结果为第一个匹配的分支的值，没有分支匹配时为null
+type MatchExpression struct {
+	Token   token.Token // match词法单元
+	Subject Expression
+	Arms    []*MatchArm
+}
+
+func (me *MatchExpression) expressionNode() {}
+
+func (me *MatchExpression) TokenLiteral() string {
+	return me.Token.Literal
+}
+
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+
+	arms := []string{}
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+
+	out.WriteString("match (")
+	out.WriteString(me.Subject.String())
+	out.WriteString(") { ")
+	out.WriteString(strings.Join(arms, ", "))
+	out.WriteString(" }")
+	return out.String()
+}
+
+// Exhaustive 判断是否总有分支匹配：存在没有守卫且模式为变量或_的分支，
+// 或者true和false都有没有守卫的分支
+func (me *MatchExpression) Exhaustive() bool {
+	booleans := map[bool]bool{}
+	for _, arm := range me.Arms {
+		if arm.Guard != nil {
+			continue
+		}
+		switch pattern := arm.Pattern.(type) {
+		case *Identifier:
+			return true
+		case *Boolean:
+			booleans[pattern.Value] = true
+		}
+	}
+	return booleans[true] && booleans[false]
+}
+
+// MatchArm match表达式的一个分支，Body为单个表达式时保存为只有一条表达式语句的代码块
+type MatchArm struct {
+	Token   token.Token // =>词法单元
+	Pattern Pattern
+	Guard   Expression // if之后的守卫条件，可以为nil
+	Body    *BlockStatement
+}
+
+func (ma *MatchArm) TokenLiteral() string {
+	return ma.Token.Literal
+}
+
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ma.Pattern.String())
+	if ma.Guard != nil {
+		out.WriteString(" if ")
+		out.WriteString(ma.Guard.String())
+	}
+	out.WriteString(" => { ")
+	out.WriteString(ma.Body.String())
+	out.WriteString(" }")
+	return out.String()
+}
+
+var _ Expression = &MatchExpression{}
+var _ Node = &MatchArm{}
@@ -0,0 +1,30 @@
+package ast
+
+import (
+	"bytes"
+
+	"github.com/nicolerobin/monkey/token"
+)
+
+// MemberExpression member access expression, e.g. util.name
+type MemberExpression struct {
+	Token    token.Token
+	Object   Expression
+	Property *Identifier
+}
+
+func (me *MemberExpression) expressionNode() {}
+
+func (me *MemberExpression) TokenLiteral() string {
+	return me.Token.Literal
+}
+
+func (me *MemberExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(me.Object.String())
+	out.WriteString(".")
+	out.WriteString(me.Property.String())
+
+	return out.String()
+}
@@ -0,0 +1,9 @@
+package ast
+
+// ModifierFunc 修改函数，接收一个节点并返回用于替换它的节点
+type ModifierFunc func(Node) Node
+
+// Modify 深度优先遍历node的全部子节点，先修改子节点，再将node本身交给modifier并返回其结果，等价于Rewrite
+func Modify(node Node, modifier ModifierFunc) Node {
+	return Rewrite(node, modifier)
+}
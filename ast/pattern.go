@@ -0,0 +1,127 @@
+package ast
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/nicolerobin/monkey/token"
+)
+
+// Pattern 解构模式，用于let语句的左侧和match表达式的分支。标识符是最简单的模式，直接绑定整个值，
+// 名为_的标识符匹配任意值但不绑定；整数、字符串和布尔字面量只能用于match，匹配与之相等的值
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+func (i *Identifier) patternNode()      {}
+func (il *IntegerLiteral) patternNode() {}
+func (sl *StringLiteral) patternNode()  {}
+func (b *Boolean) patternNode()         {}
+
+// Wildcard 判断模式是否为匹配任意值而不绑定的_
+func Wildcard(pattern Pattern) bool {
+	ident, ok := pattern.(*Identifier)
+	return ok && ident.Value == "_"
+}
+
+// ArrayPattern 数组解构模式：[a, b, ...rest]
+type ArrayPattern struct {
+	Token    token.Token // [词法单元
+	Elements []Pattern
+	Rest     *Identifier // ...rest绑定剩余的元素，可以为nil
+}
+
+func (ap *ArrayPattern) patternNode() {}
+
+func (ap *ArrayPattern) TokenLiteral() string {
+	return ap.Token.Literal
+}
+
+func (ap *ArrayPattern) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range ap.Elements {
+		elements = append(elements, el.String())
+	}
+	if ap.Rest != nil {
+		elements = append(elements, "..."+ap.Rest.String())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+	return out.String()
+}
+
+// HashPatternPair 哈希表解构模式中的一项，以Key的名称为键取值并按Value解构
+type HashPatternPair struct {
+	Key   *Identifier
+	Value Pattern
+}
+
+// String 值直接绑定到同名变量时使用简写形式
+func (pair *HashPatternPair) String() string {
+	if ident, ok := pair.Value.(*Identifier); ok && ident.Value == pair.Key.Value {
+		return pair.Key.String()
+	}
+	return pair.Key.String() + ": " + pair.Value.String()
+}
+
+// HashPattern 哈希表解构模式：{name, age: years}
+type HashPattern struct {
+	Token token.Token // {词法单元
+	Pairs []*HashPatternPair
+}
+
+func (hp *HashPattern) patternNode() {}
+
+func (hp *HashPattern) TokenLiteral() string {
+	return hp.Token.Literal
+}
+
+func (hp *HashPattern) String() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range hp.Pairs {
+		pairs = append(pairs, pair.String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+// PatternNames 按出现顺序返回模式中绑定的全部变量，不包括_
+func PatternNames(pattern Pattern) []*Identifier {
+	switch pattern := pattern.(type) {
+	case *Identifier:
+		if Wildcard(pattern) {
+			return []*Identifier{}
+		}
+		return []*Identifier{pattern}
+	case *ArrayPattern:
+		names := []*Identifier{}
+		for _, el := range pattern.Elements {
+			names = append(names, PatternNames(el)...)
+		}
+		if pattern.Rest != nil {
+			names = append(names, PatternNames(pattern.Rest)...)
+		}
+		return names
+	case *HashPattern:
+		names := []*Identifier{}
+		for _, pair := range pattern.Pairs {
+			names = append(names, PatternNames(pair.Value)...)
+		}
+		return names
+	default:
+		return []*Identifier{}
+	}
+}
+
+var _ Pattern = &ArrayPattern{}
+var _ Pattern = &HashPattern{}
@@ -10,9 +10,7 @@ type Program struct {
 func (p *Program) String() string {
 	var out bytes.Buffer
 
-	for _, s := range p.Statements {
-		out.WriteString(s.String())
-	}
+	writeStatements(&out, p.Statements)
 	return out.String()
 }
 
@@ -0,0 +1,111 @@
+package ast
+
+import "fmt"
+
+// Rewrite 深度优先遍历node的全部子节点，先重写子节点，再将node本身交给rewrite并返回其结果。
+// 子节点原地替换为rewrite的返回值，值为nil的子节点被跳过；返回值不能放入原字段时panic，
+// 例如将LetStatement.Name替换为非Identifier的节点
+func Rewrite(node Node, rewrite func(Node) Node) Node {
+	switch n := node.(type) {
+	case *Program:
+		rewriteList(n, n.Statements, rewrite)
+	case *ExpressionStatement:
+		n.Expression = rewriteChild(n, n.Expression, rewrite)
+	case *BlockStatement:
+		rewriteList(n, n.Statements, rewrite)
+	case *ReturnStatement:
+		n.ReturnValue = rewriteChild(n, n.ReturnValue, rewrite)
+	case *LetStatement:
+		n.Name = rewriteChild(n, n.Name, rewrite)
+		n.Pattern = rewriteChild(n, n.Pattern, rewrite)
+		n.Value = rewriteChild(n, n.Value, rewrite)
+	case *FunctionStatement:
+		n.Name = rewriteChild(n, n.Name, rewrite)
+		n.Function = rewriteChild(n, n.Function, rewrite)
+	case *ImportStatement:
+		n.Path = rewriteChild(n, n.Path, rewrite)
+		n.Alias = rewriteChild(n, n.Alias, rewrite)
+	case *MatchExpression:
+		n.Subject = rewriteChild(n, n.Subject, rewrite)
+		rewriteList(n, n.Arms, rewrite)
+	case *MatchArm:
+		n.Pattern = rewriteChild(n, n.Pattern, rewrite)
+		n.Guard = rewriteChild(n, n.Guard, rewrite)
+		n.Body = rewriteChild(n, n.Body, rewrite)
+	case *ArrayPattern:
+		rewriteList(n, n.Elements, rewrite)
+		n.Rest = rewriteChild(n, n.Rest, rewrite)
+	case *HashPattern:
+		for _, pair := range n.Pairs {
+			pair.Key = rewriteChild(n, pair.Key, rewrite)
+			pair.Value = rewriteChild(n, pair.Value, rewrite)
+		}
+	case *PrefixExpression:
+		n.Right = rewriteChild(n, n.Right, rewrite)
+	case *InfixExpression:
+		n.Left = rewriteChild(n, n.Left, rewrite)
+		n.Right = rewriteChild(n, n.Right, rewrite)
+	case *IndexExpression:
+		n.Left = rewriteChild(n, n.Left, rewrite)
+		n.Index = rewriteChild(n, n.Index, rewrite)
+	case *MemberExpression:
+		n.Object = rewriteChild(n, n.Object, rewrite)
+		n.Property = rewriteChild(n, n.Property, rewrite)
+	case *IfExpression:
+		n.Condition = rewriteChild(n, n.Condition, rewrite)
+		n.Consequence = rewriteChild(n, n.Consequence, rewrite)
+		n.Alternative = rewriteChild(n, n.Alternative, rewrite)
+	case *FunctionLiteral:
+		rewriteList(n, n.Parameters, rewrite)
+		rewriteList(n, n.Defaults, rewrite)
+		n.Rest = rewriteChild(n, n.Rest, rewrite)
+		n.Body = rewriteChild(n, n.Body, rewrite)
+	case *MacroLiteral:
+		rewriteList(n, n.Parameters, rewrite)
+		n.Body = rewriteChild(n, n.Body, rewrite)
+	case *CallExpression:
+		n.Function = rewriteChild(n, n.Function, rewrite)
+		rewriteList(n, n.Arguments, rewrite)
+	case *SpreadExpression:
+		n.Value = rewriteChild(n, n.Value, rewrite)
+	case *ArrayLiteral:
+		rewriteList(n, n.Elements, rewrite)
+	case *HashLiteral:
+		// 键被替换后在map中的位置也会变化，因此重建Pairs
+		pairs := make(map[Expression]Expression, len(n.Pairs))
+		keys := make([]Expression, 0, len(n.Keys))
+		for _, key := range n.Keys {
+			newKey := rewriteChild(n, key, rewrite)
+			pairs[newKey] = rewriteChild(n, n.Pairs[key], rewrite)
+			keys = append(keys, newKey)
+		}
+		n.Pairs = pairs
+		n.Keys = keys
+	}
+
+	return rewrite(node)
+}
+
+// rewriteChild 重写parent的一个子节点并检查结果能否放回原字段
+func rewriteChild[T Node](parent Node, child T, rewrite func(Node) Node) T {
+	if isNil(child) {
+		return child
+	}
+
+	result := Rewrite(child, rewrite)
+	if result == nil {
+		var zero T
+		return zero
+	}
+	replaced, ok := result.(T)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: cannot replace %T with %T in %T", child, result, parent))
+	}
+	return replaced
+}
+
+func rewriteList[T Node](parent Node, children []T, rewrite func(Node) Node) {
+	for i, child := range children {
+		children[i] = rewriteChild(parent, child, rewrite)
+	}
+}
@@ -0,0 +1,19 @@
+package ast
+
+import "github.com/nicolerobin/monkey/token"
+
+// SpreadExpression 调用实参中的...expr，将数组展开为多个实参
+type SpreadExpression struct {
+	Token token.Token // ...词法单元
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode() {}
+
+func (se *SpreadExpression) TokenLiteral() string {
+	return se.Token.Literal
+}
+
+func (se *SpreadExpression) String() string {
+	return "..." + se.Value.String()
+}
@@ -14,5 +14,5 @@ func (sl *StringLiteral) TokenLiteral() string {
 }
 
 func (sl *StringLiteral) String() string {
-	return sl.Token.Literal
+	return "\"" + sl.Value + "\""
 }
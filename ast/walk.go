@@ -0,0 +1,125 @@
+package ast
+
+// Visitor Walk遍历到每个节点时调用Visit，返回的Visitor用于遍历该节点的子节点，返回nil时跳过子节点。
+// 子节点遍历完成后会以nil再调用一次返回的Visitor的Visit
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk 以深度优先的顺序遍历node及其全部子节点，子节点按照在源码中出现的顺序访问，值为nil的子节点被跳过
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		walkList(v, n.Statements)
+	case *ExpressionStatement:
+		walk(v, n.Expression)
+	case *BlockStatement:
+		walkList(v, n.Statements)
+	case *ReturnStatement:
+		walk(v, n.ReturnValue)
+	case *LetStatement:
+		walk(v, n.Name)
+		walk(v, n.Pattern)
+		walk(v, n.Value)
+	case *FunctionStatement:
+		walk(v, n.Name)
+		walk(v, n.Function)
+	case *ImportStatement:
+		walk(v, n.Path)
+		walk(v, n.Alias)
+	case *Identifier, *IntegerLiteral, *StringLiteral, *Boolean:
+		// 叶子节点
+	case *MatchExpression:
+		walk(v, n.Subject)
+		walkList(v, n.Arms)
+	case *MatchArm:
+		walk(v, n.Pattern)
+		walk(v, n.Guard)
+		walk(v, n.Body)
+	case *ArrayPattern:
+		walkList(v, n.Elements)
+		walk(v, n.Rest)
+	case *HashPattern:
+		for _, pair := range n.Pairs {
+			walk(v, pair.Key)
+			walk(v, pair.Value)
+		}
+	case *PrefixExpression:
+		walk(v, n.Right)
+	case *InfixExpression:
+		walk(v, n.Left)
+		walk(v, n.Right)
+	case *IndexExpression:
+		walk(v, n.Left)
+		walk(v, n.Index)
+	case *MemberExpression:
+		walk(v, n.Object)
+		walk(v, n.Property)
+	case *IfExpression:
+		walk(v, n.Condition)
+		walk(v, n.Consequence)
+		walk(v, n.Alternative)
+	case *FunctionLiteral:
+		for i, param := range n.Parameters {
+			walk(v, param)
+			walk(v, n.Default(i))
+		}
+		walk(v, n.Rest)
+		walk(v, n.Body)
+	case *MacroLiteral:
+		walkList(v, n.Parameters)
+		walk(v, n.Body)
+	case *CallExpression:
+		walk(v, n.Function)
+		walkList(v, n.Arguments)
+	case *SpreadExpression:
+		walk(v, n.Value)
+	case *ArrayLiteral:
+		walkList(v, n.Elements)
+	case *HashLiteral:
+		for _, key := range n.Keys {
+			walk(v, key)
+			walk(v, n.Pairs[key])
+		}
+	}
+
+	v.Visit(nil)
+}
+
+// walk 遍历可能为nil的子节点
+func walk[T Node](v Visitor, child T) {
+	if !isNil(child) {
+		Walk(v, child)
+	}
+}
+
+func walkList[T Node](v Visitor, children []T) {
+	for _, child := range children {
+		walk(v, child)
+	}
+}
+
+// isNil 判断子节点是否为nil，同时适用于接口类型(Expression)和指针类型(*BlockStatement)的字段
+func isNil[T Node](node T) bool {
+	var zero T
+	return any(node) == nil || any(node) == any(zero)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect 以深度优先的顺序遍历node，对每个节点调用f，f返回false时不再遍历该节点的子节点。
+// 与Walk相同，子节点遍历完成后会调用f(nil)
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
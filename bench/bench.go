@@ -0,0 +1,203 @@
+package bench
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nicolerobin/monkey/ast"
+	"github.com/nicolerobin/monkey/compiler"
+	"github.com/nicolerobin/monkey/evaluator"
+	"github.com/nicolerobin/monkey/lexer"
+	"github.com/nicolerobin/monkey/module"
+	"github.com/nicolerobin/monkey/object"
+	"github.com/nicolerobin/monkey/token"
+	"github.com/nicolerobin/monkey/vm"
+)
+
+// 各阶段的名称
+const (
+	PhaseLex     = "lex"
+	PhaseParse   = "parse"
+	PhaseCompile = "compile"
+	PhaseExecute = "execute"
+)
+
+// 执行阶段使用的引擎
+const (
+	EngineEval = "eval"
+	EngineVM   = "vm"
+)
+
+// Phase 某个阶段平均每次执行的耗时和内存分配
+type Phase struct {
+	Name        string `json:"name"`
+	Engine      string `json:"engine,omitempty"`
+	NsPerOp     int64  `json:"ns_per_op"`
+	AllocsPerOp uint64 `json:"allocs_per_op"`
+	BytesPerOp  uint64 `json:"bytes_per_op"`
+}
+
+// Report 一个程序的基准测试结果，JSON格式保持稳定，便于跟踪性能回归
+type Report struct {
+	File       string  `json:"file"`
+	Iterations int     `json:"iterations"`
+	Phases     []Phase `json:"phases"`
+}
+
+// Run 读取并解析文件，依次测量词法分析、语法分析、编译以及两个引擎的执行，每个阶段重复iterations次
+func Run(file string, iterations int) (*Report, error) {
+	if iterations < 1 {
+		return nil, fmt.Errorf("iterations must be positive, got %d", iterations)
+	}
+
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	input := string(src)
+
+	// 脚本的输出被丢弃，不混入基准测试的结果
+	ctx := &object.Context{Stdout: io.Discard, Stderr: io.Discard}
+
+	// 宏只展开一次，不计入各阶段的耗时
+	macroEnv := object.NewEnvironment()
+	macroEnv.SetContext(ctx)
+	program, err := parse(input, evaluator.MacroExpander(macroEnv))
+	if err != nil {
+		return nil, err
+	}
+
+	// 导入的模块相对于被测文件所在目录查找
+	dir := filepath.Dir(file)
+
+	compile := func() (*compiler.Bytecode, error) {
+		comp := compiler.NewCompiler()
+		comp.SetLoader(evaluator.NewLoader(dir))
+		if err := comp.Compile(program); err != nil {
+			return nil, fmt.Errorf("compilation failed: %s", err)
+		}
+		return comp.Bytecode(), nil
+	}
+	bytecode, err := compile()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{File: file, Iterations: iterations}
+	steps := []struct {
+		name   string
+		engine string
+		fn     func() error
+	}{
+		{PhaseLex, "", func() error {
+			l := lexer.NewLexer(input)
+			for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+			}
+			return nil
+		}},
+		{PhaseParse, "", func() error {
+			_, err := parse(input, nil)
+			return err
+		}},
+		{PhaseCompile, EngineVM, func() error {
+			_, err := compile()
+			return err
+		}},
+		{PhaseExecute, EngineEval, func() error {
+			env := object.NewEnvironment()
+			env.SetContext(ctx)
+			env.SetLoader(evaluator.NewLoader(dir))
+			result := evaluator.Eval(program, env)
+			if errObj, ok := result.(*object.Error); ok {
+				return fmt.Errorf("evaluation failed: %s", errObj.Message)
+			}
+			return nil
+		}},
+		{PhaseExecute, EngineVM, func() error {
+			machine := vm.NewVm(bytecode)
+			machine.SetContext(ctx)
+			if err := machine.Run(); err != nil {
+				return fmt.Errorf("executing bytecode failed: %s", err)
+			}
+			return nil
+		}},
+	}
+
+	for _, step := range steps {
+		phase, err := measure(step.name, step.engine, iterations, step.fn)
+		if err != nil {
+			return nil, err
+		}
+		report.Phases = append(report.Phases, phase)
+	}
+	return report, nil
+}
+
+// parse 解析源代码，expand不为nil时展开宏
+func parse(input string, expand module.Expander) (*ast.Program, error) {
+	program, err := module.Parse(input, expand)
+	if syntaxErr, ok := err.(*module.SyntaxError); ok {
+		return nil, fmt.Errorf("parse failed: %s", syntaxErr.Errors[0])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("macro expansion failed: %s", err)
+	}
+	return program, nil
+}
+
+// measure 重复执行fn，返回平均每次的耗时和内存分配
+func measure(name, engine string, iterations int, fn func() error) (Phase, error) {
+	var before, after runtime.MemStats
+
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	for i := 0; i < iterations; i++ {
+		if err := fn(); err != nil {
+			return Phase{}, err
+		}
+	}
+
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	n := uint64(iterations)
+	return Phase{
+		Name:        name,
+		Engine:      engine,
+		NsPerOp:     elapsed.Nanoseconds() / int64(iterations),
+		AllocsPerOp: (after.Mallocs - before.Mallocs) / n,
+		BytesPerOp:  (after.TotalAlloc - before.TotalAlloc) / n,
+	}, nil
+}
+
+// WriteText 以表格形式输出结果
+func (r *Report) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "%s (%d iterations)\n", r.File, r.Iterations)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "phase\tengine\ttime/op\tallocs/op\tbytes/op\t")
+	for _, phase := range r.Phases {
+		engine := phase.Engine
+		if engine == "" {
+			engine = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t\n", phase.Name, engine,
+			time.Duration(phase.NsPerOp), phase.AllocsPerOp, phase.BytesPerOp)
+	}
+	return tw.Flush()
+}
+
+// WriteJSON 以JSON格式输出结果
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
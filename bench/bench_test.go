@@ -0,0 +1,129 @@
+package bench
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nicolerobin/monkey/internal/benchcorpus"
+)
+
+func TestRun(t *testing.T) {
+	report, err := Run(filepath.Join(benchcorpus.Dir(), "fibonacci.mk"), 2)
+	if err != nil {
+		t.Fatalf("Run() failed, error: %s", err)
+	}
+
+	expected := []struct {
+		name   string
+		engine string
+	}{
+		{PhaseLex, ""},
+		{PhaseParse, ""},
+		{PhaseCompile, EngineVM},
+		{PhaseExecute, EngineEval},
+		{PhaseExecute, EngineVM},
+	}
+	if len(report.Phases) != len(expected) {
+		t.Fatalf("wrong number of phases. want=%d, got=%d", len(expected), len(report.Phases))
+	}
+	for i, tt := range expected {
+		phase := report.Phases[i]
+		if phase.Name != tt.name || phase.Engine != tt.engine {
+			t.Errorf("phases[%d] wrong. want=%s/%s, got=%s/%s", i, tt.name, tt.engine, phase.Name, phase.Engine)
+		}
+		if phase.NsPerOp <= 0 {
+			t.Errorf("phases[%d] has no duration", i)
+		}
+	}
+	if report.Phases[3].AllocsPerOp <= report.Phases[4].AllocsPerOp {
+		t.Errorf("evaluator should allocate more than the vm on fibonacci. eval=%d, vm=%d",
+			report.Phases[3].AllocsPerOp, report.Phases[4].AllocsPerOp)
+	}
+
+	var out bytes.Buffer
+	if err := report.WriteJSON(&out); err != nil {
+		t.Fatalf("WriteJSON() failed, error: %s", err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid JSON output, error: %s", err)
+	}
+	if decoded.Iterations != 2 || len(decoded.Phases) != len(expected) || decoded.Phases[4].Engine != EngineVM {
+		t.Errorf("JSON does not round-trip. got=%s", out.String())
+	}
+	for _, field := range []string{`"ns_per_op"`, `"allocs_per_op"`, `"bytes_per_op"`} {
+		if !strings.Contains(out.String(), field) {
+			t.Errorf("JSON output missing %s", field)
+		}
+	}
+
+	out.Reset()
+	if err := report.WriteText(&out); err != nil {
+		t.Fatalf("WriteText() failed, error: %s", err)
+	}
+	if !strings.Contains(out.String(), "allocs/op") || strings.Count(out.String(), "\n") != 7 {
+		t.Errorf("unexpected text output:\n%s", out.String())
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let = 1;", "parse failed"},
+		{"undefined_name;", "compilation failed"},
+		{"len(1);", "evaluation failed: argument to `len` not supported, got INTEGER"},
+	}
+
+	for i, tt := range tests {
+		file := filepath.Join(dir, string(rune('a'+i))+".mk")
+		if err := os.WriteFile(file, []byte(tt.input), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := Run(file, 1)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("Run(%q) error = %v, want %q", tt.input, err, tt.expected)
+		}
+	}
+
+	if _, err := Run(filepath.Join(dir, "missing.mk"), 1); err == nil {
+		t.Errorf("expected error for missing file")
+	}
+	if _, err := Run(filepath.Join(benchcorpus.Dir(), "loop.mk"), 0); err == nil {
+		t.Errorf("expected error for zero iterations")
+	}
+}
+
+func TestRunDiscardsScriptOutput(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "puts.mk")
+	source := "let say = macro() { puts(\"macro\"); quote(1) };\nputs(\"script\", say());\n"
+	if err := os.WriteFile(file, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	_, err = Run(file, 1)
+	os.Stdout = stdout
+	w.Close()
+	if err != nil {
+		t.Fatalf("Run() failed, error: %s", err)
+	}
+
+	written, _ := io.ReadAll(r)
+	if len(written) != 0 {
+		t.Errorf("script output leaked to stdout: %q", written)
+	}
+}
@@ -21,9 +21,23 @@ func (ins Instructions) String() string {
 			if err != nil {
 				log.Error("fmt.Fprintf() failed, error:%s", err)
 			}
+			i++
 			continue
 		}
 
+		if Opcode(ins[i]) == OpWide && i+1 < len(ins) {
+			wideDef, err := Lookup(ins[i+1])
+			if err == nil {
+				operands, read := ReadWideOperands(wideDef, ins[i+2:])
+				_, err = fmt.Fprintf(&out, "%04d %s %s\n", i, def.Name, ins.fmtInstruction(wideDef, operands))
+				if err != nil {
+					log.Error("fmt.Fprintf() failed, error:%s", err)
+				}
+				i += 2 + read
+				continue
+			}
+		}
+
 		operands, read := ReadOperands(def, ins[i+1:])
 		_, err = fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
 		if err != nil {
@@ -48,42 +62,126 @@ func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
 		return def.Name
 	case 1:
 		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
 	}
 
 	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
 }
 
-// Make 编码，返回指定操作码和操作数对应的字节码序列
-func Make(op Opcode, operands ...int) []byte {
-	def, ok := definitions[op]
-	if !ok {
-		return []byte{}
+// Make 编码，返回指定操作码和操作数对应的字节码序列，操作数超出定义的宽度时返回错误
+func Make(op Opcode, operands ...int) ([]byte, error) {
+	def, err := lookupOperands(op, operands)
+	if err != nil {
+		return nil, err
 	}
 
 	// 计算指令长度
 	instructionLen := 1
-	for _, w := range def.OperandWidths {
+	for i, w := range def.OperandWidths {
+		if operands[i] < 0 || operands[i] > maxOperand(w) {
+			return nil, fmt.Errorf("operand %d of %s out of range: %d does not fit in %d byte(s)",
+				i, def.Name, operands[i], w)
+		}
 		instructionLen += w
 	}
 
 	instruction := make([]byte, instructionLen)
 	instruction[0] = byte(op)
+	putOperands(instruction[1:], def.OperandWidths, operands)
+	return instruction, nil
+}
 
-	offset := 1
+// MakeWide 编码带OpWide前缀的指令，每个操作数都占WideOperandWidth个字节
+func MakeWide(op Opcode, operands ...int) ([]byte, error) {
+	def, err := lookupOperands(op, operands)
+	if err != nil {
+		return nil, err
+	}
+	if len(def.OperandWidths) == 0 {
+		return nil, fmt.Errorf("%s has no operands to widen", def.Name)
+	}
+
+	widths := make([]int, len(operands))
 	for i, o := range operands {
-		width := def.OperandWidths[i]
-		switch width {
+		if o < 0 || o > maxOperand(WideOperandWidth) {
+			return nil, fmt.Errorf("operand %d of %s out of range: %d does not fit in %d byte(s)",
+				i, def.Name, o, WideOperandWidth)
+		}
+		widths[i] = WideOperandWidth
+	}
+
+	instruction := make([]byte, 2+WideOperandWidth*len(operands))
+	instruction[0] = byte(OpWide)
+	instruction[1] = byte(op)
+	putOperands(instruction[2:], widths, operands)
+	return instruction, nil
+}
+
+// Encode 编码指令，操作数超出定义的宽度时改用OpWide前缀的形式
+func Encode(op Opcode, operands ...int) ([]byte, error) {
+	if Fits(op, operands...) {
+		return Make(op, operands...)
+	}
+	return MakeWide(op, operands...)
+}
+
+// MustMake 与Make相同，编码失败时panic，用于操作数已知合法的场景
+func MustMake(op Opcode, operands ...int) []byte {
+	instruction, err := Make(op, operands...)
+	if err != nil {
+		panic(err)
+	}
+	return instruction
+}
+
+// Fits 判断操作数是否都能以不带前缀的形式编码
+func Fits(op Opcode, operands ...int) bool {
+	def, ok := definitions[op]
+	if !ok || len(operands) != len(def.OperandWidths) {
+		return false
+	}
+	for i, w := range def.OperandWidths {
+		if operands[i] < 0 || operands[i] > maxOperand(w) {
+			return false
+		}
+	}
+	return true
+}
+
+func lookupOperands(op Opcode, operands []int) (*Definition, error) {
+	def, err := Lookup(byte(op))
+	if err != nil {
+		return nil, err
+	}
+	if len(operands) != len(def.OperandWidths) {
+		return nil, fmt.Errorf("%s expects %d operand(s), got %d",
+			def.Name, len(def.OperandWidths), len(operands))
+	}
+	return def, nil
+}
+
+// maxOperand 返回width个字节能表示的最大操作数
+func maxOperand(width int) int {
+	return 1<<(8*width) - 1
+}
+
+func putOperands(dst []byte, widths []int, operands []int) {
+	offset := 0
+	for i, o := range operands {
+		switch widths[i] {
 		case 1:
-			instruction[offset] = uint8(o)
+			dst[offset] = uint8(o)
 		case 2:
-			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+			binary.BigEndian.PutUint16(dst[offset:], uint16(o))
+		case 4:
+			binary.BigEndian.PutUint32(dst[offset:], uint32(o))
 		}
-		offset += width
+		offset += widths[i]
 	}
-	return instruction
 }
 
-// ReadOperands 解码，返回
+// ReadOperands 解码，返回操作数和读取的字节数
 func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 	operands := make([]int, len(def.OperandWidths))
 	offset := 0
@@ -101,6 +199,15 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 	return operands, offset
 }
 
+// ReadWideOperands 解码OpWide前缀之后的指令的操作数，返回操作数和读取的字节数
+func ReadWideOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	for i := range operands {
+		operands[i] = int(ReadUint32(ins[i*WideOperandWidth:]))
+	}
+	return operands, len(operands) * WideOperandWidth
+}
+
 // ReadUint8 读取单字节
 func ReadUint8(ins Instructions) uint8 {
 	return uint8(ins[0])
@@ -110,3 +217,8 @@ func ReadUint8(ins Instructions) uint8 {
 func ReadUint16(ins Instructions) uint16 {
 	return binary.BigEndian.Uint16(ins)
 }
+
+// ReadUint32 以大端序的方式读取四个字节数据
+func ReadUint32(ins Instructions) uint32 {
+	return binary.BigEndian.Uint32(ins)
+}
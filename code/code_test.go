@@ -13,10 +13,15 @@ func TestMake(t *testing.T) {
 		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
 		{OpAdd, []int{}, []byte{byte(OpAdd)}},
 		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+		{OpGetLocal2, []int{}, []byte{byte(OpGetLocal2)}},
+		{OpJumpIfFalseCompare, []int{int(OpGreaterThan), 258}, []byte{byte(OpJumpIfFalseCompare), byte(OpGreaterThan), 1, 2}},
 	}
 
 	for _, tt := range tests {
-		instruction := Make(tt.op, tt.operands...)
+		instruction, err := Make(tt.op, tt.operands...)
+		if err != nil {
+			t.Fatalf("Make returned error: %s", err)
+		}
 
 		if len(instruction) != len(tt.expected) {
 			t.Errorf("instruction has wrong length. want=%d, got=%d",
@@ -34,14 +39,26 @@ func TestMake(t *testing.T) {
 
 func TestInstructionsString(t *testing.T) {
 	instructions := []Instructions{
-		Make(OpAdd),
-		Make(OpConstant, 2),
-		Make(OpConstant, 65535),
+		MustMake(OpAdd),
+		MustMake(OpConstant, 2),
+		MustMake(OpConstant, 65535),
+		MustMake(OpGetLocal0),
+		MustMake(OpAddConst, 1),
+		MustMake(OpJumpIfFalseCompare, int(OpEqual), 7),
+		MustMake(OpCall3),
+		wide(t, OpConstant, 65536),
+		wide(t, OpJumpIfFalseCompare, int(OpEqual), 70000),
 	}
 
 	expected := `0000 OpAdd
 0001 OpConstant 2
 0004 OpConstant 65535
+0007 OpGetLocal0
+0008 OpAddConst 1
+0011 OpJumpIfFalseCompare 8 7
+0015 OpCall3
+0016 OpWide OpConstant 65536
+0022 OpWide OpJumpIfFalseCompare 8 70000
 `
 
 	concatted := Instructions{}
@@ -64,10 +81,11 @@ func TestReadOperands(t *testing.T) {
 	}{
 		{OpConstant, []int{65535}, 2},
 		{OpGetLocal, []int{255}, 1},
+		{OpJumpIfFalseCompare, []int{int(OpNotEqual), 65535}, 3},
 	}
 
 	for _, tt := range tests {
-		instruction := Make(tt.op, tt.operands...)
+		instruction := MustMake(tt.op, tt.operands...)
 
 		def, err := Lookup(byte(tt.op))
 		if err != nil {
@@ -87,3 +105,82 @@ func TestReadOperands(t *testing.T) {
 		}
 	}
 }
+
+func TestMakeErrors(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected string
+	}{
+		{OpConstant, []int{65536}, "operand 0 of OpConstant out of range: 65536 does not fit in 2 byte(s)"},
+		{OpGetLocal, []int{256}, "operand 0 of OpGetLocal out of range: 256 does not fit in 1 byte(s)"},
+		{OpCall, []int{-1}, "operand 0 of OpCall out of range: -1 does not fit in 1 byte(s)"},
+		{OpConstant, []int{}, "OpConstant expects 1 operand(s), got 0"},
+		{Opcode(255), []int{}, "opcode 255 undefined"},
+	}
+
+	for _, tt := range tests {
+		_, err := Make(tt.op, tt.operands...)
+		if err == nil {
+			t.Errorf("expected error for %d %v", tt.op, tt.operands)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err)
+		}
+	}
+
+	_, err := MakeWide(OpAdd)
+	if err == nil || err.Error() != "OpAdd has no operands to widen" {
+		t.Errorf("wrong error for widening OpAdd: %v", err)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+		{OpGetLocal, []int{256}, []byte{byte(OpWide), byte(OpGetLocal), 0, 0, 1, 0}},
+		{OpConstant, []int{65536}, []byte{byte(OpWide), byte(OpConstant), 0, 1, 0, 0}},
+		{OpJumpIfFalseCompare, []int{int(OpEqual), 65536},
+			[]byte{byte(OpWide), byte(OpJumpIfFalseCompare), 0, 0, 0, byte(OpEqual), 0, 1, 0, 0}},
+	}
+
+	for _, tt := range tests {
+		instruction, err := Encode(tt.op, tt.operands...)
+		if err != nil {
+			t.Fatalf("Encode returned error: %s", err)
+		}
+
+		if string(instruction) != string(tt.expected) {
+			t.Errorf("wrong encoding for %d %v. want=%v, got=%v",
+				tt.op, tt.operands, tt.expected, instruction)
+		}
+
+		if tt.expected[0] != byte(OpWide) {
+			continue
+		}
+		def, _ := Lookup(byte(tt.op))
+		operands, n := ReadWideOperands(def, instruction[2:])
+		if n != len(instruction)-2 {
+			t.Errorf("n wrong, want=%d, got=%d", len(instruction)-2, n)
+		}
+		for i, want := range tt.operands {
+			if operands[i] != want {
+				t.Errorf("operand wrong. want=%d, got=%d", want, operands[i])
+			}
+		}
+	}
+}
+
+func wide(t *testing.T, op Opcode, operands ...int) []byte {
+	t.Helper()
+	instruction, err := MakeWide(op, operands...)
+	if err != nil {
+		t.Fatalf("MakeWide returned error: %s", err)
+	}
+	return instruction
+}
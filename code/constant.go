@@ -32,8 +32,41 @@ const (
 	OpReturn
 	OpSetLocal
 	OpGetLocal
+	OpModule     // 构建模块对象指令，操作数为栈上模块名之后的导出名称与值的个数
+	OpGetBuiltin // 获取内置函数指令，操作数为内置函数在object.Builtins中的下标
+	OpCallSpread // 展开调用指令，操作数为栈上函数之后的实参数组个数，这些数组依次拼接作为实参
+
+	OpClosure        // 创建闭包指令，操作数为已编译函数的常量下标和栈上自由变量的个数
+	OpGetFree        // 获取当前闭包的自由变量指令，操作数为自由变量的下标
+	OpCurrentClosure // 获取当前执行的函数指令，用于局部函数递归调用自身
+	OpSetFree        // 回填闭包的自由变量指令，弹出值和闭包，操作数为自由变量的下标
+
+	OpDup              // 复制栈顶元素指令，解构时保留被解构的值
+	OpDestructureArray // 检查栈顶的值能否按数组模式解构，操作数为模式的元素个数和是否带有rest元素(0或1)
+	OpDestructureHash  // 检查栈顶的值能否按哈希表模式解构，操作数为模式中全部键组成的数组常量的下标
+	OpArrayRest        // 弹出数组并压入由其剩余元素组成的新数组，操作数为剩余元素的起始下标
+	OpMatchArray       // 弹出值并压入其能否按数组模式解构的布尔值，操作数与OpDestructureArray相同
+	OpMatchHash        // 弹出值并压入其能否按哈希表模式解构的布尔值，操作数与OpDestructureHash相同
+	OpJumpTable        // 弹出值并在跳转表中查找跳转目标，操作数为跳转表的常量下标和找不到时的跳转目标
+
+	// 以下为编译器优化阶段生成的特化指令，语义与被替换的指令序列相同
+	OpGetLocal0          // 等价于OpGetLocal 0
+	OpGetLocal1          // 等价于OpGetLocal 1
+	OpGetLocal2          // 等价于OpGetLocal 2
+	OpGetLocal3          // 等价于OpGetLocal 3
+	OpAddConst           // 等价于OpConstant i; OpAdd，操作数为常量下标
+	OpJumpIfFalseCompare // 等价于比较指令后接OpJumpNotTruthy，操作数为比较指令的操作码和跳转目标
+	OpCall0              // 等价于OpCall 0
+	OpCall1              // 等价于OpCall 1
+	OpCall2              // 等价于OpCall 2
+	OpCall3              // 等价于OpCall 3
+
+	OpWide // 宽操作数前缀，紧随其后的指令的每个操作数都占WideOperandWidth个字节
 )
 
+// WideOperandWidth OpWide前缀之后的指令中每个操作数占用的字节数
+const WideOperandWidth = 4
+
 // Definition 操作指令定义
 type Definition struct {
 	Name          string // 操作码的可读名称
@@ -68,6 +101,35 @@ var definitions = map[Opcode]*Definition{
 	OpReturn:        {"OpReturn", []int{}},
 	OpSetLocal:      {"OpSetLocal", []int{1}},
 	OpGetLocal:      {"OpGetLocal", []int{1}},
+	OpModule:        {"OpModule", []int{2}},
+	OpGetBuiltin:    {"OpGetBuiltin", []int{1}},
+	OpCallSpread:    {"OpCallSpread", []int{1}},
+
+	OpClosure:        {"OpClosure", []int{2, 1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpSetFree:        {"OpSetFree", []int{1}},
+
+	OpDup:              {"OpDup", []int{}},
+	OpDestructureArray: {"OpDestructureArray", []int{2, 1}},
+	OpDestructureHash:  {"OpDestructureHash", []int{2}},
+	OpArrayRest:        {"OpArrayRest", []int{2}},
+	OpMatchArray:       {"OpMatchArray", []int{2, 1}},
+	OpMatchHash:        {"OpMatchHash", []int{2}},
+	OpJumpTable:        {"OpJumpTable", []int{2, 2}},
+
+	OpGetLocal0:          {"OpGetLocal0", []int{}},
+	OpGetLocal1:          {"OpGetLocal1", []int{}},
+	OpGetLocal2:          {"OpGetLocal2", []int{}},
+	OpGetLocal3:          {"OpGetLocal3", []int{}},
+	OpAddConst:           {"OpAddConst", []int{2}},
+	OpJumpIfFalseCompare: {"OpJumpIfFalseCompare", []int{1, 2}},
+	OpCall0:              {"OpCall0", []int{}},
+	OpCall1:              {"OpCall1", []int{}},
+	OpCall2:              {"OpCall2", []int{}},
+	OpCall3:              {"OpCall3", []int{}},
+
+	OpWide: {"OpWide", []int{}},
 }
 
 // Lookup 根据操作码查询对应的操作指令定义
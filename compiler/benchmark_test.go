@@ -0,0 +1,24 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/nicolerobin/monkey/internal/benchcorpus"
+	"github.com/nicolerobin/monkey/lexer"
+	"github.com/nicolerobin/monkey/parser"
+)
+
+func BenchmarkCompile(b *testing.B) {
+	for _, bench := range benchcorpus.Load(b) {
+		program := parser.NewParser(lexer.NewLexer(bench.Input)).ParseProgram()
+
+		b.Run(bench.Name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := NewCompiler().Compile(program); err != nil {
+					b.Fatalf("compiler error: %s", err)
+				}
+			}
+		})
+	}
+}
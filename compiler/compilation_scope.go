@@ -6,4 +6,6 @@ type CompilationScope struct {
 	instructions        code.Instructions
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+
+	tables []*jumpTable // 作用域中OpJumpTable使用的跳转表，汇编时按指令的新位置更新
 }
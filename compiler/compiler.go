@@ -4,8 +4,9 @@ import (
 	"fmt"
 	"github.com/nicolerobin/monkey/ast"
 	"github.com/nicolerobin/monkey/code"
+	"github.com/nicolerobin/monkey/module"
 	"github.com/nicolerobin/monkey/object"
-	"sort"
+	"github.com/nicolerobin/monkey/token"
 )
 
 type Bytecode struct {
@@ -13,6 +14,16 @@ type Bytecode struct {
 	Constants    []object.Object
 }
 
+// Warning 编译时发现的可能的问题，不影响生成的字节码
+type Warning struct {
+	Token   token.Token // 问题所在的词法单元
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%d:%d: %s", w.Token.LineNo, w.Token.Column, w.Message)
+}
+
 type EmittedInstruction struct {
 	Opcode   code.Opcode
 	Position int
@@ -25,6 +36,14 @@ type Compiler struct {
 
 	scopes     []CompilationScope // 作用域
 	scopeIndex int
+
+	loader *module.Loader // 模块加载器
+
+	optimize bool // 是否对生成的指令做窥孔优化
+
+	warnings []Warning // 编译时发现的可能的问题
+
+	err error // 编码指令时遇到的第一个错误，在Compile返回时报告
 }
 
 // NewCompiler 创建Compiler
@@ -35,29 +54,61 @@ func NewCompiler() *Compiler {
 		previousInstruction: EmittedInstruction{},
 	}
 
+	symbolTable := NewSymbolTable()
+	defineBuiltins(symbolTable)
+
 	return &Compiler{
 		constants:   []object.Object{},
-		symbolTable: NewSymbolTable(),
+		symbolTable: symbolTable,
 		scopes:      []CompilationScope{mainScope},
 		scopeIndex:  0,
+		loader:      module.NewLoader(),
+		optimize:    true,
 	}
 }
 
 // NewWithState 创建Compiler并设置状态存储
 func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
 	compiler := NewCompiler()
+	defineBuiltins(s)
 	compiler.symbolTable = s
 	compiler.constants = constants
 	return compiler
 }
 
+// defineBuiltins 在符号表中定义全部内置函数
+func defineBuiltins(s *SymbolTable) {
+	for i, def := range object.Builtins {
+		s.DefineBuiltin(i, def.Name)
+	}
+}
+
+// SetLoader 设置编译import语句时使用的模块加载器，默认的加载器不展开宏，
+// 导入的模块中定义或使用宏时需要设置evaluator.NewLoader创建的加载器
+func (c *Compiler) SetLoader(l *module.Loader) {
+	c.loader = l
+}
+
+// SetOptimize 设置是否将生成的指令替换为特化的超级指令，默认开启
+func (c *Compiler) SetOptimize(optimize bool) {
+	c.optimize = optimize
+}
+
 // Compile 递归遍历AST并生成指令序列
 func (c *Compiler) Compile(node ast.Node) error {
 	switch node := node.(type) {
 	case *ast.Program:
+		table := c.symbolTable
+		err := c.hoistFunctions(node.Statements)
+		if err != nil {
+			table.hoisted = nil
+			return err
+		}
 		for _, stmt := range node.Statements {
 			err := c.Compile(stmt)
 			if err != nil {
+				// REPL在多次输入之间共享符号表，编译失败的声明不再等待执行
+				table.hoisted = nil
 				return err
 			}
 		}
@@ -132,6 +183,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 		} else {
 			c.emit(code.OpFalse)
 		}
+	case *ast.MatchExpression:
+		return c.compileMatch(node)
 	case *ast.IfExpression:
 		// 处理条件condition
 		err := c.Compile(node.Condition)
@@ -140,19 +193,19 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 		// 设置JumpNotTruthy指令，先使用虚假偏移量
-		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+		jumpNotTruthyPos := c.emitJump(code.OpJumpNotTruthy)
 
 		// 处理结果consequence
 		err = c.Compile(node.Consequence)
 		if err != nil {
 			return err
 		}
-		if c.lastInstructionIs(code.OpPop) {
+		if endsWithExpression(node.Consequence) {
 			c.removeLastPop()
 		}
 
 		// 发出带有虚假偏移的OpJump
-		jumpPos := c.emit(code.OpJump, 9999)
+		jumpPos := c.emitJump(code.OpJump)
 
 		// 修正OpJumpNotTruthy指令的跳转位置
 		afterConsequencePos := len(c.currentInstructions())
@@ -169,7 +222,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 
 			// 移除末尾的OpPop
-			if c.lastInstructionIs(code.OpPop) {
+			if endsWithExpression(node.Alternative) {
 				c.removeLastPop()
 			}
 		}
@@ -177,6 +230,10 @@ func (c *Compiler) Compile(node ast.Node) error {
 		afterAlternativePos := len(c.currentInstructions())
 		c.changeOperand(jumpPos, afterAlternativePos)
 	case *ast.BlockStatement:
+		err := c.hoistFunctions(node.Statements)
+		if err != nil {
+			return err
+		}
 		for _, stmt := range node.Statements {
 			err := c.Compile(stmt)
 			if err != nil {
@@ -184,29 +241,89 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 	case *ast.LetStatement:
-		err := c.Compile(node.Value)
+		kind := letBinding
+		if node.Constant {
+			kind = constBinding
+		}
+		if node.Pattern != nil {
+			if node.Exported && c.symbolTable.Outer != nil {
+				return fmt.Errorf("export is only allowed at top level: %s", node.Pattern)
+			}
+			err := c.Compile(node.Value)
+			if err != nil {
+				return err
+			}
+			err = c.destructure(node.Pattern, kind)
+			if err != nil {
+				return err
+			}
+			return c.err
+		}
+		if node.Exported && c.symbolTable.Outer != nil {
+			return fmt.Errorf("export is only allowed at top level: %s", node.Name.Value)
+		}
+
+		fn, isFunction := node.Value.(*ast.FunctionLiteral)
+		if !isFunction {
+			err := c.Compile(node.Value)
+			if err != nil {
+				return err
+			}
+			symbol, err := c.define(node.Name, kind)
+			if err != nil {
+				return err
+			}
+			c.storeSymbol(symbol)
+			return c.err
+		}
+
+		// 全局的函数先定义名称，使函数体可以通过全局变量递归调用自身，局部函数则在函数体中以自身的名称引用自身
+		var symbol Symbol
+		var err error
+		global := c.symbolTable.Outer == nil
+		if global {
+			symbol, err = c.define(node.Name, kind)
+			if err != nil {
+				return err
+			}
+		}
+		forward, err := c.compileFunction(fn, node.Name.Value)
 		if err != nil {
 			return err
 		}
+		if !global {
+			symbol, err = c.define(node.Name, kind)
+			if err != nil {
+				return err
+			}
+		}
+		c.storeFunction(symbol, forward)
+	case *ast.FunctionStatement:
+		if node.Exported && c.symbolTable.Outer != nil {
+			return fmt.Errorf("export is only allowed at top level: %s", node.Name.Value)
+		}
 
-		// 为变量创建符号
-		symbol := c.symbolTable.Define(node.Name.Value)
-		// 将符号的Index作为OpSetGlobal或者OpSetLocal的参数添加到指令序列中
-		if symbol.Scope == GlobalScope {
-			c.emit(code.OpSetGlobal, symbol.Index)
-		} else {
-			c.emit(code.OpSetLocal, symbol.Index)
+		forward, err := c.compileFunction(node.Function, node.Name.Value)
+		if err != nil {
+			return err
 		}
+		symbol, ok := c.symbolTable.Declare(node.Name.Value)
+		if !ok {
+			symbol, err = c.define(node.Name, letBinding)
+			if err != nil {
+				return err
+			}
+		}
+		c.storeFunction(symbol, forward)
 	case *ast.Identifier:
 		sym, ok := c.symbolTable.Resolve(node.Value)
 		if !ok {
 			return fmt.Errorf("undefined variable:%s\n", node.Value)
 		}
-		if sym.Scope == GlobalScope {
-			c.emit(code.OpGetGlobal, sym.Index)
-		} else {
-			c.emit(code.OpGetLocal, sym.Index)
+		if c.symbolTable.Hoisted(node.Value) {
+			return fmt.Errorf(UsedBeforeDeclaration, node.Value)
 		}
+		c.loadSymbol(sym)
 	case *ast.StringLiteral:
 		c.emit(code.OpConstant, c.addConstant(&object.String{
 			Value: node.Value,
@@ -220,16 +337,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(code.OpArray, len(node.Elements))
 	case *ast.HashLiteral:
-		keys := []ast.Expression{}
-		for key := range node.Pairs {
-			keys = append(keys, key)
-		}
-
-		sort.Slice(keys, func(i, j int) bool {
-			return keys[i].String() < keys[j].String()
-		})
-
-		for _, key := range keys {
+		for _, key := range node.Keys {
 			err := c.Compile(key)
 			if err != nil {
 				return err
@@ -253,38 +361,27 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 		c.emit(code.OpIndex)
-	case *ast.FunctionLiteral:
-		c.enterScope()
-
-		// 处理参数
-		for _, p := range node.Parameters {
-			c.symbolTable.Define(p.Value)
-		}
-
-		err := c.Compile(node.Body)
+	case *ast.MemberExpression:
+		err := c.Compile(node.Object)
 		if err != nil {
 			return err
 		}
 
-		// 处理隐式返回值
-		if c.lastInstructionIs(code.OpPop) {
-			c.removeLastPop()
-			c.emit(code.OpReturnValue)
-		}
-
-		// 处理空函数体情况，插入OpReturn指令
-		if !c.lastInstructionIs(code.OpReturnValue) {
-			c.emit(code.OpReturn)
+		// 成员访问a.b等价于以字符串为下标的a["b"]
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Property.Value}))
+		c.emit(code.OpIndex)
+	case *ast.ImportStatement:
+		return c.compileImport(node)
+	case *ast.MacroLiteral:
+		return fmt.Errorf("macro literal must be bound by a top-level let statement and expanded before compilation")
+	case *ast.FunctionLiteral:
+		forward, err := c.compileFunction(node, "")
+		if err != nil {
+			return err
 		}
-		numLocals := c.symbolTable.numDefinitions
-		ins := c.leaveScope()
-
-		compiledFn := &object.CompiledFunction{
-			Instructions:  ins,
-			NumLocals:     numLocals,
-			NumParameters: len(node.Parameters),
+		if len(forward) > 0 {
+			return fmt.Errorf(UsedBeforeDeclaration, forward[0].target)
 		}
-		c.emit(code.OpConstant, c.addConstant(compiledFn))
 	case *ast.ReturnStatement:
 		err := c.Compile(node.ReturnValue)
 		if err != nil {
@@ -296,6 +393,9 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if err != nil {
 			return err
 		}
+		if hasSpread(node.Arguments) {
+			return c.compileSpreadCall(node.Arguments)
+		}
 
 		for _, a := range node.Arguments {
 			err := c.Compile(a)
@@ -305,13 +405,398 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(code.OpCall, len(node.Arguments))
 	}
+	return c.err
+}
+
+// fixup 创建闭包时引用的函数尚未执行到声明处，自由变量暂时为null，在该函数声明之后回填
+type fixup struct {
+	closure Symbol // 保存闭包的变量
+	free    int    // 自由变量的下标
+	target  string // 尚未声明的函数名
+}
+
+// hoistFunctions 提前定义语句列表中声明的函数名，使函数可以引用之后声明的函数。
+// 全局的函数名在声明执行之前保存object.Hoisted，在此之前调用时以函数名报告错误
+func (c *Compiler) hoistFunctions(statements []ast.Statement) error {
+	for _, stmt := range statements {
+		if fn, ok := stmt.(*ast.FunctionStatement); ok {
+			err := c.checkRedefinition(fn.Name, letBinding)
+			if err != nil {
+				return err
+			}
+			sym := c.symbolTable.Hoist(fn.Name.Value)
+			if sym.Scope == GlobalScope {
+				c.emit(code.OpConstant, c.addConstant(&object.Hoisted{Name: fn.Name.Value}))
+				c.emit(code.OpSetGlobal, sym.Index)
+			}
+		}
+	}
+	return nil
+}
+
+// 名称解析给出的警告和错误信息，%s为名称
+const (
+	AlreadyDefined         = "%s is already defined in this scope"        // 在同一作用域中重新定义变量
+	CannotRedefineConstant = "cannot redefine constant %s"                // 在同一作用域中重新定义常量
+	UsedBeforeDeclaration  = "function %s is used before its declaration" // 在同一作用域中执行到函数声明之前引用函数
+)
+
+// binding 定义名称的方式，决定在同一作用域中重新定义名称时的检查
+type binding int
+
+const (
+	letBinding   binding = iota // let语句、函数声明和import
+	constBinding                // const语句
+	matchBinding                // match分支中的变量，各个分支常常绑定同名的变量，重新定义变量时不给出警告
+)
+
+// checkRedefinition 检查在当前作用域中定义ident是否重新定义了已有的名称：已有的名称是常量时返回错误，
+// 是变量时给出警告
+func (c *Compiler) checkRedefinition(ident *ast.Identifier, kind binding) error {
+	redefined, err := c.symbolTable.CheckRedefinition(ident.Value)
+	if err != nil {
+		return err
+	}
+	if redefined && kind != matchBinding {
+		c.warn(ident.Token, fmt.Sprintf(AlreadyDefined, ident.Value))
+	}
+	return nil
+}
+
+// define 检查后在当前作用域中定义ident
+func (c *Compiler) define(ident *ast.Identifier, kind binding) (Symbol, error) {
+	err := c.checkRedefinition(ident, kind)
+	if err != nil {
+		return Symbol{}, err
+	}
+	if kind == constBinding {
+		return c.symbolTable.DefineConstant(ident.Value), nil
+	}
+	return c.symbolTable.Define(ident.Value), nil
+}
+
+// compileFunction 编译函数字面量，name为函数绑定的名称，用于错误信息，局部函数还可以在函数体中以此名称调用自身。
+// 参数的默认值在函数体之前依次求值并保存到对应的局部变量，每个默认值的起始位置都是一个入口，
+// 虚拟机按实参个数选择入口，跳过已传入的参数的默认值。
+// 函数引用了外层函数的局部变量时生成闭包，返回其中尚未声明、需要回填的自由变量
+func (c *Compiler) compileFunction(node *ast.FunctionLiteral, name string) ([]fixup, error) {
+	local := c.symbolTable.Outer != nil
+	c.enterScope()
+	if name != "" && local {
+		c.symbolTable.DefineFunctionName(name)
+	}
+
+	// 默认值只能引用它之前的参数，因此逐个定义参数
+	required := node.NumRequired()
+	for _, p := range node.Parameters[:required] {
+		c.symbolTable.Define(p.Value)
+	}
+	var entries []int
+	for i, p := range node.Parameters[required:] {
+		entries = append(entries, len(c.currentInstructions()))
+		err := c.Compile(node.Defaults[i])
+		if err != nil {
+			return nil, err
+		}
+		symbol := c.symbolTable.Define(p.Value)
+		c.emit(code.OpSetLocal, symbol.Index)
+	}
+	if entries != nil {
+		entries = append(entries, len(c.currentInstructions()))
+	}
+	if node.Rest != nil {
+		c.symbolTable.Define(node.Rest.Value)
+	}
+
+	err := c.Compile(node.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// 处理隐式返回值
+	if endsWithExpression(node.Body) {
+		c.removeLastPop()
+		c.emit(code.OpReturnValue)
+	}
+
+	// 处理空函数体情况，插入OpReturn指令
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numDefinitions
+	tables := c.scopes[c.scopeIndex].tables
+	ins := c.leaveScope()
+
+	params := make([]string, 0, len(node.Parameters)+1)
+	for _, p := range node.Parameters {
+		params = append(params, p.Value)
+	}
+	if node.Rest != nil {
+		params = append(params, node.Rest.Value)
+	}
+
+	instructions, entries := c.assemble(ins, tables, entries)
+	compiledFn := &object.CompiledFunction{
+		Name:          name,
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		Entries:       entries,
+		Variadic:      node.Rest != nil,
+		Parameters:    params,
+	}
+	if len(freeSymbols) == 0 {
+		c.emit(code.OpConstant, c.addConstant(compiledFn))
+		return nil, nil
+	}
+
+	var forward []fixup
+	for i, sym := range freeSymbols {
+		if sym.Scope == LocalScope && c.symbolTable.Hoisted(sym.Name) {
+			c.emit(code.OpConstant, c.addConstant(&object.Hoisted{Name: sym.Name}))
+			forward = append(forward, fixup{free: i, target: sym.Name})
+			continue
+		}
+		c.loadSymbol(sym)
+	}
+	c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+	return forward, nil
+}
+
+// loadSymbol 生成读取符号的值的指令
+func (c *Compiler) loadSymbol(sym Symbol) {
+	switch sym.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, sym.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, sym.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, sym.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, sym.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+// storeSymbol 生成将栈顶的值保存到符号的指令
+func (c *Compiler) storeSymbol(sym Symbol) {
+	if sym.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, sym.Index)
+	} else {
+		c.emit(code.OpSetLocal, sym.Index)
+	}
+}
+
+// destructure 将栈顶的值按pattern解构并以kind的方式定义模式中的变量，同时弹出该值。
+// 数组和哈希表模式先检查值的形状，再复制该值并以OpIndex逐个取出元素
+func (c *Compiler) destructure(pattern ast.Pattern, kind binding) error {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if ast.Wildcard(pattern) {
+			c.emit(code.OpPop)
+			return nil
+		}
+		symbol, err := c.define(pattern, kind)
+		if err != nil {
+			return err
+		}
+		c.storeSymbol(symbol)
+	case *ast.ArrayPattern:
+		variadic := 0
+		if pattern.Rest != nil {
+			variadic = 1
+		}
+		c.emit(code.OpDestructureArray, len(pattern.Elements), variadic)
+		for i, el := range pattern.Elements {
+			c.emit(code.OpDup)
+			c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: int64(i)}))
+			c.emit(code.OpIndex)
+			err := c.destructure(el, kind)
+			if err != nil {
+				return err
+			}
+		}
+		if pattern.Rest != nil {
+			c.emit(code.OpDup)
+			c.emit(code.OpArrayRest, len(pattern.Elements))
+			err := c.destructure(pattern.Rest, kind)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpPop)
+	case *ast.HashPattern:
+		keys := make([]object.Object, len(pattern.Pairs))
+		for i, pair := range pattern.Pairs {
+			keys[i] = &object.String{Value: pair.Key.Value}
+		}
+		c.emit(code.OpDestructureHash, c.addConstant(object.NewArray(keys)))
+		for _, pair := range pattern.Pairs {
+			c.emit(code.OpDup)
+			c.emit(code.OpConstant, c.addConstant(&object.String{Value: pair.Key.Value}))
+			c.emit(code.OpIndex)
+			err := c.destructure(pair.Value, kind)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpPop)
+	default:
+		// match中的字面量模式已经测试过，不绑定变量
+		c.emit(code.OpPop)
+	}
+	return nil
+}
+
+// storeFunction 将栈顶刚创建的函数保存到sym，回填之前创建的闭包中对该函数的引用，
+// 并登记该函数自身引用的尚未声明的函数
+func (c *Compiler) storeFunction(sym Symbol, forward []fixup) {
+	c.storeSymbol(sym)
+
+	table := c.symbolTable
+	pending := table.fixups[:0]
+	for _, f := range table.fixups {
+		if f.target != sym.Name {
+			pending = append(pending, f)
+			continue
+		}
+		c.loadSymbol(f.closure)
+		c.loadSymbol(sym)
+		c.emit(code.OpSetFree, f.free)
+	}
+
+	for _, f := range forward {
+		f.closure = sym
+		pending = append(pending, f)
+	}
+	table.fixups = pending
+}
+
+func hasSpread(args []ast.Expression) bool {
+	for _, a := range args {
+		if _, ok := a.(*ast.SpreadExpression); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// compileSpreadCall 编译带有展开实参的调用：相邻的普通实参构建为一个数组，展开实参直接求值为数组，
+// OpCallSpread在运行时拼接这些数组作为实参
+func (c *Compiler) compileSpreadCall(args []ast.Expression) error {
+	segments, pending := 0, 0
+	flush := func() {
+		if pending > 0 {
+			c.emit(code.OpArray, pending)
+			segments, pending = segments+1, 0
+		}
+	}
+
+	for _, a := range args {
+		spread, ok := a.(*ast.SpreadExpression)
+		if !ok {
+			err := c.Compile(a)
+			if err != nil {
+				return err
+			}
+			pending++
+			continue
+		}
+
+		flush()
+		err := c.Compile(spread.Value)
+		if err != nil {
+			return err
+		}
+		segments++
+	}
+	flush()
+
+	c.emit(code.OpCallSpread, segments)
 	return nil
 }
 
-// Bytecode
+// compileImport 编译import语句，模块只会被编译执行一次，之后的导入直接引用已构建的模块对象，原生模块作为常量直接引用
+func (c *Compiler) compileImport(node *ast.ImportStatement) error {
+	if c.symbolTable.Outer != nil {
+		return fmt.Errorf("import is only allowed at top level: %s", node.Path.Value)
+	}
+
+	m, err := c.loader.Load(node.Path.Value)
+	if err != nil {
+		return err
+	}
+
+	moduleSymbol, ok := c.symbolTable.ResolveModule(m.Path)
+	if !ok && m.Native != nil {
+		c.emit(code.OpConstant, c.addConstant(m.Native))
+		moduleSymbol = c.symbolTable.DefineModule(m.Path)
+		c.emit(code.OpSetGlobal, moduleSymbol.Index)
+	} else if !ok {
+		err = c.loader.Enter(m)
+		if err != nil {
+			return err
+		}
+		moduleSymbol, err = c.compileModule(m)
+		c.loader.Leave()
+		if err != nil {
+			return err
+		}
+	}
+
+	alias, err := c.define(node.Alias, letBinding)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpGetGlobal, moduleSymbol.Index)
+	c.emit(code.OpSetGlobal, alias.Index)
+	return nil
+}
+
+// compileModule 在模块独立的全局命名空间中编译模块体，然后将导出的绑定构建为模块对象并保存到全局变量
+func (c *Compiler) compileModule(m *module.Module) (Symbol, error) {
+	mainSymbolTable := c.symbolTable
+	c.symbolTable = NewModuleSymbolTable(mainSymbolTable)
+	defer func() {
+		c.symbolTable = mainSymbolTable
+	}()
+
+	err := c.Compile(m.Program)
+	if err != nil {
+		return Symbol{}, fmt.Errorf("module %s: %s", m.Path, err)
+	}
+
+	exports := m.Exports()
+	c.emit(code.OpConstant, c.addConstant(&object.String{Value: m.Path}))
+	for _, name := range exports {
+		sym, _ := c.symbolTable.Resolve(name)
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: name}))
+		c.emit(code.OpGetGlobal, sym.Index)
+	}
+	c.emit(code.OpModule, len(exports)*2)
+
+	moduleSymbol := mainSymbolTable.DefineModule(m.Path)
+	c.emit(code.OpSetGlobal, moduleSymbol.Index)
+	return moduleSymbol, nil
+}
+
+// Warnings 返回编译时发现的可能的问题，例如不完备的match表达式
+func (c *Compiler) Warnings() []Warning {
+	return c.warnings
+}
+
+// warn 记录在词法单元tok处发现的问题
+func (c *Compiler) warn(tok token.Token, msg string) {
+	c.warnings = append(c.warnings, Warning{Token: tok, Message: msg})
+}
+
+// Bytecode 返回编译结果，主程序的指令在此时汇编，函数体的指令在编译函数时已经汇编
 func (c *Compiler) Bytecode() *Bytecode {
+	instructions, _ := c.assemble(c.currentInstructions(), c.scopes[c.scopeIndex].tables, nil)
 	return &Bytecode{
-		Instructions: c.currentInstructions(),
+		Instructions: instructions,
 		Constants:    c.constants,
 	}
 }
@@ -332,9 +817,12 @@ func (c *Compiler) addInstruction(ins code.Instructions) int {
 	return posNewInstruction
 }
 
-// emit 生成指令并将指令添加到指令序列中
+// emit 生成指令并将指令添加到指令序列中，操作数超出定义的宽度时使用OpWide前缀
 func (c *Compiler) emit(op code.Opcode, operands ...int) int {
-	ins := code.Make(op, operands...)
+	ins, err := code.Encode(op, operands...)
+	if err != nil {
+		c.fail(err)
+	}
 	pos := c.addInstruction(ins)
 
 	c.setLastInstruction(op, pos)
@@ -342,6 +830,56 @@ func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 	return pos
 }
 
+// emitJump 生成目标地址待回填的跳转指令。回填前不知道目标地址有多大，因此先使用OpWide前缀的形式，
+// 汇编时再按实际的目标地址缩短
+func (c *Compiler) emitJump(op code.Opcode) int {
+	ins, err := code.MakeWide(op, 0)
+	if err != nil {
+		c.fail(err)
+	}
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+
+	return pos
+}
+
+// fail 记录编码指令时遇到的错误，只保留第一个
+func (c *Compiler) fail(err error) {
+	if c.err == nil {
+		c.err = fmt.Errorf("program exceeds bytecode limits: %s", err)
+	}
+}
+
+// assemble 对作用域编译完成的指令做窥孔优化(如果开启)，然后重新编码为最终的指令序列。
+// entries为函数的入口位置，与跳转目标一样不会被合并到其他指令中，返回入口在最终指令序列中的位置；
+// tables为作用域中的跳转表，其中的跳转目标同样不会被合并，并在汇编后更新为新的位置
+func (c *Compiler) assemble(ins code.Instructions, tables []*jumpTable, entries []int) (code.Instructions, []int) {
+	decoded := decodeInstructions(ins)
+	if c.optimize {
+		targets := append([]int{}, entries...)
+		for _, table := range tables {
+			targets = append(targets, table.targets...)
+		}
+		decoded = optimize(decoded, targets...)
+	}
+
+	// 操作数在emit时已经检查过，跳转目标不会超过指令序列的长度，编码不会失败
+	assembled, offsets, err := assemble(decoded, len(ins))
+	if err != nil {
+		panic(err)
+	}
+
+	for _, table := range tables {
+		table.relocate(offsets)
+	}
+	var relocated []int
+	for _, entry := range entries {
+		relocated = append(relocated, offsets[entry])
+	}
+	return assembled, relocated
+}
+
 // 记录最近一次指令和倒数第二次指令
 func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
 	previous := c.scopes[c.scopeIndex].lastInstruction
@@ -356,6 +894,16 @@ func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
 	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
 }
 
+// endsWithExpression 判断代码块的最后一条语句是否为表达式语句，此时代码块的最后一条指令是弹出其值的OpPop。
+// 不能只检查最后一条指令，解构的let语句也以OpPop结束
+func endsWithExpression(block *ast.BlockStatement) bool {
+	if len(block.Statements) == 0 {
+		return false
+	}
+	_, ok := block.Statements[len(block.Statements)-1].(*ast.ExpressionStatement)
+	return ok
+}
+
 // 移除最后一个OpPop
 func (c *Compiler) removeLastPop() {
 	c.scopes[c.scopeIndex].instructions = c.scopes[c.scopeIndex].instructions[:len(c.scopes[c.scopeIndex].instructions)-1]
@@ -369,11 +917,21 @@ func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
 	}
 }
 
-// changeOperand 修改操作数
+// changeOperand 修改操作数，保持指令原有的宽度
 func (c *Compiler) changeOperand(opPos int, operand int) {
-	op := code.Opcode(c.scopes[c.scopeIndex].instructions[opPos])
-	newInstruction := code.Make(op, operand)
+	ins := c.currentInstructions()
+	op := code.Opcode(ins[opPos])
+	encode := code.Make
+	if op == code.OpWide {
+		op = code.Opcode(ins[opPos+1])
+		encode = code.MakeWide
+	}
 
+	newInstruction, err := encode(op, operand)
+	if err != nil {
+		c.fail(err)
+		return
+	}
 	c.replaceInstruction(opPos, newInstruction)
 }
 
@@ -394,6 +952,16 @@ func (c *Compiler) enterScope() {
 	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
 }
 
+// enterBlock 进入块作用域，只嵌套符号表，指令仍然生成在当前作用域中
+func (c *Compiler) enterBlock() {
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+}
+
+// leaveBlock 离开块作用域，块中定义的变量不再可见
+func (c *Compiler) leaveBlock() {
+	c.symbolTable = c.symbolTable.Outer
+}
+
 func (c *Compiler) leaveScope() code.Instructions {
 	instructions := c.currentInstructions()
 
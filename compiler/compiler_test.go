@@ -2,6 +2,8 @@ package compiler
 
 import (
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/nicolerobin/monkey/ast"
@@ -23,59 +25,59 @@ func TestIntegerArithmetic(t *testing.T) {
 			input:             "1;2",
 			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpPop),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpPop),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "1 + 2",
 			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpAdd),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpAdd),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "1 - 2",
 			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpSub),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpSub),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "1 * 2",
 			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpMul),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpMul),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "1 / 2",
 			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpDiv),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpDiv),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "-1",
 			expectedConstants: []interface{}{1},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpMinus),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpMinus),
+				code.MustMake(code.OpPop),
 			},
 		},
 	}
@@ -89,69 +91,69 @@ func TestBooleanExpressions(t *testing.T) {
 			input:             "1 > 2",
 			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpGreaterThan),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpGreaterThan),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "1 < 2",
 			expectedConstants: []interface{}{2, 1},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpGreaterThan),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpGreaterThan),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "1 == 2",
 			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpEqual),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpEqual),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "1 != 2",
 			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpNotEqual),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpNotEqual),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "true == false",
 			expectedConstants: []interface{}{},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpTrue),
-				code.Make(code.OpFalse),
-				code.Make(code.OpEqual),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpTrue),
+				code.MustMake(code.OpFalse),
+				code.MustMake(code.OpEqual),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "true != false",
 			expectedConstants: []interface{}{},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpTrue),
-				code.Make(code.OpFalse),
-				code.Make(code.OpNotEqual),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpTrue),
+				code.MustMake(code.OpFalse),
+				code.MustMake(code.OpNotEqual),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "!true",
 			expectedConstants: []interface{}{},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpTrue),
-				code.Make(code.OpBang),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpTrue),
+				code.MustMake(code.OpBang),
+				code.MustMake(code.OpPop),
 			},
 		},
 	}
@@ -166,23 +168,23 @@ func TestConditionals(t *testing.T) {
 			expectedConstants: []interface{}{10, 20, 3333},
 			expectedInstructions: []code.Instructions{
 				// 0000
-				code.Make(code.OpTrue),
+				code.MustMake(code.OpTrue),
 				// 0001
-				code.Make(code.OpJumpNotTruthy, 10),
+				code.MustMake(code.OpJumpNotTruthy, 10),
 				// if statement
 				// 0004
-				code.Make(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 0),
 				// else statement
 				// 0007
-				code.Make(code.OpJump, 13),
+				code.MustMake(code.OpJump, 13),
 				// 0010
-				code.Make(code.OpConstant, 1),
+				code.MustMake(code.OpConstant, 1),
 				// 0013
-				code.Make(code.OpPop),
+				code.MustMake(code.OpPop),
 				// 0014
-				code.Make(code.OpConstant, 2),
+				code.MustMake(code.OpConstant, 2),
 				// 0011
-				code.Make(code.OpPop),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
@@ -190,21 +192,21 @@ func TestConditionals(t *testing.T) {
 			expectedConstants: []interface{}{10, 3333},
 			expectedInstructions: []code.Instructions{
 				// 0000
-				code.Make(code.OpTrue),
+				code.MustMake(code.OpTrue),
 				// 0001
-				code.Make(code.OpJumpNotTruthy, 10),
+				code.MustMake(code.OpJumpNotTruthy, 10),
 				// 0004
-				code.Make(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 0),
 				// 0007
-				code.Make(code.OpJump, 11),
+				code.MustMake(code.OpJump, 11),
 				// 0010
-				code.Make(code.OpNull),
+				code.MustMake(code.OpNull),
 				// 0011
-				code.Make(code.OpPop),
+				code.MustMake(code.OpPop),
 				// 0012
-				code.Make(code.OpConstant, 1),
+				code.MustMake(code.OpConstant, 1),
 				// 0013
-				code.Make(code.OpPop),
+				code.MustMake(code.OpPop),
 			},
 		},
 	}
@@ -220,10 +222,10 @@ func TestGlobalLetStatements(t *testing.T) {
 				let two = 2;`,
 			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpSetGlobal, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpSetGlobal, 1),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpSetGlobal, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpSetGlobal, 1),
 				// # TODO: 这里为什么不需要OpPop呢？
 			},
 		},
@@ -233,10 +235,10 @@ func TestGlobalLetStatements(t *testing.T) {
 				one;`,
 			expectedConstants: []interface{}{1},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpSetGlobal, 0),
-				code.Make(code.OpGetGlobal, 0),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpSetGlobal, 0),
+				code.MustMake(code.OpGetGlobal, 0),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
@@ -246,12 +248,12 @@ func TestGlobalLetStatements(t *testing.T) {
 				two;`,
 			expectedConstants: []interface{}{1},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpSetGlobal, 0),
-				code.Make(code.OpGetGlobal, 0),
-				code.Make(code.OpSetGlobal, 1),
-				code.Make(code.OpGetGlobal, 1),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpSetGlobal, 0),
+				code.MustMake(code.OpGetGlobal, 0),
+				code.MustMake(code.OpSetGlobal, 1),
+				code.MustMake(code.OpGetGlobal, 1),
+				code.MustMake(code.OpPop),
 			},
 		},
 	}
@@ -265,18 +267,18 @@ func TestStringExpression(t *testing.T) {
 			input:             `"monkey"`,
 			expectedConstants: []interface{}{"monkey"},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             `"mon" + "key"`,
 			expectedConstants: []interface{}{"mon", "key"},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpAdd),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpAdd),
+				code.MustMake(code.OpPop),
 			},
 		},
 	}
@@ -289,36 +291,36 @@ func TestArrayLiterals(t *testing.T) {
 			input:             "[]",
 			expectedConstants: []interface{}{},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpArray, 0),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpArray, 0),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "[1, 2, 3]",
 			expectedConstants: []interface{}{1, 2, 3},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpArray, 3),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpArray, 3),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "[1 + 2, 3 - 4, 5 * 6]",
 			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpAdd),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpSub),
-				code.Make(code.OpConstant, 4),
-				code.Make(code.OpConstant, 5),
-				code.Make(code.OpMul),
-				code.Make(code.OpArray, 3),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpAdd),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpConstant, 3),
+				code.MustMake(code.OpSub),
+				code.MustMake(code.OpConstant, 4),
+				code.MustMake(code.OpConstant, 5),
+				code.MustMake(code.OpMul),
+				code.MustMake(code.OpArray, 3),
+				code.MustMake(code.OpPop),
 			},
 		},
 	}
@@ -332,38 +334,38 @@ func TestHashLiteral(t *testing.T) {
 			input:             "{}",
 			expectedConstants: []interface{}{},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpHash, 0),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpHash, 0),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "{1: 2, 3: 4, 5: 6}",
 			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpConstant, 4),
-				code.Make(code.OpConstant, 5),
-				code.Make(code.OpHash, 3),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpConstant, 3),
+				code.MustMake(code.OpConstant, 4),
+				code.MustMake(code.OpConstant, 5),
+				code.MustMake(code.OpHash, 6),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "{1: 2 + 3, 4: 5 * 6}",
 			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpAdd),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpConstant, 4),
-				code.Make(code.OpConstant, 5),
-				code.Make(code.OpMul),
-				code.Make(code.OpHash, 2),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpAdd),
+				code.MustMake(code.OpConstant, 3),
+				code.MustMake(code.OpConstant, 4),
+				code.MustMake(code.OpConstant, 5),
+				code.MustMake(code.OpMul),
+				code.MustMake(code.OpHash, 4),
+				code.MustMake(code.OpPop),
 			},
 		},
 	}
@@ -377,29 +379,29 @@ func TestIndexExpression(t *testing.T) {
 			input:             "[1, 2, 3][1 + 1]",
 			expectedConstants: []interface{}{1, 2, 3, 1, 1},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpArray, 3),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpConstant, 4),
-				code.Make(code.OpAdd),
-				code.Make(code.OpIndex),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpArray, 3),
+				code.MustMake(code.OpConstant, 3),
+				code.MustMake(code.OpConstant, 4),
+				code.MustMake(code.OpAdd),
+				code.MustMake(code.OpIndex),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "{1: 2}[2 - 1]",
 			expectedConstants: []interface{}{1, 2, 2, 1},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpHash, 2),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpSub),
-				code.Make(code.OpIndex),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpHash, 2),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpConstant, 3),
+				code.MustMake(code.OpSub),
+				code.MustMake(code.OpIndex),
+				code.MustMake(code.OpPop),
 			},
 		},
 	}
@@ -416,16 +418,16 @@ func TestFunctions(t *testing.T) {
 				10,
 				// 将函数体作为一个常量存储在常量池中
 				[]code.Instructions{
-					code.Make(code.OpConstant, 0),
-					code.Make(code.OpConstant, 1),
-					code.Make(code.OpAdd),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpConstant, 0),
+					code.MustMake(code.OpConstant, 1),
+					code.MustMake(code.OpAdd),
+					code.MustMake(code.OpReturnValue),
 				},
 			},
 			expectedInstructions: []code.Instructions{
 				// 引用函数体常量
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
@@ -435,16 +437,16 @@ func TestFunctions(t *testing.T) {
 				10,
 				// 将函数体作为一个常量存储在常量池中
 				[]code.Instructions{
-					code.Make(code.OpConstant, 0),
-					code.Make(code.OpConstant, 1),
-					code.Make(code.OpAdd),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpConstant, 0),
+					code.MustMake(code.OpConstant, 1),
+					code.MustMake(code.OpAdd),
+					code.MustMake(code.OpReturnValue),
 				},
 			},
 			expectedInstructions: []code.Instructions{
 				// 引用函数体常量
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
@@ -454,28 +456,28 @@ func TestFunctions(t *testing.T) {
 				2,
 				// 将函数体作为一个常量存储在常量池中
 				[]code.Instructions{
-					code.Make(code.OpConstant, 0),
-					code.Make(code.OpPop),
-					code.Make(code.OpConstant, 1),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpConstant, 0),
+					code.MustMake(code.OpPop),
+					code.MustMake(code.OpConstant, 1),
+					code.MustMake(code.OpReturnValue),
 				},
 			},
 			expectedInstructions: []code.Instructions{
 				// 引用函数体常量
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input: `fn() {}`,
 			expectedConstants: []interface{}{
 				[]code.Instructions{
-					code.Make(code.OpReturn),
+					code.MustMake(code.OpReturn),
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpPop),
 			},
 		},
 	}
@@ -554,14 +556,14 @@ func TestFunctionCalls(t *testing.T) {
 			expectedConstants: []interface{}{
 				24,
 				[]code.Instructions{
-					code.Make(code.OpConstant, 0),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpConstant, 0),
+					code.MustMake(code.OpReturnValue),
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpCall, 0),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpCall, 0),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
@@ -570,17 +572,17 @@ func TestFunctionCalls(t *testing.T) {
 			expectedConstants: []interface{}{
 				24,
 				[]code.Instructions{
-					code.Make(code.OpConstant, 0),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpConstant, 0),
+					code.MustMake(code.OpReturnValue),
 				},
 			},
 			expectedInstructions: []code.Instructions{
 				// 函数体
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpSetGlobal, 0),
-				code.Make(code.OpGetGlobal, 0),
-				code.Make(code.OpCall, 0),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpSetGlobal, 0),
+				code.MustMake(code.OpGetGlobal, 0),
+				code.MustMake(code.OpCall, 0),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
@@ -589,18 +591,18 @@ func TestFunctionCalls(t *testing.T) {
 			oneArg(24);`,
 			expectedConstants: []interface{}{
 				[]code.Instructions{
-					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpReturnValue),
 				},
 				24,
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpSetGlobal, 0),
-				code.Make(code.OpGetGlobal, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpCall, 1),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpSetGlobal, 0),
+				code.MustMake(code.OpGetGlobal, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpCall, 1),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
@@ -609,26 +611,26 @@ func TestFunctionCalls(t *testing.T) {
 			manyArg(24, 25, 26);`,
 			expectedConstants: []interface{}{
 				[]code.Instructions{
-					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpPop),
-					code.Make(code.OpGetLocal, 1),
-					code.Make(code.OpPop),
-					code.Make(code.OpGetLocal, 2),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpPop),
+					code.MustMake(code.OpGetLocal, 1),
+					code.MustMake(code.OpPop),
+					code.MustMake(code.OpGetLocal, 2),
+					code.MustMake(code.OpReturnValue),
 				},
 				24,
 				25,
 				26,
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpSetGlobal, 0),
-				code.Make(code.OpGetGlobal, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpCall, 3),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpSetGlobal, 0),
+				code.MustMake(code.OpGetGlobal, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpConstant, 3),
+				code.MustMake(code.OpCall, 3),
+				code.MustMake(code.OpPop),
 			},
 		},
 	}
@@ -647,15 +649,30 @@ func TestLetStatementScopes(t *testing.T) {
 				55,
 				// 函数体
 				[]code.Instructions{
-					code.Make(code.OpGetGlobal, 0),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpGetGlobal, 0),
+					code.MustMake(code.OpReturnValue),
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpSetGlobal, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpSetGlobal, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpPop),
+			},
+		},
+		{
+			// 断言全局函数在编译函数体之前定义名称，函数体可以递归引用自身
+			input: `
+			let f = fn() { f };`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.MustMake(code.OpGetGlobal, 0),
+					code.MustMake(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpSetGlobal, 0),
 			},
 		},
 		{
@@ -669,15 +686,15 @@ func TestLetStatementScopes(t *testing.T) {
 				55,
 				// 函数体，编译结束后会将其添加到constants中
 				[]code.Instructions{
-					code.Make(code.OpConstant, 0),
-					code.Make(code.OpSetLocal, 0),
-					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpConstant, 0),
+					code.MustMake(code.OpSetLocal, 0),
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpReturnValue),
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
@@ -692,19 +709,230 @@ func TestLetStatementScopes(t *testing.T) {
 				55,
 				77,
 				[]code.Instructions{
-					code.Make(code.OpConstant, 0),
-					code.Make(code.OpSetLocal, 0),
-					code.Make(code.OpConstant, 1),
-					code.Make(code.OpSetLocal, 1),
-					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpGetLocal, 1),
-					code.Make(code.OpAdd),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpConstant, 0),
+					code.MustMake(code.OpSetLocal, 0),
+					code.MustMake(code.OpConstant, 1),
+					code.MustMake(code.OpSetLocal, 1),
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpGetLocal, 1),
+					code.MustMake(code.OpAdd),
+					code.MustMake(code.OpReturnValue),
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// 断言引用外层函数的局部变量产生自由变量，创建函数时生成OpClosure
+			input: `
+			fn(a) {
+				fn(b) { a + b }
+			}`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.MustMake(code.OpGetFree, 0),
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpAdd),
+					code.MustMake(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpClosure, 0, 1),
+					code.MustMake(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpPop),
+			},
+		},
+		{
+			// 断言多层嵌套时自由变量逐层传递
+			input: `
+			fn(a) {
+				fn(b) {
+					fn(c) { a + b + c }
+				}
+			}`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.MustMake(code.OpGetFree, 0),
+					code.MustMake(code.OpGetFree, 1),
+					code.MustMake(code.OpAdd),
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpAdd),
+					code.MustMake(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.MustMake(code.OpGetFree, 0),
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpClosure, 0, 2),
+					code.MustMake(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpClosure, 1, 1),
+					code.MustMake(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestFunctionStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// 断言全局函数声明通过全局变量递归调用自身，声明执行之前全局变量保存尚未声明的函数名
+			input: `fn f() { f() }`,
+			expectedConstants: []interface{}{
+				&object.Hoisted{Name: "f"},
+				[]code.Instructions{
+					code.MustMake(code.OpGetGlobal, 0),
+					code.MustMake(code.OpCall, 0),
+					code.MustMake(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpSetGlobal, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpSetGlobal, 0),
+			},
+		},
+		{
+			// 断言局部函数通过OpCurrentClosure递归调用自身
+			input: `
+			fn() {
+				let f = fn() { f() };
+			}`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.MustMake(code.OpCurrentClosure),
+					code.MustMake(code.OpCall, 0),
+					code.MustMake(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.MustMake(code.OpConstant, 0),
+					code.MustMake(code.OpSetLocal, 0),
+					code.MustMake(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpPop),
+			},
+		},
+		{
+			// 断言引用之后声明的局部函数时先捕获尚未声明的函数名，在其声明之后用OpSetFree回填
+			input: `
+			fn() {
+				fn a() { b() }
+				fn b() { a() }
+			}`,
+			expectedConstants: []interface{}{
+				&object.Hoisted{Name: "b"},
+				[]code.Instructions{
+					code.MustMake(code.OpGetFree, 0),
+					code.MustMake(code.OpCall, 0),
+					code.MustMake(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.MustMake(code.OpGetFree, 0),
+					code.MustMake(code.OpCall, 0),
+					code.MustMake(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.MustMake(code.OpConstant, 0),
+					code.MustMake(code.OpClosure, 1, 1),
+					code.MustMake(code.OpSetLocal, 0),
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpClosure, 2, 1),
+					code.MustMake(code.OpSetLocal, 1),
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpGetLocal, 1),
+					code.MustMake(code.OpSetFree, 0),
+					code.MustMake(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MustMake(code.OpConstant, 3),
+				code.MustMake(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`f(); fn f() {}`, "function f is used before its declaration"},
+		{`fn() { let g = fn() { h() }; g(); fn h() {} }`, ""},
+		{`fn() { map([], fn() { h() }); fn h() {} }`, "function h is used before its declaration"},
+		{`fn() { export fn f() {} }`, "export is only allowed at top level: f"},
+	}
+	for _, tt := range errorTests {
+		err := NewCompiler().Compile(parse(tt.input))
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("unexpected compiler error for %q: %s", tt.input, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong compiler error for %q. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			len([]);
+			push([], 1);`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.MustMake(code.OpGetBuiltin, 0),
+				code.MustMake(code.OpArray, 0),
+				code.MustMake(code.OpCall, 1),
+				code.MustMake(code.OpPop),
+				code.MustMake(code.OpGetBuiltin, 5),
+				code.MustMake(code.OpArray, 0),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpCall, 2),
+				code.MustMake(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { len([]) }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.MustMake(code.OpGetBuiltin, 0),
+					code.MustMake(code.OpArray, 0),
+					code.MustMake(code.OpCall, 1),
+					code.MustMake(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpPop),
 			},
 		},
 	}
@@ -790,6 +1018,36 @@ func testConstants(expected []interface{}, actual []object.Object) error {
 				return fmt.Errorf("constant %d - testStringObject failed, error:%s",
 					i, err)
 			}
+		case []string:
+			arr, ok := actual[i].(*object.Array)
+			if !ok || arr.Len() != len(constant) {
+				return fmt.Errorf("constant %d - not an array of %d strings:%s", i, len(constant), actual[i].Inspect())
+			}
+			for j, el := range arr.Elements() {
+				err := testStringObject(constant[j], el)
+				if err != nil {
+					return fmt.Errorf("constant %d - element %d testStringObject failed, error:%s", i, j, err)
+				}
+			}
+		case map[int]int:
+			hash, ok := actual[i].(*object.Hash)
+			if !ok || hash.Len() != len(constant) {
+				return fmt.Errorf("constant %d - not a hash of %d pairs:%s", i, len(constant), actual[i].Inspect())
+			}
+			for key, value := range constant {
+				pair, ok := hash.Get(&object.Integer{Value: int64(key)})
+				if !ok {
+					return fmt.Errorf("constant %d - no pair for key %d", i, key)
+				}
+				err := testIntegerObject(int64(value), pair.Value)
+				if err != nil {
+					return fmt.Errorf("constant %d - value for key %d testIntegerObject failed, error:%s", i, key, err)
+				}
+			}
+		case *object.Hoisted:
+			if !constant.Equal(actual[i]) {
+				return fmt.Errorf("constant %d - wrong hoisted function. got=%s, want=%s", i, actual[i].Inspect(), constant.Inspect())
+			}
 		case []code.Instructions:
 			fn, ok := actual[i].(*object.CompiledFunction)
 			if !ok {
@@ -812,6 +1070,7 @@ func runCompilerTests(t *testing.T, tests []compilerTestCase) {
 		program := parse(tt.input)
 
 		compiler := NewCompiler()
+		compiler.SetOptimize(false)
 		err := compiler.Compile(program)
 		if err != nil {
 			t.Fatalf(" compiler error: %s", err)
@@ -831,3 +1090,601 @@ func runCompilerTests(t *testing.T, tests []compilerTestCase) {
 	}
 	// bpf.Instruction
 }
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []code.Instructions
+		expected []code.Instructions
+	}{
+		{
+			name: "specialized locals and calls",
+			input: []code.Instructions{
+				code.MustMake(code.OpGetLocal, 0),
+				code.MustMake(code.OpGetLocal, 3),
+				code.MustMake(code.OpGetLocal, 4),
+				code.MustMake(code.OpCall, 2),
+				code.MustMake(code.OpCall, 4),
+			},
+			expected: []code.Instructions{
+				code.MustMake(code.OpGetLocal0),
+				code.MustMake(code.OpGetLocal3),
+				code.MustMake(code.OpGetLocal, 4),
+				code.MustMake(code.OpCall2),
+				code.MustMake(code.OpCall, 4),
+			},
+		},
+		{
+			name: "constant addition",
+			input: []code.Instructions{
+				code.MustMake(code.OpGetGlobal, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpAdd),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpSub),
+			},
+			expected: []code.Instructions{
+				code.MustMake(code.OpGetGlobal, 0),
+				code.MustMake(code.OpAddConst, 1),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpSub),
+			},
+		},
+		{
+			// if (1 == 2) { 3 }; 4
+			name: "comparison followed by conditional jump",
+			input: []code.Instructions{
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpEqual),
+				code.MustMake(code.OpJumpNotTruthy, 16),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpJump, 17),
+				code.MustMake(code.OpNull),
+				code.MustMake(code.OpPop),
+				code.MustMake(code.OpConstant, 3),
+				code.MustMake(code.OpPop),
+			},
+			expected: []code.Instructions{
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpJumpIfFalseCompare, int(code.OpEqual), 16),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpJump, 17),
+				code.MustMake(code.OpNull),
+				code.MustMake(code.OpPop),
+				code.MustMake(code.OpConstant, 3),
+				code.MustMake(code.OpPop),
+			},
+		},
+		{
+			// fn(a, b) { if (a) { b } else { a } }，指令变短后跳转目标随之前移
+			name: "jump targets are relocated",
+			input: []code.Instructions{
+				code.MustMake(code.OpGetLocal, 0),
+				code.MustMake(code.OpJumpNotTruthy, 10),
+				code.MustMake(code.OpGetLocal, 1),
+				code.MustMake(code.OpJump, 12),
+				code.MustMake(code.OpGetLocal, 0),
+				code.MustMake(code.OpReturnValue),
+			},
+			expected: []code.Instructions{
+				code.MustMake(code.OpGetLocal0),
+				code.MustMake(code.OpJumpNotTruthy, 8),
+				code.MustMake(code.OpGetLocal1),
+				code.MustMake(code.OpJump, 9),
+				code.MustMake(code.OpGetLocal0),
+				code.MustMake(code.OpReturnValue),
+			},
+		},
+		{
+			// 1 + if (true) { 2 } else { 3 }，OpAdd是跳转目标，不能与前面的常量合并
+			name: "jump target is not fused",
+			input: []code.Instructions{
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpTrue),
+				code.MustMake(code.OpJumpNotTruthy, 13),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpJump, 16),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpAdd),
+				code.MustMake(code.OpPop),
+			},
+			expected: []code.Instructions{
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpTrue),
+				code.MustMake(code.OpJumpNotTruthy, 13),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpJump, 16),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpAdd),
+				code.MustMake(code.OpPop),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		input := code.Instructions{}
+		for _, ins := range tt.input {
+			input = append(input, ins...)
+		}
+
+		optimized, _, err := assemble(optimize(decodeInstructions(input)), len(input))
+		if err != nil {
+			t.Fatalf("%s: assemble failed: %s", tt.name, err)
+		}
+
+		err = testInstructions(tt.expected, optimized)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+		}
+	}
+}
+
+func TestCompileOptimized(t *testing.T) {
+	program := parse(`let add = fn(a, b) { a + b + 1 }; add(1, 2)`)
+
+	compiler := NewCompiler()
+	err := compiler.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+
+	err = testInstructions([]code.Instructions{
+		code.MustMake(code.OpConstant, 1),
+		code.MustMake(code.OpSetGlobal, 0),
+		code.MustMake(code.OpGetGlobal, 0),
+		code.MustMake(code.OpConstant, 2),
+		code.MustMake(code.OpConstant, 3),
+		code.MustMake(code.OpCall2),
+		code.MustMake(code.OpPop),
+	}, bytecode.Instructions)
+	if err != nil {
+		t.Errorf("wrong main instructions: %s", err)
+	}
+
+	err = testConstants([]interface{}{
+		1,
+		[]code.Instructions{
+			code.MustMake(code.OpGetLocal0),
+			code.MustMake(code.OpGetLocal1),
+			code.MustMake(code.OpAdd),
+			code.MustMake(code.OpAddConst, 0),
+			code.MustMake(code.OpReturnValue),
+		},
+		1,
+		2,
+	}, bytecode.Constants)
+	if err != nil {
+		t.Errorf("wrong constants: %s", err)
+	}
+}
+
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn(a, b = 2) { a + b }`,
+			expectedConstants: []interface{}{
+				2,
+				[]code.Instructions{
+					code.MustMake(code.OpConstant, 0),
+					code.MustMake(code.OpSetLocal, 1),
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpGetLocal, 1),
+					code.MustMake(code.OpAdd),
+					code.MustMake(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpPop),
+			},
+		},
+		{
+			input: `fn(a, ...rest) { rest }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.MustMake(code.OpGetLocal, 1),
+					code.MustMake(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpPop),
+			},
+		},
+		{
+			input:             `len(1, ...[2], 3)`,
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.MustMake(code.OpGetBuiltin, 0),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpArray, 1),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpArray, 1),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpArray, 1),
+				code.MustMake(code.OpCallSpread, 3),
+				code.MustMake(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `let [a, ...b] = [1, 2];`,
+			expectedConstants: []interface{}{1, 2, 0},
+			expectedInstructions: []code.Instructions{
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpArray, 2),
+				code.MustMake(code.OpDestructureArray, 1, 1),
+				code.MustMake(code.OpDup),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpIndex),
+				code.MustMake(code.OpSetGlobal, 0),
+				code.MustMake(code.OpDup),
+				code.MustMake(code.OpArrayRest, 1),
+				code.MustMake(code.OpSetGlobal, 1),
+				code.MustMake(code.OpPop),
+			},
+		},
+		{
+			input: `fn(h) { let {x, y: z} = h; z }`,
+			expectedConstants: []interface{}{
+				[]string{"x", "y"},
+				"x",
+				"y",
+				[]code.Instructions{
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpDestructureHash, 0),
+					code.MustMake(code.OpDup),
+					code.MustMake(code.OpConstant, 1),
+					code.MustMake(code.OpIndex),
+					code.MustMake(code.OpSetLocal, 1),
+					code.MustMake(code.OpDup),
+					code.MustMake(code.OpConstant, 2),
+					code.MustMake(code.OpIndex),
+					code.MustMake(code.OpSetLocal, 2),
+					code.MustMake(code.OpPop),
+					code.MustMake(code.OpGetLocal, 2),
+					code.MustMake(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.MustMake(code.OpConstant, 3),
+				code.MustMake(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConstants(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedError    string
+		expectedWarnings []string
+	}{
+		{"const a = 1; let b = a;", "", []string{}},
+		{"const a = 1; let a = 2;", "cannot redefine constant a", []string{}},
+		{"const a = 1; const a = 2;", "cannot redefine constant a", []string{}},
+		{"const a = 1; fn a() {}", "cannot redefine constant a", []string{}},
+		{"const [a, {b}] = [1, {}]; let {b} = {};", "cannot redefine constant b", []string{}},
+		{"fn() { const f = fn() { 1 }; let f = 2; }", "cannot redefine constant f", []string{}},
+		// 内层作用域中的同名变量遮蔽常量，不是重新定义
+		{"const a = 1; fn(a) { let b = fn() { let a = 2; a }; a }", "", []string{}},
+		// match分支中的变量定义在分支的块作用域中
+		{"const a = 1; match (2) { a => a, _ => 0 }", "", []string{}},
+		{"let a = 1; match (2) { a => { let a = 3; a } }", "", []string{"1:35: a is already defined in this scope"}},
+		{"let a = 1;\nlet a = 2;", "", []string{"2:5: a is already defined in this scope"}},
+		{"let a = 1; const a = 2; let b = a;", "", []string{"1:18: a is already defined in this scope"}},
+		{"fn f() {} fn f() {}", "", []string{"1:14: f is already defined in this scope"}},
+		{"let f = 1; fn f() {}", "", []string{"1:15: f is already defined in this scope"}},
+		{"match ([1]) { [x] => x, x => x }", "", []string{}},
+	}
+
+	for _, tt := range tests {
+		compiler := NewCompiler()
+		err := compiler.Compile(parse(tt.input))
+		if tt.expectedError == "" && err != nil {
+			t.Errorf("unexpected compiler error for %q: %s", tt.input, err)
+			continue
+		}
+		if tt.expectedError != "" && (err == nil || err.Error() != tt.expectedError) {
+			t.Errorf("wrong compiler error for %q. want=%q, got=%v", tt.input, tt.expectedError, err)
+			continue
+		}
+
+		warnings := []string{}
+		for _, w := range compiler.Warnings() {
+			warnings = append(warnings, w.String())
+		}
+		if !reflect.DeepEqual(warnings, tt.expectedWarnings) {
+			t.Errorf("wrong warnings for %q. want=%q, got=%q", tt.input, tt.expectedWarnings, warnings)
+		}
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// 连续的字面量分支编译为跳转表，表中记录各个分支汇编后的位置
+			input:             `match (5) { 1 => 10, 2 => 20 }`,
+			expectedConstants: []interface{}{5, map[int]int{1: 14, 2: 20}, 10, 20},
+			expectedInstructions: []code.Instructions{
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpSetGlobal, 0),
+				code.MustMake(code.OpGetGlobal, 0),
+				code.MustMake(code.OpJumpTable, 1, 26),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpJump, 27),
+				code.MustMake(code.OpConstant, 3),
+				code.MustMake(code.OpJump, 27),
+				code.MustMake(code.OpNull),
+				code.MustMake(code.OpPop),
+			},
+		},
+		{
+			input:             `match (1) { 1 => 2, n => n }`,
+			expectedConstants: []interface{}{1, 1, 2},
+			expectedInstructions: []code.Instructions{
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpSetGlobal, 0),
+				code.MustMake(code.OpGetGlobal, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpEqual),
+				code.MustMake(code.OpJumpNotTruthy, 22),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpJump, 35),
+				code.MustMake(code.OpGetGlobal, 0),
+				code.MustMake(code.OpSetGlobal, 1),
+				code.MustMake(code.OpGetGlobal, 1),
+				code.MustMake(code.OpJump, 35),
+				code.MustMake(code.OpNull),
+				code.MustMake(code.OpPop),
+			},
+		},
+		{
+			// 主题的临时变量在match结束后释放，之后的match复用它
+			input:             `match (1) { _ => 2 }; match (3) { _ => 4 }`,
+			expectedConstants: []interface{}{1, 2, 3, 4},
+			expectedInstructions: []code.Instructions{
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpSetGlobal, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpJump, 13),
+				code.MustMake(code.OpNull),
+				code.MustMake(code.OpPop),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpSetGlobal, 0),
+				code.MustMake(code.OpConstant, 3),
+				code.MustMake(code.OpJump, 27),
+				code.MustMake(code.OpNull),
+				code.MustMake(code.OpPop),
+			},
+		},
+		{
+			input: `fn(v) { match (v) { [_, 1] if v => 0 } }`,
+			expectedConstants: []interface{}{1, 1, 0, []code.Instructions{
+				code.MustMake(code.OpGetLocal, 0),
+				code.MustMake(code.OpSetLocal, 1),
+				code.MustMake(code.OpGetLocal, 1),
+				code.MustMake(code.OpMatchArray, 2, 0),
+				code.MustMake(code.OpJumpNotTruthy, 37),
+				code.MustMake(code.OpGetLocal, 1),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpIndex),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpEqual),
+				code.MustMake(code.OpJumpNotTruthy, 37),
+				code.MustMake(code.OpGetLocal, 0),
+				code.MustMake(code.OpJumpNotTruthy, 37),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpJump, 38),
+				code.MustMake(code.OpNull),
+				code.MustMake(code.OpReturnValue),
+			}},
+			expectedInstructions: []code.Instructions{
+				code.MustMake(code.OpConstant, 3),
+				code.MustMake(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+
+	warningTests := []struct {
+		input    string
+		expected []string
+	}{
+		{"match (1) { 1 => 2 }", []string{"1:1: " + NonExhaustiveMatch}},
+		{"let x = 1;\nfn() { match (x) { n if n > 0 => n } }", []string{"2:8: " + NonExhaustiveMatch}},
+		{"match (1) { 1 => 2, _ => 3 }", []string{}},
+		{"match (1 > 0) { true => 1, false => 0 }", []string{}},
+	}
+
+	for _, tt := range warningTests {
+		compiler := NewCompiler()
+		err := compiler.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		warnings := []string{}
+		for _, w := range compiler.Warnings() {
+			warnings = append(warnings, w.String())
+		}
+		if !reflect.DeepEqual(warnings, tt.expected) {
+			t.Errorf("wrong warnings for %q. want=%q, got=%q", tt.input, tt.expected, warnings)
+		}
+	}
+}
+
+func TestMatchArmScope(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"match (1) { y => y }; y", "undefined variable:y\n"},
+		{"match ([1]) { [y] if y > 0 => y, _ => 0 }; y", "undefined variable:y\n"},
+		{"match (1) { 1 => { let z = 2; z }, _ => 0 }; z", "undefined variable:z\n"},
+		{"let y = 1; match (2) { y => y }; y", ""},
+		{"fn() { match (1) { y => y }; y }", "undefined variable:y\n"},
+	}
+
+	for _, tt := range tests {
+		err := NewCompiler().Compile(parse(tt.input))
+		if tt.expectedError == "" && err != nil {
+			t.Errorf("unexpected compiler error for %q: %s", tt.input, err)
+			continue
+		}
+		if tt.expectedError != "" && (err == nil || err.Error() != tt.expectedError) {
+			t.Errorf("wrong compiler error for %q. want=%q, got=%v", tt.input, tt.expectedError, err)
+		}
+	}
+}
+
+func TestFunctionEntries(t *testing.T) {
+	tests := []struct {
+		input            string
+		optimize         bool
+		expectedEntries  []int
+		expectedRequired int
+		expectedVariadic bool
+	}{
+		{`fn(a, b) { a }`, false, nil, 2, false},
+		{`fn(a, b = 2) { a + b }`, false, []int{0, 5}, 1, false},
+		{`fn(a, ...rest) { a }`, true, nil, 1, true},
+		// 默认值中的跳转在汇编时缩短，入口随之前移
+		{`fn(a, b = if (a) { 1 } else { 2 }, c = 3) { c }`, false, []int{0, 16, 21}, 1, false},
+		{`fn(a, b = if (a) { 1 } else { 2 }, c = 3) { c }`, true, []int{0, 15, 20}, 1, false},
+		{`fn(a = 1, ...rest) { rest }`, true, []int{0, 5}, 0, true},
+	}
+
+	for _, tt := range tests {
+		compiler := NewCompiler()
+		compiler.SetOptimize(tt.optimize)
+		if err := compiler.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		constants := compiler.Bytecode().Constants
+		fn := constants[len(constants)-1].(*object.CompiledFunction)
+		if !reflect.DeepEqual(fn.Entries, tt.expectedEntries) {
+			t.Errorf("wrong entries for %q. want=%v, got=%v\n%s", tt.input, tt.expectedEntries, fn.Entries, fn.Instructions)
+		}
+		if fn.NumRequired() != tt.expectedRequired || fn.Variadic != tt.expectedVariadic {
+			t.Errorf("wrong signature for %q. got required=%d, variadic=%t",
+				tt.input, fn.NumRequired(), fn.Variadic)
+		}
+	}
+
+	compiler := NewCompiler()
+	if err := compiler.Compile(parse(`let add = fn(a, b) { a + b }; fn() {}`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	constants := compiler.Bytecode().Constants
+	if name := constants[0].(*object.CompiledFunction).Name; name != "add" {
+		t.Errorf("function bound by let has wrong name %q", name)
+	}
+	if name := constants[1].(*object.CompiledFunction).Name; name != "" {
+		t.Errorf("anonymous function has name %q", name)
+	}
+}
+
+func TestWideOperands(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string // 反汇编结果中应当出现的指令，函数体的指令在常量中查找
+	}{
+		{
+			name:     "more than 255 locals",
+			input:    fmt.Sprintf("fn() { %s; %s }", repeat("let %s = true", 300, "; "), identifier(299)),
+			expected: []string{"OpWide OpSetLocal 256", "OpWide OpGetLocal 299"},
+		},
+		{
+			name:     "more than 255 arguments",
+			input:    fmt.Sprintf("len(%s)", repeat("%d", 300, ", ")),
+			expected: []string{"OpWide OpCall 300"},
+		},
+		{
+			name:     "more than 65535 constants",
+			input:    repeat("%d", 70000, "; "),
+			expected: []string{"OpConstant 65535", "OpWide OpConstant 65536", "OpWide OpConstant 69999"},
+		},
+		{
+			name:     "jump over more than 64 KiB",
+			input:    fmt.Sprintf("if (false) { %s } else { 1 }", repeat("true", 40000, "; ")),
+			expected: []string{"OpWide OpJumpNotTruthy 80012", "OpWide OpJump 80015"},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, optimize := range []bool{false, true} {
+			compiler := NewCompiler()
+			compiler.SetOptimize(optimize)
+			err := compiler.Compile(parse(tt.input))
+			if err != nil {
+				t.Fatalf("%s: compiler error: %s", tt.name, err)
+			}
+
+			bytecode := compiler.Bytecode()
+			disassembled := bytecode.Instructions.String()
+			for _, constant := range bytecode.Constants {
+				if fn, ok := constant.(*object.CompiledFunction); ok {
+					disassembled += fn.Instructions.String()
+				}
+			}
+
+			for _, want := range tt.expected {
+				if !strings.Contains(disassembled, want) {
+					t.Errorf("%s (optimize=%t): instructions do not contain %q", tt.name, optimize, want)
+				}
+			}
+		}
+	}
+}
+
+func TestOperandOutOfRange(t *testing.T) {
+	compiler := NewCompiler()
+	compiler.emit(code.OpConstant, 1<<32)
+
+	err := compiler.Compile(parse("1"))
+	expected := "program exceeds bytecode limits: operand 0 of OpConstant out of range: 4294967296 does not fit in 4 byte(s)"
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%v", expected, err)
+	}
+}
+
+// repeat 将format按下标0到n-1格式化后用sep连接，%d替换为下标，%s替换为由下标生成的标识符
+func repeat(format string, n int, sep string) string {
+	parts := make([]string, n)
+	for i := range parts {
+		switch {
+		case strings.Contains(format, "%d"):
+			parts[i] = fmt.Sprintf(format, i)
+		case strings.Contains(format, "%s"):
+			parts[i] = fmt.Sprintf(format, identifier(i))
+		default:
+			parts[i] = format
+		}
+	}
+	return strings.Join(parts, sep)
+}
+
+// identifier 返回第i个只由字母组成的标识符：xa, xb, ..., xz, xba, ...，前缀x避免与关键字冲突
+func identifier(i int) string {
+	name := string(rune('a' + i%26))
+	for i /= 26; i > 0; i /= 26 {
+		name = string(rune('a'+i%26)) + name
+	}
+	return "x" + name
+}
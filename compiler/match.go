@@ -0,0 +1,272 @@
+package compiler
+
+import (
+	"github.com/nicolerobin/monkey/ast"
+	"github.com/nicolerobin/monkey/code"
+	"github.com/nicolerobin/monkey/object"
+)
+
+// NonExhaustiveMatch match表达式可能没有分支匹配时的警告信息
+const NonExhaustiveMatch = "match is not exhaustive: add a `_` arm to handle the remaining values"
+
+// jumpTable OpJumpTable使用的跳转表，targets为各个键对应分支在作用域原指令序列中的位置，
+// 汇编后才知道最终位置，因此此时才写入哈希表常量
+type jumpTable struct {
+	hash    *object.Hash
+	keys    []object.Object
+	targets []int
+}
+
+// relocate 按汇编得到的位置映射写入各个键的跳转目标
+func (t *jumpTable) relocate(offsets map[int]int) {
+	for i, key := range t.keys {
+		t.hash.Set(key, &object.Integer{Value: int64(offsets[t.targets[i]])})
+	}
+}
+
+// compileMatch 编译match表达式。主题的值保存在临时变量中，连续两个以上没有守卫的字面量分支编译为
+// 一条OpJumpTable，其余分支依次测试模式和守卫，不匹配时跳到下一个分支，全部不匹配时结果为null。
+// 每个分支拥有自己的块作用域，模式中的变量只在该分支中可见。编译完全部分支后释放临时变量
+func (c *Compiler) compileMatch(node *ast.MatchExpression) error {
+	if !node.Exhaustive() {
+		c.warn(node.Token, NonExhaustiveMatch)
+	}
+
+	err := c.Compile(node.Subject)
+	if err != nil {
+		return err
+	}
+	subject := c.symbolTable.DefineTemporary()
+	c.storeSymbol(subject)
+
+	var ends []int
+	for i := 0; i < len(node.Arms); {
+		if n := literalArms(node.Arms[i:]); n >= 2 {
+			jumps, err := c.compileJumpTable(subject, node.Arms[i:i+n])
+			if err != nil {
+				return err
+			}
+			ends = append(ends, jumps...)
+			i += n
+			continue
+		}
+
+		end, err := c.compileMatchArm(subject, node.Arms[i])
+		if err != nil {
+			return err
+		}
+		ends = append(ends, end)
+		i++
+	}
+	c.emit(code.OpNull)
+	c.symbolTable.ReleaseTemporary(subject)
+
+	afterMatchPos := len(c.currentInstructions())
+	for _, pos := range ends {
+		c.changeOperand(pos, afterMatchPos)
+	}
+	return nil
+}
+
+// literalArms 返回arms开头连续的没有守卫的字面量分支的个数
+func literalArms(arms []*ast.MatchArm) int {
+	for i, arm := range arms {
+		if arm.Guard != nil || literalValue(arm.Pattern) == nil {
+			return i
+		}
+	}
+	return len(arms)
+}
+
+// literalValue 返回字面量模式对应的值，其他模式返回nil
+func literalValue(pattern ast.Pattern) object.Object {
+	switch pattern := pattern.(type) {
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: pattern.Value}
+	case *ast.StringLiteral:
+		return &object.String{Value: pattern.Value}
+	case *ast.Boolean:
+		return &object.Boolean{Value: pattern.Value}
+	default:
+		return nil
+	}
+}
+
+// compileJumpTable 将一组字面量分支编译为跳转表，表中没有的值跳到这组分支之后。
+// 重复的字面量只有第一个分支可能匹配，之后的分支不再编译。返回各个分支结束时跳到match之后的跳转指令的位置
+func (c *Compiler) compileJumpTable(subject Symbol, arms []*ast.MatchArm) ([]int, error) {
+	table := &jumpTable{hash: object.NewHash()}
+	index := c.addConstant(table.hash)
+	c.scopes[c.scopeIndex].tables = append(c.scopes[c.scopeIndex].tables, table)
+
+	c.loadSymbol(subject)
+	jumpTablePos := c.emitJumpTable(index, 0)
+
+	seen := map[object.HashKey]bool{}
+	var ends []int
+	for _, arm := range arms {
+		key := literalValue(arm.Pattern)
+		hashKey := key.(object.Hashable).HashKey()
+		if seen[hashKey] {
+			continue
+		}
+		seen[hashKey] = true
+
+		table.keys = append(table.keys, key)
+		table.targets = append(table.targets, len(c.currentInstructions()))
+		c.enterBlock()
+		err := c.compileArmBody(arm.Body)
+		c.leaveBlock()
+		if err != nil {
+			return nil, err
+		}
+		ends = append(ends, c.emitJump(code.OpJump))
+	}
+
+	c.replaceInstruction(jumpTablePos, c.makeJumpTable(index, len(c.currentInstructions())))
+	return ends, nil
+}
+
+// emitJumpTable 与emitJump相同，先使用OpWide前缀的形式生成找不到时的跳转目标待回填的OpJumpTable
+func (c *Compiler) emitJumpTable(index, defaultPos int) int {
+	pos := c.addInstruction(c.makeJumpTable(index, defaultPos))
+
+	c.setLastInstruction(code.OpJumpTable, pos)
+
+	return pos
+}
+
+// makeJumpTable 编码OpWide前缀的OpJumpTable
+func (c *Compiler) makeJumpTable(index, defaultPos int) []byte {
+	ins, err := code.MakeWide(code.OpJumpTable, index, defaultPos)
+	if err != nil {
+		c.fail(err)
+	}
+	return ins
+}
+
+// compileMatchArm 编译单个分支：测试模式，在分支的块作用域中绑定模式中的变量，再测试守卫。
+// 返回分支结束时跳到match之后的跳转指令的位置
+func (c *Compiler) compileMatchArm(subject Symbol, arm *ast.MatchArm) (int, error) {
+	fails, err := c.matchPattern(arm.Pattern, func() { c.loadSymbol(subject) })
+	if err != nil {
+		return 0, err
+	}
+
+	c.enterBlock()
+	end, guardFails, err := c.compileArmBlock(subject, arm)
+	c.leaveBlock()
+	if err != nil {
+		return 0, err
+	}
+	fails = append(fails, guardFails...)
+
+	nextArmPos := len(c.currentInstructions())
+	for _, pos := range fails {
+		c.changeOperand(pos, nextArmPos)
+	}
+	return end, nil
+}
+
+// compileArmBlock 在分支的块作用域中绑定变量、测试守卫并编译代码块，
+// 返回分支结束时的跳转指令和守卫不成立时的跳转指令的位置
+func (c *Compiler) compileArmBlock(subject Symbol, arm *ast.MatchArm) (int, []int, error) {
+	var fails []int
+	if len(ast.PatternNames(arm.Pattern)) > 0 {
+		c.loadSymbol(subject)
+		err := c.destructure(arm.Pattern, matchBinding)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if arm.Guard != nil {
+		err := c.Compile(arm.Guard)
+		if err != nil {
+			return 0, nil, err
+		}
+		fails = append(fails, c.emitJump(code.OpJumpNotTruthy))
+	}
+
+	err := c.compileArmBody(arm.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+	return c.emitJump(code.OpJump), fails, nil
+}
+
+// matchPattern 生成测试load压入的值能否匹配pattern的指令，返回不匹配时的跳转指令的位置。
+// 变量和_匹配任意值，不生成指令
+func (c *Compiler) matchPattern(pattern ast.Pattern, load func()) ([]int, error) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		return nil, nil
+	case *ast.ArrayPattern:
+		variadic := 0
+		if pattern.Rest != nil {
+			variadic = 1
+		}
+		load()
+		c.emit(code.OpMatchArray, len(pattern.Elements), variadic)
+		fails := []int{c.emitJump(code.OpJumpNotTruthy)}
+
+		for i, el := range pattern.Elements {
+			i := i
+			elFails, err := c.matchPattern(el, func() {
+				load()
+				c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: int64(i)}))
+				c.emit(code.OpIndex)
+			})
+			if err != nil {
+				return nil, err
+			}
+			fails = append(fails, elFails...)
+		}
+		return fails, nil
+	case *ast.HashPattern:
+		keys := make([]object.Object, len(pattern.Pairs))
+		for i, pair := range pattern.Pairs {
+			keys[i] = &object.String{Value: pair.Key.Value}
+		}
+		load()
+		c.emit(code.OpMatchHash, c.addConstant(object.NewArray(keys)))
+		fails := []int{c.emitJump(code.OpJumpNotTruthy)}
+
+		for _, pair := range pattern.Pairs {
+			key := pair.Key.Value
+			valueFails, err := c.matchPattern(pair.Value, func() {
+				load()
+				c.emit(code.OpConstant, c.addConstant(&object.String{Value: key}))
+				c.emit(code.OpIndex)
+			})
+			if err != nil {
+				return nil, err
+			}
+			fails = append(fails, valueFails...)
+		}
+		return fails, nil
+	default:
+		// 字面量模式：与值比较是否相等
+		load()
+		err := c.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		c.emit(code.OpEqual)
+		return []int{c.emitJump(code.OpJumpNotTruthy)}, nil
+	}
+}
+
+// compileArmBody 编译分支的代码块，将其值留在栈上，代码块不以表达式结束时值为null
+func (c *Compiler) compileArmBody(body *ast.BlockStatement) error {
+	err := c.Compile(body)
+	if err != nil {
+		return err
+	}
+	if endsWithExpression(body) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package compiler
+
+import "github.com/nicolerobin/monkey/code"
+
+// instruction 解码后的单条指令
+type instruction struct {
+	op       code.Opcode
+	operands []int
+	offset   int // 在原指令序列中的位置
+}
+
+// decodeInstructions 将指令序列解码为指令列表，OpWide前缀与其后的指令解码为一条指令
+func decodeInstructions(ins code.Instructions) []instruction {
+	var decoded []instruction
+	for i := 0; i < len(ins); {
+		offset := i
+		op := code.Opcode(ins[i])
+		read := code.ReadOperands
+		if op == code.OpWide {
+			i++
+			op = code.Opcode(ins[i])
+			read = code.ReadWideOperands
+		}
+
+		def, err := code.Lookup(byte(op))
+		if err != nil {
+			panic(err)
+		}
+		operands, n := read(def, ins[i+1:])
+		decoded = append(decoded, instruction{op: op, operands: operands, offset: offset})
+		i += 1 + n
+	}
+	return decoded
+}
+
+// jumpOperand 返回跳转指令的目标地址在操作数中的下标，非跳转指令返回-1
+func jumpOperand(op code.Opcode) int {
+	switch op {
+	case code.OpJump, code.OpJumpNotTruthy:
+		return 0
+	case code.OpJumpIfFalseCompare, code.OpJumpTable:
+		return 1
+	default:
+		return -1
+	}
+}
+
+func isComparison(op code.Opcode) bool {
+	return op == code.OpEqual || op == code.OpNotEqual || op == code.OpGreaterThan
+}
+
+// optimize 窥孔优化：将常见的指令和指令序列替换为特化的超级指令。
+// 被合并的第二条指令是跳转目标或函数入口entries时不做合并，以免跳转落到合并后的指令中间
+func optimize(decoded []instruction, entries ...int) []instruction {
+	targets := make(map[int]bool)
+	for _, entry := range entries {
+		targets[entry] = true
+	}
+	for _, in := range decoded {
+		if i := jumpOperand(in.op); i >= 0 {
+			targets[in.operands[i]] = true
+		}
+	}
+
+	optimized := make([]instruction, 0, len(decoded))
+	for i := 0; i < len(decoded); i++ {
+		in := decoded[i]
+
+		var next *instruction
+		if i+1 < len(decoded) && !targets[decoded[i+1].offset] {
+			next = &decoded[i+1]
+		}
+
+		switch {
+		case in.op == code.OpGetLocal && in.operands[0] < 4:
+			in = instruction{op: code.OpGetLocal0 + code.Opcode(in.operands[0]), offset: in.offset}
+		case in.op == code.OpCall && in.operands[0] < 4:
+			in = instruction{op: code.OpCall0 + code.Opcode(in.operands[0]), offset: in.offset}
+		case in.op == code.OpConstant && next != nil && next.op == code.OpAdd:
+			in = instruction{op: code.OpAddConst, operands: in.operands, offset: in.offset}
+			i++
+		case isComparison(in.op) && next != nil && next.op == code.OpJumpNotTruthy:
+			in = instruction{op: code.OpJumpIfFalseCompare, operands: []int{int(in.op), next.operands[0]}, offset: in.offset}
+			i++
+		}
+		optimized = append(optimized, in)
+	}
+
+	return optimized
+}
+
+// assemble 将指令列表编码为指令序列，并把跳转目标从原位置映射到新位置，end为原指令序列的长度，
+// 同时返回原位置到新位置的映射。操作数超出定义的宽度时使用OpWide前缀；
+// 跳转变宽会使后面的指令后移，因此重复计算直到不再有跳转需要变宽
+func assemble(decoded []instruction, end int) (code.Instructions, map[int]int, error) {
+	wide := make([]bool, len(decoded))
+	for i, in := range decoded {
+		wide[i] = jumpOperand(in.op) < 0 && !code.Fits(in.op, in.operands...)
+	}
+
+	// 原位置到新位置的映射，跳转目标可能是指令序列的末尾
+	offsets := make(map[int]int, len(decoded)+1)
+	for {
+		position := 0
+		for i, in := range decoded {
+			offsets[in.offset] = position
+			position += instructionLen(in, wide[i])
+		}
+		offsets[end] = position
+
+		changed := false
+		for i, in := range decoded {
+			if wide[i] || jumpOperand(in.op) < 0 {
+				continue
+			}
+			if !code.Fits(in.op, relocate(in, offsets)...) {
+				wide[i], changed = true, true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+
+	result := make(code.Instructions, 0, offsets[end])
+	for i, in := range decoded {
+		operands := relocate(in, offsets)
+		encode := code.Make
+		if wide[i] {
+			encode = code.MakeWide
+		}
+		ins, err := encode(in.op, operands...)
+		if err != nil {
+			return nil, nil, err
+		}
+		result = append(result, ins...)
+	}
+	return result, offsets, nil
+}
+
+// instructionLen 返回指令编码后的长度
+func instructionLen(in instruction, wide bool) int {
+	if wide {
+		return 2 + code.WideOperandWidth*len(in.operands)
+	}
+	def, _ := code.Lookup(byte(in.op))
+	n := 1
+	for _, w := range def.OperandWidths {
+		n += w
+	}
+	return n
+}
+
+// relocate 返回跳转目标映射到新位置后的操作数
+func relocate(in instruction, offsets map[int]int) []int {
+	j := jumpOperand(in.op)
+	if j < 0 {
+		return in.operands
+	}
+	operands := make([]int, len(in.operands))
+	copy(operands, in.operands)
+	operands[j] = offsets[operands[j]]
+	return operands
+}
@@ -0,0 +1,272 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/nicolerobin/monkey/ast"
+)
+
+// Resolver 按照编译器的作用域规则解析程序中的名称而不生成指令，给出与编译器相同的警告，
+// 并报告编译器会因名称而拒绝的错误。解释器在求值之前用它检查程序，语言服务器用它查找名称的定义和引用
+type Resolver struct {
+	// Defined 定义名称后调用，sym为分配的符号，node为定义名称的语句、函数字面量、宏字面量或match分支
+	Defined func(ident *ast.Identifier, sym Symbol, node ast.Node)
+	// Referenced 引用名称时调用，def为名称定义处的标识符，名称未定义、是内置函数或在解析之前已定义时为nil
+	Referenced func(ident, def *ast.Identifier)
+
+	table    *SymbolTable
+	defs     map[*SymbolTable]map[string]*ast.Identifier // 每个符号表中名称的定义处
+	warnings []Warning
+	errors   []Warning
+}
+
+// NewResolver 创建名称解析器，names为顶层作用域中已定义的名称，值表示是否为常量
+func NewResolver(names map[string]bool) *Resolver {
+	table := NewSymbolTable()
+	defineBuiltins(table)
+	for name, constant := range names {
+		if constant {
+			table.DefineConstant(name)
+		} else {
+			table.Define(name)
+		}
+	}
+	return &Resolver{table: table, defs: make(map[*SymbolTable]map[string]*ast.Identifier)}
+}
+
+// Warnings 返回与编译器相同的警告
+func (r *Resolver) Warnings() []Warning {
+	return r.warnings
+}
+
+// Errors 返回编译器会报告的错误，例如重新定义常量，按出现的顺序排列
+func (r *Resolver) Errors() []Warning {
+	return r.errors
+}
+
+// Lookup 返回name在当前作用域中的定义处
+func (r *Resolver) Lookup(name string) (*ast.Identifier, bool) {
+	for table := r.table; table != nil; table = table.Outer {
+		sym, ok := table.store[name]
+		if !ok || sym.Scope == FreeScope {
+			continue
+		}
+		def, ok := r.defs[table][name]
+		return def, ok
+	}
+	return nil, false
+}
+
+// Resolve 解析程序中的名称
+func (r *Resolver) Resolve(program *ast.Program) {
+	r.block(program.Statements)
+}
+
+func (r *Resolver) fail(tok *ast.Identifier, format string, a ...interface{}) {
+	r.errors = append(r.errors, Warning{Token: tok.Token, Message: fmt.Sprintf(format, a...)})
+}
+
+// check 与编译器的checkRedefinition相同，检查在当前作用域中定义ident是否重新定义了已有的名称
+func (r *Resolver) check(ident *ast.Identifier, kind binding) {
+	redefined, err := r.table.CheckRedefinition(ident.Value)
+	if err != nil {
+		r.fail(ident, "%s", err)
+		return
+	}
+	if redefined && kind != matchBinding {
+		r.warnings = append(r.warnings, Warning{Token: ident.Token, Message: fmt.Sprintf(AlreadyDefined, ident.Value)})
+	}
+}
+
+// define 检查后在当前作用域中定义ident，重新定义常量时也会定义，使之后的引用仍能找到定义处
+func (r *Resolver) define(ident *ast.Identifier, kind binding, node ast.Node) {
+	r.check(ident, kind)
+	if kind == constBinding {
+		r.defined(ident, r.table.DefineConstant(ident.Value), node)
+	} else {
+		r.defined(ident, r.table.Define(ident.Value), node)
+	}
+}
+
+// defined 记录当前作用域中ident的定义处
+func (r *Resolver) defined(ident *ast.Identifier, sym Symbol, node ast.Node) {
+	if r.defs[r.table] == nil {
+		r.defs[r.table] = make(map[string]*ast.Identifier)
+	}
+	r.defs[r.table][ident.Value] = ident
+	if r.Defined != nil {
+		r.Defined(ident, sym, node)
+	}
+}
+
+// block 与编译器一致，先提前定义语句列表中声明的函数，再依次解析各条语句
+func (r *Resolver) block(statements []ast.Statement) {
+	for _, stmt := range statements {
+		if stmt, ok := stmt.(*ast.FunctionStatement); ok {
+			r.check(stmt.Name, letBinding)
+			r.defined(stmt.Name, r.table.Hoist(stmt.Name.Value), stmt)
+		}
+	}
+	for _, stmt := range statements {
+		r.statement(stmt)
+	}
+}
+
+func (r *Resolver) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		kind := letBinding
+		if stmt.Constant {
+			kind = constBinding
+		}
+		if stmt.Pattern != nil {
+			r.expression(stmt.Value)
+			for _, name := range ast.PatternNames(stmt.Pattern) {
+				r.define(name, kind, stmt)
+			}
+			return
+		}
+
+		fn, isFunction := stmt.Value.(*ast.FunctionLiteral)
+		if !isFunction {
+			r.expression(stmt.Value)
+			r.define(stmt.Name, kind, stmt)
+			return
+		}
+		// 全局的函数先定义名称，局部函数则在函数体中以自身的名称引用自身
+		global := r.table.Outer == nil
+		if global {
+			r.define(stmt.Name, kind, stmt)
+		}
+		r.function(fn, stmt.Name)
+		if !global {
+			r.define(stmt.Name, kind, stmt)
+		}
+	case *ast.FunctionStatement:
+		r.function(stmt.Function, stmt.Name)
+		if _, ok := r.table.Declare(stmt.Name.Value); !ok {
+			r.define(stmt.Name, letBinding, stmt)
+		}
+	case *ast.ImportStatement:
+		r.define(stmt.Alias, letBinding, stmt)
+	case *ast.ReturnStatement:
+		r.expression(stmt.ReturnValue)
+	case *ast.ExpressionStatement:
+		r.expression(stmt.Expression)
+	case *ast.BlockStatement:
+		r.block(stmt.Statements)
+	}
+}
+
+func (r *Resolver) expression(exp ast.Expression) {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		def, _ := r.Lookup(exp.Value)
+		// 与编译器一致，同时把引用的外层函数的局部变量记为自由变量
+		r.table.Resolve(exp.Value)
+		if r.table.Hoisted(exp.Value) {
+			r.fail(exp, UsedBeforeDeclaration, exp.Value)
+		}
+		if r.Referenced != nil {
+			r.Referenced(exp, def)
+		}
+	case *ast.PrefixExpression:
+		r.expression(exp.Right)
+	case *ast.InfixExpression:
+		r.expression(exp.Left)
+		r.expression(exp.Right)
+	case *ast.IfExpression:
+		r.expression(exp.Condition)
+		r.statement(exp.Consequence)
+		if exp.Alternative != nil {
+			r.statement(exp.Alternative)
+		}
+	case *ast.MatchExpression:
+		r.match(exp)
+	case *ast.FunctionLiteral:
+		if target := r.function(exp, nil); target != "" {
+			r.errors = append(r.errors, Warning{Token: exp.Token, Message: fmt.Sprintf(UsedBeforeDeclaration, target)})
+		}
+	case *ast.MacroLiteral:
+		r.table = NewEnclosedSymbolTable(r.table)
+		for _, param := range exp.Parameters {
+			r.defined(param, r.table.Define(param.Value), exp)
+		}
+		r.statement(exp.Body)
+		r.table = r.table.Outer
+	case *ast.SpreadExpression:
+		r.expression(exp.Value)
+	case *ast.CallExpression:
+		r.expression(exp.Function)
+		for _, arg := range exp.Arguments {
+			r.expression(arg)
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range exp.Elements {
+			r.expression(el)
+		}
+	case *ast.HashLiteral:
+		for _, key := range exp.Keys {
+			r.expression(key)
+			r.expression(exp.Pairs[key])
+		}
+	case *ast.IndexExpression:
+		r.expression(exp.Left)
+		r.expression(exp.Index)
+	case *ast.MemberExpression:
+		r.expression(exp.Object)
+	}
+}
+
+// function 与编译器的compileFunction一致，在新的作用域中解析参数的默认值和函数体，name为函数绑定的名称。
+// 函数引用了外层函数中尚未执行到声明处的函数时返回该函数名，没有绑定名称的函数无法在之后回填而出错
+func (r *Resolver) function(fn *ast.FunctionLiteral, name *ast.Identifier) string {
+	local := r.table.Outer != nil
+	r.table = NewEnclosedSymbolTable(r.table)
+	if name != nil && local {
+		r.table.DefineFunctionName(name.Value)
+		if r.defs[r.table] == nil {
+			r.defs[r.table] = make(map[string]*ast.Identifier)
+		}
+		r.defs[r.table][name.Value] = name
+	}
+
+	required := fn.NumRequired()
+	for _, p := range fn.Parameters[:required] {
+		r.defined(p, r.table.Define(p.Value), fn)
+	}
+	for i, p := range fn.Parameters[required:] {
+		r.expression(fn.Defaults[i])
+		r.defined(p, r.table.Define(p.Value), fn)
+	}
+	if fn.Rest != nil {
+		r.defined(fn.Rest, r.table.Define(fn.Rest.Value), fn)
+	}
+	r.statement(fn.Body)
+
+	free := r.table.FreeSymbols
+	r.table = r.table.Outer
+	for _, sym := range free {
+		if sym.Scope == LocalScope && r.table.Hoisted(sym.Name) {
+			return sym.Name
+		}
+	}
+	return ""
+}
+
+// match 与编译器一致，每个分支在自己的块作用域中绑定模式中的变量，分支之间绑定同名变量不给出警告
+func (r *Resolver) match(match *ast.MatchExpression) {
+	if !match.Exhaustive() {
+		r.warnings = append(r.warnings, Warning{Token: match.Token, Message: NonExhaustiveMatch})
+	}
+	r.expression(match.Subject)
+	for _, arm := range match.Arms {
+		r.table = NewBlockSymbolTable(r.table)
+		for _, name := range ast.PatternNames(arm.Pattern) {
+			r.define(name, matchBinding, arm)
+		}
+		r.expression(arm.Guard)
+		r.statement(arm.Body)
+		r.table = r.table.Outer
+	}
+}
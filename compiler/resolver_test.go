@@ -0,0 +1,57 @@
+package compiler
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/nicolerobin/monkey/ast"
+)
+
+func TestResolver(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string // 每次引用的位置和定义处的位置，未定义时为-
+	}{
+		{"let a = 1; a", []string{"1:12 -> 1:5"}},
+		{"let a = 1; let f = fn(a) { a }; a", []string{"1:28 -> 1:23", "1:33 -> 1:5"}},
+		{"let f = fn() { let g = fn() { g }; g };", []string{"1:31 -> 1:20", "1:36 -> 1:20"}},
+		{"fn f() { g() } fn g() { f() }", []string{"1:10 -> 1:19", "1:25 -> 1:4"}},
+		{"let x = 1; match (x) { x => x, _ => x }", []string{"1:19 -> 1:5", "1:29 -> 1:24", "1:37 -> 1:5"}},
+		{"len(y)", []string{"1:1 -> -", "1:5 -> -"}},
+	}
+
+	for _, tt := range tests {
+		r := NewResolver(nil)
+		references := []string{}
+		r.Referenced = func(ident, def *ast.Identifier) {
+			target := "-"
+			if def != nil {
+				target = fmt.Sprintf("%d:%d", def.Token.LineNo, def.Token.Column)
+			}
+			references = append(references, fmt.Sprintf("%d:%d -> %s", ident.Token.LineNo, ident.Token.Column, target))
+		}
+		r.Resolve(parse(tt.input).(*ast.Program))
+
+		if !reflect.DeepEqual(references, tt.expected) {
+			t.Errorf("wrong references for %q. want=%q, got=%q", tt.input, tt.expected, references)
+		}
+	}
+}
+
+func TestResolverErrors(t *testing.T) {
+	r := NewResolver(map[string]bool{"a": true, "b": false})
+	r.Resolve(parse("let a = 1; let b = 2; fn() { f(); fn f() {} };").(*ast.Program))
+
+	errors := []string{}
+	for _, e := range r.Errors() {
+		errors = append(errors, e.String())
+	}
+	expected := []string{"1:5: cannot redefine constant a", "1:30: function f is used before its declaration"}
+	if !reflect.DeepEqual(errors, expected) {
+		t.Errorf("wrong errors. want=%q, got=%q", expected, errors)
+	}
+	if len(r.Warnings()) != 1 || r.Warnings()[0].String() != "1:16: b is already defined in this scope" {
+		t.Errorf("wrong warnings %q", r.Warnings())
+	}
+}
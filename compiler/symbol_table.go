@@ -1,17 +1,36 @@
 package compiler
 
+import (
+	"fmt"
+	"sort"
+)
+
 type SymbolScope string
 
 const (
-	GlobalScope SymbolScope = "GLOBAL"
-	LocalScope  SymbolScope = "LOCAL"
+	GlobalScope  SymbolScope = "GLOBAL"
+	LocalScope   SymbolScope = "LOCAL"
+	BuiltinScope SymbolScope = "BUILTIN"
+	// FreeScope 函数体引用的外层函数的局部变量，创建闭包时捕获
+	FreeScope SymbolScope = "FREE"
+	// FunctionScope 局部函数自身的名称，用于在函数体中递归调用
+	FunctionScope SymbolScope = "FUNCTION"
 )
 
 // Symbol 符号
 type Symbol struct {
-	Name  string
-	Scope SymbolScope
-	Index int
+	Name     string
+	Scope    SymbolScope
+	Index    int
+	Constant bool // 是否为const定义的常量
+}
+
+// globalState 主程序与各模块的全局命名空间共享的状态
+type globalState struct {
+	numDefinitions int               // 已分配的全局变量个数，保证各命名空间的下标互不冲突
+	released       []Symbol          // 已释放、可以复用的全局临时变量
+	modules        map[string]Symbol // 已编译模块对象所在的全局变量，按模块路径索引
+	builtins       map[string]Symbol // 内置函数，所有命名空间可见，可被同名的定义遮蔽
 }
 
 // SymbolTable 符号表
@@ -20,46 +39,246 @@ type SymbolTable struct {
 
 	store          map[string]Symbol
 	numDefinitions int
+	released       []Symbol // 已释放、可以复用的局部临时变量
+
+	block bool // 是否为块作用域，块中定义的变量使用外层作用域的存储，离开块后不再可见
+
+	FreeSymbols []Symbol // 捕获的自由变量在外层作用域中的符号，按自由变量的下标排列
+
+	hoisted map[string]bool // 已提前定义、尚未执行到声明处的函数名
+	fixups  []fixup         // 等待回填的闭包自由变量
+
+	globals *globalState
 }
 
 // NewEnclosedSymbolTable 创建嵌套符号表
 func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
 	s := NewSymbolTable()
 	s.Outer = outer
+	s.globals = outer.globals
+	return s
+}
+
+// NewBlockSymbolTable 创建块作用域的符号表，其中定义的变量遮蔽外层的同名变量，
+// 但与外层作用域一样保存在当前函数的局部变量或全局变量中
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewEnclosedSymbolTable(outer)
+	s.block = true
+	return s
+}
+
+// NewModuleSymbolTable 创建模块的全局符号表，模块拥有独立的命名空间，但与主程序共享全局变量的下标空间
+func NewModuleSymbolTable(main *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.globals = main.globals
 	return s
 }
 
 // NewSymbolTable 创建符号表
 func NewSymbolTable() *SymbolTable {
 	s := make(map[string]Symbol)
-	return &SymbolTable{store: s}
+	g := &globalState{modules: make(map[string]Symbol), builtins: make(map[string]Symbol)}
+	return &SymbolTable{store: s, globals: g}
 }
 
 // Define 定义符号
 func (st *SymbolTable) Define(name string) Symbol {
-	sym := Symbol{
-		Name:  name,
-		Index: st.numDefinitions,
+	sym := st.frame().allocate()
+	sym.Name = name
+
+	st.store[name] = sym
+	delete(st.hoisted, name)
+	return sym
+}
+
+// DefineConstant 定义常量，常量不能在同一作用域中重新定义
+func (st *SymbolTable) DefineConstant(name string) Symbol {
+	sym := st.Define(name)
+	sym.Constant = true
+	st.store[name] = sym
+	return sym
+}
+
+// Defined 返回当前作用域中定义的同名变量或常量，不包括捕获的自由变量和局部函数自身的名称，
+// 在当前作用域中定义同名变量会遮蔽它们，不算重新定义
+func (st *SymbolTable) Defined(name string) (Symbol, bool) {
+	sym, ok := st.store[name]
+	if !ok || sym.Scope == FreeScope || sym.Scope == FunctionScope {
+		return Symbol{}, false
+	}
+	return sym, true
+}
+
+// CheckRedefinition 检查在当前作用域中定义name是否重新定义了已有的名称：已有的名称是常量时返回错误，
+// 是变量时返回true，调用者据此给出警告。提前定义的函数尚未执行到声明处，由之后的函数声明检查
+func (st *SymbolTable) CheckRedefinition(name string) (bool, error) {
+	sym, ok := st.Defined(name)
+	if !ok || st.Hoisted(name) {
+		return false, nil
+	}
+	if sym.Constant {
+		return false, fmt.Errorf(CannotRedefineConstant, name)
+	}
+	return true, nil
+}
+
+// DefineTemporary 分配一个没有名称的变量，用于保存编译器生成的中间值，不能通过Resolve找到。
+// 优先复用已释放的临时变量
+func (st *SymbolTable) DefineTemporary() Symbol {
+	released := st.frame().releasedTemporaries()
+	if n := len(*released); n > 0 {
+		sym := (*released)[n-1]
+		*released = (*released)[:n-1]
+		return sym
 	}
+	return st.frame().allocate()
+}
+
+// ReleaseTemporary 释放不再使用的临时变量，之后分配的临时变量可以复用它
+func (st *SymbolTable) ReleaseTemporary(sym Symbol) {
+	released := st.frame().releasedTemporaries()
+	*released = append(*released, sym)
+}
+
+// frame 返回为变量分配存储的符号表，块作用域使用外层作用域的存储
+func (st *SymbolTable) frame() *SymbolTable {
+	for st.block {
+		st = st.Outer
+	}
+	return st
+}
+
+// allocate 分配一个新的全局变量或局部变量
+func (st *SymbolTable) allocate() Symbol {
+	sym := Symbol{}
 
 	if st.Outer == nil {
 		sym.Scope = GlobalScope
+		sym.Index = st.globals.numDefinitions
+		st.globals.numDefinitions++
 	} else {
 		sym.Scope = LocalScope
+		sym.Index = st.numDefinitions
 	}
 
-	st.store[name] = sym
 	st.numDefinitions++
 	return sym
 }
 
-// Resolve 解析符号
+// releasedTemporaries 返回已释放的临时变量，全局的临时变量由各命名空间共享
+func (st *SymbolTable) releasedTemporaries() *[]Symbol {
+	if st.Outer == nil {
+		return &st.globals.released
+	}
+	return &st.released
+}
+
+// Hoist 在执行到函数声明之前定义函数名，使之前声明的函数可以引用它
+func (st *SymbolTable) Hoist(name string) Symbol {
+	sym := st.Define(name)
+	if st.hoisted == nil {
+		st.hoisted = make(map[string]bool)
+	}
+	st.hoisted[name] = true
+	return sym
+}
+
+// Hoisted 判断name是否为当前作用域中已提前定义、尚未执行到声明处的函数
+func (st *SymbolTable) Hoisted(name string) bool {
+	return st.hoisted[name]
+}
+
+// Declare 执行到函数声明处，返回提前定义的符号。name未被提前定义时返回false
+func (st *SymbolTable) Declare(name string) (Symbol, bool) {
+	if !st.hoisted[name] {
+		return Symbol{}, false
+	}
+	delete(st.hoisted, name)
+	return st.store[name], true
+}
+
+// DefineFunctionName 定义局部函数自身的名称，之后定义的同名参数或变量会遮蔽它
+func (st *SymbolTable) DefineFunctionName(name string) Symbol {
+	sym := Symbol{Name: name, Scope: FunctionScope, Index: 0}
+	st.store[name] = sym
+	return sym
+}
+
+// defineFree 将外层函数的局部变量original定义为当前函数的自由变量
+func (st *SymbolTable) defineFree(original Symbol) Symbol {
+	st.FreeSymbols = append(st.FreeSymbols, original)
+
+	sym := Symbol{Name: original.Name, Scope: FreeScope, Index: len(st.FreeSymbols) - 1}
+	st.store[original.Name] = sym
+	return sym
+}
+
+// DefineBuiltin 定义内置函数，index为其在object.Builtins中的下标
+func (st *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	sym := Symbol{Name: name, Scope: BuiltinScope, Index: index}
+	st.globals.builtins[name] = sym
+	return sym
+}
+
+// Resolve 解析符号，各级作用域中都未定义时查找内置函数。外层函数的局部变量解析为当前函数的自由变量，
+// 块作用域与外层作用域属于同一个函数，不产生自由变量
 func (st *SymbolTable) Resolve(name string) (Symbol, bool) {
 	sym, ok := st.store[name]
-	if !ok && st.Outer != nil {
-		sym, ok = st.Outer.Resolve(name)
+	if ok {
+		return sym, true
+	}
+	if st.Outer == nil {
+		sym, ok = st.globals.builtins[name]
+		return sym, ok
+	}
+	if st.block {
+		return st.Outer.Resolve(name)
+	}
+
+	sym, ok = st.Outer.Resolve(name)
+	if !ok || sym.Scope == GlobalScope || sym.Scope == BuiltinScope {
 		return sym, ok
 	}
+	return st.defineFree(sym), true
+}
+
+// ResolveTable 解析符号，同时返回定义该符号的符号表
+func (st *SymbolTable) ResolveTable(name string) (Symbol, *SymbolTable, bool) {
+	sym, ok := st.store[name]
+	if !ok && st.Outer != nil {
+		return st.Outer.ResolveTable(name)
+	}
 
+	return sym, st, ok
+}
+
+// DefineModule 为已编译的模块对象分配全局变量
+func (st *SymbolTable) DefineModule(path string) Symbol {
+	sym := Symbol{
+		Name:  path,
+		Scope: GlobalScope,
+		Index: st.globals.numDefinitions,
+	}
+	st.globals.numDefinitions++
+	st.globals.modules[path] = sym
+	return sym
+}
+
+// ResolveModule 查找已编译的模块对象所在的全局变量
+func (st *SymbolTable) ResolveModule(path string) (Symbol, bool) {
+	sym, ok := st.globals.modules[path]
 	return sym, ok
 }
+
+// Symbols 返回当前作用域中定义的全部符号，按下标排序
+func (st *SymbolTable) Symbols() []Symbol {
+	symbols := make([]Symbol, 0, len(st.store))
+	for _, sym := range st.store {
+		symbols = append(symbols, sym)
+	}
+
+	sort.Slice(symbols, func(i, j int) bool {
+		return symbols[i].Index < symbols[j].Index
+	})
+	return symbols
+}
@@ -1,6 +1,7 @@
 package compiler
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -153,3 +154,227 @@ func TestResolveNestedLocal(t *testing.T) {
 		}
 	}
 }
+
+func TestResolveFree(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("c")
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	secondLocal.Define("e")
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 0},
+		{Name: "c", Scope: FreeScope, Index: 0},
+		{Name: "e", Scope: LocalScope, Index: 0},
+	}
+	for _, sym := range expected {
+		result, ok := secondLocal.Resolve(sym.Name)
+		if !ok || result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+		}
+	}
+
+	expectedFree := []Symbol{{Name: "c", Scope: LocalScope, Index: 0}}
+	if !reflect.DeepEqual(secondLocal.FreeSymbols, expectedFree) {
+		t.Errorf("wrong free symbols. want=%+v, got=%+v", expectedFree, secondLocal.FreeSymbols)
+	}
+	if _, ok := secondLocal.Resolve("x"); ok {
+		t.Errorf("name x resolvable")
+	}
+}
+
+func TestFunctionNamesAndHoisting(t *testing.T) {
+	global := NewSymbolTable()
+	local := NewEnclosedSymbolTable(global)
+
+	self := local.DefineFunctionName("f")
+	expected := Symbol{Name: "f", Scope: FunctionScope, Index: 0}
+	if self != expected {
+		t.Errorf("expected f=%+v, got=%+v", expected, self)
+	}
+	// 同名参数遮蔽函数自身的名称
+	param := local.Define("f")
+	if result, _ := local.Resolve("f"); result != param || param.Scope != LocalScope {
+		t.Errorf("expected f to resolve to %+v, got=%+v", param, result)
+	}
+
+	hoisted := local.Hoist("g")
+	if !local.Hoisted("g") || global.Hoisted("g") {
+		t.Errorf("g not hoisted in the local table only")
+	}
+	declared, ok := local.Declare("g")
+	if !ok || declared != hoisted || local.Hoisted("g") {
+		t.Errorf("Declare(g) wrong. got=%+v, %t", declared, ok)
+	}
+	if _, ok := local.Declare("g"); ok {
+		t.Errorf("g declared twice")
+	}
+
+	// 重新定义同名变量后不再是提前定义的函数
+	local.Hoist("h")
+	local.Define("h")
+	if local.Hoisted("h") {
+		t.Errorf("h still hoisted after redefinition")
+	}
+}
+
+func TestDefineConstant(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	b := global.DefineConstant("b")
+	expected := Symbol{Name: "b", Scope: GlobalScope, Index: 1, Constant: true}
+	if b != expected {
+		t.Errorf("expected b=%+v, got=%+v", expected, b)
+	}
+	if result, ok := global.Resolve("b"); !ok || result != expected {
+		t.Errorf("expected b to resolve to %+v, got=%+v", expected, result)
+	}
+	if sym, ok := global.Defined("a"); !ok || sym.Constant {
+		t.Errorf("Defined(a) wrong. got=%+v, %t", sym, ok)
+	}
+
+	// 自由变量和局部函数自身的名称不是当前作用域中的定义
+	first := NewEnclosedSymbolTable(global)
+	first.Define("c")
+	second := NewEnclosedSymbolTable(first)
+	second.DefineFunctionName("f")
+	second.Resolve("c")
+	for _, name := range []string{"b", "c", "f"} {
+		if sym, ok := second.Defined(name); ok {
+			t.Errorf("%s should not be defined in the inner scope, got=%+v", name, sym)
+		}
+	}
+}
+
+func TestModuleNamespace(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	util := NewModuleSymbolTable(global)
+	utilA := util.Define("a")
+	expected := Symbol{Name: "a", Scope: GlobalScope, Index: 1}
+	if utilA != expected {
+		t.Errorf("expected a=%+v, got=%+v", expected, utilA)
+	}
+
+	if _, ok := util.Resolve("b"); ok {
+		t.Errorf("name b resolvable in module namespace")
+	}
+	global.Define("b")
+	if _, ok := util.Resolve("b"); ok {
+		t.Errorf("name b defined in main namespace resolvable in module namespace")
+	}
+
+	moduleSymbol := global.DefineModule("/lib/util.mk")
+	expected = Symbol{Name: "/lib/util.mk", Scope: GlobalScope, Index: 3}
+	if moduleSymbol != expected {
+		t.Errorf("expected module=%+v, got=%+v", expected, moduleSymbol)
+	}
+
+	resolved, ok := util.ResolveModule("/lib/util.mk")
+	if !ok || resolved != expected {
+		t.Errorf("expected module=%+v, got=%+v", expected, resolved)
+	}
+}
+
+func TestBlockScope(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+	block := NewBlockSymbolTable(global)
+
+	// 块中的变量遮蔽外层的同名变量，并使用外层作用域的存储
+	shadow := block.Define("a")
+	expected := Symbol{Name: "a", Scope: GlobalScope, Index: 1}
+	if shadow != expected {
+		t.Errorf("expected a=%+v, got=%+v", expected, shadow)
+	}
+	if result, _ := global.Resolve("a"); result != a {
+		t.Errorf("expected a to resolve to %+v in global scope, got=%+v", a, result)
+	}
+	if _, ok := block.Defined("b"); ok {
+		t.Errorf("name b defined in block")
+	}
+
+	// 块中引用所在函数的局部变量不产生自由变量
+	local := NewEnclosedSymbolTable(global)
+	c := local.Define("c")
+	localBlock := NewBlockSymbolTable(local)
+	if result, _ := localBlock.Resolve("c"); result != c {
+		t.Errorf("expected c to resolve to %+v, got=%+v", c, result)
+	}
+	d := localBlock.Define("d")
+	if d.Scope != LocalScope || d.Index != 1 || local.numDefinitions != 2 {
+		t.Errorf("expected d to be local 1, got=%+v (locals=%d)", d, local.numDefinitions)
+	}
+	if len(local.FreeSymbols) != 0 {
+		t.Errorf("unexpected free symbols: %+v", local.FreeSymbols)
+	}
+}
+
+func TestReleaseTemporary(t *testing.T) {
+	global := NewSymbolTable()
+	first := global.DefineTemporary()
+	global.ReleaseTemporary(first)
+
+	// 释放的临时变量被之后的临时变量复用，具名变量总是分配新的存储
+	if reused := global.DefineTemporary(); reused != first {
+		t.Errorf("expected temporary %+v to be reused, got=%+v", first, reused)
+	}
+	if a := global.Define("a"); a.Index != 1 {
+		t.Errorf("expected a to be global 1, got=%+v", a)
+	}
+
+	// 模块与主程序共享全局临时变量
+	module := NewModuleSymbolTable(global)
+	second := NewBlockSymbolTable(global).DefineTemporary()
+	global.ReleaseTemporary(second)
+	if reused := module.DefineTemporary(); reused != second {
+		t.Errorf("expected temporary %+v to be reused, got=%+v", second, reused)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	temp := local.DefineTemporary()
+	NewBlockSymbolTable(local).ReleaseTemporary(temp)
+	if reused := local.DefineTemporary(); reused != temp || local.numDefinitions != 1 {
+		t.Errorf("expected temporary %+v to be reused, got=%+v (locals=%d)", temp, reused, local.numDefinitions)
+	}
+}
+
+func TestDefineResolveBuiltins(t *testing.T) {
+	global := NewSymbolTable()
+	local := NewEnclosedSymbolTable(global)
+	module := NewModuleSymbolTable(global)
+
+	expected := []Symbol{
+		{Name: "a", Scope: BuiltinScope, Index: 0},
+		{Name: "c", Scope: BuiltinScope, Index: 1},
+	}
+	for i, sym := range expected {
+		global.DefineBuiltin(i, sym.Name)
+	}
+
+	for _, table := range []*SymbolTable{global, local, module} {
+		for _, sym := range expected {
+			result, ok := table.Resolve(sym.Name)
+			if !ok {
+				t.Errorf("name %s not resolvable", sym.Name)
+				continue
+			}
+			if result != sym {
+				t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+			}
+		}
+	}
+
+	// 同名的定义遮蔽内置函数
+	shadow := local.Define("a")
+	if result, _ := local.Resolve("a"); result != shadow {
+		t.Errorf("expected a to resolve to %+v, got=%+v", shadow, result)
+	}
+	if len(global.Symbols()) != 0 {
+		t.Errorf("builtins listed in global symbols: %+v", global.Symbols())
+	}
+}
@@ -0,0 +1,26 @@
+package evaluator
+
+import (
+	"testing"
+
+	"github.com/nicolerobin/monkey/internal/benchcorpus"
+	"github.com/nicolerobin/monkey/lexer"
+	"github.com/nicolerobin/monkey/object"
+	"github.com/nicolerobin/monkey/parser"
+)
+
+func BenchmarkEval(b *testing.B) {
+	for _, bench := range benchcorpus.Load(b) {
+		program := parser.NewParser(lexer.NewLexer(bench.Input)).ParseProgram()
+
+		b.Run(bench.Name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				result := Eval(program, object.NewEnvironment())
+				if errObj, ok := result.(*object.Error); ok {
+					b.Fatalf("Eval() failed, error: %s", errObj.Message)
+				}
+			}
+		})
+	}
+}
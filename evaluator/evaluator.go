@@ -3,13 +3,14 @@ package evaluator
 import (
 	"fmt"
 	"github.com/nicolerobin/monkey/ast"
+	"github.com/nicolerobin/monkey/module"
 	"github.com/nicolerobin/monkey/object"
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
 )
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
@@ -27,7 +28,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
-		return &object.Array{Elements: elements}
+		return object.NewArray(elements)
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
 		if isError(left) {
@@ -38,6 +39,15 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return index
 		}
 		return evalIndexExpression(left, index)
+	case *ast.MemberExpression:
+		obj := Eval(node.Object, env)
+		if isError(obj) {
+			return obj
+		}
+		// 成员访问a.b等价于以字符串为下标的a["b"]
+		return evalIndexExpression(obj, &object.String{Value: node.Property.Value})
+	case *ast.ImportStatement:
+		return evalImportStatement(node, env)
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 	case *ast.PrefixExpression:
@@ -60,6 +70,8 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalBlockStatement(node, env)
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env)
 	case *ast.ReturnStatement:
 		val := Eval(node.ReturnValue, env)
 		// 避免错误继续传递
@@ -72,53 +84,134 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		if node.Pattern != nil {
+			if err := destructure(node.Pattern, val, env, node.Constant); err != nil {
+				return err
+			}
+			return nil
+		}
+		// 直接绑定函数字面量时记录名称，用于错误信息
+		if fn, ok := val.(*object.Function); ok && isFunctionLiteral(node.Value) {
+			fn.Name = node.Name.Value
+		}
+		if err := define(env, node.Name.Value, val, node.Constant); err != nil {
+			return err
+		}
+	case *ast.FunctionStatement:
+		// 函数体在定义它的环境中查找名称，因此可以递归调用自身以及之后声明的函数
+		fn := &object.Function{
+			Name:       node.Name.Value,
+			Parameters: node.Function.Parameters,
+			Defaults:   node.Function.Defaults,
+			Rest:       node.Function.Rest,
+			Env:        env,
+			Body:       node.Function.Body,
+		}
+		if err := define(env, node.Name.Value, fn, false); err != nil {
+			return err
+		}
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 	case *ast.FunctionLiteral:
-		params := node.Parameters
-		body := node.Body
 		return &object.Function{
-			Parameters: params,
+			Parameters: node.Parameters,
+			Defaults:   node.Defaults,
+			Rest:       node.Rest,
 			Env:        env,
-			Body:       body,
+			Body:       node.Body,
 		}
+	case *ast.MacroLiteral:
+		return newError("macro literal must be bound by a top-level let statement and expanded before evaluation")
 	case *ast.CallExpression:
+		if isCallTo(node, "quote") {
+			if len(node.Arguments) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(node.Arguments))
+			}
+			return quote(node.Arguments[0], env)
+		}
+
 		function := Eval(node.Function, env)
 		if isError(function) {
 			return function
 		}
-		args := evalExpressions(node.Arguments, env)
+		args := evalArguments(node.Arguments, env)
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args)
+		return applyFunction(function, args, env.Context())
+	case *ast.SpreadExpression:
+		return newError("spread %s is only allowed in call arguments", node)
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
 	}
 	return nil
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// caller 供内置函数回调Monkey函数以及获取调用处的执行上下文
+type caller struct {
+	ctx *object.Context
+}
+
+func (c caller) Call(fn object.Object, args ...object.Object) object.Object {
+	return applyFunction(fn, args, c.ctx)
+}
+
+func (c caller) Context() *object.Context {
+	return c.ctx
+}
+
+// applyFunction 调用函数，ctx为调用处的执行上下文，交给内置函数使用
+func applyFunction(fn object.Object, args []object.Object, ctx *object.Context) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
+		required := len(fn.Parameters) - len(fn.Defaults)
+		if err := object.CheckArity(fn.Name, required, len(fn.Parameters), fn.Rest != nil, len(args)); err != nil {
+			return newError("%s", err)
+		}
+		extendedEnv, errObj := extendFunctionEnv(fn, args)
+		if errObj != nil {
+			return errObj
+		}
 		evaluated := Eval(fn.Body, extendedEnv)
 		return unwrapReturnValue(evaluated)
 	case *object.Builtin:
-		return fn.Fn(args...)
+		if result := fn.Fn(caller{ctx: ctx}, args...); result != nil {
+			return result
+		}
+		return NULL
+	case *object.Hoisted:
+		return newError("%s", fn.CallError())
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
 }
 
-func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+// extendFunctionEnv 创建函数体的环境并绑定参数。缺少的参数使用默认值，默认值在绑定了前面参数的环境中求值，
+// 多余的实参以数组绑定到rest参数
+func extendFunctionEnv(fn *object.Function, args []object.Object) (*object.Environment, object.Object) {
 	env := object.NewEnclosedEnvironment(fn.Env)
 
+	required := len(fn.Parameters) - len(fn.Defaults)
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		if paramIdx < len(args) {
+			env.Set(param.Value, args[paramIdx])
+			continue
+		}
+		value := unwrapReturnValue(Eval(fn.Defaults[paramIdx-required], env))
+		if isError(value) {
+			return nil, value
+		}
+		env.Set(param.Value, value)
 	}
-	return env
+
+	if fn.Rest != nil {
+		rest := []object.Object{}
+		if len(args) > len(fn.Parameters) {
+			rest = append(rest, args[len(fn.Parameters):]...)
+		}
+		env.Set(fn.Rest.Value, object.NewArray(rest))
+	}
+	return env, nil
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
@@ -128,8 +221,84 @@ func unwrapReturnValue(obj object.Object) object.Object {
 	return obj
 }
 
+// evalImportStatement 加载模块并将模块对象绑定到别名，模块只会被求值一次
+func evalImportStatement(node *ast.ImportStatement, env *object.Environment) object.Object {
+	loader := loaderOf(env)
+	m, err := loader.Load(node.Path.Value)
+	if err != nil {
+		return newError("%s", err)
+	}
+
+	mod, ok := env.Module(m.Path)
+	if !ok && m.Native != nil {
+		mod = m.Native
+		env.SetModule(m.Path, mod)
+	} else if !ok {
+		err = loader.Enter(m)
+		if err != nil {
+			return newError("%s", err)
+		}
+		result := evalModule(m, env)
+		loader.Leave()
+		if isError(result) {
+			return result
+		}
+		mod = result.(*object.Module)
+		env.SetModule(m.Path, mod)
+	}
+
+	if err := define(env, node.Alias.Value, mod, false); err != nil {
+		return err
+	}
+	return nil
+}
+
+// loaderOf 返回env中设置的模块加载器，未设置时创建默认的加载器并保存到env中，
+// 之后在该环境中的导入共享同一个加载器
+func loaderOf(env *object.Environment) *module.Loader {
+	if l, ok := env.Loader().(*module.Loader); ok {
+		return l
+	}
+	l := NewLoader()
+	env.SetLoader(l)
+	return l
+}
+
+// evalModule 检查后在模块独立的环境中求值模块体，并收集导出的绑定
+func evalModule(m *module.Module, importer *object.Environment) object.Object {
+	env := object.NewModuleEnvironment(importer)
+
+	// 与编译器一致，模块中的名称错误在执行模块之前报告
+	if _, err := Check(m.Program, env); err != nil {
+		return newError("module %s: %s", m.Path, err)
+	}
+	result := Eval(m.Program, env)
+	if isError(result) {
+		return newError("module %s: %s", m.Path, result.(*object.Error).Message)
+	}
+
+	exports := make(map[string]object.Object)
+	for _, name := range m.Exports() {
+		exports[name], _ = env.Get(name)
+	}
+	return &object.Module{Name: m.Path, Exports: exports}
+}
+
+func evalModuleMember(mod, index object.Object) object.Object {
+	moduleObj := mod.(*object.Module)
+	name := index.(*object.String).Value
+
+	value, ok := moduleObj.Exports[name]
+	if !ok {
+		return newError("module %s has no exported member %s", moduleObj.Name, name)
+	}
+	return value
+}
+
 func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
+	case left.Type() == object.MODULE_OBJ && index.Type() == object.STRING_OBJ:
+		return evalModuleMember(left, index)
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
@@ -142,12 +311,11 @@ func evalIndexExpression(left, index object.Object) object.Object {
 func evalHashIndexExpression(hash, index object.Object) object.Object {
 	hashObject := hash.(*object.Hash)
 
-	key, ok := index.(object.Hashable)
-	if !ok {
+	if !object.IsHashable(index) {
 		return newError("unusable as hash key: %s", index.Type())
 	}
 
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	pair, ok := hashObject.Get(index)
 	if !ok {
 		return NULL
 	}
@@ -156,40 +324,38 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 }
 
 func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+	hash := object.NewHash()
 
-	for keyNode, valueNode := range node.Pairs {
+	for _, keyNode := range node.Keys {
 		key := Eval(keyNode, env)
 		if isError(key) {
 			return key
 		}
 
-		hashKey, ok := key.(object.Hashable)
-		if !ok {
+		if !object.IsHashable(key) {
 			return newError("unusable as hash key: %s", key.Type())
 		}
 
-		value := Eval(valueNode, env)
+		value := Eval(node.Pairs[keyNode], env)
 		if isError(value) {
 			return value
 		}
 
-		hashed := hashKey.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
+		hash.Set(key, value)
 	}
-	return &object.Hash{Pairs: pairs}
+	return hash
 }
 
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arrayObj := array.(*object.Array)
 	idx := index.(*object.Integer).Value
-	max := int64(len(arrayObj.Elements) - 1)
+	max := int64(arrayObj.Len() - 1)
 
 	if idx < 0 || idx > max {
 		return NULL
 	}
 
-	return arrayObj.Elements[idx]
+	return arrayObj.At(int(idx))
 }
 
 func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
@@ -205,12 +371,45 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 	return result
 }
 
+// evalArguments 对实参求值，展开实参...expr的值必须是数组，其元素依次作为实参
+func evalArguments(exps []ast.Expression, env *object.Environment) []object.Object {
+	var result []object.Object
+
+	for _, e := range exps {
+		spread, ok := e.(*ast.SpreadExpression)
+		if !ok {
+			evaluated := Eval(e, env)
+			if isError(evaluated) {
+				return []object.Object{evaluated}
+			}
+			result = append(result, evaluated)
+			continue
+		}
+
+		evaluated := Eval(spread.Value, env)
+		if isError(evaluated) {
+			return []object.Object{evaluated}
+		}
+		arr, ok := evaluated.(*object.Array)
+		if !ok {
+			return []object.Object{newError("spread argument must be ARRAY, got %s", evaluated.Type())}
+		}
+		result = append(result, arr.Elements()...)
+	}
+	return result
+}
+
+func isFunctionLiteral(exp ast.Expression) bool {
+	_, ok := exp.(*ast.FunctionLiteral)
+	return ok
+}
+
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
 	if val, ok := env.Get(node.Value); ok {
 		return val
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
+	if builtin := object.GetBuiltinByName(node.Value); builtin != nil {
 		return builtin
 	}
 
@@ -219,6 +418,7 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 
 func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
+	hoistFunctions(program.Statements, env)
 
 	for _, stmt := range program.Statements {
 		result = Eval(stmt, env)
@@ -236,6 +436,7 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 
 func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
 	var result object.Object
+	hoistFunctions(block.Statements, env)
 
 	for _, stmt := range block.Statements {
 		result = Eval(stmt, env)
@@ -250,6 +451,16 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 	return result
 }
 
+// hoistFunctions 与编译器一致，在执行到函数声明之前将函数名绑定为object.Hoisted，
+// 之前声明的函数在此期间调用它时以函数名报告错误
+func hoistFunctions(statements []ast.Statement, env *object.Environment) {
+	for _, stmt := range statements {
+		if fn, ok := stmt.(*ast.FunctionStatement); ok {
+			env.Set(fn.Name.Value, &object.Hoisted{Name: fn.Name.Value})
+		}
+	}
+}
+
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	if input {
 		return TRUE
@@ -273,12 +484,14 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
-	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
-		return evalStringInfixExpression(operator, left, right)
 	case operator == "==":
-		return nativeBoolToBooleanObject(left == right)
+		return nativeBoolToBooleanObject(object.Equal(left, right))
 	case operator == "!=":
-		return nativeBoolToBooleanObject(left != right)
+		return nativeBoolToBooleanObject(!object.Equal(left, right))
+	case operator == "<" || operator == ">":
+		return evalOrderingExpression(operator, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(operator, left, right)
 	case left.Type() != right.Type():
 		return newError("type mismatch: %s %s %s",
 			left.Type(), operator, right.Type())
@@ -288,9 +501,27 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 	}
 }
 
+// evalOrderingExpression 使用object.Compare求值<和>
+func evalOrderingExpression(operator string, left, right object.Object) object.Object {
+	result, err := object.Compare(left, right)
+	if err != nil {
+		if left.Type() != right.Type() {
+			return newError("type mismatch: %s %s %s",
+				left.Type(), operator, right.Type())
+		}
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+
+	if operator == "<" {
+		return nativeBoolToBooleanObject(result < 0)
+	}
+	return nativeBoolToBooleanObject(result > 0)
+}
+
 func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
 	if operator != "+" {
-		return newError("unknown operator:%s %s %s", left.Type(), operator, right.Type())
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 
 	leftVal := left.(*object.String).Value
@@ -340,6 +571,85 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 	}
 }
 
+// evalMatchExpression 依次尝试各个分支：模式匹配后绑定其中的变量，再检查守卫，
+// 守卫成立时结果为该分支的值；没有分支匹配时结果为null
+func evalMatchExpression(me *ast.MatchExpression, env *object.Environment) object.Object {
+	subject := Eval(me.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+
+	for _, arm := range me.Arms {
+		if !matchPattern(arm.Pattern, subject) {
+			continue
+		}
+		// 每个分支在嵌套环境中绑定模式中的变量，遮蔽外层的同名变量，分支结束后不再可见
+		armEnv := object.NewEnclosedEnvironment(env)
+		if err := destructure(arm.Pattern, subject, armEnv, false); err != nil {
+			return err
+		}
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, armEnv)
+			if isError(guard) {
+				return guard
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+
+		result := Eval(arm.Body, armEnv)
+		if result == nil {
+			return NULL
+		}
+		return result
+	}
+	return NULL
+}
+
+// matchPattern 判断val是否匹配pattern，变量和_匹配任意值，字面量匹配与之相等的值
+func matchPattern(pattern ast.Pattern, val object.Object) bool {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		return true
+	case *ast.IntegerLiteral:
+		return object.Equal(&object.Integer{Value: pattern.Value}, val)
+	case *ast.StringLiteral:
+		return object.Equal(&object.String{Value: pattern.Value}, val)
+	case *ast.Boolean:
+		return object.Equal(nativeBoolToBooleanObject(pattern.Value), val)
+	case *ast.ArrayPattern:
+		if !object.MatchArray(val, len(pattern.Elements), pattern.Rest != nil) {
+			return false
+		}
+		arr := val.(*object.Array)
+		for i, el := range pattern.Elements {
+			if !matchPattern(el, arr.At(i)) {
+				return false
+			}
+		}
+		return true
+	case *ast.HashPattern:
+		keys := make([]string, len(pattern.Pairs))
+		for i, pair := range pattern.Pairs {
+			keys[i] = pair.Key.Value
+		}
+		if !object.MatchHash(val, keys) {
+			return false
+		}
+		hash := val.(*object.Hash)
+		for _, pair := range pattern.Pairs {
+			entry, _ := hash.Get(&object.String{Value: pair.Key.Value})
+			if !matchPattern(pair.Value, entry.Value) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj {
 	case NULL:
@@ -375,6 +685,58 @@ func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
 	return &object.Integer{Value: -value}
 }
 
+// define 在env中定义名称，constant为true时定义常量，env中已有同名常量时返回错误
+func define(env *object.Environment, name string, val object.Object, constant bool) *object.Error {
+	set := env.Define
+	if constant {
+		set = env.DefineConstant
+	}
+	if err := set(name, val); err != nil {
+		return newError("%s", err)
+	}
+	return nil
+}
+
+// destructure 将val按pattern解构并绑定到env中，constant为true时绑定为常量，值的形状与模式不符时返回错误。
+// 字面量模式不绑定变量，由matchPattern检查
+func destructure(pattern ast.Pattern, val object.Object, env *object.Environment, constant bool) *object.Error {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if !ast.Wildcard(pattern) {
+			return define(env, pattern.Value, val, constant)
+		}
+	case *ast.ArrayPattern:
+		if err := object.DestructureArray(val, len(pattern.Elements), pattern.Rest != nil); err != nil {
+			return newError("%s", err)
+		}
+		arr := val.(*object.Array)
+		for i, el := range pattern.Elements {
+			if err := destructure(el, arr.At(i), env, constant); err != nil {
+				return err
+			}
+		}
+		if pattern.Rest != nil {
+			return destructure(pattern.Rest, arr.Drop(len(pattern.Elements)), env, constant)
+		}
+	case *ast.HashPattern:
+		keys := make([]string, len(pattern.Pairs))
+		for i, pair := range pattern.Pairs {
+			keys[i] = pair.Key.Value
+		}
+		if err := object.DestructureHash(val, keys); err != nil {
+			return newError("%s", err)
+		}
+		hash := val.(*object.Hash)
+		for _, pair := range pattern.Pairs {
+			entry, _ := hash.Get(&object.String{Value: pair.Key.Value})
+			if err := destructure(pair.Value, entry.Value, env, constant); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
@@ -1,11 +1,20 @@
 package evaluator
 
 import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/nicolerobin/monkey/ast"
+	"github.com/nicolerobin/monkey/compiler"
 	"github.com/nicolerobin/monkey/lexer"
+	"github.com/nicolerobin/monkey/module"
 	"github.com/nicolerobin/monkey/object"
 	"github.com/nicolerobin/monkey/parser"
+	"github.com/nicolerobin/monkey/stdlib"
 )
 
 func TestEvalIntegerExpression(t *testing.T) {
@@ -45,6 +54,13 @@ func testEval(input string) object.Object {
 	return Eval(program, env)
 }
 
+// testEvalWithLoader 使用模块加载器l求值input
+func testEvalWithLoader(input string, l *module.Loader) object.Object {
+	env := object.NewEnvironment()
+	env.SetLoader(l)
+	return Eval(parser.NewParser(lexer.NewLexer(input)).ParseProgram(), env)
+}
+
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	result, ok := obj.(*object.Integer)
 	if !ok {
@@ -83,6 +99,24 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
+		{`"a" == "a"`, true},
+		{`"a" != "b"`, true},
+		{"[1, 2] == [1, 2]", true},
+		{"[1, 2] == [2, 1]", false},
+		{"[1, [2]] != [1, [2]]", false},
+		{"{1: 2, 3: 4} == {3: 4, 1: 2}", true},
+		{"{1: 2} == {1: 3}", false},
+		{"1 == true", false},
+		{"[] == {}", false},
+		{`"a" < "b"`, true},
+		{`"b" < "a"`, false},
+		{`"ab" > "a"`, true},
+		{"[1, 2] < [1, 3]", true},
+		{"[1, 2] > [1]", true},
+		{"[] < [0]", true},
+		{"false < true", true},
+		{"true > true", false},
+		{"if (false) { 1 } == if (false) { 2 }", true},
 	}
 
 	for _, tt := range tests {
@@ -247,6 +281,14 @@ if (10 > 1) {
 			`"Hello" - "World!"`,
 			"unknown operator: STRING - STRING",
 		},
+		{
+			`1 < "a"`,
+			"type mismatch: INTEGER < STRING",
+		},
+		{
+			"{} > {}",
+			"unknown operator: HASH > HASH",
+		},
 		{
 			`{"name": "Monkey"}[fn(x) { x }];`,
 			"unusable as hash key: FUNCTION",
@@ -339,6 +381,55 @@ addTwo(2);
 	testIntegerObject(t, testEval(input), 4)
 }
 
+func TestFunctionStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fn fact(n) { if (n == 0) { 1 } else { n * fact(n - 1) } } fact(5)`, "120"},
+		{`fn isEven(n) { if (n == 0) { true } else { isOdd(n - 1) } }
+		  fn isOdd(n) { if (n == 0) { false } else { isEven(n - 1) } }
+		  [isEven(10), isOdd(7), isEven(3)]`, "[true, true, false]"},
+		{`let f = fn() { fn fact(n) { if (n == 0) { 1 } else { n * fact(n - 1) } } fact(4) }; f()`, "24"},
+		{`let f = fn(k) { fn scale(x) { x * k } map([1, 2], scale) }; f(3)`, "[3, 6]"},
+		{`fn add(a, b = 1) { a + b } add(1)`, "2"},
+		{`fn add(a, b) { a + b }`, ""},
+		{`fn add(a, b) { a + b } add`, "fn add(a, b)"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		result := ""
+		if evaluated != nil {
+			result = evaluated.Inspect()
+		}
+		if result != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, result)
+		}
+	}
+
+	errObj, ok := testEval(`fn add(a, b) { a + b } add(1)`).(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned")
+	}
+	expected := "wrong number of arguments to `add`: want=2, got=1"
+	if errObj.Message != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+	}
+
+	// 调用尚未执行到声明处的函数时报告函数名
+	errorTests := []string{
+		`fn f() { g() } f(); fn g() { 1 }`,
+		`let f = fn() { fn h() { g() } h(); fn g() { 1 } }; f()`,
+		`let f = fn() { let h = fn() { g() }; h(); fn g() { 1 } }; f()`,
+	}
+	for _, input := range errorTests {
+		errObj, ok := testEval(input).(*object.Error)
+		if !ok || errObj.Message != "function g called before its declaration" {
+			t.Errorf("wrong result for %q. got=%v", input, errObj)
+		}
+	}
+}
+
 func TestStringLiteral(t *testing.T) {
 	input := `"Hello World!"`
 
@@ -377,6 +468,25 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("hello world")`, 11},
 		{`len(1)`, "argument to `len` not supported, got INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`len({1: 2, 3: 4})`, 2},
+		{`keys([1])`, "argument to `keys` must be HASH, got ARRAY"},
+		{`delete({}, fn(x) { x })`, "unusable as hash key: FUNCTION"},
+		{`merge({}, 1)`, "argument to `merge` must be HASH, got INTEGER"},
+		{`map(1, fn(x) { x })`, "argument to `map` must be ARRAY, got INTEGER"},
+		{`filter([1], "f")`, "argument to `filter` must be FUNCTION, got STRING"},
+		{`map([1], fn(a, b) { a })`, "wrong number of arguments: want=2, got=1"},
+		{`map([1, 2], fn(x) { if (x > 1) { x + true } else { x } })`, "type mismatch: INTEGER + BOOLEAN"},
+		{`sort([1, "a"])`, "cannot compare STRING and INTEGER"},
+		{`sort([2, 1], fn(a, b) { "x" })`, "comparator passed to `sort` must return INTEGER, got STRING"},
+		{`range("3")`, "argument to `range` must be INTEGER, got STRING"},
+		{`zip()`, "wrong number of arguments. got=0, want at least 1"},
+		{`json_parse(1)`, "argument to `json_parse` must be STRING, got INTEGER"},
+		{`json_parse("[1.5]")`, "json_parse: number 1.5 is not a 64-bit integer"},
+		{`json_parse("[1")`, "json_parse: unexpected end of JSON input"},
+		{`json_stringify(fn(x) { x })`, "json_stringify: cannot encode FUNCTION as JSON"},
+		{`json_stringify({"f": len})`, "json_stringify: cannot encode BUILTIN as JSON"},
+		{`json_stringify({1: 2})`, "json_stringify: hash key must be STRING, got INTEGER"},
+		{`json_stringify([], -1)`, "`json_stringify` indent must be between 0 and 16, got -1"},
 	}
 
 	for _, tt := range tests {
@@ -399,6 +509,30 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+func TestJSONBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`json_parse("[1, -2, true, null, []]")`, `[1, -2, true, null, []]`},
+		{`json_parse(" 42 ")`, `42`},
+		{`json_stringify([1, "a", true, first([])])`, `[1,"a",true,null]`},
+		{`json_stringify({"b": [1], "a": {}})`, `{"a":{},"b":[1]}`},
+		{`json_stringify([1, [2]], 2)`, "[\n  1,\n  [\n    2\n  ]\n]"},
+		{`json_stringify("x", 0)`, `"x"`},
+		{`json_parse(json_stringify({"k": [1, 2]}))["k"][1]`, `2`},
+		{`let config = json_parse(json_stringify({"port": 80, "debug": false})); config["port"] + 1`, `81`},
+		{`keys(json_parse(json_stringify({"b": 1, "a": 2})))`, `[a, b]`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
@@ -408,14 +542,14 @@ func TestArrayLiterals(t *testing.T) {
 		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
 	}
 
-	if len(result.Elements) != 3 {
+	if result.Len() != 3 {
 		t.Fatalf("array has wrong num of elements. got=%d",
-			len(result.Elements))
+			result.Len())
 	}
 
-	testIntegerObject(t, result.Elements[0], 1)
-	testIntegerObject(t, result.Elements[1], 4)
-	testIntegerObject(t, result.Elements[2], 6)
+	testIntegerObject(t, result.At(0), 1)
+	testIntegerObject(t, result.At(1), 4)
+	testIntegerObject(t, result.At(2), 6)
 }
 
 func TestArrayIndexExpression(t *testing.T) {
@@ -493,21 +627,21 @@ func TestHashLiteral(t *testing.T) {
 		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
 	}
 
-	expected := map[object.HashKey]int64{
-		(&object.String{Value: "one"}).HashKey():   1,
-		(&object.String{Value: "two"}).HashKey():   2,
-		(&object.String{Value: "three"}).HashKey(): 3,
-		(&object.Integer{Value: 4}).HashKey():      4,
-		TRUE.HashKey():                             5,
-		FALSE.HashKey():                            6,
+	expected := map[object.Object]int64{
+		&object.String{Value: "one"}:   1,
+		&object.String{Value: "two"}:   2,
+		&object.String{Value: "three"}: 3,
+		&object.Integer{Value: 4}:      4,
+		TRUE:                           5,
+		FALSE:                          6,
 	}
 
-	if len(result.Pairs) != len(expected) {
-		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	if result.Len() != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", result.Len())
 	}
 
 	for expectedKey, expectedValue := range expected {
-		pair, ok := result.Pairs[expectedKey]
+		pair, ok := result.Get(expectedKey)
 		if !ok {
 			t.Errorf("no pair for given key in Pairs")
 		}
@@ -516,6 +650,76 @@ func TestHashLiteral(t *testing.T) {
 	}
 }
 
+func TestHashOrder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b": 1, "a": 2, "c": 3}`, `{b: 1, a: 2, c: 3}`},
+		{`{3: 1, 1: 2, 3: 4}`, `{3: 4, 1: 2}`},
+		{`keys({3: 1, 1: 2, 2: 3})`, `[3, 1, 2]`},
+		{`values({3: 1, 1: 2, 2: 3})`, `[1, 2, 3]`},
+		{`entries({"b": 1, true: 2})`, `[[b, 1], [true, 2]]`},
+		{`has({"a": 1}, "a")`, `true`},
+		{`has({"a": 1}, "b")`, `false`},
+		{`delete({"b": 1, "a": 2, "c": 3}, "a")`, `{b: 1, c: 3}`},
+		{`let h = {"a": 1}; delete(h, "a"); h`, `{a: 1}`},
+		{`merge({"b": 1, "a": 2}, {"c": 3, "b": 4})`, `{b: 4, a: 2, c: 3}`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. want=%s, got=%s",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestHigherOrderBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, `[2, 4, 6]`},
+		{`let f = fn(xs) { let n = 5; map(xs, fn(x) { x + n }) }; f([1, 2])`, `[6, 7]`},
+		{`map([[1], [2, 3]], len)`, `[1, 2]`},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, `[3, 4]`},
+		{`filter([1, 2], fn(x) { if (x > 1) { 1 } })`, `[2]`},
+		{`reduce([1, 2, 3, 4], 0, fn(acc, x) { acc + x })`, `10`},
+		{`reduce(["a", "b"], "", fn(acc, x) { acc + x })`, `ab`},
+		{`each([1, 2], fn(x) { x })`, `null`},
+		{`sort([3, 1, 2])`, `[1, 2, 3]`},
+		{`sort(["b", "c", "a"])`, `[a, b, c]`},
+		{`sort([[2], [1, 5], [1]])`, `[[1], [1, 5], [2]]`},
+		{`sort([3, 1, 2], fn(a, b) { b - a })`, `[3, 2, 1]`},
+		{`sort([[1, "a"], [0, "b"], [1, "c"], [0, "d"]], fn(a, b) { a[0] - b[0] })`, `[[0, b], [0, d], [1, a], [1, c]]`},
+		{`let xs = [2, 1]; sort(xs); xs`, `[2, 1]`},
+		{`range(0)`, `[]`},
+		{`range(3)`, `[0, 1, 2]`},
+		{`range(2, 5)`, `[2, 3, 4]`},
+		{`range(10, 0, -3)`, `[10, 7, 4, 1]`},
+		{`zip([1, 2, 3], ["a", "b"])`, `[[1, a], [2, b]]`},
+		{`zip([1, 2], [3, 4], [5, 6])`, `[[1, 3, 5], [2, 4, 6]]`},
+		{`reverse([1, 2, 3])`, `[3, 2, 1]`},
+		{`reverse("héllo")`, `olléh`},
+		{`flatten([[1], 2, [[3], 4]])`, `[1, 2, [3], 4]`},
+		{`unique([1, 2, 1, "a", "a", [1], [1], true])`, `[1, 2, a, [1], true]`},
+		{`unique([fn(x) { x }, 1])[1]`, `1`},
+		{`len(reduce(range(10000), [], fn(acc, x) { push(acc, x) }))`, `10000`},
+		{`let xs = reduce(range(100), [], fn(acc, x) { push(acc, x) }); [rest(xs)[0], xs[99], len(rest(xs))]`, `[1, 99, 99]`},
+		{`let h = reduce(range(50), {}, fn(acc, x) { merge(acc, {x: x * x}) }); [len(h), h[7], len(delete(h, 7)), h[7]]`, `[50, 49, 49, 49]`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. want=%s, got=%s",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestHashIndexExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -549,6 +753,18 @@ func TestHashIndexExpression(t *testing.T) {
 			`{false: 5}[false]`,
 			5,
 		},
+		{
+			`{[1, 2]: 5}[[1, 2]]`,
+			5,
+		},
+		{
+			`{[1, 2]: 5}[[2, 1]]`,
+			nil,
+		},
+		{
+			`{{"a": 1, "b": 2}: 5}[{"b": 2, "a": 1}]`,
+			5,
+		},
 	}
 
 	for _, tt := range tests {
@@ -561,3 +777,604 @@ func TestHashIndexExpression(t *testing.T) {
 		}
 	}
 }
+
+func TestImportModule(t *testing.T) {
+	dir := t.TempDir()
+	modules := map[string]string{
+		"math.mk": `
+			let base = 10;
+			export let add = fn(a, b) { a + b };
+			export let addBase = fn(a) { add(a, base) };
+			export fn mul(a, b) { a * b }`,
+		"lib/twice.mk": `
+			import "math.mk" as m;
+			let base = 100;
+			export let twice = fn(a) { m.add(a, a) + base };`,
+		"cycle/a.mk":  `import "./b.mk" as b;`,
+		"cycle/b.mk":  `import "./a.mk" as a;`,
+		"badconst.mk": `export let f = fn() { const b = 1; let b = 2; b };`,
+		"macros.mk": `
+			let twice = macro(x) { quote(unquote(x) + unquote(x)) };
+			export let quadruple = fn(a) { twice(twice(a)) };`,
+	}
+	for name, source := range modules {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("os.MkdirAll() failed, error:%s", err)
+		}
+		if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+			t.Fatalf("os.WriteFile() failed, error:%s", err)
+		}
+	}
+	loader := NewLoader(dir)
+
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`import "macros.mk" as macros; macros.quadruple(3)`, 12},
+		{`import "math.mk" as math; math.add(1, 2)`, 3},
+		{`import "math.mk" as math; math.addBase(1)`, 11},
+		{`let base = 5; import "math.mk" as math; math.addBase(base)`, 15},
+		{`import "lib/twice.mk" as t; t.twice(2)`, 104},
+		{`import "math.mk" as math; math.mul(2, 3)`, 6},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEvalWithLoader(tt.input, loader), tt.expected)
+	}
+
+	// 加载器保存在环境中，没有设置加载器的环境使用默认的搜索路径
+	if _, ok := testEval(`import "math.mk" as math;`).(*object.Error); !ok {
+		t.Errorf("environment without a loader found math.mk in %s", dir)
+	}
+
+	errorTests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`import "math.mk" as math; math.base`, "has no exported member base"},
+		{`import "missing.mk" as m;`, `module not found: "missing.mk"`},
+		{`import "cycle/a.mk" as a;`, "import cycle: "},
+		{`import "badconst.mk" as m;`, "badconst.mk: cannot redefine constant b"},
+	}
+	for _, tt := range errorTests {
+		errObj, ok := testEvalWithLoader(tt.input, loader).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if !strings.Contains(errObj.Message, tt.expectedMessage) {
+			t.Errorf("wrong error message. expected to contain %q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestImportNativeModule(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatalf("os.WriteFile() failed, error:%s", err)
+	}
+	input := `import "io" as io; io.read_file("` + filepath.Join(dir, "a.txt") + `")`
+
+	errObj, ok := testEval(input).(*object.Error)
+	if !ok || !strings.Contains(errObj.Message, "outside the allowed directories") {
+		t.Errorf("io module is not sandboxed by default, got=%v", errObj)
+	}
+
+	l := module.NewLoader()
+	l.Register(stdlib.NewIO(stdlib.Capabilities{Dirs: []string{dir}}))
+	if result := testEvalWithLoader(input, l); result.Inspect() != "hello" {
+		t.Errorf("io.read_file wrong. got=%s", result.Inspect())
+	}
+	testBooleanObject(t, testEvalWithLoader(`import "io" as a; import "io" as b; a.print == b.print`, l), true)
+}
+
+func TestDefaultRestAndSpread(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let f = fn(a, b = 2) { a + b }; f(1)`, "3"},
+		{`let f = fn(a, b = 2) { a + b }; f(1, 5)`, "6"},
+		{`let f = fn(a = 1, b = a * 10) { a + b }; f()`, "11"},
+		{`let f = fn(a = 1, b = a * 10) { a + b }; f(2)`, "22"},
+		{`let base = 10; let f = fn(a = base) { a }; f()`, "10"},
+		{`let sum = fn(n, acc = 0) { if (n == 0) { acc } else { sum(n - 1, acc + n) } }; sum(4)`, "10"},
+		{`let f = fn(a, ...rest) { rest }; f(1, 2, 3)`, "[2, 3]"},
+		{`let f = fn(a, ...rest) { rest }; f(1)`, "[]"},
+		{`let f = fn(a, b = 5, ...rest) { b + len(rest) }; f(1, 2, 3, 4)`, "4"},
+		{`let add = fn(a, b, c) { a + b + c }; add(1, ...[2], 3)`, "6"},
+		{`let f = fn(...args) { args }; f(...[], ...[1], 2)`, "[1, 2]"},
+		{`push(...[[1], 2])`, "[1, 2]"},
+		{`map([1, 2], fn(x, y = 10) { x + y })`, "[11, 12]"},
+		{`fn(a, b = 2, ...c) { a }`, "fn(a, b, ...c)"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`fn(a, b) { a + b }(1)`, "wrong number of arguments: want=2, got=1"},
+		{`let add = fn(a, b) { a + b }; add(1)`, "wrong number of arguments to `add`: want=2, got=1"},
+		{`let inc = fn(a, b = 1) { a + b }; inc(1, 2, 3)`, "wrong number of arguments to `inc`: want=1 to 2, got=3"},
+		{`let f = fn(a, ...rest) { a }; f()`, "wrong number of arguments to `f`: want=at least 1, got=0"},
+		{`fn(a) { a }(...1)`, "spread argument must be ARRAY, got INTEGER"},
+		{`let f = fn(a = b) { a }; f()`, "identifier not found: b"},
+	}
+	for _, tt := range errorTests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let [a, b] = [1, 2]; a * 10 + b`, "12"},
+		{`let [head, ...tail] = [1, 2, 3]; tail`, "[2, 3]"},
+		{`let [a, ...rest] = [1]; rest`, "[]"},
+		{`let {name, age: years} = {"name": "ann", "age": 3}; len(name) * years`, "9"},
+		{`let {pos: [x, y]} = {"pos": [3, 4], "id": 1}; x * y`, "12"},
+		{`let [{a}, [b]] = [{"a": 1}, [2]]; a + b`, "3"},
+		{`let f = fn(pair) { let [a, b] = pair; b - a }; f([1, 5])`, "4"},
+		{`let a = 1; let g = fn() { let [a] = [2]; a }; g() + a`, "3"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`let [a, b] = [1];`, "cannot destructure array of length 1 into 2 elements"},
+		{`let [a, b] = [1, 2, 3];`, "cannot destructure array of length 3 into 2 elements"},
+		{`let [a, b, ...c] = [1];`, "cannot destructure array of length 1 into at least 2 elements"},
+		{`let [a] = 1;`, "cannot destructure INTEGER as array"},
+		{`let {a} = [1];`, "cannot destructure ARRAY as hash"},
+		{`let {a, b} = {"a": 1};`, `cannot destructure hash without key "b"`},
+		{`let {p: [x]} = {"p": 1};`, "cannot destructure INTEGER as array"},
+	}
+	for _, tt := range errorTests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestConstants(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"const a = 2; a * 3", "6"},
+		{"const [a, {b}] = [1, {\"b\": 2}]; a + b", "3"},
+		{"let a = 1; let a = 2; a", "2"},
+		{"let a = 1; const a = 2; a", "2"},
+		{"const a = 1; let f = fn(a) { let b = fn() { let a = 3; a }; b() + a }; f(2) + a", "6"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errorTests := []string{
+		"const a = 1; let a = 2;",
+		"const a = 1; const a = 2;",
+		"const a = 1; fn a() {}",
+		"const [a, {b}] = [1, {\"b\": 2}]; let {b} = {\"b\": 3};",
+		"let f = fn() { const a = 1; let a = 2; }; f()",
+	}
+	for _, input := range errorTests {
+		errObj, ok := testEval(input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", input)
+			continue
+		}
+		name := "a"
+		if strings.Contains(input, "{b}") {
+			name = "b"
+		}
+		if errObj.Message != "cannot redefine constant "+name {
+			t.Errorf("wrong error message for %q. got=%q", input, errObj.Message)
+		}
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	describe := `let describe = fn(v) {
+		match (v) {
+			0 => "zero",
+			"x" => "ex",
+			[a, b] => a + b,
+			[h, ...t] if len(t) > 1 => len(t),
+			{type: "point", pos: [x, y]} => x * y,
+			true => "yes",
+			n if n == -3 => "negative",
+			_ => "other"
+		}
+	};`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{describe + `describe(0)`, "zero"},
+		{describe + `describe("x")`, "ex"},
+		{describe + `describe([3, 4])`, "7"},
+		{describe + `describe([1, 2, 3])`, "2"},
+		{describe + `describe([1])`, "other"},
+		{describe + `describe({"type": "point", "pos": [2, 5]})`, "10"},
+		{describe + `describe({"type": "line", "pos": [2, 5]})`, "other"},
+		{describe + `describe(true)`, "yes"},
+		{describe + `describe(-3)`, "negative"},
+		{describe + `describe(false)`, "other"},
+		{`match (1) { 2 => "two" }`, "null"},
+		{`match (1) { 1 => "first", 1 => "second" }`, "first"},
+		{`match (5) { x => { let y = x * 2; y } }`, "10"},
+		{`match ([1, [2, 3]]) { [1, [2, 4]] => "a", [1, [2, z]] => z }`, "3"},
+		{`let f = fn(x) { match (x) { 1 => { return "early"; } } "late" }; f(1) + f(2)`, "earlylate"},
+		// 分支中的变量遮蔽外层的同名变量，分支结束后不再可见
+		{`let x = 10; match (2) { x => x }`, "2"},
+		{`let x = 10; match (2) { x => x }; x`, "10"},
+		{`const x = 10; match (2) { x => x, _ => 0 }`, "2"},
+		{`let f = fn() { let x = 1; let y = match (2) { x => x }; [x, y] }; f()`, "[1, 2]"},
+		{`match (1) { y => y }; y`, "ERROR: identifier not found: y"},
+		{`match (1) { 1 => { let z = 2; z }, _ => 0 }; z`, "ERROR: identifier not found: z"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input         string
+		expected      []string
+		expectedError string
+	}{
+		{"match (1) { 1 => 2 }", []string{"1:1: " + compiler.NonExhaustiveMatch}, ""},
+		{"let x = 1;\nfn() { match (x) { n if n > 0 => n } }", []string{"2:8: " + compiler.NonExhaustiveMatch}, ""},
+		{"match (1) { 1 => 2, _ => 3 }", []string{}, ""},
+		{"match (1 > 0) { true => 1, false => 0 }", []string{}, ""},
+		{"let a = 1;\nlet a = 2;", []string{"2:5: a is already defined in this scope"}, ""},
+		{"let a = 1; const a = 2; let b = a;", []string{"1:18: a is already defined in this scope"}, ""},
+		{"fn f() {} fn f() {}", []string{"1:14: f is already defined in this scope"}, ""},
+		{"let f = 1; fn f() {}", []string{"1:15: f is already defined in this scope"}, ""},
+		{"fn() { fn g() {} let g = 1; }", []string{"1:22: g is already defined in this scope"}, ""},
+		{"let [a, b] = [1, 2]; let {b} = {\"b\": 3};", []string{"1:27: b is already defined in this scope"}, ""},
+		{"if (true) { let a = 1; } let a = 2;", []string{"1:30: a is already defined in this scope"}, ""},
+		{"let f = fn(x) { let x = 1; x };", []string{"1:21: x is already defined in this scope"}, ""},
+		{"let f = fn() { let g = fn() { g }; let g = 2; };", []string{"1:40: g is already defined in this scope"}, ""},
+		{"let a = 1; match (2) { a => { let a = 3; a } }", []string{"1:35: a is already defined in this scope"}, ""},
+		{"let a = 1; fn() { let a = 2; }", []string{}, ""},
+		{"let f = fn(a, b = fn() { let a = 1; let a = 2; }) { a };", []string{"1:41: a is already defined in this scope"}, ""},
+		{"match ([1]) { [x] => x, x => x }", []string{}, ""},
+		{"fn f() { g() } fn g() { f() }", []string{}, ""},
+		{"const a = 1; fn() { let a = 2; let a = 3; }", []string{"1:36: a is already defined in this scope"}, ""},
+		{"const a = 1; match (2) { a => a }", []string{}, ""},
+		// 编译器拒绝的程序在求值之前报错，即使出错的代码不会被执行
+		{"let f = fn() { const b = 1; let b = 2; b };", []string{}, "cannot redefine constant b"},
+		{"const a = 1; let [a] = [2];", []string{}, "cannot redefine constant a"},
+		{"fn f() {} const f = 1; fn() { const f = 2; }", []string{"1:17: f is already defined in this scope"}, ""},
+		{"f(); fn f() {}", []string{}, "function f is used before its declaration"},
+		{"fn() { map([1], fn(x) { g(x) }); fn g(x) { x } }", []string{}, "function g is used before its declaration"},
+	}
+
+	for _, tt := range tests {
+		program := parser.NewParser(lexer.NewLexer(tt.input)).ParseProgram()
+		result, err := Check(program, object.NewEnvironment())
+		warnings := []string{}
+		for _, w := range result {
+			warnings = append(warnings, w.String())
+		}
+		errMsg := ""
+		if err != nil {
+			errMsg = err.Error()
+		}
+		if errMsg != tt.expectedError {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expectedError, errMsg)
+		}
+
+		// 与编译器给出的警告和错误一致
+		comp := compiler.NewCompiler()
+		compileErr := comp.Compile(program)
+		if compileErr != nil {
+			if compileErr.Error() != tt.expectedError {
+				t.Errorf("compiler error for %q differs. compiler=%q, got=%q", tt.input, compileErr, errMsg)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(warnings, tt.expected) {
+			t.Errorf("wrong warnings for %q. want=%q, got=%q", tt.input, tt.expected, warnings)
+		}
+		compilerWarnings := []string{}
+		for _, w := range comp.Warnings() {
+			compilerWarnings = append(compilerWarnings, w.String())
+		}
+		if !reflect.DeepEqual(warnings, compilerWarnings) {
+			t.Errorf("warnings for %q differ from the compiler. compiler=%q, got=%q", tt.input, compilerWarnings, warnings)
+		}
+	}
+
+	// 环境中已定义的名称属于顶层作用域
+	env := object.NewEnvironment()
+	Eval(parser.NewParser(lexer.NewLexer("let y = 1; const z = 2;")).ParseProgram(), env)
+	warnings, err := Check(parser.NewParser(lexer.NewLexer("let y = 2;")).ParseProgram(), env)
+	if err != nil || len(warnings) != 1 || warnings[0].String() != "1:5: y is already defined in this scope" {
+		t.Errorf("wrong warnings for names defined in the environment: %q, error=%v", warnings, err)
+	}
+	_, err = Check(parser.NewParser(lexer.NewLexer("let z = 3;")).ParseProgram(), env)
+	if err == nil || err.Error() != "cannot redefine constant z" {
+		t.Errorf("wrong error for a constant defined in the environment: %v", err)
+	}
+}
+
+func TestContext(t *testing.T) {
+	var out bytes.Buffer
+	env := object.NewEnvironment()
+	env.SetContext(&object.Context{Stdout: &out})
+
+	input := `let show = fn(x) { puts(x) }; puts("a", 1); map([2, 3], show);`
+	Eval(parser.NewParser(lexer.NewLexer(input)).ParseProgram(), env)
+	if out.String() != "a\n1\n2\n3\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(5)`, `5`},
+		{`quote(5 + 8)`, `(5 + 8)`},
+		{`quote(foobar)`, `foobar`},
+		{`quote(foobar + barfoo)`, `(foobar + barfoo)`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			t.Fatalf("expected *object.Quote. got=%T (%+v)", evaluated, evaluated)
+		}
+
+		if quote.Node == nil {
+			t.Fatalf("quote.Node is nil")
+		}
+
+		if quote.Node.String() != tt.expected {
+			t.Errorf("not equal. got=%q, want=%q", quote.Node.String(), tt.expected)
+		}
+	}
+}
+
+func TestQuoteUnquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(unquote(4))`, `4`},
+		{`quote(unquote(4 + 4))`, `8`},
+		{`quote(8 + unquote(4 + 4))`, `(8 + 8)`},
+		{`quote(unquote(4 + 4) + 8)`, `(8 + 8)`},
+		{`let foobar = 8; quote(foobar)`, `foobar`},
+		{`let foobar = 8; quote(unquote(foobar))`, `8`},
+		{`quote(unquote(true))`, `true`},
+		{`quote(unquote(true == false))`, `false`},
+		{`quote(unquote("a" + "b"))`, `"ab"`},
+		{`quote(unquote([1, 2 + 3]))`, `[1, 5]`},
+		{`quote(unquote(quote(4 + 4)))`, `(4 + 4)`},
+		{`let quotedInfixExpression = quote(4 + 4);
+		quote(unquote(4 + 4) + unquote(quotedInfixExpression))`, `(8 + (4 + 4))`},
+		// 函数等无法转换为AST的值保留unquote调用
+		{`quote(unquote(fn(x) { x }))`, `unquote(fn(x) { x })`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			t.Fatalf("expected *object.Quote. got=%T (%+v)", evaluated, evaluated)
+		}
+
+		if quote.Node.String() != tt.expected {
+			t.Errorf("not equal. got=%q, want=%q", quote.Node.String(), tt.expected)
+		}
+	}
+}
+
+func TestDefineMacros(t *testing.T) {
+	input := `
+	let number = 1;
+	let function = fn(x, y) { x + y };
+	let mymacro = macro(x, y) { x + y; };
+	`
+
+	env := object.NewEnvironment()
+	program := testParseProgram(input)
+
+	DefineMacros(program, env)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("Wrong number of statements. got=%d", len(program.Statements))
+	}
+
+	_, ok := env.Get("number")
+	if ok {
+		t.Fatalf("number should not be defined")
+	}
+	_, ok = env.Get("function")
+	if ok {
+		t.Fatalf("function should not be defined")
+	}
+
+	obj, ok := env.Get("mymacro")
+	if !ok {
+		t.Fatalf("macro not in environment.")
+	}
+
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		t.Fatalf("object is not Macro. got=%T (%+v)", obj, obj)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("Wrong number of macro parameters. got=%d", len(macro.Parameters))
+	}
+
+	if macro.Parameters[0].String() != "x" || macro.Parameters[1].String() != "y" {
+		t.Fatalf("parameters wrong. got=%v", macro.Parameters)
+	}
+
+	expectedBody := "(x + y)"
+	if macro.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, macro.Body.String())
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+			let infixExpression = macro() { quote(1 + 2); };
+
+			infixExpression();
+			`,
+			`(1 + 2)`,
+		},
+		{
+			`
+			let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); };
+
+			reverse(2 + 2, 10 - 5);
+			`,
+			`(10 - 5) - (2 + 2)`,
+		},
+		{
+			`
+			let unless = macro(condition, consequence, alternative) {
+				quote(if (!(unquote(condition))) {
+					unquote(consequence);
+				} else {
+					unquote(alternative);
+				});
+			};
+
+			unless(10 > 5, puts("not greater"), puts("greater"));
+			`,
+			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
+		},
+		{
+			// 同一个宏多次调用互不影响
+			`
+			let twice = macro(x) { quote(unquote(x) + unquote(x)); };
+
+			twice(1);
+			twice(2);
+			`,
+			`(1 + 1); (2 + 2)`,
+		},
+		{
+			// 宏展开的结果中的宏调用继续展开
+			`
+			let one = macro() { quote(1); };
+			let plusOne = macro(x) { quote(unquote(x) + one()); };
+
+			plusOne(2);
+			`,
+			`(2 + 1)`,
+		},
+	}
+
+	for _, tt := range tests {
+		expected := testParseProgram(tt.expected)
+		program := testParseProgram(tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Fatalf("ExpandMacros failed, input:%s, error:%s", tt.input, err)
+		}
+
+		if expanded.String() != expected.String() {
+			t.Errorf("not equal. want=%q, got=%q", expected.String(), expanded.String())
+		}
+	}
+}
+
+func TestExpandMacrosErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let m = macro(x) { x; }; m(1, 2)`,
+			"wrong number of arguments to macro m: want=1, got=2",
+		},
+		{
+			`let m = macro() { 1; }; m()`,
+			"macro m must return a quote, got INTEGER",
+		},
+		{
+			`let m = macro() { -true; }; m()`,
+			"macro m: unknown operator: -BOOLEAN",
+		},
+		{
+			`let m = macro() { quote(m()); }; m()`,
+			"macro expansion exceeds depth 100",
+		},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+
+		_, err := ExpandMacros(program, env)
+		if err == nil {
+			t.Fatalf("expected error for %q", tt.input)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func testParseProgram(input string) *ast.Program {
+	l := lexer.NewLexer(input)
+	p := parser.NewParser(l)
+	return p.ParseProgram()
+}
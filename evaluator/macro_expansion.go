@@ -0,0 +1,163 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/nicolerobin/monkey/ast"
+	"github.com/nicolerobin/monkey/module"
+	"github.com/nicolerobin/monkey/object"
+)
+
+// maxExpansionDepth 宏展开结果中再次出现宏调用时的最大展开深度
+const maxExpansionDepth = 100
+
+// DefineMacros 将程序顶层以let绑定的宏保存到env中，并从程序中移除这些定义
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	statements := program.Statements[:0]
+
+	for _, statement := range program.Statements {
+		letStatement, ok := statement.(*ast.LetStatement)
+		if !ok {
+			statements = append(statements, statement)
+			continue
+		}
+		macroLiteral, ok := letStatement.Value.(*ast.MacroLiteral)
+		if !ok || letStatement.Pattern != nil {
+			statements = append(statements, statement)
+			continue
+		}
+
+		env.Set(letStatement.Name.Value, &object.Macro{
+			Parameters: macroLiteral.Parameters,
+			Env:        env,
+			Body:       macroLiteral.Body,
+		})
+	}
+
+	program.Statements = statements
+}
+
+// MacroExpander 返回在env中定义程序顶层的宏并展开宏调用的module.Expander，
+// 多次解析共用同一个env时，之前定义的宏在之后的程序中仍然可用
+func MacroExpander(env *object.Environment) module.Expander {
+	return func(program *ast.Program) (*ast.Program, error) {
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			return nil, err
+		}
+		return expanded.(*ast.Program), nil
+	}
+}
+
+// NewLoader 创建展开模块中宏的模块加载器，每个模块的宏只在模块内部可见
+func NewLoader(searchPaths ...string) *module.Loader {
+	l := module.NewLoader(searchPaths...)
+	l.Expand = func(program *ast.Program) (*ast.Program, error) {
+		return MacroExpander(object.NewEnvironment())(program)
+	}
+	return l
+}
+
+// ExpandMacros 将程序中对env中宏的调用替换为宏返回的AST，在解析之后、求值或编译之前执行
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, error) {
+	return expandMacros(program, env, 0)
+}
+
+func expandMacros(program ast.Node, env *object.Environment, depth int) (ast.Node, error) {
+	if depth > maxExpansionDepth {
+		return nil, fmt.Errorf("macro expansion exceeds depth %d", maxExpansionDepth)
+	}
+
+	var expandErr error
+	expanded := ast.Modify(program, func(node ast.Node) ast.Node {
+		if expandErr != nil {
+			return node
+		}
+
+		call, ok := node.(*ast.CallExpression)
+		if !ok {
+			return node
+		}
+		macro, ok := isMacroCall(call, env)
+		if !ok {
+			return node
+		}
+
+		for _, a := range call.Arguments {
+			if _, ok := a.(*ast.SpreadExpression); ok {
+				expandErr = fmt.Errorf("spread arguments are not supported in calls to macro %s", call.Function)
+				return node
+			}
+		}
+		if len(call.Arguments) != len(macro.Parameters) {
+			expandErr = fmt.Errorf("wrong number of arguments to macro %s: want=%d, got=%d",
+				call.Function, len(macro.Parameters), len(call.Arguments))
+			return node
+		}
+
+		evaluated := Eval(macro.Body, extendMacroEnv(macro, quoteArgs(call)))
+		evaluated = unwrapReturnValue(evaluated)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			expandErr = fmt.Errorf("macro %s: %s", call.Function, errObj.Message)
+			return node
+		}
+
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			expandErr = fmt.Errorf("macro %s must return a quote, got %s", call.Function, typeOf(evaluated))
+			return node
+		}
+
+		// 宏返回的AST中可能包含新的宏调用
+		result, err := expandMacros(quote.Node, env, depth+1)
+		if err != nil {
+			expandErr = err
+			return node
+		}
+		return result
+	})
+
+	if expandErr != nil {
+		return nil, expandErr
+	}
+	return expanded, nil
+}
+
+func isMacroCall(exp *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
+	identifier, ok := exp.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+
+	obj, ok := env.Get(identifier.Value)
+	if !ok {
+		return nil, false
+	}
+
+	macro, ok := obj.(*object.Macro)
+	return macro, ok
+}
+
+func quoteArgs(exp *ast.CallExpression) []*object.Quote {
+	args := []*object.Quote{}
+	for _, a := range exp.Arguments {
+		args = append(args, &object.Quote{Node: a})
+	}
+	return args
+}
+
+func extendMacroEnv(macro *object.Macro, args []*object.Quote) *object.Environment {
+	extended := object.NewEnclosedEnvironment(macro.Env)
+	for paramIdx, param := range macro.Parameters {
+		extended.Set(param.Value, args[paramIdx])
+	}
+	return extended
+}
+
+func typeOf(obj object.Object) string {
+	if obj == nil {
+		return "nothing"
+	}
+	return string(obj.Type())
+}
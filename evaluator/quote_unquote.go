@@ -0,0 +1,80 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/nicolerobin/monkey/ast"
+	"github.com/nicolerobin/monkey/object"
+	"github.com/nicolerobin/monkey/token"
+)
+
+// quote 返回包裹node的Quote对象，node中的unquote调用在此时求值并替换为结果对应的AST节点
+func quote(node ast.Node, env *object.Environment) object.Object {
+	node = evalUnquoteCalls(ast.Copy(node), env)
+	return &object.Quote{Node: node}
+}
+
+func evalUnquoteCalls(quoted ast.Node, env *object.Environment) ast.Node {
+	return ast.Modify(quoted, func(node ast.Node) ast.Node {
+		if !isCallTo(node, "unquote") {
+			return node
+		}
+
+		call := node.(*ast.CallExpression)
+		if len(call.Arguments) != 1 {
+			return node
+		}
+
+		unquoted := Eval(call.Arguments[0], env)
+		converted := convertObjectToASTNode(unquoted)
+		if converted == nil {
+			return node
+		}
+		return converted
+	})
+}
+
+// isCallTo 判断node是否为对名为name的标识符的调用
+func isCallTo(node ast.Node, name string) bool {
+	call, ok := node.(*ast.CallExpression)
+	if !ok {
+		return false
+	}
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == name
+}
+
+// convertObjectToASTNode 将unquote的求值结果转换为AST节点，无法转换时返回nil
+func convertObjectToASTNode(obj object.Object) ast.Node {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		t := token.Token{Type: token.INT, Literal: fmt.Sprintf("%d", obj.Value)}
+		return &ast.IntegerLiteral{Token: t, Value: obj.Value}
+	case *object.Boolean:
+		var t token.Token
+		if obj.Value {
+			t = token.Token{Type: token.TRUE, Literal: "true"}
+		} else {
+			t = token.Token{Type: token.FALSE, Literal: "false"}
+		}
+		return &ast.Boolean{Token: t, Value: obj.Value}
+	case *object.String:
+		t := token.Token{Type: token.STRING, Literal: obj.Value}
+		return &ast.StringLiteral{Token: t, Value: obj.Value}
+	case *object.Array:
+		elements := make([]ast.Expression, 0, obj.Len())
+		for _, el := range obj.Elements() {
+			node, ok := convertObjectToASTNode(el).(ast.Expression)
+			if !ok {
+				return nil
+			}
+			elements = append(elements, node)
+		}
+		t := token.Token{Type: token.LBRACKET, Literal: "["}
+		return &ast.ArrayLiteral{Token: t, Elements: elements}
+	case *object.Quote:
+		return obj.Node
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,26 @@
+package evaluator
+
+import (
+	"errors"
+
+	"github.com/nicolerobin/monkey/ast"
+	"github.com/nicolerobin/monkey/compiler"
+	"github.com/nicolerobin/monkey/object"
+)
+
+// Check 在求值之前按照编译器的作用域规则检查程序，返回与编译器相同的警告，以及编译器会报告的第一个名称错误，
+// 例如在未调用的函数中重新定义常量，使解释器引擎与虚拟机引擎给出一致的提示和错误。
+// env为将要求值程序的环境，其中已定义的名称视为顶层作用域中已有的定义
+func Check(program *ast.Program, env *object.Environment) ([]compiler.Warning, error) {
+	names := make(map[string]bool)
+	for _, name := range env.Names() {
+		names[name] = env.IsConstant(name)
+	}
+
+	r := compiler.NewResolver(names)
+	r.Resolve(program)
+	if errs := r.Errors(); len(errs) > 0 {
+		return r.Warnings(), errors.New(errs[0].Message)
+	}
+	return r.Warnings(), nil
+}
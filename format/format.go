@@ -0,0 +1,277 @@
+package format
+
+import (
+	"strings"
+
+	"github.com/nicolerobin/monkey/ast"
+	"github.com/nicolerobin/monkey/lexer"
+	"github.com/nicolerobin/monkey/parser"
+)
+
+const indentUnit = "    "
+
+// Program 将语法树格式化为规范的源代码：每条语句占一行，代码块缩进，只保留必要的括号
+func Program(program *ast.Program) string {
+	p := &printer{}
+	for _, stmt := range program.Statements {
+		p.statement(stmt, false)
+		p.out.WriteString("\n")
+	}
+	return p.out.String()
+}
+
+// Source 解析并格式化源代码，存在解析错误时返回错误信息
+func Source(source string) (string, []string) {
+	p := parser.NewParser(lexer.NewLexer(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return "", p.Errors()
+	}
+	return Program(program), nil
+}
+
+type printer struct {
+	out    strings.Builder
+	indent int
+}
+
+func (p *printer) writeIndent() {
+	p.out.WriteString(strings.Repeat(indentUnit, p.indent))
+}
+
+// statement 输出一条语句，implicit为true时表示该语句是代码块的最后一条，其值作为代码块的值，省略末尾分号
+func (p *printer) statement(stmt ast.Statement, implicit bool) {
+	p.writeIndent()
+
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		if stmt.Exported {
+			p.out.WriteString("export ")
+		}
+		keyword := "let "
+		if stmt.Constant {
+			keyword = "const "
+		}
+		if stmt.Pattern != nil {
+			p.out.WriteString(keyword + stmt.Pattern.String() + " = ")
+		} else {
+			p.out.WriteString(keyword + stmt.Name.Value + " = ")
+		}
+		p.expression(stmt.Value)
+		p.out.WriteString(";")
+	case *ast.FunctionStatement:
+		if stmt.Exported {
+			p.out.WriteString("export ")
+		}
+		p.function(stmt.Name.Value, stmt.Function)
+	case *ast.ReturnStatement:
+		p.out.WriteString("return ")
+		p.expression(stmt.ReturnValue)
+		p.out.WriteString(";")
+	case *ast.ImportStatement:
+		p.out.WriteString("import \"" + stmt.Path.Value + "\" as " + stmt.Alias.Value + ";")
+	case *ast.ExpressionStatement:
+		p.expression(stmt.Expression)
+		if !implicit {
+			p.out.WriteString(";")
+		}
+	default:
+		p.out.WriteString(stmt.String())
+	}
+}
+
+// function 输出函数字面量，name不为空时输出为具名函数声明
+func (p *printer) function(name string, fn *ast.FunctionLiteral) {
+	p.out.WriteString("fn")
+	if name != "" {
+		p.out.WriteString(" " + name)
+	}
+	p.out.WriteString("(")
+	for i, param := range fn.Parameters {
+		if i > 0 {
+			p.out.WriteString(", ")
+		}
+		p.out.WriteString(param.Value)
+		if d := fn.Default(i); d != nil {
+			p.out.WriteString(" = ")
+			p.expression(d)
+		}
+	}
+	if fn.Rest != nil {
+		if len(fn.Parameters) > 0 {
+			p.out.WriteString(", ")
+		}
+		p.out.WriteString("..." + fn.Rest.Value)
+	}
+	p.out.WriteString(") ")
+	p.block(fn.Body)
+}
+
+// block 输出花括号包围的代码块
+func (p *printer) block(block *ast.BlockStatement) {
+	if len(block.Statements) == 0 {
+		p.out.WriteString("{}")
+		return
+	}
+
+	p.out.WriteString("{\n")
+	p.indent++
+	for i, stmt := range block.Statements {
+		p.statement(stmt, i == len(block.Statements)-1)
+		p.out.WriteString("\n")
+	}
+	p.indent--
+	p.writeIndent()
+	p.out.WriteString("}")
+}
+
+func (p *printer) expression(exp ast.Expression) {
+	switch exp := exp.(type) {
+	case *ast.StringLiteral:
+		p.out.WriteString("\"" + exp.Value + "\"")
+	case *ast.PrefixExpression:
+		p.out.WriteString(exp.Operator)
+		_, infix := exp.Right.(*ast.InfixExpression)
+		p.operand(exp.Right, infix)
+	case *ast.InfixExpression:
+		precedence := parser.Precedence(exp.Token.Type)
+		// 运算符左结合，右侧同优先级的运算需要括号
+		p.operand(exp.Left, infixPrecedence(exp.Left) < precedence)
+		p.out.WriteString(" " + exp.Operator + " ")
+		p.operand(exp.Right, infixPrecedence(exp.Right) <= precedence)
+	case *ast.IfExpression:
+		p.out.WriteString("if (")
+		p.expression(exp.Condition)
+		p.out.WriteString(") ")
+		p.block(exp.Consequence)
+		if exp.Alternative != nil {
+			p.out.WriteString(" else ")
+			p.block(exp.Alternative)
+		}
+	case *ast.MatchExpression:
+		p.match(exp)
+	case *ast.FunctionLiteral:
+		p.function("", exp)
+	case *ast.MacroLiteral:
+		params := []string{}
+		for _, param := range exp.Parameters {
+			params = append(params, param.Value)
+		}
+		p.out.WriteString("macro(" + strings.Join(params, ", ") + ") ")
+		p.block(exp.Body)
+	case *ast.CallExpression:
+		p.operand(exp.Function, needsParensAsOperand(exp.Function))
+		p.out.WriteString("(")
+		p.list(exp.Arguments)
+		p.out.WriteString(")")
+	case *ast.SpreadExpression:
+		p.out.WriteString("...")
+		p.expression(exp.Value)
+	case *ast.ArrayLiteral:
+		p.out.WriteString("[")
+		p.list(exp.Elements)
+		p.out.WriteString("]")
+	case *ast.IndexExpression:
+		p.operand(exp.Left, needsParensAsOperand(exp.Left))
+		p.out.WriteString("[")
+		p.expression(exp.Index)
+		p.out.WriteString("]")
+	case *ast.MemberExpression:
+		p.operand(exp.Object, needsParensAsOperand(exp.Object))
+		p.out.WriteString("." + exp.Property.Value)
+	case *ast.HashLiteral:
+		p.hash(exp)
+	default:
+		p.out.WriteString(exp.String())
+	}
+}
+
+// match 输出match表达式，每个分支占一行，只有一个表达式的分支体省略花括号
+func (p *printer) match(match *ast.MatchExpression) {
+	p.out.WriteString("match (")
+	p.expression(match.Subject)
+	p.out.WriteString(") {\n")
+	p.indent++
+	for _, arm := range match.Arms {
+		p.writeIndent()
+		p.out.WriteString(arm.Pattern.String())
+		if arm.Guard != nil {
+			p.out.WriteString(" if ")
+			p.expression(arm.Guard)
+		}
+		p.out.WriteString(" => ")
+		if stmt, ok := singleExpression(arm.Body); ok {
+			p.expression(stmt.Expression)
+		} else {
+			p.block(arm.Body)
+		}
+		p.out.WriteString(",\n")
+	}
+	p.indent--
+	p.writeIndent()
+	p.out.WriteString("}")
+}
+
+// singleExpression 判断代码块是否只有一条表达式语句。哈希字面量以花括号开头，省略外层花括号后会被解析为代码块，不算在内
+func singleExpression(block *ast.BlockStatement) (*ast.ExpressionStatement, bool) {
+	if len(block.Statements) != 1 {
+		return nil, false
+	}
+	stmt, ok := block.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		return nil, false
+	}
+	_, isHash := stmt.Expression.(*ast.HashLiteral)
+	return stmt, !isHash
+}
+
+func (p *printer) operand(exp ast.Expression, parens bool) {
+	if parens {
+		p.out.WriteString("(")
+	}
+	p.expression(exp)
+	if parens {
+		p.out.WriteString(")")
+	}
+}
+
+func (p *printer) list(exps []ast.Expression) {
+	for i, exp := range exps {
+		if i > 0 {
+			p.out.WriteString(", ")
+		}
+		p.expression(exp)
+	}
+}
+
+// hash 输出哈希字面量，键值对保持源码中的顺序
+func (p *printer) hash(hash *ast.HashLiteral) {
+	pairs := []string{}
+	for _, key := range hash.Keys {
+		pairPrinter := &printer{indent: p.indent}
+		pairPrinter.expression(key)
+		pairPrinter.out.WriteString(": ")
+		pairPrinter.expression(hash.Pairs[key])
+		pairs = append(pairs, pairPrinter.out.String())
+	}
+
+	p.out.WriteString("{" + strings.Join(pairs, ", ") + "}")
+}
+
+// infixPrecedence 返回作为中缀运算操作数时表达式的优先级，非中缀表达式不需要括号
+func infixPrecedence(exp ast.Expression) int {
+	if infix, ok := exp.(*ast.InfixExpression); ok {
+		return parser.Precedence(infix.Token.Type)
+	}
+	return parser.INDEX + 1
+}
+
+// needsParensAsOperand 判断表达式作为调用、下标或成员访问的操作数时是否需要括号
+func needsParensAsOperand(exp ast.Expression) bool {
+	switch exp.(type) {
+	case *ast.InfixExpression, *ast.PrefixExpression:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,85 @@
+package format
+
+import (
+	"testing"
+
+	"github.com/nicolerobin/monkey/lexer"
+	"github.com/nicolerobin/monkey/parser"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1+2*3", "1 + 2 * 3;\n"},
+		{"(1+2)*3", "(1 + 2) * 3;\n"},
+		{"1-(2-3)", "1 - (2 - 3);\n"},
+		{"(1-2)-3", "1 - 2 - 3;\n"},
+		{"-(a+b); !-a; (-a)[0]", "-(a + b);\n!-a;\n(-a)[0];\n"},
+		{`let s="a"+"b";`, "let s = \"a\" + \"b\";\n"},
+		{`import "util.mk" as util; export let x=util.add(1,2).y`,
+			"import \"util.mk\" as util;\nexport let x = util.add(1, 2).y;\n"},
+		{`{"b":2,"a":[1,2]}["a"]`, "{\"b\": 2, \"a\": [1, 2]}[\"a\"];\n"},
+		{"let m=macro(x){quote(unquote(x)*2)}", "let m = macro(x) {\n    quote(unquote(x) * 2)\n};\n"},
+		{"let [a,{b,c:d},...e]=xs", "let [a, {b, c: d}, ...e] = xs;\n"},
+		{"const x=1;export const [y]=xs", "const x = 1;\nexport const [y] = xs;\n"},
+		{`match(x){1=>"a",[a,"b"] if a>0=>{let y=a;y} {k}=>k,_=>{{"k":0}}}`,
+			"match (x) {\n    1 => \"a\",\n    [a, \"b\"] if a > 0 => {\n        let y = a;\n        y\n    },\n    {k} => k,\n    _ => {\n        {\"k\": 0}\n    },\n};\n"},
+		{"fn add(a,b=1){a+b} export fn f(...xs){}", "fn add(a, b = 1) {\n    a + b\n}\nexport fn f(...xs) {}\n"},
+		{
+			"let add=fn(a,b){let c=a+b;c};if(add(1,2)>2){true}else{fn(){}}",
+			`let add = fn(a, b) {
+    let c = a + b;
+    c
+};
+if (add(1, 2) > 2) {
+    true
+} else {
+    fn() {}
+};
+`,
+		},
+		{
+			"let f=fn(x){if(x){return x;};fn(y){y}}",
+			`let f = fn(x) {
+    if (x) {
+        return x;
+    };
+    fn(y) {
+        y
+    }
+};
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		formatted, errors := Source(tt.input)
+		if len(errors) > 0 {
+			t.Fatalf("Source(%q) failed, errors:%v", tt.input, errors)
+		}
+		if formatted != tt.expected {
+			t.Errorf("Source(%q) wrong.\nwant=%q\ngot=%q", tt.input, tt.expected, formatted)
+		}
+
+		// 格式化不能改变语法树，且结果是幂等的
+		original := parser.NewParser(lexer.NewLexer(tt.input)).ParseProgram()
+		reparsed := parser.NewParser(lexer.NewLexer(formatted)).ParseProgram()
+		if original.String() != reparsed.String() {
+			t.Errorf("formatting %q changed the syntax tree.\nwant=%q\ngot=%q",
+				tt.input, original.String(), reparsed.String())
+		}
+		again, _ := Source(formatted)
+		if again != formatted {
+			t.Errorf("formatting is not idempotent.\nfirst=%q\nsecond=%q", formatted, again)
+		}
+	}
+}
+
+func TestSourceParserErrors(t *testing.T) {
+	_, errors := Source("let = 1;")
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors but got none")
+	}
+}
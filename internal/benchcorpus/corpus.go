@@ -0,0 +1,43 @@
+// Package benchcorpus 为各个包的基准测试提供testdata/bench下的同一组程序
+package benchcorpus
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// Program 一个基准测试程序，Name为去掉.mk后缀的文件名
+type Program struct {
+	Name  string
+	Input string
+}
+
+// Dir 返回基准测试程序所在的目录，与调用者所在的包无关
+func Dir() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..", "testdata", "bench")
+}
+
+// Load 读取testdata/bench下的全部基准测试程序，按文件名排序
+func Load(tb testing.TB) []Program {
+	tb.Helper()
+
+	files, err := filepath.Glob(filepath.Join(Dir(), "*.mk"))
+	if err != nil || len(files) == 0 {
+		tb.Fatalf("no benchmark programs found, error: %v", err)
+	}
+
+	programs := make([]Program, 0, len(files))
+	for _, file := range files {
+		input, err := os.ReadFile(file)
+		if err != nil {
+			tb.Fatalf("os.ReadFile() failed, error: %s", err)
+		}
+		name := strings.TrimSuffix(filepath.Base(file), ".mk")
+		programs = append(programs, Program{Name: name, Input: string(input)})
+	}
+	return programs
+}
@@ -0,0 +1,22 @@
+package lexer
+
+import (
+	"testing"
+
+	"github.com/nicolerobin/monkey/internal/benchcorpus"
+	"github.com/nicolerobin/monkey/token"
+)
+
+func BenchmarkNextToken(b *testing.B) {
+	for _, bench := range benchcorpus.Load(b) {
+		b.Run(bench.Name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(bench.Input)))
+			for i := 0; i < b.N; i++ {
+				l := NewLexer(bench.Input)
+				for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package lexer
+
+import (
+	"testing"
+
+	"github.com/nicolerobin/monkey/token"
+)
+
+func FuzzNextToken(f *testing.F) {
+	f.Add(`let add = fn(x, y) { x + y; }; add(1, 2);`)
+	f.Add(`{"foo": [1, 2]}["foo"][0] != 10 == !true`)
+	f.Add(`"unterminated`)
+
+	f.Fuzz(func(t *testing.T, input string) {
+		l := NewLexer(input)
+
+		// 每个词法单元至少消耗一个字符，因此必须在len(input)+1个词法单元内到达EOF
+		for i := 0; i <= len(input); i++ {
+			tok := l.NextToken()
+			if tok.Type == token.EOF {
+				return
+			}
+			if tok.Literal == "" && tok.Type != token.STRING {
+				t.Fatalf("token %d of type %s has empty literal", i, tok.Type)
+			}
+		}
+		t.Fatalf("no EOF after %d tokens", len(input)+1)
+	})
+}
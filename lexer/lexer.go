@@ -7,20 +7,35 @@ type Lexer struct {
 	position     int
 	readPosition int
 	ch           byte
+
+	line   int // 当前字符所在行
+	column int // 当前字符所在列
 }
 
 func NewLexer(input string) *Lexer {
 	l := &Lexer{
 		input: input,
+		line:  1,
 	}
 	l.readChar()
 
 	return l
 }
 
+// NextToken 返回下一个词法单元，并记录其起始位置
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
 	l.skipWhitespace()
+
+	line, column := l.line, l.column
+	tok := l.nextToken()
+	tok.LineNo = line
+	tok.Column = column
+
+	return tok
+}
+
+func (l *Lexer) nextToken() token.Token {
+	var tok token.Token
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
@@ -28,6 +43,9 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar()
 			literal := string(ch) + string(l.ch)
 			tok = newToken(token.EQ, literal)
+		} else if l.peekChar() == '>' {
+			l.readChar()
+			tok = newToken(token.ARROW, "=>")
 		} else {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
@@ -37,6 +55,14 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.SEMICOLON, l.ch)
 	case ':':
 		tok = newToken(token.COLON, l.ch)
+	case '.':
+		if l.peekChar() == '.' && l.readPosition+1 < len(l.input) && l.input[l.readPosition+1] == '.' {
+			l.readChar()
+			l.readChar()
+			tok = newToken(token.ELLIPSIS, "...")
+		} else {
+			tok = newToken(token.DOT, l.ch)
+		}
 	case '+':
 		tok = newToken(token.PLUS, l.ch)
 	case '-':
@@ -96,6 +122,13 @@ func (l *Lexer) NextToken() token.Token {
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -27,6 +27,12 @@ if (5 < 10) {
 "foo bar"
 [1, 2];
 {"foo": "bar"}
+import "util.mk" as util;
+export let x = util.y;
+fn(a = 1, ...b) { f(...b) }
+..
+match (x) { _ => 1 }
+const c;
 `
 
 	tests := []struct {
@@ -119,6 +125,49 @@ if (5 < 10) {
 		{token.COLON, ":"},
 		{token.STRING, "bar"},
 		{token.RBRACE, "}"},
+		{token.IMPORT, "import"},
+		{token.STRING, "util.mk"},
+		{token.AS, "as"},
+		{token.IDENT, "util"},
+		{token.SEMICOLON, ";"},
+		{token.EXPORT, "export"},
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.IDENT, "util"},
+		{token.DOT, "."},
+		{token.IDENT, "y"},
+		{token.SEMICOLON, ";"},
+		{token.FUNCTION, "fn"},
+		{token.LPAREN, "("},
+		{token.IDENT, "a"},
+		{token.ASSIGN, "="},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "b"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "f"},
+		{token.LPAREN, "("},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "b"},
+		{token.RPAREN, ")"},
+		{token.RBRACE, "}"},
+		{token.DOT, "."},
+		{token.DOT, "."},
+		{token.MATCH, "match"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "_"},
+		{token.ARROW, "=>"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
+		{token.CONST, "const"},
+		{token.IDENT, "c"},
+		{token.SEMICOLON, ";"},
 		{token.EOF, ""},
 	}
 
@@ -134,3 +183,39 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestTokenPosition(t *testing.T) {
+	input := `let x = 5;
+  "a b" + x
+
+fn`
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, 1, 1},
+		{token.IDENT, 1, 5},
+		{token.ASSIGN, 1, 7},
+		{token.INT, 1, 9},
+		{token.SEMICOLON, 1, 10},
+		{token.STRING, 2, 3},
+		{token.PLUS, 2, 9},
+		{token.IDENT, 2, 11},
+		{token.FUNCTION, 4, 1},
+		{token.EOF, 4, 3},
+	}
+
+	l := NewLexer(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokenType wrong. expected:%q, got:%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.LineNo != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected:%d:%d, got:%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.LineNo, tok.Column)
+		}
+	}
+}
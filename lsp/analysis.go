@@ -0,0 +1,253 @@
+package lsp
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/nicolerobin/monkey/ast"
+	"github.com/nicolerobin/monkey/compiler"
+	"github.com/nicolerobin/monkey/object"
+	"github.com/nicolerobin/monkey/token"
+)
+
+// definition 一个名称的定义：let绑定、函数声明、函数参数或import别名
+type definition struct {
+	name     string
+	token    token.Token          // 定义处的标识符
+	kind     object.ObjectType    // 推断出的值类型，无法推断时为空
+	detail   string               // 悬停提示中显示的声明
+	global   bool                 // 是否为顶层定义
+	function *ast.FunctionLiteral // 函数声明或let绑定的值为函数字面量时的函数
+}
+
+// reference 标识符的一次出现，定义处本身也记为一次出现
+type reference struct {
+	token      token.Token
+	definition *definition
+	builtin    string // 引用内置函数时的函数名
+}
+
+// analysis 使用compiler.Resolver按照编译器的作用域规则对程序进行名称解析的结果
+type analysis struct {
+	definitions []*definition
+	references  []reference
+	unresolved  []token.Token // 无法解析的标识符
+	warnings    []compiler.Warning
+	errors      []compiler.Warning // 编译器会因名称而拒绝的错误，例如重新定义常量
+
+	resolver    *compiler.Resolver
+	definedBy   map[*ast.Identifier]*definition // 按定义处的标识符索引的定义
+	isBuiltin   map[string]bool
+	builtinList []string
+}
+
+func analyze(program *ast.Program) *analysis {
+	a := &analysis{
+		resolver:    compiler.NewResolver(nil),
+		definedBy:   make(map[*ast.Identifier]*definition),
+		isBuiltin:   make(map[string]bool),
+		builtinList: object.BuiltinNames(),
+	}
+	// quote和unquote由解释器特殊处理，不在内置函数表中
+	a.builtinList = append(a.builtinList, "quote", "unquote")
+	sort.Strings(a.builtinList)
+	for _, name := range a.builtinList {
+		a.isBuiltin[name] = true
+	}
+
+	a.resolver.Defined = a.define
+	a.resolver.Referenced = a.reference
+	a.resolver.Resolve(program)
+	a.warnings = a.resolver.Warnings()
+	a.errors = a.resolver.Errors()
+	return a
+}
+
+// definitionOf 返回ident处的定义。局部函数在定义名称之前就可以在函数体中引用自身，此时先创建定义
+func (a *analysis) definitionOf(ident *ast.Identifier) *definition {
+	def, ok := a.definedBy[ident]
+	if !ok {
+		def = &definition{name: ident.Value, token: ident.Token}
+		a.definedBy[ident] = def
+		a.definitions = append(a.definitions, def)
+	}
+	return def
+}
+
+// define 记录由node定义的名称ident，根据node生成悬停提示并推断值的类型
+func (a *analysis) define(ident *ast.Identifier, sym compiler.Symbol, node ast.Node) {
+	def := a.definitionOf(ident)
+	def.global = sym.Scope == compiler.GlobalScope
+	a.references = append(a.references, reference{token: ident.Token, definition: def})
+
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		keyword := "let "
+		if node.Constant {
+			keyword = "const "
+		}
+		if node.Pattern != nil {
+			def.detail = keyword + ident.Value
+			return
+		}
+		if fn, ok := node.Value.(*ast.FunctionLiteral); ok {
+			def.function = fn
+			def.kind = object.FUNCTION_OBJ
+			def.detail = keyword + ident.Value + " = " + signature(fn)
+			return
+		}
+		def.kind = a.inferKind(node.Value)
+		def.detail = keyword + ident.Value
+		if def.kind != "" {
+			def.detail += ": " + string(def.kind)
+		}
+	case *ast.FunctionStatement:
+		def.function = node.Function
+		def.kind = object.FUNCTION_OBJ
+		def.detail = "fn " + ident.Value + strings.TrimPrefix(signature(node.Function), "fn")
+	case *ast.ImportStatement:
+		def.kind = object.MODULE_OBJ
+		def.detail = "import \"" + node.Path.Value + "\" as " + ident.Value
+	case *ast.FunctionLiteral:
+		def.detail = "param " + ident.Value
+		if ident == node.Rest {
+			def.detail = "param ..." + ident.Value
+		}
+	case *ast.MacroLiteral:
+		def.detail = "param " + ident.Value
+	case *ast.MatchArm:
+		def.detail = "let " + ident.Value
+	}
+}
+
+// reference 记录标识符的一次引用，def为其定义处
+func (a *analysis) reference(ident, def *ast.Identifier) {
+	switch {
+	case def != nil:
+		a.references = append(a.references, reference{token: ident.Token, definition: a.definitionOf(def)})
+	case a.isBuiltin[ident.Value]:
+		a.references = append(a.references, reference{token: ident.Token, builtin: ident.Value})
+	default:
+		a.unresolved = append(a.unresolved, ident.Token)
+	}
+}
+
+// lookup 按照编译器的作用域规则查找名称在当前位置对应的定义
+func (a *analysis) lookup(name string) (*definition, bool) {
+	ident, ok := a.resolver.Lookup(name)
+	if !ok {
+		return nil, false
+	}
+	def, ok := a.definedBy[ident]
+	return def, ok
+}
+
+// inferKind 根据表达式的形式推断其值的类型，无法确定时返回空
+func (a *analysis) inferKind(exp ast.Expression) object.ObjectType {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		return object.INTEGER_OBJ
+	case *ast.StringLiteral:
+		return object.STRING_OBJ
+	case *ast.Boolean:
+		return object.BOOLEAN_OBJ
+	case *ast.ArrayLiteral:
+		return object.ARRAY_OBJ
+	case *ast.HashLiteral:
+		return object.HASH_OBJ
+	case *ast.FunctionLiteral:
+		return object.FUNCTION_OBJ
+	case *ast.Identifier:
+		if def, ok := a.lookup(exp.Value); ok {
+			return def.kind
+		}
+	case *ast.PrefixExpression:
+		if exp.Operator == "!" {
+			return object.BOOLEAN_OBJ
+		}
+		return object.INTEGER_OBJ
+	case *ast.InfixExpression:
+		switch exp.Operator {
+		case "<", ">", "==", "!=":
+			return object.BOOLEAN_OBJ
+		}
+		left, right := a.inferKind(exp.Left), a.inferKind(exp.Right)
+		if left == right {
+			return left
+		}
+	case *ast.IfExpression:
+		if exp.Alternative == nil {
+			return ""
+		}
+		consequence, alternative := a.blockKind(exp.Consequence), a.blockKind(exp.Alternative)
+		if consequence == alternative {
+			return consequence
+		}
+	case *ast.CallExpression:
+		if ident, ok := exp.Function.(*ast.Identifier); ok && ident.Value == "len" {
+			return object.INTEGER_OBJ
+		}
+	}
+	return ""
+}
+
+// blockKind 推断代码块的值的类型，即最后一条表达式语句的类型
+func (a *analysis) blockKind(block *ast.BlockStatement) object.ObjectType {
+	if len(block.Statements) == 0 {
+		return ""
+	}
+	stmt, ok := block.Statements[len(block.Statements)-1].(*ast.ExpressionStatement)
+	if !ok {
+		return ""
+	}
+	return a.inferKind(stmt.Expression)
+}
+
+// referenceAt 返回位于第line行（从0开始）字节偏移column处的标识符
+func (a *analysis) referenceAt(line, column int) (reference, bool) {
+	for _, ref := range a.references {
+		l, start, end := tokenSpan(ref.token)
+		if l == line && start <= column && column <= end {
+			return ref, true
+		}
+	}
+	return reference{}, false
+}
+
+// referencesTo 返回定义def的全部出现位置
+func (a *analysis) referencesTo(def *definition) []token.Token {
+	tokens := []token.Token{}
+	for _, ref := range a.references {
+		if ref.definition == def {
+			tokens = append(tokens, ref.token)
+		}
+	}
+	return tokens
+}
+
+func signature(fn *ast.FunctionLiteral) string {
+	params := []string{}
+	for i, p := range fn.Parameters {
+		if d := fn.Default(i); d != nil {
+			params = append(params, p.Value+" = "+d.String())
+		} else {
+			params = append(params, p.Value)
+		}
+	}
+	if fn.Rest != nil {
+		params = append(params, "..."+fn.Rest.Value)
+	}
+	return "fn(" + strings.Join(params, ", ") + ")"
+}
+
+// tokenSpan 返回词法单元所在的行以及在行中的起止字节偏移，均从0开始
+func tokenSpan(tok token.Token) (line, start, end int) {
+	length := len(tok.Literal)
+	if tok.Type == token.STRING {
+		length += 2
+	}
+	if length == 0 {
+		length = 1
+	}
+	return tok.LineNo - 1, tok.Column - 1, tok.Column - 1 + length
+}
@@ -0,0 +1,395 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/nicolerobin/log"
+	"github.com/nicolerobin/monkey/ast"
+	"github.com/nicolerobin/monkey/format"
+	"github.com/nicolerobin/monkey/lexer"
+	"github.com/nicolerobin/monkey/object"
+	"github.com/nicolerobin/monkey/parser"
+	"github.com/nicolerobin/monkey/token"
+)
+
+// document 一个已打开的文档及其分析结果
+type document struct {
+	text     string
+	lines    []string
+	program  *ast.Program
+	errors   []parser.ParseError
+	analysis *analysis
+}
+
+func newDocument(text string) *document {
+	p := parser.NewParser(lexer.NewLexer(text))
+	program := p.ParseProgram()
+	return &document{
+		text:     text,
+		lines:    strings.Split(text, "\n"),
+		program:  program,
+		errors:   p.ParseErrors(),
+		analysis: analyze(program),
+	}
+}
+
+// tokenRange 将词法单元的位置转换为LSP中的范围，列为UTF-16码元的偏移
+func (d *document) tokenRange(tok token.Token) Range {
+	line, start, end := tokenSpan(tok)
+	return Range{
+		Start: Position{Line: line, Character: d.utf16Column(line, start)},
+		End:   Position{Line: line, Character: d.utf16Column(line, end)},
+	}
+}
+
+// referenceAt 返回位于pos处的标识符，pos的列为UTF-16码元的偏移
+func (d *document) referenceAt(pos Position) (reference, bool) {
+	return d.analysis.referenceAt(pos.Line, d.byteColumn(pos.Line, pos.Character))
+}
+
+// utf16Column 将第line行中的字节偏移转换为UTF-16码元的偏移，超出行尾的部分按每字节一个码元计算
+func (d *document) utf16Column(line, column int) int {
+	text := ""
+	if line >= 0 && line < len(d.lines) {
+		text = d.lines[line]
+	}
+	if column > len(text) {
+		return d.utf16Column(line, len(text)) + column - len(text)
+	}
+
+	n := 0
+	for _, r := range text[:column] {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// byteColumn 将第line行中的UTF-16码元偏移转换为字节偏移
+func (d *document) byteColumn(line, character int) int {
+	text := ""
+	if line >= 0 && line < len(d.lines) {
+		text = d.lines[line]
+	}
+
+	n := 0
+	for i, r := range text {
+		if n >= character {
+			return i
+		}
+		n += utf16.RuneLen(r)
+	}
+	return len(text) + character - n
+}
+
+// Server 通过标准输入输出与编辑器通信的Monkey语言服务器
+type Server struct {
+	documents map[string]*document
+	out       io.Writer
+	shutdown  bool
+}
+
+// NewServer 创建语言服务器
+func NewServer() *Server {
+	return &Server{documents: make(map[string]*document)}
+}
+
+// Serve 从in读取请求并将响应写入out，直到收到exit通知或输入结束
+func (s *Server) Serve(in io.Reader, out io.Writer) error {
+	s.out = out
+	r := bufio.NewReader(in)
+	for {
+		body, err := readMessage(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		err = json.Unmarshal(body, &req)
+		if err != nil {
+			s.reply(nil, nil, &responseError{Code: codeParseError, Message: err.Error()})
+			continue
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+
+		result, rerr := s.handle(req)
+		if req.ID != nil {
+			s.reply(req.ID, result, rerr)
+		}
+	}
+}
+
+func (s *Server) reply(id *json.RawMessage, result interface{}, rerr *responseError) {
+	err := writeMessage(s.out, response{JSONRPC: "2.0", ID: id, Result: result, Error: rerr})
+	if err != nil {
+		log.Error("write response failed, err:%s", err)
+	}
+}
+
+func (s *Server) notify(method string, params interface{}) {
+	err := writeMessage(s.out, notification{JSONRPC: "2.0", Method: method, Params: params})
+	if err != nil {
+		log.Error("write notification failed, err:%s", err)
+	}
+}
+
+func (s *Server) handle(req request) (interface{}, *responseError) {
+	switch req.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":           textDocumentSyncFull,
+				"definitionProvider":         true,
+				"referencesProvider":         true,
+				"hoverProvider":              true,
+				"completionProvider":         map[string]interface{}{},
+				"documentSymbolProvider":     true,
+				"documentFormattingProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "monkey-lsp"},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.open(params.TextDocument.URI, params.TextDocument.Text)
+		return nil, nil
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		if len(params.ContentChanges) > 0 {
+			s.open(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		delete(s.documents, params.TextDocument.URI)
+		return nil, nil
+	case "textDocument/definition":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.definition(params), nil
+	case "textDocument/references":
+		var params referenceParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.references(params), nil
+	case "textDocument/hover":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.hover(params), nil
+	case "textDocument/completion":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.completion(params), nil
+	case "textDocument/documentSymbol":
+		var params documentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.documentSymbols(params), nil
+	case "textDocument/formatting":
+		var params documentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.formatting(params), nil
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + req.Method}
+}
+
+func invalidParams(err error) *responseError {
+	return &responseError{Code: codeInvalidParams, Message: err.Error()}
+}
+
+// open 重新分析文档并发布诊断信息
+func (s *Server) open(uri, text string) {
+	doc := newDocument(text)
+	s.documents[uri] = doc
+
+	diagnostics := []Diagnostic{}
+	for _, e := range doc.errors {
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    doc.tokenRange(e.Token),
+			Severity: severityError,
+			Source:   "monkey",
+			Message:  e.Message,
+		})
+	}
+	for _, e := range doc.analysis.errors {
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    doc.tokenRange(e.Token),
+			Severity: severityError,
+			Source:   "monkey",
+			Message:  e.Message,
+		})
+	}
+	for _, tok := range doc.analysis.unresolved {
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    doc.tokenRange(tok),
+			Severity: severityWarning,
+			Source:   "monkey",
+			Message:  "undefined: " + tok.Literal,
+		})
+	}
+	for _, w := range doc.analysis.warnings {
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    doc.tokenRange(w.Token),
+			Severity: severityWarning,
+			Source:   "monkey",
+			Message:  w.Message,
+		})
+	}
+	s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+}
+
+func (s *Server) definition(params textDocumentPositionParams) interface{} {
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+	ref, ok := doc.referenceAt(params.Position)
+	if !ok || ref.definition == nil {
+		return nil
+	}
+	return Location{URI: params.TextDocument.URI, Range: doc.tokenRange(ref.definition.token)}
+}
+
+func (s *Server) references(params referenceParams) interface{} {
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+	ref, ok := doc.referenceAt(params.Position)
+	if !ok || ref.definition == nil {
+		return nil
+	}
+
+	locations := []Location{}
+	for _, tok := range doc.analysis.referencesTo(ref.definition) {
+		if tok == ref.definition.token && !params.Context.IncludeDeclaration {
+			continue
+		}
+		locations = append(locations, Location{URI: params.TextDocument.URI, Range: doc.tokenRange(tok)})
+	}
+	return locations
+}
+
+func (s *Server) hover(params textDocumentPositionParams) interface{} {
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+	ref, ok := doc.referenceAt(params.Position)
+	if !ok {
+		return nil
+	}
+
+	detail := "builtin " + ref.builtin
+	if ref.definition != nil {
+		detail = ref.definition.detail
+	}
+	return Hover{
+		Contents: markupContent{Kind: "markdown", Value: "```monkey\n" + detail + "\n```"},
+		Range:    doc.tokenRange(ref.token),
+	}
+}
+
+func (s *Server) completion(params textDocumentPositionParams) interface{} {
+	items := []CompletionItem{}
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return items
+	}
+
+	seen := make(map[string]bool)
+	for _, def := range doc.analysis.definitions {
+		if seen[def.name] {
+			continue
+		}
+		seen[def.name] = true
+
+		kind := completionKindVariable
+		if def.function != nil {
+			kind = completionKindFunction
+		} else if def.kind == object.MODULE_OBJ {
+			kind = completionKindModule
+		}
+		items = append(items, CompletionItem{Label: def.name, Kind: kind, Detail: def.detail})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+
+	for _, name := range doc.analysis.builtinList {
+		if !seen[name] {
+			items = append(items, CompletionItem{Label: name, Kind: completionKindFunction, Detail: "builtin " + name})
+		}
+	}
+	return items
+}
+
+func (s *Server) documentSymbols(params documentParams) interface{} {
+	symbols := []DocumentSymbol{}
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return symbols
+	}
+
+	for _, def := range doc.analysis.definitions {
+		if !def.global || def.function == nil {
+			continue
+		}
+		r := doc.tokenRange(def.token)
+		symbols = append(symbols, DocumentSymbol{
+			Name:           def.name,
+			Detail:         signature(def.function),
+			Kind:           symbolKindFunction,
+			Range:          r,
+			SelectionRange: r,
+		})
+	}
+	return symbols
+}
+
+// formatting 用格式化后的源码替换整个文档，存在语法错误时不做修改
+func (s *Server) formatting(params documentParams) interface{} {
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok || len(doc.errors) > 0 {
+		return nil
+	}
+
+	formatted := format.Program(doc.program)
+	if formatted == doc.text {
+		return []TextEdit{}
+	}
+
+	last := len(doc.lines) - 1
+	end := Position{Line: last, Character: doc.utf16Column(last, len(doc.lines[last]))}
+	return []TextEdit{{Range: Range{End: end}, NewText: formatted}}
+}
@@ -0,0 +1,444 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/nicolerobin/monkey/compiler"
+)
+
+const testURI = "file:///test.mk"
+
+// client 按脚本依次发送请求，并收集服务器的全部输出
+type client struct {
+	input  bytes.Buffer
+	nextID int
+}
+
+func (c *client) request(method string, params interface{}) int {
+	c.nextID++
+	c.send(map[string]interface{}{"jsonrpc": "2.0", "id": c.nextID, "method": method, "params": params})
+	return c.nextID
+}
+
+func (c *client) notify(method string, params interface{}) {
+	c.send(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+func (c *client) send(msg interface{}) {
+	body, _ := json.Marshal(msg)
+	fmt.Fprintf(&c.input, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+type message struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *responseError  `json:"error"`
+}
+
+// run 运行服务器直到输入结束，返回按id索引的响应和按顺序排列的通知
+func (c *client) run(t *testing.T) (map[int]message, []message) {
+	var out bytes.Buffer
+	err := NewServer().Serve(&c.input, &out)
+	if err != nil {
+		t.Fatalf("serve failed: %s", err)
+	}
+
+	responses := make(map[int]message)
+	notifications := []message{}
+	r := bufio.NewReader(&out)
+	for {
+		body, err := readMessage(r)
+		if err != nil {
+			break
+		}
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatalf("invalid message %s: %s", body, err)
+		}
+		if msg.ID != nil {
+			responses[*msg.ID] = msg
+		} else {
+			notifications = append(notifications, msg)
+		}
+	}
+	return responses, notifications
+}
+
+func position(uri string, line, character int) map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]string{"uri": uri},
+		"position":     Position{Line: line, Character: character},
+	}
+}
+
+func open(c *client, text string) {
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": testURI, "languageId": "monkey", "version": 1, "text": text},
+	})
+}
+
+func decode(t *testing.T, msg message, v interface{}) {
+	t.Helper()
+	if msg.Error != nil {
+		t.Fatalf("unexpected error response: %+v", msg.Error)
+	}
+	if err := json.Unmarshal(msg.Result, v); err != nil {
+		t.Fatalf("invalid result %s: %s", msg.Result, err)
+	}
+}
+
+func TestInitialize(t *testing.T) {
+	c := &client{}
+	id := c.request("initialize", map[string]interface{}{})
+	c.notify("initialized", map[string]interface{}{})
+	unknown := c.request("workspace/unknown", nil)
+	shutdown := c.request("shutdown", nil)
+	c.notify("exit", nil)
+	// exit之后的请求不应得到响应
+	after := c.request("shutdown", nil)
+
+	responses, _ := c.run(t)
+
+	var result struct {
+		Capabilities map[string]interface{} `json:"capabilities"`
+	}
+	decode(t, responses[id], &result)
+	for _, capability := range []string{"definitionProvider", "referencesProvider", "hoverProvider",
+		"completionProvider", "documentSymbolProvider", "documentFormattingProvider"} {
+		if _, ok := result.Capabilities[capability]; !ok {
+			t.Errorf("capability %s missing", capability)
+		}
+	}
+
+	if responses[unknown].Error == nil || responses[unknown].Error.Code != codeMethodNotFound {
+		t.Errorf("expected method not found, got %+v", responses[unknown])
+	}
+	if _, ok := responses[shutdown]; !ok {
+		t.Errorf("no response to shutdown")
+	}
+	if _, ok := responses[after]; ok {
+		t.Errorf("unexpected response after exit")
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	c := &client{}
+	open(c, "let x = 5;\nlet = 10;\ny;")
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": testURI, "version": 2},
+		"contentChanges": []map[string]string{{"text": "let x = 5;\nx;"}},
+	})
+	_, notifications := c.run(t)
+
+	if len(notifications) != 2 {
+		t.Fatalf("expected 2 notifications, got %d", len(notifications))
+	}
+
+	var first publishDiagnosticsParams
+	json.Unmarshal(notifications[0].Params, &first)
+	if first.URI != testURI {
+		t.Errorf("wrong uri %q", first.URI)
+	}
+	if len(first.Diagnostics) == 0 {
+		t.Fatalf("expected diagnostics")
+	}
+	d := first.Diagnostics[0]
+	if d.Severity != severityError || d.Range.Start != (Position{Line: 1, Character: 4}) {
+		t.Errorf("wrong diagnostic %+v", d)
+	}
+	last := first.Diagnostics[len(first.Diagnostics)-1]
+	if last.Severity != severityWarning || last.Message != "undefined: y" || last.Range.Start.Line != 2 {
+		t.Errorf("wrong diagnostic %+v", last)
+	}
+
+	var second publishDiagnosticsParams
+	json.Unmarshal(notifications[1].Params, &second)
+	if len(second.Diagnostics) != 0 {
+		t.Errorf("expected no diagnostics after change, got %+v", second.Diagnostics)
+	}
+}
+
+func TestMatchDiagnostics(t *testing.T) {
+	c := &client{}
+	open(c, "let x = 5;\nmatch (x) { [a] => a, n if n > 0 => n }")
+	_, notifications := c.run(t)
+
+	var params publishDiagnosticsParams
+	json.Unmarshal(notifications[0].Params, &params)
+	if len(params.Diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %+v", params.Diagnostics)
+	}
+	d := params.Diagnostics[0]
+	if d.Severity != severityWarning || d.Message != compiler.NonExhaustiveMatch || d.Range.Start != (Position{Line: 1, Character: 0}) {
+		t.Errorf("wrong diagnostic %+v", d)
+	}
+}
+
+func TestMatchArmScope(t *testing.T) {
+	c := &client{}
+	open(c, "let x = 5;\nmatch (x) { x => x, _ => 0 };\nx + y;\nmatch (x) { y => y, _ => 0 };")
+	inArm := c.request("textDocument/definition", position(testURI, 1, 17))
+	afterMatch := c.request("textDocument/definition", position(testURI, 2, 0))
+	responses, notifications := c.run(t)
+
+	// 分支中的名称遮蔽外层的同名名称，分支之外无法引用
+	var params publishDiagnosticsParams
+	json.Unmarshal(notifications[0].Params, &params)
+	if len(params.Diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %+v", params.Diagnostics)
+	}
+	d := params.Diagnostics[0]
+	if d.Message != "undefined: y" || d.Range.Start != (Position{Line: 2, Character: 4}) {
+		t.Errorf("wrong diagnostic %+v", d)
+	}
+
+	var loc *Location
+	decode(t, responses[inArm], &loc)
+	if loc == nil || loc.Range.Start != (Position{Line: 1, Character: 12}) {
+		t.Errorf("expected definition at the arm pattern, got %+v", loc)
+	}
+	decode(t, responses[afterMatch], &loc)
+	if loc == nil || loc.Range.Start != (Position{Line: 0, Character: 4}) {
+		t.Errorf("expected definition at the let statement, got %+v", loc)
+	}
+}
+
+func TestResolverDiagnostics(t *testing.T) {
+	c := &client{}
+	open(c, "let a = 1;\nlet a = 2;\nlet f = fn() { const b = 1; let b = 2; let g = fn() { g() }; g };")
+	self := c.request("textDocument/definition", position(testURI, 2, 54))
+	responses, notifications := c.run(t)
+
+	// 与编译器一致，重新定义变量给出警告，重新定义常量是错误
+	var params publishDiagnosticsParams
+	json.Unmarshal(notifications[0].Params, &params)
+	if len(params.Diagnostics) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %+v", params.Diagnostics)
+	}
+	expected := []Diagnostic{
+		{Range: Range{Start: Position{Line: 2, Character: 32}, End: Position{Line: 2, Character: 33}},
+			Severity: severityError, Source: "monkey", Message: "cannot redefine constant b"},
+		{Range: Range{Start: Position{Line: 1, Character: 4}, End: Position{Line: 1, Character: 5}},
+			Severity: severityWarning, Source: "monkey", Message: "a is already defined in this scope"},
+	}
+	for i, d := range params.Diagnostics {
+		if d != expected[i] {
+			t.Errorf("diagnostics[%d] wrong. want=%+v, got=%+v", i, expected[i], d)
+		}
+	}
+
+	// 局部函数在函数体中引用自身
+	var loc *Location
+	decode(t, responses[self], &loc)
+	if loc == nil || loc.Range.Start != (Position{Line: 2, Character: 43}) {
+		t.Errorf("expected definition at the local function, got %+v", loc)
+	}
+}
+
+func TestUTF16Positions(t *testing.T) {
+	c := &client{}
+	// é占1个UTF-16码元，😀占2个，而在UTF-8中分别占2个和4个字节
+	open(c, "let s = \"é😀\"; let x = 1;\nlet t = \"😀\"; x + y")
+	definition := c.request("textDocument/definition", position(testURI, 1, 14))
+	hover := c.request("textDocument/hover", position(testURI, 0, 19))
+	responses, notifications := c.run(t)
+
+	var params publishDiagnosticsParams
+	json.Unmarshal(notifications[0].Params, &params)
+	if len(params.Diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %+v", params.Diagnostics)
+	}
+	expected := Range{Start: Position{Line: 1, Character: 18}, End: Position{Line: 1, Character: 19}}
+	if d := params.Diagnostics[0]; d.Message != "undefined: y" || d.Range != expected {
+		t.Errorf("wrong diagnostic %+v", d)
+	}
+
+	var loc *Location
+	decode(t, responses[definition], &loc)
+	expected = Range{Start: Position{Line: 0, Character: 19}, End: Position{Line: 0, Character: 20}}
+	if loc == nil || loc.Range != expected {
+		t.Errorf("expected definition at %+v, got %+v", expected, loc)
+	}
+
+	var h Hover
+	decode(t, responses[hover], &h)
+	if h.Contents.Value != "```monkey\nlet x: INTEGER\n```" || h.Range != expected {
+		t.Errorf("wrong hover %+v", h)
+	}
+}
+
+const navigationSource = `let x = 1;
+let add = fn(a, b) { a + b + x };
+let id = fn(x) { x };
+add(x, len("ab"));`
+
+func TestDefinitionAndReferences(t *testing.T) {
+	tests := []struct {
+		line, character int
+		expected        *Position
+	}{
+		{1, 29, &Position{Line: 0, Character: 4}},  // 函数体中的全局x
+		{1, 21, &Position{Line: 1, Character: 13}}, // 参数a
+		{2, 17, &Position{Line: 2, Character: 12}}, // 参数x遮蔽了全局x
+		{3, 0, &Position{Line: 1, Character: 4}},   // add
+		{3, 7, nil},                                // 内置函数len
+	}
+
+	c := &client{}
+	open(c, navigationSource)
+	ids := []int{}
+	for _, tt := range tests {
+		ids = append(ids, c.request("textDocument/definition", position(testURI, tt.line, tt.character)))
+	}
+	refParams := position(testURI, 0, 4)
+	refParams["context"] = map[string]bool{"includeDeclaration": true}
+	refs := c.request("textDocument/references", refParams)
+	refParams["context"] = map[string]bool{"includeDeclaration": false}
+	refsWithoutDecl := c.request("textDocument/references", refParams)
+
+	responses, _ := c.run(t)
+
+	for i, tt := range tests {
+		var loc *Location
+		decode(t, responses[ids[i]], &loc)
+		if tt.expected == nil {
+			if loc != nil {
+				t.Errorf("tests[%d]: expected no definition, got %+v", i, loc)
+			}
+			continue
+		}
+		if loc == nil || loc.Range.Start != *tt.expected {
+			t.Errorf("tests[%d]: expected definition at %+v, got %+v", i, tt.expected, loc)
+		}
+	}
+
+	var locations []Location
+	decode(t, responses[refs], &locations)
+	expected := []Position{{0, 4}, {1, 29}, {3, 4}}
+	if len(locations) != len(expected) {
+		t.Fatalf("expected %d references, got %+v", len(expected), locations)
+	}
+	for i, pos := range expected {
+		if locations[i].Range.Start != pos {
+			t.Errorf("references[%d]: expected %+v, got %+v", i, pos, locations[i].Range.Start)
+		}
+	}
+
+	decode(t, responses[refsWithoutDecl], &locations)
+	if len(locations) != len(expected)-1 {
+		t.Errorf("expected %d references without declaration, got %+v", len(expected)-1, locations)
+	}
+}
+
+func TestHover(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = 1 + 2;\na", "let a: INTEGER"},
+		{"let s = \"x\";\ns", "let s: STRING"},
+		{"let b = 1 < 2;\nb", "let b: BOOLEAN"},
+		{"let h = {};\nh", "let h: HASH"},
+		{"let c = if (true) { [] } else { [1] };\nc", "let c: ARRAY"},
+		{"let u = if (true) { 1 } else { \"x\" };\nu", "let u"},
+		{"let f = fn(x, y) { x };\nf", "let f = fn(x, y)"},
+		{"fn g(x, y = 1) { h(x) }\nfn h(x) { g(x) }\ng", "fn g(x, y = 1)"},
+		{"let n = len(\"x\");\nn", "let n: INTEGER"},
+		{"let m = 1;\nlet k = m;\nk", "let k: INTEGER"},
+		{"\nlen", "builtin len"},
+	}
+
+	for _, tt := range tests {
+		c := &client{}
+		open(c, tt.input)
+		line := strings.Count(tt.input, "\n")
+		id := c.request("textDocument/hover", position(testURI, line, 0))
+		responses, _ := c.run(t)
+
+		var hover Hover
+		decode(t, responses[id], &hover)
+		expected := "```monkey\n" + tt.expected + "\n```"
+		if hover.Contents.Value != expected {
+			t.Errorf("input %q: expected hover %q, got %q", tt.input, expected, hover.Contents.Value)
+		}
+	}
+}
+
+func TestCompletionAndSymbols(t *testing.T) {
+	c := &client{}
+	open(c, navigationSource)
+	completion := c.request("textDocument/completion", position(testURI, 3, 0))
+	symbols := c.request("textDocument/documentSymbol", map[string]interface{}{
+		"textDocument": map[string]string{"uri": testURI},
+	})
+	responses, _ := c.run(t)
+
+	var items []CompletionItem
+	decode(t, responses[completion], &items)
+	kinds := make(map[string]int)
+	for _, item := range items {
+		kinds[item.Label] = item.Kind
+	}
+	expected := map[string]int{
+		"x":    completionKindVariable,
+		"add":  completionKindFunction,
+		"a":    completionKindVariable,
+		"len":  completionKindFunction,
+		"puts": completionKindFunction,
+	}
+	for label, kind := range expected {
+		if kinds[label] != kind {
+			t.Errorf("completion %s: expected kind %d, got %d", label, kind, kinds[label])
+		}
+	}
+
+	var docSymbols []DocumentSymbol
+	decode(t, responses[symbols], &docSymbols)
+	if len(docSymbols) != 2 {
+		t.Fatalf("expected 2 symbols, got %+v", docSymbols)
+	}
+	if docSymbols[0].Name != "add" || docSymbols[0].Detail != "fn(a, b)" || docSymbols[0].Kind != symbolKindFunction {
+		t.Errorf("wrong symbol %+v", docSymbols[0])
+	}
+	if docSymbols[1].Name != "id" {
+		t.Errorf("wrong symbol %+v", docSymbols[1])
+	}
+}
+
+func TestFormatting(t *testing.T) {
+	c := &client{}
+	open(c, "let f=fn(x){x+1};\nf(2)")
+	formatting := c.request("textDocument/formatting", map[string]interface{}{
+		"textDocument": map[string]string{"uri": testURI},
+		"options":      map[string]interface{}{"tabSize": 4, "insertSpaces": true},
+	})
+	open(c, "let = ;")
+	broken := c.request("textDocument/formatting", map[string]interface{}{
+		"textDocument": map[string]string{"uri": testURI},
+	})
+	responses, _ := c.run(t)
+
+	var edits []TextEdit
+	decode(t, responses[formatting], &edits)
+	if len(edits) != 1 {
+		t.Fatalf("expected 1 edit, got %+v", edits)
+	}
+	if edits[0].Range.End != (Position{Line: 1, Character: 4}) {
+		t.Errorf("wrong edit range %+v", edits[0].Range)
+	}
+	expected := "let f = fn(x) {\n    x + 1\n};\nf(2);\n"
+	if edits[0].NewText != expected {
+		t.Errorf("expected %q, got %q", expected, edits[0].NewText)
+	}
+
+	if string(responses[broken].Result) != "null" {
+		t.Errorf("expected null result for broken document, got %s", responses[broken].Result)
+	}
+}
@@ -1,19 +1,141 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"os/user"
+	"path/filepath"
 
+	"github.com/nicolerobin/monkey/ast"
+	"github.com/nicolerobin/monkey/bench"
+	"github.com/nicolerobin/monkey/evaluator"
+	"github.com/nicolerobin/monkey/lsp"
+	"github.com/nicolerobin/monkey/module"
+	"github.com/nicolerobin/monkey/object"
 	"github.com/nicolerobin/monkey/repl"
 )
 
 func main() {
+	engine := flag.String("engine", repl.EngineVM,
+		"execution engine: vm, eval, or both to run each input on both engines and report disagreements")
+	flag.Parse()
+
+	if flag.Arg(0) == "lsp" {
+		err := lsp.NewServer().Serve(os.Stdin, os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "bench" {
+		os.Exit(runBench(flag.Args()[1:]))
+	}
+
+	if flag.Arg(0) == "parse" {
+		os.Exit(runParse(flag.Args()[1:]))
+	}
+
+	if *engine != repl.EngineVM && *engine != repl.EngineEval && *engine != repl.EngineBoth {
+		fmt.Fprintf(os.Stderr, "unknown engine %q\n", *engine)
+		flag.Usage()
+		os.Exit(2)
+	}
+
 	userName, err := user.Current()
 	if err != nil {
 		panic(err)
 	}
 	fmt.Printf("Hello %s! This is the monkey programming language!\n", userName.Username)
-	fmt.Println("Feel free to type in commands!")
-	repl.StartVM(os.Stdin, os.Stdout)
+	fmt.Println("Feel free to type in commands! Type :help for a list of REPL commands.")
+	repl.Start(os.Stdin, os.Stdout, repl.Config{
+		Engine:      *engine,
+		HistoryFile: filepath.Join(userName.HomeDir, ".monkey_history"),
+		Dirs:        []string{string(filepath.Separator)},
+	})
+}
+
+// runBench 执行monkey bench [-json] [-n iterations] file.mk，返回进程退出码
+func runBench(args []string) int {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	jsonOutput := flags.Bool("json", false, "print the report as JSON")
+	iterations := flags.Int("n", 10, "number of times each phase is run")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: monkey bench [-json] [-n iterations] file.mk")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	report, err := bench.Run(flags.Arg(0), *iterations)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if *jsonOutput {
+		err = report.WriteJSON(os.Stdout)
+	} else {
+		err = report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// runParse 执行monkey parse [-json] file.mk，输出展开宏之后的语法树，返回进程退出码
+func runParse(args []string) int {
+	flags := flag.NewFlagSet("parse", flag.ContinueOnError)
+	jsonOutput := flags.Bool("json", false, "print the syntax tree as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: monkey parse [-json] file.mk")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	src, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	program, err := module.Parse(string(src), evaluator.MacroExpander(object.NewEnvironment()))
+	if syntaxErr, ok := err.(*module.SyntaxError); ok {
+		for _, msg := range syntaxErr.Errors {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", flags.Arg(0), msg)
+		}
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: macro expansion failed: %s\n", flags.Arg(0), err)
+		return 1
+	}
+
+	if !*jsonOutput {
+		fmt.Println(program.String())
+		return 0
+	}
+
+	data, err := ast.Encode(program)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("%s\n", data)
+	return 0
 }
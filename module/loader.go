@@ -0,0 +1,177 @@
+package module
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nicolerobin/monkey/ast"
+	"github.com/nicolerobin/monkey/object"
+	"github.com/nicolerobin/monkey/stdlib"
+)
+
+// Module 已解析的模块
+type Module struct {
+	Path    string       // 模块文件的绝对路径
+	Program *ast.Program // 模块的语法树
+
+	Native *object.Module // 宿主提供的原生模块，此时Path为模块名且Program为nil
+}
+
+// Exports 返回模块中通过export导出的顶层let绑定和函数声明的名称，按声明顺序排列
+func (m *Module) Exports() []string {
+	names := []string{}
+	for _, stmt := range m.Program.Statements {
+		switch stmt := stmt.(type) {
+		case *ast.LetStatement:
+			if !stmt.Exported {
+				continue
+			}
+			if stmt.Pattern == nil {
+				names = append(names, stmt.Name.Value)
+				continue
+			}
+			for _, name := range ast.PatternNames(stmt.Pattern) {
+				names = append(names, name.Value)
+			}
+		case *ast.FunctionStatement:
+			if stmt.Exported {
+				names = append(names, stmt.Name.Value)
+			}
+		}
+	}
+	return names
+}
+
+// Loader 模块加载器，负责查找、解析和缓存模块，并检测循环导入
+type Loader struct {
+	SearchPaths []string // 模块搜索路径
+
+	// Expand 展开模块中的宏，为nil时不展开，模块中的宏定义会在执行时报错。
+	// evaluator.NewLoader创建的加载器会设置它
+	Expand Expander
+
+	// Caps 不为nil时按照io模块的权限检查模块文件，只加载允许读取的目录中的模块。
+	// 为nil时不做检查，由宿主自行决定脚本可以导入哪些文件
+	Caps *stdlib.Capabilities
+
+	cache   map[string]*Module        // 已解析模块，按绝对路径索引
+	natives map[string]*object.Module // 宿主注册的原生模块，按模块名索引
+	stack   []string                  // 正在加载的模块路径，用于解析相对路径和检测循环导入
+}
+
+// NewLoader 创建模块加载器，未指定搜索路径时使用当前目录。
+// 加载器默认注册不授予任何权限的io模块，宿主可以通过Register替换
+func NewLoader(searchPaths ...string) *Loader {
+	if len(searchPaths) == 0 {
+		searchPaths = []string{"."}
+	}
+	l := &Loader{
+		SearchPaths: searchPaths,
+		cache:       make(map[string]*Module),
+		natives:     make(map[string]*object.Module),
+	}
+	l.Register(stdlib.NewIO(stdlib.Capabilities{}))
+	return l
+}
+
+// Register 注册原生模块，import该模块名时直接使用模块对象而不查找文件，同名的原生模块会被替换
+func (l *Loader) Register(m *object.Module) {
+	l.natives[m.Name] = m
+	delete(l.cache, m.Name)
+}
+
+// Resolve 将import语句中的路径解析为模块文件的绝对路径
+// 以./或../开头的路径相对于当前正在加载的模块所在目录，其他路径依次在搜索路径中查找
+func (l *Loader) Resolve(name string) (string, error) {
+	var candidates []string
+
+	switch {
+	case filepath.IsAbs(name):
+		candidates = []string{name}
+	case strings.HasPrefix(name, "./") || strings.HasPrefix(name, "../"):
+		dir := "."
+		if len(l.stack) > 0 {
+			dir = filepath.Dir(l.stack[len(l.stack)-1])
+		}
+		candidates = []string{filepath.Join(dir, name)}
+	default:
+		for _, searchPath := range l.SearchPaths {
+			candidates = append(candidates, filepath.Join(searchPath, name))
+		}
+	}
+
+	for _, candidate := range candidates {
+		info, err := os.Stat(candidate)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		return filepath.Abs(candidate)
+	}
+	return "", fmt.Errorf("module not found: %q", name)
+}
+
+// Load 解析并加载模块，同一路径的模块只会被解析一次
+func (l *Loader) Load(name string) (*Module, error) {
+	if native, ok := l.natives[name]; ok {
+		m, ok := l.cache[name]
+		if !ok {
+			m = &Module{Path: name, Native: native}
+			l.cache[name] = m
+		}
+		return m, nil
+	}
+
+	path, err := l.Resolve(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if m, ok := l.cache[path]; ok {
+		return m, nil
+	}
+
+	// 读取检查过的路径，之后修改路径中的符号链接也无法读取允许访问的目录之外的文件
+	file := path
+	if l.Caps != nil {
+		file, err = l.Caps.Check(path, false)
+		if err != nil {
+			return nil, fmt.Errorf("cannot import %q: %s", name, err)
+		}
+	}
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	program, err := Parse(string(source), l.Expand)
+	if syntaxErr, ok := err.(*SyntaxError); ok {
+		return nil, fmt.Errorf("module %s has parser errors:\n\t%s",
+			path, strings.Join(syntaxErr.Errors, "\n\t"))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("module %s: macro expansion failed: %s", path, err)
+	}
+
+	m := &Module{Path: path, Program: program}
+	l.cache[path] = m
+	return m, nil
+}
+
+// Enter 标记开始执行模块，若模块已在加载链上则说明存在循环导入
+func (l *Loader) Enter(m *Module) error {
+	for i, path := range l.stack {
+		if path == m.Path {
+			cycle := append(append([]string{}, l.stack[i:]...), m.Path)
+			return fmt.Errorf("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	l.stack = append(l.stack, m.Path)
+	return nil
+}
+
+// Leave 标记模块执行结束
+func (l *Loader) Leave() {
+	l.stack = l.stack[:len(l.stack)-1]
+}
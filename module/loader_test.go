@@ -0,0 +1,229 @@
+package module
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nicolerobin/monkey/ast"
+	"github.com/nicolerobin/monkey/object"
+	"github.com/nicolerobin/monkey/stdlib"
+)
+
+func writeModules(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatalf("os.MkdirAll() failed, error:%s", err)
+		}
+		err = os.WriteFile(path, []byte(source), 0644)
+		if err != nil {
+			t.Fatalf("os.WriteFile() failed, error:%s", err)
+		}
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"lib/util.mk": `export let add = fn(a, b) { a + b }; let hidden = 1; export let two = 2; export let [x, {y}] = [1, {"y": 2}];`,
+	})
+	l := NewLoader(dir)
+
+	m, err := l.Load("lib/util.mk")
+	if err != nil {
+		t.Fatalf("l.Load() failed, error:%s", err)
+	}
+	if m.Path != filepath.Join(dir, "lib/util.mk") {
+		t.Errorf("m.Path wrong. got=%s", m.Path)
+	}
+
+	exports := m.Exports()
+	if strings.Join(exports, ",") != "add,two,x,y" {
+		t.Errorf("m.Exports() wrong. got=%v", exports)
+	}
+
+	cached, err := l.Load("lib/util.mk")
+	if err != nil {
+		t.Fatalf("l.Load() failed, error:%s", err)
+	}
+	if cached != m {
+		t.Errorf("module was not cached")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"first/a.mk":      ``,
+		"second/a.mk":     ``,
+		"second/b.mk":     ``,
+		"second/sub/c.mk": ``,
+	})
+	l := NewLoader(filepath.Join(dir, "first"), filepath.Join(dir, "second"))
+
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"a.mk", "first/a.mk"},
+		{"b.mk", "second/b.mk"},
+		{"sub/c.mk", "second/sub/c.mk"},
+	}
+	for _, tt := range tests {
+		path, err := l.Resolve(tt.name)
+		if err != nil {
+			t.Fatalf("l.Resolve(%q) failed, error:%s", tt.name, err)
+		}
+		if path != filepath.Join(dir, tt.expected) {
+			t.Errorf("l.Resolve(%q) wrong. want=%s, got=%s", tt.name, tt.expected, path)
+		}
+	}
+
+	// 相对路径基于当前正在加载的模块所在目录
+	m, err := l.Load("sub/c.mk")
+	if err != nil {
+		t.Fatalf("l.Load() failed, error:%s", err)
+	}
+	err = l.Enter(m)
+	if err != nil {
+		t.Fatalf("l.Enter() failed, error:%s", err)
+	}
+	path, err := l.Resolve("../b.mk")
+	if err != nil {
+		t.Fatalf("l.Resolve() failed, error:%s", err)
+	}
+	if path != filepath.Join(dir, "second/b.mk") {
+		t.Errorf("l.Resolve() wrong. got=%s", path)
+	}
+	l.Leave()
+
+	_, err = l.Resolve("missing.mk")
+	if err == nil || err.Error() != `module not found: "missing.mk"` {
+		t.Errorf("expected module not found error, got=%v", err)
+	}
+}
+
+func TestImportCycle(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"a.mk": `import "b.mk" as b;`,
+		"b.mk": `import "a.mk" as a;`,
+	})
+	l := NewLoader(dir)
+
+	a, _ := l.Load("a.mk")
+	b, _ := l.Load("b.mk")
+	if err := l.Enter(a); err != nil {
+		t.Fatalf("l.Enter(a) failed, error:%s", err)
+	}
+	if err := l.Enter(b); err != nil {
+		t.Fatalf("l.Enter(b) failed, error:%s", err)
+	}
+
+	err := l.Enter(a)
+	expected := "import cycle: " + a.Path + " -> " + b.Path + " -> " + a.Path
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong cycle error. want=%q, got=%v", expected, err)
+	}
+}
+
+func TestLoadParserErrors(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"bad.mk": `let = 1;`,
+	})
+	l := NewLoader(dir)
+
+	_, err := l.Load("bad.mk")
+	if err == nil {
+		t.Fatalf("expected parser error but resulted in none")
+	}
+}
+
+func TestLoadExpand(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"a.mk": `export let a = 1; export let b = 2;`,
+	})
+	l := NewLoader(dir)
+	l.Expand = func(program *ast.Program) (*ast.Program, error) {
+		program.Statements = program.Statements[:1]
+		return program, nil
+	}
+
+	m, err := l.Load("a.mk")
+	if err != nil {
+		t.Fatalf("l.Load() failed, error:%s", err)
+	}
+	if strings.Join(m.Exports(), ",") != "a" {
+		t.Errorf("module was not expanded, exports=%v", m.Exports())
+	}
+
+	l = NewLoader(dir)
+	l.Expand = func(program *ast.Program) (*ast.Program, error) {
+		return nil, fmt.Errorf("boom")
+	}
+	_, err = l.Load("a.mk")
+	if err == nil || !strings.Contains(err.Error(), "macro expansion failed: boom") {
+		t.Errorf("wrong expansion error, got=%v", err)
+	}
+}
+
+func TestLoadCaps(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"a.mk": `export let a = 1;`,
+	})
+
+	l := NewLoader(dir)
+	l.Caps = &stdlib.Capabilities{Dirs: []string{t.TempDir()}}
+	_, err := l.Load("a.mk")
+	if err == nil || !strings.Contains(err.Error(), `cannot import "a.mk": permission denied`) {
+		t.Errorf("wrong permission error, got=%v", err)
+	}
+
+	l.Caps = &stdlib.Capabilities{Dirs: []string{dir}, ReadOnly: true}
+	if _, err := l.Load("a.mk"); err != nil {
+		t.Errorf("l.Load() failed, error:%s", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	_, err := Parse(`let = 1;`, nil)
+	syntaxErr, ok := err.(*SyntaxError)
+	if !ok || len(syntaxErr.Errors) == 0 {
+		t.Fatalf("expected *SyntaxError, got=%v", err)
+	}
+
+	program, err := Parse(`let a = 1;`, nil)
+	if err != nil || len(program.Statements) != 1 {
+		t.Errorf("Parse() wrong, program=%v, error=%v", program, err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	l := NewLoader(t.TempDir())
+
+	m, err := l.Load("io")
+	if err != nil {
+		t.Fatalf("l.Load() failed, error:%s", err)
+	}
+	if m.Native == nil || m.Native.Name != "io" || m.Path != "io" {
+		t.Fatalf("io module is not registered by default, got=%+v", m)
+	}
+
+	native := &object.Module{Name: "io", Exports: map[string]object.Object{}}
+	l.Register(native)
+	m, err = l.Load("io")
+	if err != nil {
+		t.Fatalf("l.Load() failed, error:%s", err)
+	}
+	if m.Native != native {
+		t.Errorf("registered module did not replace the default one")
+	}
+	if cached, _ := l.Load("io"); cached != m {
+		t.Errorf("native module was not cached")
+	}
+}
@@ -0,0 +1,37 @@
+package module
+
+import (
+	"strings"
+
+	"github.com/nicolerobin/monkey/ast"
+	"github.com/nicolerobin/monkey/lexer"
+	"github.com/nicolerobin/monkey/parser"
+)
+
+// Expander 定义并展开程序中的宏，返回可以求值或编译的程序
+type Expander func(program *ast.Program) (*ast.Program, error)
+
+// SyntaxError 源代码中的语法错误
+type SyntaxError struct {
+	Errors []string // 解析器报告的全部错误
+}
+
+func (e *SyntaxError) Error() string {
+	return "parser errors:\n\t" + strings.Join(e.Errors, "\n\t")
+}
+
+// Parse 解析源代码，expand不为nil时再用它展开程序中的宏。
+// 加载模块、REPL、基准测试和parse命令都通过它得到可以求值或编译的程序，
+// 语法错误以*SyntaxError返回，其他错误都来自宏展开
+func Parse(source string, expand Expander) (*ast.Program, error) {
+	p := parser.NewParser(lexer.NewLexer(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, &SyntaxError{Errors: p.Errors()}
+	}
+
+	if expand == nil {
+		return program, nil
+	}
+	return expand(program)
+}
@@ -5,8 +5,14 @@ import (
 	"strings"
 )
 
+// Array 不可变数组，以持久化向量保存元素，Push和Rest与原数组共享结构。零值为空数组
 type Array struct {
-	Elements []Object
+	elements vector[Object]
+}
+
+// NewArray 由切片创建数组，不引用传入的切片
+func NewArray(elements []Object) *Array {
+	return &Array{elements: newVector(elements)}
 }
 
 func (a *Array) Type() ObjectType {
@@ -17,7 +23,7 @@ func (a *Array) Inspect() string {
 	var out bytes.Buffer
 
 	elements := []string{}
-	for _, e := range a.Elements {
+	for _, e := range a.Elements() {
 		elements = append(elements, e.Inspect())
 	}
 
@@ -27,3 +33,78 @@ func (a *Array) Inspect() string {
 
 	return out.String()
 }
+
+// Len 返回元素个数
+func (a *Array) Len() int {
+	return a.elements.Len()
+}
+
+// At 返回下标i处的元素，调用者需保证0 <= i < Len()
+func (a *Array) At(i int) Object {
+	return a.elements.At(i)
+}
+
+// Elements 按顺序返回全部元素组成的新切片
+func (a *Array) Elements() []Object {
+	return a.elements.Slice()
+}
+
+// Push 返回在末尾追加obj的新数组，时间复杂度O(log n)
+func (a *Array) Push(obj Object) *Array {
+	return &Array{elements: a.elements.Push(obj)}
+}
+
+// Rest 返回去掉第一个元素的新数组，调用者需保证数组非空
+func (a *Array) Rest() *Array {
+	return &Array{elements: a.elements.Rest()}
+}
+
+// Drop 返回去掉前n个元素的新数组，n不小于Len()时返回空数组
+func (a *Array) Drop(n int) *Array {
+	if n <= 0 {
+		return a
+	}
+	if n >= a.Len() {
+		return &Array{}
+	}
+	return NewArray(a.Elements()[n:])
+}
+
+// Equal 逐个比较元素
+func (a *Array) Equal(other Object) bool {
+	o, ok := other.(*Array)
+	if !ok || a.Len() != o.Len() {
+		return false
+	}
+
+	for i := 0; i < a.Len(); i++ {
+		if !a.At(i).Equal(o.At(i)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Compare 按字典序逐个比较元素，较短的数组是另一个的前缀时较短的数组更小
+func (a *Array) Compare(other Object) (int, error) {
+	o, ok := other.(*Array)
+	if !ok {
+		return 0, errUnordered(a, other)
+	}
+
+	for i := 0; i < a.Len() && i < o.Len(); i++ {
+		result, err := a.At(i).Compare(o.At(i))
+		if err != nil || result != 0 {
+			return result, err
+		}
+	}
+
+	switch {
+	case a.Len() < o.Len():
+		return -1, nil
+	case a.Len() > o.Len():
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
@@ -2,6 +2,11 @@ package object
 
 import "fmt"
 
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+)
+
 type Boolean struct {
 	Value bool
 }
@@ -13,3 +18,32 @@ func (b *Boolean) Type() ObjectType {
 func (b *Boolean) Inspect() string {
 	return fmt.Sprintf("%t", b.Value)
 }
+
+func (b *Boolean) Equal(other Object) bool {
+	o, ok := other.(*Boolean)
+	return ok && b.Value == o.Value
+}
+
+// Compare false小于true
+func (b *Boolean) Compare(other Object) (int, error) {
+	o, ok := other.(*Boolean)
+	if !ok {
+		return 0, errUnordered(b, other)
+	}
+
+	switch {
+	case b.Value == o.Value:
+		return 0, nil
+	case o.Value:
+		return -1, nil
+	default:
+		return 1, nil
+	}
+}
+
+func nativeBoolToBoolean(b bool) *Boolean {
+	if b {
+		return TRUE
+	}
+	return FALSE
+}
@@ -1,6 +1,31 @@
 package object
 
-type BuiltinFunction func(args ...Object) Object
+// Caller 由执行引擎实现，供内置函数回调Monkey函数(调用失败时返回*Error)以及获取执行上下文
+type Caller interface {
+	Call(fn Object, args ...Object) Object
+	Context() *Context
+}
+
+// CallerFunc 将普通函数适配为Caller，执行上下文为nil，即使用进程的标准输入输出
+type CallerFunc func(fn Object, args ...Object) Object
+
+func (f CallerFunc) Call(fn Object, args ...Object) Object {
+	return f(fn, args...)
+}
+
+func (f CallerFunc) Context() *Context {
+	return nil
+}
+
+// contextOf 返回caller的执行上下文，caller为nil时返回nil
+func contextOf(caller Caller) *Context {
+	if caller == nil {
+		return nil
+	}
+	return caller.Context()
+}
+
+type BuiltinFunction func(caller Caller, args ...Object) Object
 
 type Builtin struct {
 	Fn BuiltinFunction
@@ -13,3 +38,12 @@ func (b *Builtin) Type() ObjectType {
 func (b *Builtin) Inspect() string {
 	return "builtin function"
 }
+
+// Equal 比较是否为同一个对象
+func (b *Builtin) Equal(other Object) bool {
+	return Object(b) == other
+}
+
+func (b *Builtin) Compare(other Object) (int, error) {
+	return 0, errUnordered(b, other)
+}
@@ -0,0 +1,263 @@
+package object
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Builtins 内置函数表，解释器按名称查找，编译器和虚拟机按下标引用，因此只能在末尾追加
+var Builtins = []struct {
+	Name    string
+	Builtin *Builtin
+}{
+	{"len", &Builtin{Fn: builtinLen}},
+	{"puts", &Builtin{Fn: builtinPuts}},
+	{"first", &Builtin{Fn: builtinFirst}},
+	{"last", &Builtin{Fn: builtinLast}},
+	{"rest", &Builtin{Fn: builtinRest}},
+	{"push", &Builtin{Fn: builtinPush}},
+	{"keys", &Builtin{Fn: builtinKeys}},
+	{"values", &Builtin{Fn: builtinValues}},
+	{"entries", &Builtin{Fn: builtinEntries}},
+	{"has", &Builtin{Fn: builtinHas}},
+	{"delete", &Builtin{Fn: builtinDelete}},
+	{"merge", &Builtin{Fn: builtinMerge}},
+	{"map", &Builtin{Fn: builtinMap}},
+	{"filter", &Builtin{Fn: builtinFilter}},
+	{"reduce", &Builtin{Fn: builtinReduce}},
+	{"each", &Builtin{Fn: builtinEach}},
+	{"sort", &Builtin{Fn: builtinSort}},
+	{"range", &Builtin{Fn: builtinRange}},
+	{"zip", &Builtin{Fn: builtinZip}},
+	{"reverse", &Builtin{Fn: builtinReverse}},
+	{"flatten", &Builtin{Fn: builtinFlatten}},
+	{"unique", &Builtin{Fn: builtinUnique}},
+	{"json_parse", &Builtin{Fn: builtinJSONParse}},
+	{"json_stringify", &Builtin{Fn: builtinJSONStringify}},
+}
+
+// GetBuiltinByName 按名称查找内置函数
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+	return nil
+}
+
+// BuiltinNames 返回全部内置函数的名称，按字典序排序
+func BuiltinNames() []string {
+	names := make([]string, 0, len(Builtins))
+	for _, def := range Builtins {
+		names = append(names, def.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
+
+func builtinLen(_ Caller, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *String:
+		return &Integer{Value: int64(len(arg.Value))}
+	case *Array:
+		return &Integer{Value: int64(arg.Len())}
+	case *Hash:
+		return &Integer{Value: int64(arg.Len())}
+	default:
+		return newError("argument to `len` not supported, got %s",
+			args[0].Type())
+	}
+}
+
+// builtinPuts 将每个参数输出为一行，写入执行上下文的输出
+func builtinPuts(caller Caller, args ...Object) Object {
+	out := contextOf(caller).Out()
+	for _, arg := range args {
+		if _, err := fmt.Fprintln(out, arg.Inspect()); err != nil {
+			return newError("puts: %s", err)
+		}
+	}
+	return NULL
+}
+
+func builtinFirst(_ Caller, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	if args[0].Type() != ARRAY_OBJ {
+		return newError("argument to `first` must be ARRAY, got %s",
+			args[0].Type())
+	}
+
+	arr := args[0].(*Array)
+	if arr.Len() > 0 {
+		return arr.At(0)
+	}
+	return NULL
+}
+
+func builtinLast(_ Caller, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	if args[0].Type() != ARRAY_OBJ {
+		return newError("argument to `last` must be ARRAY, got %s",
+			args[0].Type())
+	}
+
+	arr := args[0].(*Array)
+	length := arr.Len()
+	if length > 0 {
+		return arr.At(length - 1)
+	}
+	return NULL
+}
+
+func builtinRest(_ Caller, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	if args[0].Type() != ARRAY_OBJ {
+		return newError("argument to `rest` must be ARRAY, got %s",
+			args[0].Type())
+	}
+
+	arr := args[0].(*Array)
+	if arr.Len() > 0 {
+		return arr.Rest()
+	}
+	return NULL
+}
+
+func builtinPush(_ Caller, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+	if args[0].Type() != ARRAY_OBJ {
+		return newError("argument to `push` must be ARRAY, got %s",
+			args[0].Type())
+	}
+
+	return args[0].(*Array).Push(args[1])
+}
+
+// hashArgument 检查第一个参数为哈希表，返回该哈希表
+func hashArgument(name string, want int, args []Object) (*Hash, *Error) {
+	if len(args) != want {
+		return nil, newError("wrong number of arguments. got=%d, want=%d",
+			len(args), want)
+	}
+
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return nil, newError("argument to `%s` must be HASH, got %s",
+			name, args[0].Type())
+	}
+	return hash, nil
+}
+
+func builtinKeys(_ Caller, args ...Object) Object {
+	hash, err := hashArgument("keys", 1, args)
+	if err != nil {
+		return err
+	}
+
+	elements := make([]Object, 0, hash.Len())
+	for _, pair := range hash.Ordered() {
+		elements = append(elements, pair.Key)
+	}
+	return NewArray(elements)
+}
+
+func builtinValues(_ Caller, args ...Object) Object {
+	hash, err := hashArgument("values", 1, args)
+	if err != nil {
+		return err
+	}
+
+	elements := make([]Object, 0, hash.Len())
+	for _, pair := range hash.Ordered() {
+		elements = append(elements, pair.Value)
+	}
+	return NewArray(elements)
+}
+
+// builtinEntries 返回由[键, 值]数组组成的数组
+func builtinEntries(_ Caller, args ...Object) Object {
+	hash, err := hashArgument("entries", 1, args)
+	if err != nil {
+		return err
+	}
+
+	elements := make([]Object, 0, hash.Len())
+	for _, pair := range hash.Ordered() {
+		elements = append(elements, NewArray([]Object{pair.Key, pair.Value}))
+	}
+	return NewArray(elements)
+}
+
+func builtinHas(_ Caller, args ...Object) Object {
+	hash, err := hashArgument("has", 2, args)
+	if err != nil {
+		return err
+	}
+
+	if !IsHashable(args[1]) {
+		return newError("unusable as hash key: %s", args[1].Type())
+	}
+
+	if _, ok := hash.Get(args[1]); ok {
+		return TRUE
+	}
+	return FALSE
+}
+
+// builtinDelete 返回删除了指定键的新哈希表，原哈希表不变
+func builtinDelete(_ Caller, args ...Object) Object {
+	hash, err := hashArgument("delete", 2, args)
+	if err != nil {
+		return err
+	}
+
+	if !IsHashable(args[1]) {
+		return newError("unusable as hash key: %s", args[1].Type())
+	}
+
+	return hash.Without(args[1])
+}
+
+// builtinMerge 返回合并后的新哈希表，第二个哈希表中的值覆盖第一个中相同键的值，新键追加在末尾
+func builtinMerge(_ Caller, args ...Object) Object {
+	hash, err := hashArgument("merge", 2, args)
+	if err != nil {
+		return err
+	}
+
+	other, ok := args[1].(*Hash)
+	if !ok {
+		return newError("argument to `merge` must be HASH, got %s",
+			args[1].Type())
+	}
+
+	result := hash
+	for _, pair := range other.Ordered() {
+		result = result.With(pair.Key, pair.Value)
+	}
+	return result
+}
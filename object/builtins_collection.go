@@ -0,0 +1,364 @@
+package object
+
+import "sort"
+
+// arrayArgument 检查第index个参数为数组，返回该数组
+func arrayArgument(name string, index int, args []Object) (*Array, *Error) {
+	arr, ok := args[index].(*Array)
+	if !ok {
+		return nil, newError("argument to `%s` must be ARRAY, got %s",
+			name, args[index].Type())
+	}
+	return arr, nil
+}
+
+// functionArgument 检查第index个参数可以被调用
+func functionArgument(name string, index int, args []Object) (Object, *Error) {
+	switch args[index].(type) {
+	case *Function, *CompiledFunction, *Closure, *Builtin:
+		return args[index], nil
+	default:
+		return nil, newError("argument to `%s` must be FUNCTION, got %s",
+			name, args[index].Type())
+	}
+}
+
+// call 通过caller调用fn，引擎未提供caller时返回错误
+func call(caller Caller, fn Object, args ...Object) Object {
+	if caller == nil {
+		return newError("calling functions from builtins is not supported here")
+	}
+	result := caller.Call(fn, args...)
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+// isTruthy 与两个执行引擎一致：null与false为假，其余为真
+func isTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+	case *Null:
+		return false
+	default:
+		return true
+	}
+}
+
+func isError(obj Object) bool {
+	return obj != nil && obj.Type() == ERROR_OBJ
+}
+
+// builtinMap 对数组的每个元素调用函数，返回结果组成的新数组
+func builtinMap(caller Caller, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+	arr, err := arrayArgument("map", 0, args)
+	if err != nil {
+		return err
+	}
+	fn, err := functionArgument("map", 1, args)
+	if err != nil {
+		return err
+	}
+
+	elements := make([]Object, arr.Len())
+	for i, element := range arr.Elements() {
+		result := call(caller, fn, element)
+		if isError(result) {
+			return result
+		}
+		elements[i] = result
+	}
+	return NewArray(elements)
+}
+
+// builtinFilter 返回使函数结果为真的元素组成的新数组
+func builtinFilter(caller Caller, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+	arr, err := arrayArgument("filter", 0, args)
+	if err != nil {
+		return err
+	}
+	fn, err := functionArgument("filter", 1, args)
+	if err != nil {
+		return err
+	}
+
+	elements := make([]Object, 0, arr.Len())
+	for _, element := range arr.Elements() {
+		result := call(caller, fn, element)
+		if isError(result) {
+			return result
+		}
+		if isTruthy(result) {
+			elements = append(elements, element)
+		}
+	}
+	return NewArray(elements)
+}
+
+// builtinReduce reduce(arr, initial, fn)，依次以(累积值, 元素)调用函数
+func builtinReduce(caller Caller, args ...Object) Object {
+	if len(args) != 3 {
+		return newError("wrong number of arguments. got=%d, want=3",
+			len(args))
+	}
+	arr, err := arrayArgument("reduce", 0, args)
+	if err != nil {
+		return err
+	}
+	fn, err := functionArgument("reduce", 2, args)
+	if err != nil {
+		return err
+	}
+
+	acc := args[1]
+	for _, element := range arr.Elements() {
+		acc = call(caller, fn, acc, element)
+		if isError(acc) {
+			return acc
+		}
+	}
+	return acc
+}
+
+// builtinEach 对数组的每个元素调用函数，返回null
+func builtinEach(caller Caller, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+	arr, err := arrayArgument("each", 0, args)
+	if err != nil {
+		return err
+	}
+	fn, err := functionArgument("each", 1, args)
+	if err != nil {
+		return err
+	}
+
+	for _, element := range arr.Elements() {
+		if result := call(caller, fn, element); isError(result) {
+			return result
+		}
+	}
+	return NULL
+}
+
+// builtinSort 返回排好序的新数组，排序是稳定的。
+// 默认按Compare排序，也可以传入比较函数，其返回值小于0、等于0、大于0分别表示小于、等于、大于
+func builtinSort(caller Caller, args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2",
+			len(args))
+	}
+	arr, err := arrayArgument("sort", 0, args)
+	if err != nil {
+		return err
+	}
+
+	compare := func(a, b Object) (int, Object) {
+		result, err := Compare(a, b)
+		if err != nil {
+			return 0, newError("%s", err)
+		}
+		return result, nil
+	}
+	if len(args) == 2 {
+		fn, err := functionArgument("sort", 1, args)
+		if err != nil {
+			return err
+		}
+		compare = func(a, b Object) (int, Object) {
+			result := call(caller, fn, a, b)
+			if isError(result) {
+				return 0, result
+			}
+			integer, ok := result.(*Integer)
+			if !ok {
+				return 0, newError("comparator passed to `sort` must return INTEGER, got %s",
+					result.Type())
+			}
+			return int(integer.Value), nil
+		}
+	}
+
+	elements := arr.Elements()
+
+	// 比较出错后不再调用比较函数，排序结束后返回第一个错误
+	var failure Object
+	sort.SliceStable(elements, func(i, j int) bool {
+		if failure != nil {
+			return false
+		}
+		result, errObj := compare(elements[i], elements[j])
+		if errObj != nil {
+			failure = errObj
+			return false
+		}
+		return result < 0
+	})
+	if failure != nil {
+		return failure
+	}
+	return NewArray(elements)
+}
+
+// builtinRange range(stop)、range(start, stop)或range(start, stop, step)，返回整数数组，不包含stop
+func builtinRange(_ Caller, args ...Object) Object {
+	if len(args) < 1 || len(args) > 3 {
+		return newError("wrong number of arguments. got=%d, want=1 to 3",
+			len(args))
+	}
+
+	values := make([]int64, len(args))
+	for i, arg := range args {
+		integer, ok := arg.(*Integer)
+		if !ok {
+			return newError("argument to `range` must be INTEGER, got %s",
+				arg.Type())
+		}
+		values[i] = integer.Value
+	}
+
+	var start, stop, step int64 = 0, values[0], 1
+	if len(values) > 1 {
+		start, stop = values[0], values[1]
+	}
+	if len(values) > 2 {
+		step = values[2]
+	}
+	if step == 0 {
+		return newError("`range` step must not be zero")
+	}
+
+	elements := []Object{}
+	for i := start; (step > 0 && i < stop) || (step < 0 && i > stop); i += step {
+		elements = append(elements, &Integer{Value: i})
+	}
+	return NewArray(elements)
+}
+
+// builtinZip 将多个数组按位置组合为[a[i], b[i], ...]，长度取最短的数组
+func builtinZip(_ Caller, args ...Object) Object {
+	if len(args) == 0 {
+		return newError("wrong number of arguments. got=0, want at least 1")
+	}
+
+	arrays := make([]*Array, len(args))
+	length := -1
+	for i := range args {
+		arr, err := arrayArgument("zip", i, args)
+		if err != nil {
+			return err
+		}
+		arrays[i] = arr
+		if length < 0 || arr.Len() < length {
+			length = arr.Len()
+		}
+	}
+
+	elements := make([]Object, length)
+	for i := range elements {
+		tuple := make([]Object, len(arrays))
+		for j, arr := range arrays {
+			tuple[j] = arr.At(i)
+		}
+		elements[i] = NewArray(tuple)
+	}
+	return NewArray(elements)
+}
+
+// builtinReverse 返回逆序的新数组或字符串
+func builtinReverse(_ Caller, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *Array:
+		length := arg.Len()
+		elements := make([]Object, length)
+		for i, element := range arg.Elements() {
+			elements[length-1-i] = element
+		}
+		return NewArray(elements)
+	case *String:
+		runes := []rune(arg.Value)
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+		return &String{Value: string(runes)}
+	default:
+		return newError("argument to `reverse` not supported, got %s",
+			args[0].Type())
+	}
+}
+
+// builtinFlatten 将数组中的数组元素展开一层
+func builtinFlatten(_ Caller, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	arr, err := arrayArgument("flatten", 0, args)
+	if err != nil {
+		return err
+	}
+
+	elements := make([]Object, 0, arr.Len())
+	for _, element := range arr.Elements() {
+		if inner, ok := element.(*Array); ok {
+			elements = append(elements, inner.Elements()...)
+			continue
+		}
+		elements = append(elements, element)
+	}
+	return NewArray(elements)
+}
+
+// builtinUnique 按Equal去除重复元素，保留第一次出现的位置
+func builtinUnique(_ Caller, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	arr, err := arrayArgument("unique", 0, args)
+	if err != nil {
+		return err
+	}
+
+	// 可哈希的元素通过哈希表判重，其余元素逐个比较
+	seen := NewHash()
+	elements := make([]Object, 0, arr.Len())
+	for _, element := range arr.Elements() {
+		if IsHashable(element) {
+			if _, ok := seen.Get(element); ok {
+				continue
+			}
+			seen.Set(element, TRUE)
+		} else if containsEqual(elements, element) {
+			continue
+		}
+		elements = append(elements, element)
+	}
+	return NewArray(elements)
+}
+
+func containsEqual(elements []Object, obj Object) bool {
+	for _, element := range elements {
+		if Equal(element, obj) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package object
+
+import "strings"
+
+// maxJSONIndent json_stringify允许的最大缩进空格数
+const maxJSONIndent = 16
+
+// builtinJSONParse 将JSON字符串解析为对象
+func builtinJSONParse(_ Caller, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	str, ok := args[0].(*String)
+	if !ok {
+		return newError("argument to `json_parse` must be STRING, got %s",
+			args[0].Type())
+	}
+
+	obj, err := FromJSON([]byte(str.Value))
+	if err != nil {
+		return newError("json_parse: %s", err)
+	}
+	return obj
+}
+
+// builtinJSONStringify 将对象编码为规范的JSON字符串，可选的第二个参数为缩进的空格数
+func builtinJSONStringify(_ Caller, args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2",
+			len(args))
+	}
+
+	indent := ""
+	if len(args) == 2 {
+		n, ok := args[1].(*Integer)
+		if !ok {
+			return newError("argument to `json_stringify` must be INTEGER, got %s",
+				args[1].Type())
+		}
+		if n.Value < 0 || n.Value > maxJSONIndent {
+			return newError("`json_stringify` indent must be between 0 and %d, got %d",
+				maxJSONIndent, n.Value)
+		}
+		indent = strings.Repeat(" ", int(n.Value))
+	}
+
+	data, err := ToJSON(args[0], indent)
+	if err != nil {
+		return newError("json_stringify: %s", err)
+	}
+	return &String{Value: string(data)}
+}
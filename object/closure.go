@@ -0,0 +1,24 @@
+package object
+
+// Closure 闭包，由虚拟机在运行时创建，保存已编译函数及其捕获的自由变量
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object // 自由变量的值，按编译器分配的下标排列
+}
+
+func (c *Closure) Type() ObjectType {
+	return CLOSURE_OBJ
+}
+
+func (c *Closure) Inspect() string {
+	return c.Fn.Inspect()
+}
+
+// Equal 比较是否为同一个对象
+func (c *Closure) Equal(other Object) bool {
+	return Object(c) == other
+}
+
+func (c *Closure) Compare(other Object) (int, error) {
+	return 0, errUnordered(c, other)
+}
@@ -0,0 +1,17 @@
+package object
+
+import "fmt"
+
+// Equal 判断两个对象是否相等，各对象类型通过Object.Equal定义相等的含义
+func Equal(a, b Object) bool {
+	return a.Equal(b)
+}
+
+// Compare 比较两个对象的大小，负数表示a小于b，0表示相等，正数表示a大于b，两者无序时返回错误
+func Compare(a, b Object) (int, error) {
+	return a.Compare(b)
+}
+
+func errUnordered(a, b Object) error {
+	return fmt.Errorf("cannot compare %s and %s", a.Type(), b.Type())
+}
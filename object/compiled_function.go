@@ -1,14 +1,27 @@
 package object
 
 import (
-	"fmt"
 	"github.com/nicolerobin/monkey/code"
 )
 
 type CompiledFunction struct {
+	Name          string // 函数绑定的名称，用于错误信息，匿名函数为空
 	Instructions  code.Instructions
 	NumLocals     int
-	NumParameters int
+	NumParameters int // 具名参数个数，包括带默认值的参数，不包括rest参数
+	// Entries 有默认值的参数时，Entries[k]为传入k个带默认值的参数时的入口，最后一项为函数体的起始位置，
+	// 没有默认值的参数时为nil，从头开始执行
+	Entries    []int
+	Variadic   bool     // 是否有rest参数，rest参数是第NumParameters个局部变量
+	Parameters []string // 参数的名称，有rest参数时最后一项为rest参数的名称，用于Inspect
+}
+
+// NumRequired 返回没有默认值的参数个数
+func (cf *CompiledFunction) NumRequired() int {
+	if len(cf.Entries) == 0 {
+		return cf.NumParameters
+	}
+	return cf.NumParameters - (len(cf.Entries) - 1)
 }
 
 func (cf *CompiledFunction) Type() ObjectType {
@@ -16,5 +29,18 @@ func (cf *CompiledFunction) Type() ObjectType {
 }
 
 func (cf *CompiledFunction) Inspect() string {
-	return fmt.Sprintf("CompiledFunction[%p]", cf)
+	params, rest := cf.Parameters, ""
+	if cf.Variadic && len(params) > 0 {
+		params, rest = params[:len(params)-1], params[len(params)-1]
+	}
+	return inspectFunction(cf.Name, params, rest)
+}
+
+// Equal 比较是否为同一个对象
+func (cf *CompiledFunction) Equal(other Object) bool {
+	return Object(cf) == other
+}
+
+func (cf *CompiledFunction) Compare(other Object) (int, error) {
+	return 0, errUnordered(cf, other)
 }
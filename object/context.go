@@ -0,0 +1,38 @@
+package object
+
+import (
+	"io"
+	"os"
+)
+
+// Context 执行上下文，保存宿主提供给脚本的输入输出，内置函数通过Caller获取。
+// nil或未设置的字段使用进程的标准输入输出
+type Context struct {
+	Stdout io.Writer // 输出，puts写入此处
+	Stderr io.Writer // 错误输出
+	Stdin  io.Reader // 输入
+}
+
+// Out 返回输出
+func (c *Context) Out() io.Writer {
+	if c == nil || c.Stdout == nil {
+		return os.Stdout
+	}
+	return c.Stdout
+}
+
+// Err 返回错误输出
+func (c *Context) Err() io.Writer {
+	if c == nil || c.Stderr == nil {
+		return os.Stderr
+	}
+	return c.Stderr
+}
+
+// In 返回输入
+func (c *Context) In() io.Reader {
+	if c == nil || c.Stdin == nil {
+		return os.Stdin
+	}
+	return c.Stdin
+}
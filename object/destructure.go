@@ -0,0 +1,53 @@
+package object
+
+import "fmt"
+
+// MatchArray 判断obj能否按包含count个元素的数组模式解构，
+// variadic(模式带有...rest)时数组至少有count个元素，否则恰好有count个
+func MatchArray(obj Object, count int, variadic bool) bool {
+	arr, ok := obj.(*Array)
+	return ok && (arr.Len() == count || variadic && arr.Len() > count)
+}
+
+// MatchHash 判断obj能否按包含keys中全部键的哈希表模式解构，哈希表可以有模式之外的键
+func MatchHash(obj Object, keys []string) bool {
+	hash, ok := obj.(*Hash)
+	if !ok {
+		return false
+	}
+	for _, key := range keys {
+		if _, ok := hash.Get(&String{Value: key}); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// DestructureArray 与MatchArray相同，不能解构时返回描述原因的错误
+func DestructureArray(obj Object, count int, variadic bool) error {
+	if MatchArray(obj, count, variadic) {
+		return nil
+	}
+	arr, ok := obj.(*Array)
+	if !ok {
+		return fmt.Errorf("cannot destructure %s as array", obj.Type())
+	}
+	if variadic {
+		return fmt.Errorf("cannot destructure array of length %d into at least %d elements", arr.Len(), count)
+	}
+	return fmt.Errorf("cannot destructure array of length %d into %d elements", arr.Len(), count)
+}
+
+// DestructureHash 与MatchHash相同，不能解构时返回描述原因的错误
+func DestructureHash(obj Object, keys []string) error {
+	hash, ok := obj.(*Hash)
+	if !ok {
+		return fmt.Errorf("cannot destructure %s as hash", obj.Type())
+	}
+	for _, key := range keys {
+		if _, ok := hash.Get(&String{Value: key}); !ok {
+			return fmt.Errorf("cannot destructure hash without key %q", key)
+		}
+	}
+	return nil
+}
@@ -1,19 +1,40 @@
 package object
 
+import (
+	"fmt"
+	"sort"
+)
+
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
+	env.modules = outer.modules
 	return env
 }
 
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s}
+	return &Environment{store: s, constants: make(map[string]bool), modules: make(map[string]*Module)}
+}
+
+// NewModuleEnvironment 创建模块的顶层环境，模块拥有独立的全局命名空间，但与导入方共享模块缓存
+func NewModuleEnvironment(importer *Environment) *Environment {
+	env := NewEnvironment()
+	env.modules = importer.modules
+	env.ctx = importer.Context()
+	env.loader = importer.Loader()
+	return env
 }
 
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store     map[string]Object
+	constants map[string]bool // 当前环境中由const定义的名称
+	outer     *Environment
+	modules   map[string]*Module // 已加载的模块，按模块路径索引
+	ctx       *Context           // 执行上下文，嵌套环境未设置时使用外层环境的
+	// loader 求值import语句时使用的模块加载器，即*module.Loader，嵌套环境未设置时使用外层环境的。
+	// module包依赖object包，因此这里不指定具体类型
+	loader interface{}
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
@@ -28,3 +49,74 @@ func (e *Environment) Set(name string, val Object) Object {
 	e.store[name] = val
 	return val
 }
+
+// Define 在当前环境中定义名称，与Set不同，当前环境中已有同名常量时返回错误
+func (e *Environment) Define(name string, val Object) error {
+	if e.constants[name] {
+		return fmt.Errorf("cannot redefine constant %s", name)
+	}
+	e.store[name] = val
+	return nil
+}
+
+// DefineConstant 在当前环境中定义常量，当前环境中已有同名常量时返回错误
+func (e *Environment) DefineConstant(name string, val Object) error {
+	err := e.Define(name, val)
+	if err != nil {
+		return err
+	}
+	e.constants[name] = true
+	return nil
+}
+
+// IsConstant 判断name是否为当前环境中定义的常量
+func (e *Environment) IsConstant(name string) bool {
+	return e.constants[name]
+}
+
+// Names 返回当前环境中定义的全部名称，按字典序排序
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Module 获取已加载的模块
+func (e *Environment) Module(path string) (*Module, bool) {
+	m, ok := e.modules[path]
+	return m, ok
+}
+
+// SetModule 缓存已加载的模块
+func (e *Environment) SetModule(path string, m *Module) {
+	e.modules[path] = m
+}
+
+// Context 返回执行上下文，当前环境未设置时查找外层环境，都未设置时返回nil
+func (e *Environment) Context() *Context {
+	if e.ctx == nil && e.outer != nil {
+		return e.outer.Context()
+	}
+	return e.ctx
+}
+
+// SetContext 设置执行上下文，在该环境及其嵌套环境中求值的内置函数通过它访问输入输出
+func (e *Environment) SetContext(ctx *Context) {
+	e.ctx = ctx
+}
+
+// Loader 返回模块加载器，当前环境未设置时查找外层环境，都未设置时返回nil
+func (e *Environment) Loader() interface{} {
+	if e.loader == nil && e.outer != nil {
+		return e.outer.Loader()
+	}
+	return e.loader
+}
+
+// SetLoader 设置模块加载器，在该环境及其嵌套环境中求值import语句时使用
+func (e *Environment) SetLoader(l interface{}) {
+	e.loader = l
+}
@@ -11,3 +11,12 @@ func (e *Error) Type() ObjectType {
 func (e *Error) Inspect() string {
 	return "ERROR: " + e.Message
 }
+
+func (e *Error) Equal(other Object) bool {
+	o, ok := other.(*Error)
+	return ok && e.Message == o.Message
+}
+
+func (e *Error) Compare(other Object) (int, error) {
+	return 0, errUnordered(e, other)
+}
@@ -2,13 +2,17 @@ package object
 
 import (
 	"bytes"
+	"fmt"
 	"strings"
 
 	"github.com/nicolerobin/monkey/ast"
 )
 
 type Function struct {
+	Name       string // 函数绑定的名称，用于错误信息，匿名函数为空
 	Parameters []*ast.Identifier
+	Defaults   []ast.Expression // 默认值，依次对应最后len(Defaults)个参数
+	Rest       *ast.Identifier  // ...rest参数，可以为nil
 	Body       *ast.BlockStatement
 	Env        *Environment
 }
@@ -18,19 +22,64 @@ func (f *Function) Type() ObjectType {
 }
 
 func (f *Function) Inspect() string {
-	var out bytes.Buffer
-
-	params := []string{}
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
+	params := make([]string, len(f.Parameters))
+	for i, p := range f.Parameters {
+		params[i] = p.Value
+	}
+	rest := ""
+	if f.Rest != nil {
+		rest = f.Rest.Value
 	}
+	return inspectFunction(f.Name, params, rest)
+}
+
+// inspectFunction 返回函数的名称和参数列表，如fn add(a, b)，省略参数的默认值。
+// 解释器和虚拟机的函数使用相同的形式，差分模式可以比较两个引擎返回的函数
+func inspectFunction(name string, params []string, rest string) string {
+	var out bytes.Buffer
 
 	out.WriteString("fn")
+	if name != "" {
+		out.WriteString(" " + name)
+	}
+	if rest != "" {
+		params = append(params[:len(params):len(params)], "..."+rest)
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
-	out.WriteString(") {\n")
-	out.WriteString(f.Body.String())
-	out.WriteString("\n}")
+	out.WriteString(")")
 
 	return out.String()
 }
+
+// Equal 比较是否为同一个对象
+func (f *Function) Equal(other Object) bool {
+	return Object(f) == other
+}
+
+func (f *Function) Compare(other Object) (int, error) {
+	return 0, errUnordered(f, other)
+}
+
+// CheckArity 检查调用name函数时的实参个数got：至少为required个必需参数，
+// 不是variadic(没有rest参数)时至多为params个具名参数。匿名函数的name为空
+func CheckArity(name string, required, params int, variadic bool, got int) error {
+	if got >= required && (variadic || got <= params) {
+		return nil
+	}
+
+	var want string
+	switch {
+	case variadic:
+		want = fmt.Sprintf("at least %d", required)
+	case required == params:
+		want = fmt.Sprint(params)
+	default:
+		want = fmt.Sprintf("%d to %d", required, params)
+	}
+
+	if name == "" {
+		return fmt.Errorf("wrong number of arguments: want=%s, got=%d", want, got)
+	}
+	return fmt.Errorf("wrong number of arguments to `%s`: want=%s, got=%d", name, want, got)
+}
@@ -0,0 +1,180 @@
+package object
+
+import "math/bits"
+
+// hamtNode 持久化哈希数组映射字典树(HAMT)的节点，用于Hash按键查找键值对的下标
+//
+// 每层消耗哈希值的5位，bitmap的第i位表示第i个槽位是否存在，slots只保存存在的槽位。
+// 修改操作复制从根到目标槽位的路径并返回新的根节点，nil表示空树。
+type hamtNode struct {
+	bitmap uint32
+	slots  []hamtSlot
+}
+
+// hamtSlot 子节点或叶子，叶子保存哈希值相同的全部条目
+type hamtSlot struct {
+	node    *hamtNode
+	hash    uint64
+	entries []hamtEntry
+}
+
+type hamtEntry struct {
+	key   Object
+	index int // 键值对在Hash.pairs中的下标
+}
+
+// hamtHash 将HashKey的类型与值合成为字典树使用的哈希值
+func hamtHash(key HashKey) uint64 {
+	// FNV-1a
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key.Type); i++ {
+		h ^= uint64(key.Type[i])
+		h *= 1099511628211
+	}
+	return h ^ key.Value
+}
+
+// position 返回hash在shift层对应的槽位标记及其在slots中的位置
+func (n *hamtNode) position(shift uint, hash uint64) (uint32, int) {
+	bit := uint32(1) << ((hash >> shift) & vectorMask)
+	return bit, bits.OnesCount32(n.bitmap & (bit - 1))
+}
+
+// find 查找与key相等的条目
+func (n *hamtNode) find(shift uint, hash uint64, key Object) (hamtEntry, bool) {
+	for n != nil {
+		bit, pos := n.position(shift, hash)
+		if n.bitmap&bit == 0 {
+			return hamtEntry{}, false
+		}
+
+		slot := n.slots[pos]
+		if slot.node == nil {
+			if slot.hash == hash {
+				for _, entry := range slot.entries {
+					if Equal(entry.key, key) {
+						return entry, true
+					}
+				}
+			}
+			return hamtEntry{}, false
+		}
+		n, shift = slot.node, shift+vectorBits
+	}
+	return hamtEntry{}, false
+}
+
+// insert 返回加入entry后的新节点，已存在相等的键时替换该条目
+func (n *hamtNode) insert(shift uint, hash uint64, entry hamtEntry) *hamtNode {
+	if n == nil {
+		n = &hamtNode{}
+	}
+	bit, pos := n.position(shift, hash)
+	leaf := hamtSlot{hash: hash, entries: []hamtEntry{entry}}
+
+	if n.bitmap&bit == 0 {
+		slots := make([]hamtSlot, 0, len(n.slots)+1)
+		slots = append(slots, n.slots[:pos]...)
+		slots = append(slots, leaf)
+		slots = append(slots, n.slots[pos:]...)
+		return &hamtNode{bitmap: n.bitmap | bit, slots: slots}
+	}
+
+	slots := make([]hamtSlot, len(n.slots))
+	copy(slots, n.slots)
+
+	slot := slots[pos]
+	switch {
+	case slot.node != nil:
+		slots[pos] = hamtSlot{node: slot.node.insert(shift+vectorBits, hash, entry)}
+	case slot.hash == hash:
+		entries := make([]hamtEntry, 0, len(slot.entries)+1)
+		replaced := false
+		for _, e := range slot.entries {
+			if !replaced && Equal(e.key, entry.key) {
+				e, replaced = entry, true
+			}
+			entries = append(entries, e)
+		}
+		if !replaced {
+			entries = append(entries, entry)
+		}
+		slots[pos] = hamtSlot{hash: hash, entries: entries}
+	default:
+		slots[pos] = hamtSlot{node: newHamtBranch(shift+vectorBits, slot, leaf)}
+	}
+	return &hamtNode{bitmap: n.bitmap, slots: slots}
+}
+
+// newHamtBranch 创建同时包含两个哈希值不同的叶子的节点
+func newHamtBranch(shift uint, a, b hamtSlot) *hamtNode {
+	bitA := uint32(1) << ((a.hash >> shift) & vectorMask)
+	bitB := uint32(1) << ((b.hash >> shift) & vectorMask)
+
+	switch {
+	case bitA == bitB:
+		return &hamtNode{bitmap: bitA, slots: []hamtSlot{{node: newHamtBranch(shift+vectorBits, a, b)}}}
+	case bitA < bitB:
+		return &hamtNode{bitmap: bitA | bitB, slots: []hamtSlot{a, b}}
+	default:
+		return &hamtNode{bitmap: bitA | bitB, slots: []hamtSlot{b, a}}
+	}
+}
+
+// remove 返回删除key后的新节点，树为空时返回nil，key不存在时返回n本身
+func (n *hamtNode) remove(shift uint, hash uint64, key Object) *hamtNode {
+	if n == nil {
+		return nil
+	}
+	bit, pos := n.position(shift, hash)
+	if n.bitmap&bit == 0 {
+		return n
+	}
+
+	slot := n.slots[pos]
+	var replacement *hamtSlot
+	switch {
+	case slot.node != nil:
+		child := slot.node.remove(shift+vectorBits, hash, key)
+		if child == slot.node {
+			return n
+		}
+		if child != nil {
+			replacement = &hamtSlot{node: child}
+		}
+	case slot.hash == hash:
+		i := -1
+		for j, entry := range slot.entries {
+			if Equal(entry.key, key) {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			return n
+		}
+		if len(slot.entries) > 1 {
+			entries := make([]hamtEntry, 0, len(slot.entries)-1)
+			entries = append(entries, slot.entries[:i]...)
+			entries = append(entries, slot.entries[i+1:]...)
+			replacement = &hamtSlot{hash: hash, entries: entries}
+		}
+	default:
+		return n
+	}
+
+	if replacement != nil {
+		slots := make([]hamtSlot, len(n.slots))
+		copy(slots, n.slots)
+		slots[pos] = *replacement
+		return &hamtNode{bitmap: n.bitmap, slots: slots}
+	}
+
+	if n.bitmap == bit {
+		return nil
+	}
+	slots := make([]hamtSlot, 0, len(n.slots)-1)
+	slots = append(slots, n.slots[:pos]...)
+	slots = append(slots, n.slots[pos+1:]...)
+	return &hamtNode{bitmap: n.bitmap &^ bit, slots: slots}
+}
@@ -15,8 +15,21 @@ type Hashable interface {
 	HashKey() HashKey
 }
 
+// Hash 不可变哈希表，遍历和打印时保持键的插入顺序
+//
+// 键值对按插入顺序保存在持久化向量中，删除时留下空位；另用持久化字典树(HAMT)记录每个键
+// 在向量中的下标。不同的键可能有相同的HashKey，字典树的叶子保存同一哈希值下的全部键，
+// 查找时再用Equal比较键本身。With和Without返回共享结构的新哈希表，时间复杂度O(log n)。
+// 零值为空哈希表。
 type Hash struct {
-	Pairs map[HashKey]HashPair
+	index *hamtNode         // 键到pairs下标的映射
+	pairs vector[*HashPair] // 按插入顺序排列的键值对，已删除的位置为nil
+	count int               // 键值对的个数
+}
+
+// NewHash 创建空哈希表
+func NewHash() *Hash {
+	return &Hash{}
 }
 
 func (h *Hash) Type() ObjectType {
@@ -27,7 +40,7 @@ func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for _, pair := range h.Pairs {
+	for _, pair := range h.Ordered() {
 		pairs = append(pairs, fmt.Sprintf("%s: %s",
 			pair.Key.Inspect(), pair.Value.Inspect()))
 	}
@@ -38,3 +51,126 @@ func (h *Hash) Inspect() string {
 
 	return out.String()
 }
+
+// lookup 返回key在pairs中的下标，调用者需保证key满足IsHashable
+func (h *Hash) lookup(key Object) (int, bool) {
+	hash := hamtHash(key.(Hashable).HashKey())
+	entry, ok := h.index.find(0, hash, key)
+	return entry.index, ok
+}
+
+// With 返回写入键值对后的新哈希表，已存在的键保持原有位置，只更新值；调用者需保证key满足IsHashable
+func (h *Hash) With(key, value Object) *Hash {
+	result := *h
+
+	if i, ok := h.lookup(key); ok {
+		result.pairs = h.pairs.Set(i, &HashPair{Key: h.pairs.At(i).Key, Value: value})
+		return &result
+	}
+
+	hash := hamtHash(key.(Hashable).HashKey())
+	result.index = h.index.insert(0, hash, hamtEntry{key: key, index: h.pairs.Len()})
+	result.pairs = h.pairs.Push(&HashPair{Key: key, Value: value})
+	result.count++
+	return &result
+}
+
+// Without 返回删除key后的新哈希表
+func (h *Hash) Without(key Object) *Hash {
+	result := *h
+	if !IsHashable(key) {
+		return &result
+	}
+
+	i, ok := h.lookup(key)
+	if !ok {
+		return &result
+	}
+
+	hash := hamtHash(key.(Hashable).HashKey())
+	result.index = h.index.remove(0, hash, key)
+	result.pairs = h.pairs.Set(i, nil)
+	result.count--
+
+	// 空位过多时重建，保证遍历的代价与键值对个数成正比
+	if result.pairs.Len() > 2*result.count+vectorWidth {
+		return result.compact()
+	}
+	return &result
+}
+
+// compact 去掉pairs中的空位并重建索引
+func (h *Hash) compact() *Hash {
+	result := NewHash()
+	for _, pair := range h.Ordered() {
+		result = result.With(pair.Key, pair.Value)
+	}
+	return result
+}
+
+// Set 写入键值对，已存在的键保持原有位置，只更新值；调用者需保证key满足IsHashable。
+// 只应在构建新哈希表时使用，已共享的哈希表应使用With
+func (h *Hash) Set(key, value Object) {
+	*h = *h.With(key, value)
+}
+
+// Get 按键查找键值对，key不可作为键时视为不存在
+func (h *Hash) Get(key Object) (HashPair, bool) {
+	if !IsHashable(key) {
+		return HashPair{}, false
+	}
+
+	i, ok := h.lookup(key)
+	if !ok {
+		return HashPair{}, false
+	}
+	return *h.pairs.At(i), true
+}
+
+// Delete 删除键值对，只应在构建新哈希表时使用，已共享的哈希表应使用Without
+func (h *Hash) Delete(key Object) {
+	*h = *h.Without(key)
+}
+
+// Len 返回键值对的个数
+func (h *Hash) Len() int {
+	return h.count
+}
+
+// Ordered 按插入顺序返回全部键值对组成的新切片
+func (h *Hash) Ordered() []HashPair {
+	pairs := make([]HashPair, 0, h.count)
+	for _, pair := range h.pairs.Slice() {
+		if pair != nil {
+			pairs = append(pairs, *pair)
+		}
+	}
+	return pairs
+}
+
+// Copy 返回哈希表的浅拷贝，与原哈希表共享结构，时间复杂度O(1)
+func (h *Hash) Copy() *Hash {
+	c := *h
+	return &c
+}
+
+// Equal 比较键值对集合，与顺序无关
+func (h *Hash) Equal(other Object) bool {
+	o, ok := other.(*Hash)
+	if !ok || h.Len() != o.Len() {
+		return false
+	}
+
+	for _, pair := range h.Ordered() {
+		otherPair, ok := o.Get(pair.Key)
+		if !ok || !pair.Value.Equal(otherPair.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Compare 哈希表之间无序
+func (h *Hash) Compare(other Object) (int, error) {
+	return 0, errUnordered(h, other)
+}
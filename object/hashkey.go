@@ -1,12 +1,39 @@
 package object
 
-import "hash/fnv"
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"io"
+)
 
 type HashKey struct {
 	Type  ObjectType
 	Value uint64
 }
 
+// IsHashable 判断对象能否作为哈希表的键，数组和哈希表要求其包含的值都能作为键
+func IsHashable(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Array:
+		for _, el := range obj.Elements() {
+			if !IsHashable(el) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		for _, pair := range obj.Ordered() {
+			if !IsHashable(pair.Value) {
+				return false
+			}
+		}
+		return true
+	default:
+		_, ok := obj.(Hashable)
+		return ok
+	}
+}
+
 func (b *Boolean) HashKey() HashKey {
 	var value uint64
 
@@ -31,3 +58,38 @@ func (s *String) HashKey() HashKey {
 	}
 	return HashKey{Type: s.Type(), Value: h.Sum64()}
 }
+
+func (n *Null) HashKey() HashKey {
+	return HashKey{Type: n.Type()}
+}
+
+// HashKey 由各元素的HashKey按顺序组合而成，元素必须都能作为键
+func (a *Array) HashKey() HashKey {
+	h := fnv.New64a()
+	for _, el := range a.Elements() {
+		writeHashKey(h, el.(Hashable).HashKey())
+	}
+	return HashKey{Type: a.Type(), Value: h.Sum64()}
+}
+
+// HashKey 与键值对的顺序无关，与Equal的语义一致，值必须都能作为键
+func (h *Hash) HashKey() HashKey {
+	var sum uint64
+	for _, pair := range h.Ordered() {
+		f := fnv.New64a()
+		writeHashKey(f, pair.Key.(Hashable).HashKey())
+		writeHashKey(f, pair.Value.(Hashable).HashKey())
+		sum += f.Sum64()
+	}
+	return HashKey{Type: h.Type(), Value: sum}
+}
+
+func writeHashKey(w io.Writer, key HashKey) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], key.Value)
+
+	_, err := w.Write(append([]byte(key.Type), buf[:]...))
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,31 @@
+package object
+
+import "fmt"
+
+// Hoisted 提前定义、尚未执行到声明处的函数名的值。函数可以引用之后声明的函数，
+// 在声明执行之前调用时，两个引擎都以函数名报告错误
+type Hoisted struct {
+	Name string
+}
+
+func (h *Hoisted) Type() ObjectType {
+	return HOISTED_OBJ
+}
+
+func (h *Hoisted) Inspect() string {
+	return "fn " + h.Name + " (not declared yet)"
+}
+
+func (h *Hoisted) Equal(other Object) bool {
+	o, ok := other.(*Hoisted)
+	return ok && o.Name == h.Name
+}
+
+func (h *Hoisted) Compare(other Object) (int, error) {
+	return 0, errUnordered(h, other)
+}
+
+// CallError 返回在声明执行之前调用函数的错误
+func (h *Hoisted) CallError() error {
+	return fmt.Errorf("function %s called before its declaration", h.Name)
+}
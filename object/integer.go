@@ -13,3 +13,24 @@ func (i *Integer) Type() ObjectType {
 func (i *Integer) Inspect() string {
 	return fmt.Sprintf("%d", i.Value)
 }
+
+func (i *Integer) Equal(other Object) bool {
+	o, ok := other.(*Integer)
+	return ok && i.Value == o.Value
+}
+
+func (i *Integer) Compare(other Object) (int, error) {
+	o, ok := other.(*Integer)
+	if !ok {
+		return 0, errUnordered(i, other)
+	}
+
+	switch {
+	case i.Value < o.Value:
+		return -1, nil
+	case i.Value > o.Value:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
@@ -0,0 +1,269 @@
+package object
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FromJSON 将JSON文本解析为对象：对象为Hash(保留键在文本中的顺序)，数组为Array，
+// 字符串、整数、布尔值和null分别为String、Integer、Boolean和NULL。Monkey没有浮点数，非整数的数字返回错误
+func FromJSON(data []byte) (Object, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	obj, err := decodeJSON(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after top-level value")
+	}
+	return obj, nil
+}
+
+func decodeJSON(dec *json.Decoder) (Object, error) {
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return nil, fmt.Errorf("unexpected end of JSON input")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok := tok.(type) {
+	case json.Delim:
+		if tok == '[' {
+			elements := []Object{}
+			for dec.More() {
+				element, err := decodeJSON(dec)
+				if err != nil {
+					return nil, err
+				}
+				elements = append(elements, element)
+			}
+			_, err = dec.Token()
+			return NewArray(elements), err
+		}
+
+		hash := NewHash()
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			hash.Set(&String{Value: key.(string)}, value)
+		}
+		_, err = dec.Token()
+		return hash, err
+	case string:
+		return &String{Value: tok}, nil
+	case json.Number:
+		value, err := strconv.ParseInt(tok.String(), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("number %s is not a 64-bit integer", tok)
+		}
+		return &Integer{Value: value}, nil
+	case bool:
+		return nativeBoolToBoolean(tok), nil
+	default:
+		return NULL, nil
+	}
+}
+
+// ToJSON 将对象编码为规范的JSON文本：Hash的键必须是字符串并按字典序输出，字符串不做HTML转义。
+// indent为空时输出紧凑格式，否则每层缩进indent。函数、模块等无法表示为JSON的对象返回错误
+func ToJSON(obj Object, indent string) ([]byte, error) {
+	var out bytes.Buffer
+	if err := encodeJSON(&out, obj, indent, 0); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func encodeJSON(out *bytes.Buffer, obj Object, indent string, depth int) error {
+	switch obj := obj.(type) {
+	case *Null:
+		out.WriteString("null")
+	case *Boolean:
+		out.WriteString(strconv.FormatBool(obj.Value))
+	case *Integer:
+		out.WriteString(strconv.FormatInt(obj.Value, 10))
+	case *String:
+		encodeJSONString(out, obj.Value)
+	case *Array:
+		if obj.Len() == 0 {
+			out.WriteString("[]")
+			return nil
+		}
+		out.WriteByte('[')
+		for i, element := range obj.Elements() {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			newline(out, indent, depth+1)
+			if err := encodeJSON(out, element, indent, depth+1); err != nil {
+				return err
+			}
+		}
+		newline(out, indent, depth)
+		out.WriteByte(']')
+	case *Hash:
+		if obj.Len() == 0 {
+			out.WriteString("{}")
+			return nil
+		}
+		pairs := obj.Ordered()
+		for _, pair := range pairs {
+			if _, ok := pair.Key.(*String); !ok {
+				return fmt.Errorf("hash key must be STRING, got %s", pair.Key.Type())
+			}
+		}
+		sort.Slice(pairs, func(i, j int) bool {
+			return pairs[i].Key.(*String).Value < pairs[j].Key.(*String).Value
+		})
+
+		out.WriteByte('{')
+		for i, pair := range pairs {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			newline(out, indent, depth+1)
+			encodeJSONString(out, pair.Key.(*String).Value)
+			out.WriteByte(':')
+			if indent != "" {
+				out.WriteByte(' ')
+			}
+			if err := encodeJSON(out, pair.Value, indent, depth+1); err != nil {
+				return err
+			}
+		}
+		newline(out, indent, depth)
+		out.WriteByte('}')
+	default:
+		return fmt.Errorf("cannot encode %s as JSON", obj.Type())
+	}
+	return nil
+}
+
+// newline 缩进格式下换行并缩进到depth层
+func newline(out *bytes.Buffer, indent string, depth int) {
+	if indent == "" {
+		return
+	}
+	out.WriteByte('\n')
+	out.WriteString(strings.Repeat(indent, depth))
+}
+
+func encodeJSONString(out *bytes.Buffer, s string) {
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s) // 编码字符串不会失败
+	out.Truncate(out.Len() - 1)
+}
+
+// FromGo 将Go值转换为对象，支持nil、bool、整数、整数值的float64、json.Number、string，
+// 以及元素为这些类型的[]interface{}和map[string]interface{}(按键的字典序插入)
+func FromGo(v interface{}) (Object, error) {
+	switch v := v.(type) {
+	case nil:
+		return NULL, nil
+	case bool:
+		return nativeBoolToBoolean(v), nil
+	case int:
+		return &Integer{Value: int64(v)}, nil
+	case int64:
+		return &Integer{Value: v}, nil
+	case float64:
+		if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+			return nil, fmt.Errorf("number %v is not a 64-bit integer", v)
+		}
+		return &Integer{Value: int64(v)}, nil
+	case json.Number:
+		value, err := strconv.ParseInt(v.String(), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("number %s is not a 64-bit integer", v)
+		}
+		return &Integer{Value: value}, nil
+	case string:
+		return &String{Value: v}, nil
+	case []interface{}:
+		elements := make([]Object, len(v))
+		for i, element := range v {
+			obj, err := FromGo(element)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = obj
+		}
+		return NewArray(elements), nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		hash := NewHash()
+		for _, key := range keys {
+			obj, err := FromGo(v[key])
+			if err != nil {
+				return nil, err
+			}
+			hash.Set(&String{Value: key}, obj)
+		}
+		return hash, nil
+	default:
+		return nil, fmt.Errorf("cannot convert %T to a monkey object", v)
+	}
+}
+
+// ToGo 将对象转换为Go值，与FromGo互逆：Hash转换为map[string]interface{}，Array转换为[]interface{}，
+// Integer转换为int64。Hash的键必须是字符串
+func ToGo(obj Object) (interface{}, error) {
+	switch obj := obj.(type) {
+	case *Null:
+		return nil, nil
+	case *Boolean:
+		return obj.Value, nil
+	case *Integer:
+		return obj.Value, nil
+	case *String:
+		return obj.Value, nil
+	case *Array:
+		values := make([]interface{}, obj.Len())
+		for i, element := range obj.Elements() {
+			value, err := ToGo(element)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	case *Hash:
+		values := make(map[string]interface{}, obj.Len())
+		for _, pair := range obj.Ordered() {
+			key, ok := pair.Key.(*String)
+			if !ok {
+				return nil, fmt.Errorf("hash key must be STRING, got %s", pair.Key.Type())
+			}
+			value, err := ToGo(pair.Value)
+			if err != nil {
+				return nil, err
+			}
+			values[key.Value] = value
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("cannot convert %s to a Go value", obj.Type())
+	}
+}
@@ -0,0 +1,46 @@
+package object
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/nicolerobin/monkey/ast"
+)
+
+// Macro 宏对象，在宏展开阶段以未求值的参数调用，返回替换调用处的AST
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (m *Macro) Type() ObjectType {
+	return MACRO_OBJ
+}
+
+func (m *Macro) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range m.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("macro")
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(m.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+// Equal 比较是否为同一个对象
+func (m *Macro) Equal(other Object) bool {
+	return Object(m) == other
+}
+
+func (m *Macro) Compare(other Object) (int, error) {
+	return 0, errUnordered(m, other)
+}
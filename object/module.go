@@ -0,0 +1,26 @@
+package object
+
+import "fmt"
+
+// Module 模块对象，保存模块通过export导出的绑定
+type Module struct {
+	Name    string
+	Exports map[string]Object
+}
+
+func (m *Module) Type() ObjectType {
+	return MODULE_OBJ
+}
+
+func (m *Module) Inspect() string {
+	return fmt.Sprintf("module(%s)", m.Name)
+}
+
+// Equal 比较是否为同一个对象
+func (m *Module) Equal(other Object) bool {
+	return Object(m) == other
+}
+
+func (m *Module) Compare(other Object) (int, error) {
+	return 0, errUnordered(m, other)
+}
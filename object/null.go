@@ -1,5 +1,7 @@
 package object
 
+var NULL = &Null{}
+
 type Null struct {
 }
 
@@ -10,3 +12,15 @@ func (n *Null) Type() ObjectType {
 func (n *Null) Inspect() string {
 	return "null"
 }
+
+func (n *Null) Equal(other Object) bool {
+	_, ok := other.(*Null)
+	return ok
+}
+
+func (n *Null) Compare(other Object) (int, error) {
+	if _, ok := other.(*Null); !ok {
+		return 0, errUnordered(n, other)
+	}
+	return 0, nil
+}
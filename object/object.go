@@ -14,9 +14,19 @@ const (
 	ARRAY_OBJ             = "ARRAY"
 	HASH_OBJ              = "HASH"
 	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	CLOSURE_OBJ           = "CLOSURE"
+	MODULE_OBJ            = "MODULE"
+	QUOTE_OBJ             = "QUOTE"
+	MACRO_OBJ             = "MACRO"
+	HOISTED_OBJ           = "HOISTED"
 )
 
 type Object interface {
 	Type() ObjectType
 	Inspect() string
+
+	// Equal 判断与other是否相等，不同类型的对象总是不相等
+	Equal(other Object) bool
+	// Compare 比较与other的大小，负数表示小于，0表示相等，正数表示大于，两者无序时返回错误
+	Compare(other Object) (int, error)
 }
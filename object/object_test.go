@@ -1,6 +1,135 @@
 package object
 
-import "testing"
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestHashOrder(t *testing.T) {
+	one := &Integer{Value: 1}
+	two := &Integer{Value: 2}
+	key := &String{Value: "key"}
+
+	hash := NewHash()
+	hash.Set(two, one)
+	hash.Set(key, two)
+	hash.Set(one, key)
+	hash.Set(&Integer{Value: 2}, two)
+
+	if hash.Inspect() != `{2: 2, key: 2, 1: key}` {
+		t.Errorf("wrong order. got=%s", hash.Inspect())
+	}
+
+	copied := hash.Copy()
+	hash.Delete(&String{Value: "key"})
+	if hash.Inspect() != `{2: 2, 1: key}` {
+		t.Errorf("wrong order after delete. got=%s", hash.Inspect())
+	}
+	if copied.Inspect() != `{2: 2, key: 2, 1: key}` {
+		t.Errorf("copy changed by delete. got=%s", copied.Inspect())
+	}
+}
+
+// collidingKey 所有实例的HashKey都相同，用于测试哈希冲突
+type collidingKey struct {
+	name string
+}
+
+func (c *collidingKey) Type() ObjectType { return "COLLIDING" }
+func (c *collidingKey) Inspect() string  { return c.name }
+func (c *collidingKey) HashKey() HashKey { return HashKey{Type: "COLLIDING", Value: 42} }
+func (c *collidingKey) Equal(other Object) bool {
+	return Object(c) == other
+}
+func (c *collidingKey) Compare(other Object) (int, error) {
+	return 0, errUnordered(c, other)
+}
+
+func TestHashCollision(t *testing.T) {
+	a := &collidingKey{name: "a"}
+	b := &collidingKey{name: "b"}
+	c := &collidingKey{name: "c"}
+
+	hash := NewHash()
+	hash.Set(a, &Integer{Value: 1})
+	hash.Set(b, &Integer{Value: 2})
+
+	for key, expected := range map[*collidingKey]int64{a: 1, b: 2} {
+		pair, ok := hash.Get(key)
+		if !ok {
+			t.Fatalf("no pair for key %s", key.name)
+		}
+		if pair.Value.(*Integer).Value != expected {
+			t.Errorf("key %s: expected %d, got %s", key.name, expected, pair.Value.Inspect())
+		}
+	}
+	if _, ok := hash.Get(c); ok {
+		t.Errorf("found pair for key c")
+	}
+
+	hash.Delete(a)
+	if _, ok := hash.Get(a); ok {
+		t.Errorf("found pair for deleted key a")
+	}
+	if pair, ok := hash.Get(b); !ok || pair.Value.(*Integer).Value != 2 {
+		t.Errorf("lost pair for key b after deleting a")
+	}
+}
+
+func TestCompositeHashKey(t *testing.T) {
+	array := func(values ...int64) *Array {
+		elements := []Object{}
+		for _, v := range values {
+			elements = append(elements, &Integer{Value: v})
+		}
+		return NewArray(elements)
+	}
+	hashOf := func(pairs ...Object) *Hash {
+		h := NewHash()
+		for i := 0; i < len(pairs); i += 2 {
+			h.Set(pairs[i], pairs[i+1])
+		}
+		return h
+	}
+	one, two := &Integer{Value: 1}, &Integer{Value: 2}
+
+	tests := []struct {
+		a, b  Object
+		equal bool
+	}{
+		{array(1, 2), array(1, 2), true},
+		{array(1, 2), array(2, 1), false},
+		{array(), array(), true},
+		{NewArray([]Object{array(1), NULL}), NewArray([]Object{array(1), NULL}), true},
+		{hashOf(one, two, two, one), hashOf(two, one, one, two), true},
+		{hashOf(one, two), hashOf(one, one), false},
+		{hashOf(array(1), one), hashOf(array(1), one), true},
+		{array(1), hashOf(one, one), false},
+		{&String{Value: "a"}, &String{Value: "a"}, true},
+		{TRUE, &Boolean{Value: true}, true},
+		{one, TRUE, false},
+	}
+
+	for i, tt := range tests {
+		if Equal(tt.a, tt.b) != tt.equal {
+			t.Errorf("tests[%d]: Equal(%s, %s) != %t", i, tt.a.Inspect(), tt.b.Inspect(), tt.equal)
+		}
+		if tt.equal && tt.a.(Hashable).HashKey() != tt.b.(Hashable).HashKey() {
+			t.Errorf("tests[%d]: equal values %s and %s have different hash keys", i, tt.a.Inspect(), tt.b.Inspect())
+		}
+	}
+
+	fn := &Builtin{}
+	unhashable := []Object{fn, NewArray([]Object{one, fn}), hashOf(one, fn)}
+	for _, obj := range unhashable {
+		if IsHashable(obj) {
+			t.Errorf("%T (%s) is hashable", obj, obj.Inspect())
+		}
+	}
+}
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -20,3 +149,378 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestCompare(t *testing.T) {
+	one, two := &Integer{Value: 1}, &Integer{Value: 2}
+	a, b := &String{Value: "a"}, &String{Value: "b"}
+	fn := &Builtin{}
+
+	tests := []struct {
+		left, right Object
+		expected    int
+		unordered   bool
+	}{
+		{one, two, -1, false},
+		{two, one, 1, false},
+		{one, &Integer{Value: 1}, 0, false},
+		{a, b, -1, false},
+		{&String{Value: "ab"}, a, 1, false},
+		{FALSE, TRUE, -1, false},
+		{TRUE, TRUE, 0, false},
+		{NULL, &Null{}, 0, false},
+		{NewArray([]Object{one, two}), NewArray([]Object{one, one}), 1, false},
+		{NewArray([]Object{one}), NewArray([]Object{one, one}), -1, false},
+		{&Array{}, &Array{}, 0, false},
+		{NewArray([]Object{one}), NewArray([]Object{a}), 0, true},
+		{one, a, 0, true},
+		{NewHash(), NewHash(), 0, true},
+		{fn, fn, 0, true},
+		{&ReturnValue{Value: one}, &ReturnValue{Value: two}, -1, false},
+	}
+
+	for i, tt := range tests {
+		result, err := Compare(tt.left, tt.right)
+		if tt.unordered {
+			if err == nil {
+				t.Errorf("tests[%d]: expected %s and %s to be unordered, got %d",
+					i, tt.left.Inspect(), tt.right.Inspect(), result)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("tests[%d]: unexpected error %s", i, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("tests[%d]: Compare(%s, %s) expected %d, got %d",
+				i, tt.left.Inspect(), tt.right.Inspect(), tt.expected, result)
+		}
+		if Equal(tt.left, tt.right) != (result == 0) {
+			t.Errorf("tests[%d]: Equal disagrees with Compare", i)
+		}
+	}
+
+	if !Equal(fn, fn) || Equal(fn, &Builtin{}) {
+		t.Errorf("builtins should compare by identity")
+	}
+	if !Equal(&Error{Message: "x"}, &Error{Message: "x"}) {
+		t.Errorf("errors with the same message should be equal")
+	}
+}
+
+func TestHigherOrderBuiltinCaller(t *testing.T) {
+	// negate 模拟执行引擎，将整数取反后返回
+	var calls int
+	negate := CallerFunc(func(fn Object, args ...Object) Object {
+		calls++
+		return &Integer{Value: -args[0].(*Integer).Value}
+	})
+	arr := NewArray([]Object{&Integer{Value: 1}, &Integer{Value: 2}})
+	fn := GetBuiltinByName("len")
+
+	result := GetBuiltinByName("map").Fn(negate, arr, fn)
+	if result.Inspect() != "[-1, -2]" || calls != 2 {
+		t.Errorf("wrong map result. got=%s, calls=%d", result.Inspect(), calls)
+	}
+	if arr.Inspect() != "[1, 2]" {
+		t.Errorf("map changed its argument. got=%s", arr.Inspect())
+	}
+
+	result = GetBuiltinByName("map").Fn(nil, arr, fn)
+	if errObj, ok := result.(*Error); !ok {
+		t.Errorf("expected error without caller. got=%s", result.Inspect())
+	} else if errObj.Message != "calling functions from builtins is not supported here" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+
+	failing := CallerFunc(func(fn Object, args ...Object) Object {
+		return &Error{Message: "boom"}
+	})
+	result = GetBuiltinByName("sort").Fn(failing, arr, fn)
+	if errObj, ok := result.(*Error); !ok || errObj.Message != "boom" {
+		t.Errorf("expected comparator error. got=%s", result.Inspect())
+	}
+}
+
+// contextCaller 只提供执行上下文的Caller
+type contextCaller struct {
+	CallerFunc
+	ctx *Context
+}
+
+func (c contextCaller) Context() *Context {
+	return c.ctx
+}
+
+func TestEnvironmentConstants(t *testing.T) {
+	env := NewEnvironment()
+	if err := env.Define("a", &Integer{Value: 1}); err != nil {
+		t.Fatalf("Define(a) failed, error:%s", err)
+	}
+	if err := env.DefineConstant("a", &Integer{Value: 2}); err != nil {
+		t.Fatalf("DefineConstant(a) failed, error:%s", err)
+	}
+	if !env.IsConstant("a") {
+		t.Errorf("a is not a constant")
+	}
+	for _, err := range []error{env.Define("a", TRUE), env.DefineConstant("a", TRUE)} {
+		if err == nil || err.Error() != "cannot redefine constant a" {
+			t.Errorf("wrong error %v", err)
+		}
+	}
+	if val, _ := env.Get("a"); val.Inspect() != "2" {
+		t.Errorf("constant a changed to %s", val.Inspect())
+	}
+
+	// 嵌套环境中可以定义同名变量
+	inner := NewEnclosedEnvironment(env)
+	if err := inner.Define("a", TRUE); err != nil || inner.IsConstant("a") {
+		t.Errorf("Define(a) in inner environment failed, error:%v", err)
+	}
+}
+
+func TestPutsContext(t *testing.T) {
+	var out bytes.Buffer
+	caller := contextCaller{ctx: &Context{Stdout: &out}}
+
+	result := GetBuiltinByName("puts").Fn(caller, &String{Value: "a"}, &Integer{Value: 1})
+	if result != NULL {
+		t.Errorf("puts should return null. got=%s", result.Inspect())
+	}
+	if out.String() != "a\n1\n" {
+		t.Errorf("wrong puts output. got=%q", out.String())
+	}
+
+	var ctx *Context
+	if ctx.Out() != os.Stdout || ctx.Err() != os.Stderr || ctx.In() != os.Stdin {
+		t.Errorf("nil context should use the process standard streams")
+	}
+}
+
+func TestArrayPersistence(t *testing.T) {
+	// 元素个数跨越多层树节点
+	const n = 3000
+
+	versions := []*Array{{}}
+	for i := 0; i < n; i++ {
+		versions = append(versions, versions[i].Push(&Integer{Value: int64(i)}))
+	}
+
+	// 每个历史版本都不受之后Push的影响
+	for _, length := range []int{0, 1, 31, 32, 33, 1024, 1056, 1057, n} {
+		arr := versions[length]
+		if arr.Len() != length {
+			t.Fatalf("wrong length. want=%d, got=%d", length, arr.Len())
+		}
+		elements := arr.Elements()
+		for i := 0; i < length; i++ {
+			if arr.At(i).(*Integer).Value != int64(i) || elements[i].(*Integer).Value != int64(i) {
+				t.Fatalf("wrong element %d of version %d", i, length)
+			}
+		}
+	}
+
+	// 同一版本上两次Push互不影响
+	base := versions[40]
+	a := base.Push(&String{Value: "a"})
+	b := base.Push(&String{Value: "b"})
+	if a.At(40).Inspect() != "a" || b.At(40).Inspect() != "b" || base.Len() != 40 {
+		t.Errorf("pushes on a shared array interfere. a=%s, b=%s", a.At(40).Inspect(), b.At(40).Inspect())
+	}
+
+	rest := versions[n]
+	for i := 0; i < n-1; i++ {
+		rest = rest.Rest()
+	}
+	if rest.Len() != 1 || rest.At(0).(*Integer).Value != n-1 {
+		t.Errorf("wrong rest. got=%s", rest.Inspect())
+	}
+	if rest.Rest().Len() != 0 || rest.Rest().Push(TRUE).Inspect() != "[true]" {
+		t.Errorf("wrong rest of single element array")
+	}
+
+	mixed := versions[100].Rest().Rest().Push(NULL)
+	if mixed.Len() != 99 || mixed.At(0).(*Integer).Value != 2 || mixed.At(98) != NULL {
+		t.Errorf("wrong result of rest then push. got=%s", mixed.Inspect())
+	}
+	if !NewArray(versions[n].Elements()).Equal(versions[n]) {
+		t.Errorf("NewArray(Elements()) differs from original")
+	}
+}
+
+func TestHashPersistence(t *testing.T) {
+	const n = 2000
+
+	hash := NewHash()
+	model := map[int64]int64{}
+	for i := int64(0); i < n; i++ {
+		hash = hash.With(&Integer{Value: i}, &Integer{Value: i * 10})
+		model[i] = i * 10
+	}
+	snapshot := hash
+
+	for i := int64(0); i < n; i += 3 {
+		hash = hash.Without(&Integer{Value: i})
+		delete(model, i)
+	}
+	hash = hash.With(&Integer{Value: 1}, &Integer{Value: -1})
+	model[1] = -1
+
+	if hash.Len() != len(model) {
+		t.Fatalf("wrong length. want=%d, got=%d", len(model), hash.Len())
+	}
+	for i := int64(0); i < n; i++ {
+		pair, ok := hash.Get(&Integer{Value: i})
+		want, exists := model[i]
+		if ok != exists || (ok && pair.Value.(*Integer).Value != want) {
+			t.Fatalf("wrong value for key %d. want=%d (%t), got=%v (%t)", i, want, exists, pair.Value, ok)
+		}
+	}
+
+	// 插入顺序在删除和更新后保持不变
+	var last int64 = -1
+	for _, pair := range hash.Ordered() {
+		key := pair.Key.(*Integer).Value
+		if key <= last {
+			t.Fatalf("keys out of insertion order: %d after %d", key, last)
+		}
+		last = key
+	}
+
+	if snapshot.Len() != n {
+		t.Errorf("earlier version changed. len=%d", snapshot.Len())
+	}
+	if pair, ok := snapshot.Get(&Integer{Value: 1}); !ok || pair.Value.(*Integer).Value != 10 {
+		t.Errorf("earlier version changed. got=%v", pair.Value)
+	}
+
+	for i := int64(0); i < n; i++ {
+		hash = hash.Without(&Integer{Value: i})
+	}
+	if hash.Len() != 0 || hash.Inspect() != "{}" || hash.index != nil {
+		t.Errorf("hash not empty after removing every key. got=%s", hash.Inspect())
+	}
+}
+
+func TestJSON(t *testing.T) {
+	tests := []struct {
+		input    string
+		inspect  string
+		compact  string
+		indented string
+	}{
+		{`null`, `null`, `null`, `null`},
+		{` true `, `true`, `true`, `true`},
+		{`-42`, `-42`, `-42`, `-42`},
+		{`"a\"b<\u00e9>"`, `a"b<é>`, `"a\"b<é>"`, `"a\"b<é>"`},
+		{`[]`, `[]`, `[]`, `[]`},
+		{`{}`, `{}`, `{}`, `{}`},
+		{`[1, [2], {"x": null}]`, `[1, [2], {x: null}]`, `[1,[2],{"x":null}]`, "[\n  1,\n  [\n    2\n  ],\n  {\n    \"x\": null\n  }\n]"},
+		{`{"b": 1, "a": {"d": [], "c": false}}`, `{b: 1, a: {d: [], c: false}}`,
+			`{"a":{"c":false,"d":[]},"b":1}`, "{\n  \"a\": {\n    \"c\": false,\n    \"d\": []\n  },\n  \"b\": 1\n}"},
+		{`{"a": 1, "a": 2}`, `{a: 2}`, `{"a":2}`, "{\n  \"a\": 2\n}"},
+	}
+
+	for _, tt := range tests {
+		obj, err := FromJSON([]byte(tt.input))
+		if err != nil {
+			t.Fatalf("FromJSON(%s) failed: %s", tt.input, err)
+		}
+		if obj.Inspect() != tt.inspect {
+			t.Errorf("FromJSON(%s) wrong. want=%s, got=%s", tt.input, tt.inspect, obj.Inspect())
+		}
+
+		compact, err := ToJSON(obj, "")
+		if err != nil {
+			t.Fatalf("ToJSON(%s) failed: %s", tt.inspect, err)
+		}
+		if string(compact) != tt.compact {
+			t.Errorf("ToJSON(%s) wrong. want=%s, got=%s", tt.inspect, tt.compact, compact)
+		}
+
+		indented, err := ToJSON(obj, "  ")
+		if err != nil {
+			t.Fatalf("ToJSON(%s) failed: %s", tt.inspect, err)
+		}
+		if string(indented) != tt.indented {
+			t.Errorf("ToJSON(%s, indent) wrong. want=%q, got=%q", tt.inspect, tt.indented, indented)
+		}
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	parseTests := []struct {
+		input    string
+		expected string
+	}{
+		{``, "unexpected end of JSON input"},
+		{`[1,`, "unexpected end of JSON input"},
+		{`1.5`, "number 1.5 is not a 64-bit integer"},
+		{`1e3`, "number 1e3 is not a 64-bit integer"},
+		{`9223372036854775808`, "number 9223372036854775808 is not a 64-bit integer"},
+		{`{"a" 1}`, "invalid character '1' after object key"},
+		{`[1] 2`, "unexpected data after top-level value"},
+	}
+	for _, tt := range parseTests {
+		_, err := FromJSON([]byte(tt.input))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("FromJSON(%q) wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+
+	hash := NewHash()
+	hash.Set(&Integer{Value: 1}, TRUE)
+	stringifyTests := []struct {
+		input    Object
+		expected string
+	}{
+		{&CompiledFunction{}, "cannot encode COMPILED_FUNCTION as JSON"},
+		{NewArray([]Object{&Builtin{}}), "cannot encode BUILTIN as JSON"},
+		{hash, "hash key must be STRING, got INTEGER"},
+	}
+	for _, tt := range stringifyTests {
+		_, err := ToJSON(tt.input, "")
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("ToJSON(%s) wrong error. want=%q, got=%v", tt.input.Inspect(), tt.expected, err)
+		}
+	}
+}
+
+func TestGoInterop(t *testing.T) {
+	value := map[string]interface{}{
+		"name":  "monkey",
+		"tags":  []interface{}{"a", int64(2), nil, true},
+		"count": 3.0,
+		"big":   json.Number("9007199254740993"),
+		"empty": map[string]interface{}{},
+	}
+
+	obj, err := FromGo(value)
+	if err != nil {
+		t.Fatalf("FromGo failed: %s", err)
+	}
+	expected := `{big: 9007199254740993, count: 3, empty: {}, name: monkey, tags: [a, 2, null, true]}`
+	if obj.Inspect() != expected {
+		t.Errorf("FromGo wrong. want=%s, got=%s", expected, obj.Inspect())
+	}
+
+	back, err := ToGo(obj)
+	if err != nil {
+		t.Fatalf("ToGo failed: %s", err)
+	}
+	value["count"] = int64(3)
+	value["big"] = int64(9007199254740993)
+	if !reflect.DeepEqual(back, value) {
+		t.Errorf("ToGo wrong.\nwant=%#v\ngot= %#v", value, back)
+	}
+
+	if _, err := FromGo(1.5); err == nil || err.Error() != "number 1.5 is not a 64-bit integer" {
+		t.Errorf("FromGo(1.5) wrong error: %v", err)
+	}
+	if _, err := FromGo(struct{}{}); err == nil || err.Error() != "cannot convert struct {} to a monkey object" {
+		t.Errorf("FromGo(struct{}{}) wrong error: %v", err)
+	}
+	if _, err := ToGo(&Function{}); err == nil || err.Error() != "cannot convert FUNCTION to a Go value" {
+		t.Errorf("ToGo(FUNCTION) wrong error: %v", err)
+	}
+}
@@ -0,0 +1,26 @@
+package object
+
+import "github.com/nicolerobin/monkey/ast"
+
+// Quote 被quote包裹的未求值的AST节点
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType {
+	return QUOTE_OBJ
+}
+
+func (q *Quote) Inspect() string {
+	return "QUOTE(" + q.Node.String() + ")"
+}
+
+// Equal 比较节点的源码形式
+func (q *Quote) Equal(other Object) bool {
+	o, ok := other.(*Quote)
+	return ok && q.Node.String() == o.Node.String()
+}
+
+func (q *Quote) Compare(other Object) (int, error) {
+	return 0, errUnordered(q, other)
+}
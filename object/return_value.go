@@ -11,3 +11,17 @@ func (rv *ReturnValue) Type() ObjectType {
 func (rv *ReturnValue) Inspect() string {
 	return rv.Value.Inspect()
 }
+
+// Equal 比较包装的返回值
+func (rv *ReturnValue) Equal(other Object) bool {
+	o, ok := other.(*ReturnValue)
+	return ok && rv.Value.Equal(o.Value)
+}
+
+func (rv *ReturnValue) Compare(other Object) (int, error) {
+	o, ok := other.(*ReturnValue)
+	if !ok {
+		return 0, errUnordered(rv, other)
+	}
+	return rv.Value.Compare(o.Value)
+}
@@ -1,5 +1,7 @@
 package object
 
+import "strings"
+
 type String struct {
 	Value string
 }
@@ -11,3 +13,17 @@ func (s *String) Type() ObjectType {
 func (s *String) Inspect() string {
 	return s.Value
 }
+
+func (s *String) Equal(other Object) bool {
+	o, ok := other.(*String)
+	return ok && s.Value == o.Value
+}
+
+// Compare 按字节序比较
+func (s *String) Compare(other Object) (int, error) {
+	o, ok := other.(*String)
+	if !ok {
+		return 0, errUnordered(s, other)
+	}
+	return strings.Compare(s.Value, o.Value), nil
+}
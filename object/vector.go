@@ -0,0 +1,180 @@
+package object
+
+const (
+	vectorBits  = 5
+	vectorWidth = 1 << vectorBits
+	vectorMask  = vectorWidth - 1
+)
+
+// vector 持久化向量，32叉树加尾部缓冲区，修改操作返回新向量并与原向量共享未改动的节点
+//
+// 下标在[0, tailOffset)的元素保存在树中，其余保存在tail中；start之前的元素已被rest丢弃。
+// 零值为空向量。
+type vector[T any] struct {
+	root  *vectorNode[T]
+	tail  []T
+	size  int  // 包括已丢弃前缀在内的元素个数
+	shift uint // 根节点所在层的位移
+	start int  // 已丢弃的前缀长度
+}
+
+type vectorNode[T any] struct {
+	children []*vectorNode[T] // 内部节点的子节点
+	values   []T              // 叶子节点的元素
+}
+
+// newVector 由切片构建向量，不引用传入的切片
+func newVector[T any](elements []T) vector[T] {
+	var v vector[T]
+	for len(elements) > 0 {
+		n := vectorWidth
+		if len(elements) < n {
+			n = len(elements)
+		}
+		if len(v.tail) == vectorWidth {
+			v = v.flushTail()
+		}
+		v.tail = append(make([]T, 0, vectorWidth), elements[:n]...)
+		v.size += n
+		elements = elements[n:]
+	}
+	return v
+}
+
+// Len 返回元素个数
+func (v vector[T]) Len() int {
+	return v.size - v.start
+}
+
+func (v vector[T]) tailOffset() int {
+	return v.size - len(v.tail)
+}
+
+// leafFor 返回包含绝对下标i的叶子节点元素，tailOffset总是32的倍数，因此叶子内的下标为i&vectorMask
+func (v vector[T]) leafFor(i int) []T {
+	if i >= v.tailOffset() {
+		return v.tail
+	}
+
+	node := v.root
+	for level := v.shift; level > 0; level -= vectorBits {
+		node = node.children[(i>>level)&vectorMask]
+	}
+	return node.values
+}
+
+// At 返回下标i处的元素，调用者需保证0 <= i < Len()
+func (v vector[T]) At(i int) T {
+	i += v.start
+	return v.leafFor(i)[i&vectorMask]
+}
+
+// Push 返回在末尾追加x的新向量
+func (v vector[T]) Push(x T) vector[T] {
+	if len(v.tail) == vectorWidth {
+		v = v.flushTail()
+	}
+
+	tail := make([]T, len(v.tail), vectorWidth)
+	copy(tail, v.tail)
+	v.tail = append(tail, x)
+	v.size++
+	return v
+}
+
+// flushTail 将已满的tail移入树中
+func (v vector[T]) flushTail() vector[T] {
+	if v.shift == 0 {
+		v.shift = vectorBits
+	}
+	leaf := &vectorNode[T]{values: v.tail}
+
+	if (v.size >> vectorBits) > (1 << v.shift) {
+		// 根节点已满，树增高一层
+		v.root = &vectorNode[T]{children: []*vectorNode[T]{v.root, newVectorPath(v.shift, leaf)}}
+		v.shift += vectorBits
+	} else {
+		v.root = v.pushLeaf(v.shift, v.root, leaf)
+	}
+	v.tail = nil
+	return v
+}
+
+func (v vector[T]) pushLeaf(level uint, parent, leaf *vectorNode[T]) *vectorNode[T] {
+	index := ((v.size - 1) >> level) & vectorMask
+	node := &vectorNode[T]{children: make([]*vectorNode[T], index+1)}
+	if parent != nil {
+		copy(node.children, parent.children)
+	}
+
+	if level == vectorBits {
+		node.children[index] = leaf
+	} else if child := node.children[index]; child != nil {
+		node.children[index] = v.pushLeaf(level-vectorBits, child, leaf)
+	} else {
+		node.children[index] = newVectorPath(level-vectorBits, leaf)
+	}
+	return node
+}
+
+// newVectorPath 创建从第level层到叶子的单链路径
+func newVectorPath[T any](level uint, leaf *vectorNode[T]) *vectorNode[T] {
+	if level == 0 {
+		return leaf
+	}
+	return &vectorNode[T]{children: []*vectorNode[T]{newVectorPath(level-vectorBits, leaf)}}
+}
+
+// Set 返回将下标i处的元素替换为x的新向量，调用者需保证0 <= i < Len()
+func (v vector[T]) Set(i int, x T) vector[T] {
+	i += v.start
+	if i >= v.tailOffset() {
+		tail := make([]T, len(v.tail), vectorWidth)
+		copy(tail, v.tail)
+		tail[i&vectorMask] = x
+		v.tail = tail
+		return v
+	}
+
+	v.root = setVectorNode(v.shift, v.root, i, x)
+	return v
+}
+
+func setVectorNode[T any](level uint, node *vectorNode[T], i int, x T) *vectorNode[T] {
+	if level == 0 {
+		values := make([]T, len(node.values))
+		copy(values, node.values)
+		values[i&vectorMask] = x
+		return &vectorNode[T]{values: values}
+	}
+
+	children := make([]*vectorNode[T], len(node.children))
+	copy(children, node.children)
+	index := (i >> level) & vectorMask
+	children[index] = setVectorNode(level-vectorBits, children[index], i, x)
+	return &vectorNode[T]{children: children}
+}
+
+// Rest 返回去掉第一个元素的新向量，调用者需保证Len() > 0
+func (v vector[T]) Rest() vector[T] {
+	v.start++
+	if v.start == v.size {
+		return vector[T]{}
+	}
+	return v
+}
+
+// Slice 按顺序返回全部元素组成的新切片
+func (v vector[T]) Slice() []T {
+	elements := make([]T, 0, v.Len())
+	for i := v.start; i < v.size; {
+		leaf := v.leafFor(i)
+		values := leaf[i&vectorMask:]
+		if remaining := v.size - i; len(values) > remaining {
+			values = values[:remaining]
+		}
+		elements = append(elements, values...)
+		i += len(values)
+	}
+	return elements
+}
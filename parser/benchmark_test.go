@@ -0,0 +1,24 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/nicolerobin/monkey/internal/benchcorpus"
+	"github.com/nicolerobin/monkey/lexer"
+)
+
+func BenchmarkParseProgram(b *testing.B) {
+	for _, bench := range benchcorpus.Load(b) {
+		b.Run(bench.Name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(bench.Input)))
+			for i := 0; i < b.N; i++ {
+				p := NewParser(lexer.NewLexer(bench.Input))
+				p.ParseProgram()
+				if len(p.Errors()) > 0 {
+					b.Fatalf("parser has errors: %v", p.Errors())
+				}
+			}
+		})
+	}
+}
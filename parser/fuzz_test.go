@@ -0,0 +1,60 @@
+package parser
+
+import (
+	"testing"
+	"unicode/utf8"
+
+	"github.com/nicolerobin/monkey/ast"
+	"github.com/nicolerobin/monkey/lexer"
+)
+
+func FuzzParseProgram(f *testing.F) {
+	f.Add(`let add = fn(x, y) { x + y; }; add(1, 2);`)
+	f.Add(`if (a < b) { a } else { let c = b; c }; -a * !b`)
+	f.Add(`{"one": 1, 2: [3, 4]}["one"]; fn() {}()`)
+	f.Add(`import "util.mk" as util; export let x = util.y;`)
+	f.Add(`let unless = macro(c, a, b) { quote(if (!(unquote(c))) { unquote(a) } else { unquote(b) }) };`)
+	f.Add(`let f = fn(a, b = a * 2, ...rest) { rest }; f(1, ...[2, 3], 4);`)
+	f.Add(`fn even(n) { if (n == 0) { true } else { odd(n - 1) } } export fn odd(n) { even(n) }`)
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := NewParser(lexer.NewLexer(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) > 0 {
+			return
+		}
+
+		// String()的输出必须能重新解析为相同的语法树
+		printed := program.String()
+		reparser := NewParser(lexer.NewLexer(printed))
+		reparsed := reparser.ParseProgram()
+		if len(reparser.Errors()) > 0 {
+			t.Fatalf("String() output %q of %q does not parse: %v",
+				printed, input, reparser.Errors())
+		}
+		if reparsed.String() != printed {
+			t.Fatalf("String() does not round-trip.\ninput=%q\nfirst=%q\nsecond=%q",
+				input, printed, reparsed.String())
+		}
+
+		// JSON编码后必须能无损地还原，含有非法UTF-8的语法树不能编码
+		data, err := ast.Encode(program)
+		if !utf8.ValidString(printed) {
+			if err == nil {
+				t.Fatalf("Encode(%q) accepted invalid UTF-8", input)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("Encode(%q) failed: %s", input, err)
+		}
+		decoded, err := ast.Decode(data)
+		if err != nil {
+			t.Fatalf("Decode of %q failed: %s", input, err)
+		}
+		if decoded.String() != printed {
+			t.Fatalf("JSON does not round-trip.\ninput=%q\nwant=%q\ngot=%q",
+				input, printed, decoded.String())
+		}
+	})
+}
@@ -17,8 +17,9 @@ type (
 
 // Parser parser
 type Parser struct {
-	l      *lexer.Lexer
-	errors []string
+	l           *lexer.Lexer
+	errors      []string
+	parseErrors []ParseError
 
 	curToken  token.Token
 	peekToken token.Token
@@ -40,7 +41,9 @@ func NewParser(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
@@ -56,6 +59,7 @@ func NewParser(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.GT, p.parseInfixExpress)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.DOT, p.parseMemberExpression)
 
 	p.nextToken()
 	p.nextToken()
@@ -63,10 +67,27 @@ func NewParser(l *lexer.Lexer) *Parser {
 	return p
 }
 
+// ParseError 带有位置信息的解析错误
+type ParseError struct {
+	Token   token.Token // 出错位置的词法单元
+	Message string
+}
+
 func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+// ParseErrors 返回带有位置信息的解析错误，与Errors()一一对应
+func (p *Parser) ParseErrors() []ParseError {
+	return p.parseErrors
+}
+
+// addError 记录在词法单元tok处发生的解析错误
+func (p *Parser) addError(tok token.Token, msg string) {
+	p.errors = append(p.errors, msg)
+	p.parseErrors = append(p.parseErrors, ParseError{Token: tok, Message: msg})
+}
+
 func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
 	p.prefixParseFns[tokenType] = fn
 }
@@ -110,6 +131,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		p.nextToken()
 		value := p.parseExpression(LOWEST)
 		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
 		}
@@ -157,6 +179,17 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	return exp
 }
 
+func (p *Parser) parseMemberExpression(object ast.Expression) ast.Expression {
+	exp := &ast.MemberExpression{Token: p.curToken, Object: object}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	exp.Property = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	return exp
+}
+
 // ParseProgram parse program
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
@@ -172,25 +205,60 @@ func (p *Parser) ParseProgram() *ast.Program {
 }
 
 func (p *Parser) parseStatement() ast.Statement {
+	// 解析失败时返回无类型的nil，避免语句列表中出现包含nil指针的接口值
 	switch p.curToken.Type {
-	case token.LET:
-		return p.parseLetStatement()
+	case token.LET, token.CONST:
+		if stmt := p.parseLetStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
 	case token.RETURN:
-		return p.parseReturnStatement()
+		if stmt := p.parseReturnStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
+	case token.FUNCTION:
+		if !p.peekTokenIs(token.IDENT) {
+			// 匿名函数字面量作为表达式语句
+			if stmt := p.parseExpressionStatement(); stmt != nil {
+				return stmt
+			}
+			return nil
+		}
+		if stmt := p.parseFunctionStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
+	case token.IMPORT:
+		return p.parseImportStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
 	default:
-		return p.parseExpressionStatement()
+		if stmt := p.parseExpressionStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
 	}
 }
 
+// parseLetStatement 解析let或const语句
 func (p *Parser) parseLetStatement() *ast.LetStatement {
-	stmt := &ast.LetStatement{Token: p.curToken}
-	if !p.expectPeek(token.IDENT) {
-		return nil
-	}
+	stmt := &ast.LetStatement{Token: p.curToken, Constant: p.curTokenIs(token.CONST)}
+	if p.peekTokenIs(token.LBRACKET) || p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+		stmt.Pattern = p.parsePattern(false)
+		if stmt.Pattern == nil {
+			return nil
+		}
+	} else {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
 
-	stmt.Name = &ast.Identifier{
-		Token: p.curToken,
-		Value: p.curToken.Literal,
+		stmt.Name = &ast.Identifier{
+			Token: p.curToken,
+			Value: p.curToken.Literal,
+		}
 	}
 
 	if !p.expectPeek(token.ASSIGN) {
@@ -208,6 +276,216 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
+// parsePattern 解析当前词法单元开始的解构模式，同一模式中的变量不能重名。
+// refutable为true时用于match分支，允许出现字面量
+func (p *Parser) parsePattern(refutable bool) ast.Pattern {
+	pattern := p.parsePatternElement(refutable)
+	if pattern == nil {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	for _, name := range ast.PatternNames(pattern) {
+		if seen[name.Value] {
+			p.addError(name.Token, fmt.Sprintf("duplicate name %s in pattern %s", name.Value, pattern))
+			return nil
+		}
+		seen[name.Value] = true
+	}
+	return pattern
+}
+
+func (p *Parser) parsePatternElement(refutable bool) ast.Pattern {
+	switch {
+	case p.curTokenIs(token.IDENT):
+		return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	case p.curTokenIs(token.LBRACKET):
+		if pattern := p.parseArrayPattern(refutable); pattern != nil {
+			return pattern
+		}
+		return nil
+	case p.curTokenIs(token.LBRACE):
+		if pattern := p.parseHashPattern(refutable); pattern != nil {
+			return pattern
+		}
+		return nil
+	case refutable && (p.curTokenIs(token.INT) || p.curTokenIs(token.MINUS)):
+		if pattern := p.parseIntegerPattern(); pattern != nil {
+			return pattern
+		}
+		return nil
+	case refutable && p.curTokenIs(token.STRING):
+		return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+	case refutable && (p.curTokenIs(token.TRUE) || p.curTokenIs(token.FALSE)):
+		return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
+	default:
+		p.addError(p.curToken, fmt.Sprintf("expected a name or a pattern, got %s instead", p.curToken.Type))
+		return nil
+	}
+}
+
+// parseArrayPattern 解析数组解构模式：[a, [b, c], ...rest]，rest元素只能位于最后
+func (p *Parser) parseArrayPattern(refutable bool) *ast.ArrayPattern {
+	pattern := &ast.ArrayPattern{Token: p.curToken, Elements: []ast.Pattern{}}
+
+	if p.peekTokenIs(token.RBRACKEY) {
+		p.nextToken()
+		return pattern
+	}
+
+	for {
+		p.nextToken()
+		if p.curTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			pattern.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			if p.peekTokenIs(token.COMMA) {
+				p.addError(pattern.Rest.Token, fmt.Sprintf("rest element ...%s must be the last element", pattern.Rest.Value))
+				return nil
+			}
+			break
+		}
+
+		element := p.parsePatternElement(refutable)
+		if element == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, element)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(token.RBRACKEY) {
+		return nil
+	}
+	return pattern
+}
+
+// parseHashPattern 解析哈希表解构模式：{name, age: years}，键为字符串形式的名称
+func (p *Parser) parseHashPattern(refutable bool) *ast.HashPattern {
+	pattern := &ast.HashPattern{Token: p.curToken, Pairs: []*ast.HashPatternPair{}}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		key := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+		var value ast.Pattern = key
+		if p.peekTokenIs(token.COLON) {
+			p.nextToken()
+			p.nextToken()
+			value = p.parsePatternElement(refutable)
+			if value == nil {
+				return nil
+			}
+		}
+		pattern.Pairs = append(pattern.Pairs, &ast.HashPatternPair{Key: key, Value: value})
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	return pattern
+}
+
+// parseIntegerPattern 解析整数字面量模式，负数的词法单元合并为一个，使模式可以原样输出
+func (p *Parser) parseIntegerPattern() *ast.IntegerLiteral {
+	tok := p.curToken
+	if p.curTokenIs(token.MINUS) {
+		if !p.expectPeek(token.INT) {
+			return nil
+		}
+		tok.Type = token.INT
+		tok.Literal += p.curToken.Literal
+	}
+
+	value, err := strconv.ParseInt(tok.Literal, 0, 64)
+	if err != nil {
+		p.addError(tok, fmt.Sprintf("could not parse %q as integer", tok.Literal))
+		return nil
+	}
+	return &ast.IntegerLiteral{Token: tok, Value: value}
+}
+
+// parseImportStatement 解析import语句：import "path/util.mk" as util;
+func (p *Parser) parseImportStatement() ast.Statement {
+	stmt := &ast.ImportStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	stmt.Path = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.AS) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Alias = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// parseExportStatement 解析export语句，export只能修饰let语句
+// parseFunctionStatement 解析具名函数声明：fn name(a, b) { ... }
+func (p *Parser) parseFunctionStatement() *ast.FunctionStatement {
+	stmt := &ast.FunctionStatement{Token: p.curToken}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	fn, ok := p.parseFunctionLiteral().(*ast.FunctionLiteral)
+	if !ok {
+		return nil
+	}
+	// 函数字面量的词法单元仍为fn
+	fn.Token = stmt.Token
+	stmt.Function = fn
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseExportStatement() ast.Statement {
+	if p.peekTokenIs(token.FUNCTION) {
+		p.nextToken()
+		stmt := p.parseFunctionStatement()
+		if stmt == nil {
+			return nil
+		}
+		stmt.Exported = true
+		return stmt
+	}
+	if p.peekTokenIs(token.CONST) {
+		p.nextToken()
+	} else if !p.expectPeek(token.LET) {
+		return nil
+	}
+
+	stmt := p.parseLetStatement()
+	if stmt == nil {
+		return nil
+	}
+	stmt.Exported = true
+	return stmt
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{
 		Token: p.curToken,
@@ -248,7 +526,7 @@ func (p *Parser) peekTokenIs(tokenType token.TokenType) bool {
 func (p *Parser) peekError(t token.TokenType) {
 	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
 		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.addError(p.peekToken, msg)
 }
 func (p *Parser) expectPeek(tokenType token.TokenType) bool {
 	if p.peekTokenIs(tokenType) {
@@ -269,7 +547,7 @@ func (p *Parser) parseIdentifier() ast.Expression {
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.addError(p.curToken, msg)
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
@@ -304,7 +582,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(p.curToken, msg)
 		return nil
 	}
 	intLiteral.Value = value
@@ -383,6 +661,72 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return exp
 }
 
+// parseMatchExpression 解析match表达式：match (value) { pattern if guard => body, ... }。
+// 分支之间以逗号分隔，以代码块为结果的分支之后可以省略逗号；以哈希表字面量为结果时需要加括号
+func (p *Parser) parseMatchExpression() ast.Expression {
+	exp := &ast.MatchExpression{Token: p.curToken, Arms: []*ast.MatchArm{}}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	exp.Subject = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		exp.Arms = append(exp.Arms, arm)
+
+		if p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+		} else if !p.peekTokenIs(token.RBRACE) && !p.curTokenIs(token.RBRACE) {
+			p.peekError(token.COMMA)
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	return exp
+}
+
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	arm := &ast.MatchArm{}
+
+	arm.Pattern = p.parsePattern(true)
+	if arm.Pattern == nil {
+		return nil
+	}
+	if p.peekTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		arm.Guard = p.parseExpression(LOWEST)
+	}
+	if !p.expectPeek(token.ARROW) {
+		return nil
+	}
+	arm.Token = p.curToken
+
+	p.nextToken()
+	if p.curTokenIs(token.LBRACE) {
+		arm.Body = p.parseBlockStatement()
+		return arm
+	}
+	body := &ast.ExpressionStatement{Token: p.curToken, Expression: p.parseExpression(LOWEST)}
+	arm.Body = &ast.BlockStatement{Token: body.Token, Statements: []ast.Statement{body}}
+	return arm
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	defer untrace(trace("parsePrefixExpression"))
 	expression := &ast.PrefixExpression{
@@ -421,7 +765,7 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	lit.Parameters, lit.Defaults, lit.Rest = p.parseFunctionParameters()
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
@@ -432,36 +776,97 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return lit
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	identifiers := []*ast.Identifier{}
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	lit := &ast.MacroLiteral{
+		Token: p.curToken,
+	}
 
-	if p.peekTokenIs(token.RPAREN) {
-		p.nextToken()
-		return identifiers
+	if !p.expectPeek(token.LPAREN) {
+		return nil
 	}
 
-	p.nextToken()
+	params, defaults, rest := p.parseFunctionParameters()
+	if defaults != nil || rest != nil {
+		p.addError(lit.Token, "macro parameters cannot have default values or a rest parameter")
+		return nil
+	}
+	lit.Parameters = params
 
-	ident := &ast.Identifier{
-		Token: p.curToken,
-		Value: p.curToken.Literal,
+	if !p.expectPeek(token.LBRACE) {
+		return nil
 	}
-	identifiers = append(identifiers, ident)
 
-	for p.peekTokenIs(token.COMMA) {
-		p.nextToken()
+	lit.Body = p.parseBlockStatement()
+
+	return lit
+}
+
+// parseFunctionParameters 解析形参列表，参数可以带默认值name = expr，最后一个参数可以是...rest。
+// 带默认值的参数之后的普通参数也必须带默认值
+func (p *Parser) parseFunctionParameters() ([]*ast.Identifier, []ast.Expression, *ast.Identifier) {
+	identifiers := []*ast.Identifier{}
+	var defaults []ast.Expression
+	seen := make(map[string]bool) // 已出现的参数名，同名参数是错误
+
+	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
+		return identifiers, nil, nil
+	}
+
+	for {
+		if p.peekTokenIs(token.ELLIPSIS) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return nil, nil, nil
+			}
+			rest := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			if seen[rest.Value] {
+				p.addError(rest.Token, fmt.Sprintf("duplicate parameter %s", rest.Value))
+				return nil, nil, nil
+			}
+			if p.peekTokenIs(token.COMMA) {
+				p.addError(rest.Token, fmt.Sprintf("rest parameter ...%s must be the last parameter", rest.Value))
+				return nil, nil, nil
+			}
+			if !p.expectPeek(token.RPAREN) {
+				return nil, nil, nil
+			}
+			return identifiers, defaults, rest
+		}
+
+		if !p.expectPeek(token.IDENT) {
+			return nil, nil, nil
+		}
 		ident := &ast.Identifier{
 			Token: p.curToken,
 			Value: p.curToken.Literal,
 		}
+		if seen[ident.Value] {
+			p.addError(ident.Token, fmt.Sprintf("duplicate parameter %s", ident.Value))
+			return nil, nil, nil
+		}
+		seen[ident.Value] = true
 		identifiers = append(identifiers, ident)
+
+		if p.peekTokenIs(token.ASSIGN) {
+			p.nextToken()
+			p.nextToken()
+			defaults = append(defaults, p.parseExpression(LOWEST))
+		} else if defaults != nil {
+			p.addError(ident.Token, fmt.Sprintf("parameter %s without a default value follows a parameter with one", ident.Value))
+			return nil, nil, nil
+		}
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
 	}
 
 	if !p.expectPeek(token.RPAREN) {
-		return nil
+		return nil, nil, nil
 	}
-	return identifiers
+	return identifiers, defaults, nil
 }
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
@@ -469,7 +874,7 @@ func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 		Token:    p.curToken,
 		Function: function,
 	}
-	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	exp.Arguments = p.parseCallArguments()
 	return exp
 }
 
@@ -482,12 +887,12 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 	}
 
 	p.nextToken()
-	args = append(args, p.parseExpression(LOWEST))
+	args = append(args, p.parseCallArgument())
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		args = append(args, p.parseExpression(LOWEST))
+		args = append(args, p.parseCallArgument())
 	}
 
 	if !p.expectPeek(token.RPAREN) {
@@ -495,3 +900,15 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 	}
 	return args
 }
+
+// parseCallArgument 解析一个实参，...expr解析为展开实参
+func (p *Parser) parseCallArgument() ast.Expression {
+	if !p.curTokenIs(token.ELLIPSIS) {
+		return p.parseExpression(LOWEST)
+	}
+
+	spread := &ast.SpreadExpression{Token: p.curToken}
+	p.nextToken()
+	spread.Value = p.parseExpression(LOWEST)
+	return spread
+}
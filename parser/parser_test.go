@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/nicolerobin/monkey/ast"
@@ -394,6 +395,56 @@ func TestIfExpression(t *testing.T) {
 	}
 }
 
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkPeekError(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MacroLiteral. got=%T",
+			stmt.Expression)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got=%d\n",
+			len(macro.Parameters))
+	}
+
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements has not 1 statements. got=%d\n",
+			len(macro.Body.Statements))
+	}
+
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body stmt is not ast.ExpressionStatement. got=%T",
+			macro.Body.Statements[0])
+	}
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+
+	if macro.String() != "macro(x, y) { (x + y) }" {
+		t.Errorf("macro.String() wrong. got=%q", macro.String())
+	}
+}
+
 func TestFunctionLiteralParsing(t *testing.T) {
 	input := `fn(x, y) { x + y; }`
 
@@ -440,6 +491,54 @@ func TestFunctionLiteralParsing(t *testing.T) {
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
 
+func TestFunctionStatement(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedName     string
+		expectedParams   int
+		expectedExported bool
+		expectedString   string
+	}{
+		{`fn add(x, y) { x + y }`, "add", 2, false, "fn add(x, y) { (x + y) }"},
+		{`fn f(a, b = 1, ...rest) { rest };`, "f", 2, false, "fn f(a, b = 1, ...rest) { rest }"},
+		{`export fn id(x) { x }`, "id", 1, true, "export fn id(x) { x }"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkPeekError(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.FunctionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.FunctionStatement. got=%T", program.Statements[0])
+		}
+		if stmt.Name.Value != tt.expectedName || stmt.Exported != tt.expectedExported {
+			t.Errorf("wrong declaration. got name=%s, exported=%t", stmt.Name.Value, stmt.Exported)
+		}
+		if len(stmt.Function.Parameters) != tt.expectedParams {
+			t.Errorf("wrong number of parameters. want=%d, got=%d",
+				tt.expectedParams, len(stmt.Function.Parameters))
+		}
+		if stmt.Function.TokenLiteral() != "fn" {
+			t.Errorf("function token wrong. got=%q", stmt.Function.TokenLiteral())
+		}
+		if program.String() != tt.expectedString {
+			t.Errorf("program.String() wrong. want=%q, got=%q", tt.expectedString, program.String())
+		}
+	}
+
+	// 匿名函数字面量仍然是表达式语句
+	program := NewParser(lexer.NewLexer(`fn(x) { x }(1)`)).ParseProgram()
+	if _, ok := program.Statements[0].(*ast.ExpressionStatement); !ok {
+		t.Errorf("anonymous function parsed as %T", program.Statements[0])
+	}
+}
+
 func TestFunctionParameterParsing(t *testing.T) {
 	tests := []struct {
 		input          string
@@ -479,6 +578,240 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedRequired int
+		expected         string
+	}{
+		{"fn(a, b = 2) { a + b }", 1, "fn(a, b = 2) { (a + b) }"},
+		{"fn(a = 1, b = a * 2) { b }", 0, "fn(a = 1, b = (a * 2)) { b }"},
+		{"fn(...rest) { rest }", 0, "fn(...rest) { rest }"},
+		{"fn(a, b = [1], ...rest) { rest }", 1, "fn(a, b = [1], ...rest) { rest }"},
+	}
+
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		program := p.ParseProgram()
+		checkPeekError(t, p)
+
+		function := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+		if function.NumRequired() != tt.expectedRequired {
+			t.Errorf("wrong number of required parameters for %q. got=%d", tt.input, function.NumRequired())
+		}
+		if function.String() != tt.expected {
+			t.Errorf("wrong function. want=%q, got=%q", tt.expected, function.String())
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(a = 1, b) { b }", "parameter b without a default value follows a parameter with one"},
+		{"fn(...rest, a) { a }", "rest parameter ...rest must be the last parameter"},
+		{"fn(...) { 1 }", "expected next token to be IDENT, got ) instead"},
+		{"fn(a, a) {}", "duplicate parameter a"},
+		{"fn(a, b = 1, a = 2) { a }", "duplicate parameter a"},
+		{"fn(a, ...a) { a }", "duplicate parameter a"},
+		{"macro(x, x) { x }", "duplicate parameter x"},
+		{"macro(a = 1) { a }", "macro parameters cannot have default values or a rest parameter"},
+		{"macro(...a) { a }", "macro parameters cannot have default values or a rest parameter"},
+	}
+
+	for _, tt := range errorTests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want first=%q, got=%q", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestSpreadArguments(t *testing.T) {
+	p := NewParser(lexer.NewLexer("add(1, ...rest, ...[2, 3])"))
+	program := p.ParseProgram()
+	checkPeekError(t, p)
+
+	exp := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	if len(exp.Arguments) != 3 {
+		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	}
+	testLiteralExpression(t, exp.Arguments[0], 1)
+	spread, ok := exp.Arguments[1].(*ast.SpreadExpression)
+	if !ok {
+		t.Fatalf("exp.Arguments[1] is not ast.SpreadExpression. got=%T", exp.Arguments[1])
+	}
+	testIdentifier(t, spread.Value, "rest")
+	if exp.String() != "add(1, ...rest, ...[2, 3])" {
+		t.Errorf("wrong call. got=%q", exp.String())
+	}
+}
+
+func TestLetPatterns(t *testing.T) {
+	tests := []struct {
+		input         string
+		expected      string
+		expectedNames []string
+	}{
+		{"let [a, b] = pair;", "let [a, b] = pair;", []string{"a", "b"}},
+		{"let [head, ...tail] = xs", "let [head, ...tail] = xs;", []string{"head", "tail"}},
+		{"let [] = xs;", "let [] = xs;", []string{}},
+		{"let {name, age: years} = person;", "let {name, age: years} = person;", []string{"name", "years"}},
+		{"let {pos: [x, y], tags: [first, ...others]} = p;", "let {pos: [x, y], tags: [first, ...others]} = p;", []string{"x", "y", "first", "others"}},
+		{"export let [a, {b}] = f();", "export let [a, {b}] = f();", []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		program := p.ParseProgram()
+		checkPeekError(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.LetStatement. got=%T", program.Statements[0])
+		}
+		if stmt.Name != nil || stmt.Pattern == nil {
+			t.Fatalf("let statement %q has no pattern", tt.input)
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("wrong let statement. want=%q, got=%q", tt.expected, stmt.String())
+		}
+		names := []string{}
+		for _, name := range ast.PatternNames(stmt.Pattern) {
+			names = append(names, name.Value)
+		}
+		if !reflect.DeepEqual(names, tt.expectedNames) {
+			t.Errorf("wrong names for %q. want=%v, got=%v", tt.input, tt.expectedNames, names)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, ...b, c] = xs;", "rest element ...b must be the last element"},
+		{"let [a, a] = xs;", "duplicate name a in pattern [a, a]"},
+		{"let {a, b: [a]} = h;", "duplicate name a in pattern {a, b: [a]}"},
+		{"let [1] = xs;", "expected a name or a pattern, got INT instead"},
+		{`let {"a": b} = h;`, "expected next token to be IDENT, got STRING instead"},
+		{"let {a b} = h;", "expected next token to be ,, got IDENT instead"},
+	}
+
+	for _, tt := range errorTests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want first=%q, got=%q", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestConstStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		exported bool
+	}{
+		{"const x = 5;", "const x = 5;", false},
+		{"const [a, ...b] = xs", "const [a, ...b] = xs;", false},
+		{"export const y = x;", "export const y = x;", true},
+	}
+
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		program := p.ParseProgram()
+		checkPeekError(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.LetStatement. got=%T", program.Statements[0])
+		}
+		if !stmt.Constant || stmt.Exported != tt.exported {
+			t.Errorf("wrong flags for %q. constant=%t, exported=%t", tt.input, stmt.Constant, stmt.Exported)
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("wrong const statement. want=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+
+	p := NewParser(lexer.NewLexer("const = 1;"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 || p.Errors()[0] != "expected next token to be IDENT, got = instead" {
+		t.Errorf("wrong errors %q", p.Errors())
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"match (x) { 1 => a, 2 => b }", "match (x) { 1 => { a }, 2 => { b } }"},
+		{"match (x) { -1 => a, _ => b, }", "match (x) { -1 => { a }, _ => { b } }"},
+		{"match (f(x)) { [a, ...t] if len(t) > 0 => { let y = a; y } _ => 0 }",
+			"match (f(x)) { [a, ...t] if (len(t) > 0) => { let y = a;y }, _ => { 0 } }"},
+		{`match (x) { {type: "t", val} => val, true => 1, false => 0 }`,
+			"match (x) { {type: \"t\", val} => { val }, true => { 1 }, false => { 0 } }"},
+		{"match (x) { }", "match (x) {  }"},
+	}
+
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		program := p.ParseProgram()
+		checkPeekError(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+		match, ok := stmt.Expression.(*ast.MatchExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.MatchExpression. got=%T", stmt.Expression)
+		}
+		if match.String() != tt.expected {
+			t.Errorf("wrong match expression. want=%q, got=%q", tt.expected, match.String())
+		}
+	}
+
+	exhaustiveTests := []struct {
+		input    string
+		expected bool
+	}{
+		{"match (x) { 1 => a }", false},
+		{"match (x) { 1 => a, n => b }", true},
+		{"match (x) { _ if ok => a }", false},
+		{"match (x) { true => a, false => b }", true},
+		{"match (x) { [a] => a, {b} => b }", false},
+	}
+
+	for _, tt := range exhaustiveTests {
+		program := NewParser(lexer.NewLexer(tt.input)).ParseProgram()
+		match := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.MatchExpression)
+		if match.Exhaustive() != tt.expected {
+			t.Errorf("wrong exhaustiveness for %q. want=%t, got=%t", tt.input, tt.expected, match.Exhaustive())
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"match x { _ => 1 }", "expected next token to be (, got IDENT instead"},
+		{"match (x) { 1 -> a }", "expected next token to be =>, got - instead"},
+		{"match (x) { [a, a] => a }", "duplicate name a in pattern [a, a]"},
+		{"match (x) { 1 => a 2 => b }", "expected next token to be ,, got INT instead"},
+	}
+
+	for _, tt := range errorTests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want first=%q, got=%q", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := "add(1, 2 * 3, 4 + 5);"
 
@@ -660,10 +993,18 @@ func TestParsingHashLiteralsStringKeys(t *testing.T) {
 			t.Errorf("key is not ast.StringLiteral. got=%T", key)
 		}
 
-		expectedValue := expected[literal.String()]
+		expectedValue := expected[literal.Value]
 
 		testIntegerLiteral(t, value, expectedValue)
 	}
+
+	// Keys保持源码中的顺序
+	for i, name := range []string{"one", "two", "three"} {
+		literal, ok := hash.Keys[i].(*ast.StringLiteral)
+		if !ok || literal.Value != name {
+			t.Errorf("hash.Keys[%d] is not %q. got=%s", i, name, hash.Keys[i])
+		}
+	}
 }
 
 func TestParsingEmptyHashLiteral(t *testing.T) {
@@ -722,12 +1063,98 @@ func TestParsingHashLiteralWithExpression(t *testing.T) {
 			continue
 		}
 
-		testFunc, ok := tests[literal.String()]
+		testFunc, ok := tests[literal.Value]
 		if !ok {
-			t.Errorf("No test function for key %q found", literal.String())
+			t.Errorf("No test function for key %q found", literal.Value)
 			continue
 		}
 
 		testFunc(value)
 	}
 }
+
+func TestImportStatement(t *testing.T) {
+	input := `import "lib/util.mk" as util; util.add(1, 2);`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkPeekError(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ImportStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ImportStatement. got=%T", program.Statements[0])
+	}
+	if stmt.Path.Value != "lib/util.mk" {
+		t.Errorf("stmt.Path.Value not %q. got=%q", "lib/util.mk", stmt.Path.Value)
+	}
+	if !testIdentifier(t, stmt.Alias, "util") {
+		return
+	}
+
+	call := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	member, ok := call.Function.(*ast.MemberExpression)
+	if !ok {
+		t.Fatalf("call.Function not *ast.MemberExpression. got=%T", call.Function)
+	}
+	if !testIdentifier(t, member.Object, "util") {
+		return
+	}
+	if !testIdentifier(t, member.Property, "add") {
+		return
+	}
+}
+
+func TestExportStatement(t *testing.T) {
+	input := `export let x = 5; let y = 10;`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkPeekError(t, p)
+
+	tests := []struct {
+		expectedIdentifier string
+		expectedExported   bool
+	}{
+		{"x", true},
+		{"y", false},
+	}
+	for i, tt := range tests {
+		stmt := program.Statements[i]
+		if !testLetStatement(t, stmt, tt.expectedIdentifier) {
+			return
+		}
+		if stmt.(*ast.LetStatement).Exported != tt.expectedExported {
+			t.Errorf("stmt.Exported not %t", tt.expectedExported)
+		}
+	}
+
+	if program.String() != "export let x = 5;let y = 10;" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	input := `let x = 5;
+let = 10;`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	p.ParseProgram()
+
+	errors := p.ParseErrors()
+	if len(errors) == 0 || len(errors) != len(p.Errors()) {
+		t.Fatalf("wrong number of parse errors. got=%d, want=%d", len(errors), len(p.Errors()))
+	}
+	if errors[0].Message != "expected next token to be IDENT, got = instead" {
+		t.Errorf("wrong message. got=%q", errors[0].Message)
+	}
+	if errors[0].Token.LineNo != 2 || errors[0].Token.Column != 5 {
+		t.Errorf("wrong position. got=%d:%d", errors[0].Token.LineNo, errors[0].Token.Column)
+	}
+}
@@ -13,6 +13,15 @@ var precedences = map[token.TokenType]int{
 	token.ASTERISk: PRODUCT,
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
+	token.DOT:      INDEX,
+}
+
+// Precedence 返回运算符对应的优先级，非运算符返回LOWEST
+func Precedence(tokenType token.TokenType) int {
+	if p, ok := precedences[tokenType]; ok {
+		return p
+	}
+	return LOWEST
 }
 
 func (p *Parser) peekPrecedence() int {
@@ -0,0 +1,121 @@
+package repl
+
+import (
+	"os"
+	"strings"
+)
+
+const HELP = `Commands:
+  :help              show this help
+  :ast               print the syntax tree of the last input
+  :bytecode          print the bytecode of the last input (not with eval)
+  :globals           list global bindings of the current engine
+  :reset             discard all bindings and compiled state
+  :load <file.mk>    run a file in the current session
+  :engine [eval|vm|both]
+                     show or switch the execution engine, both runs each
+                     input on both engines and reports any disagreement
+  :history           list previous inputs
+  :quit              leave the REPL
+`
+
+// runCommand 执行以冒号开头的元命令，返回false表示退出REPL
+func (s *session) runCommand(input string, history *History) bool {
+	fields := strings.Fields(input)
+	name, args := fields[0], fields[1:]
+
+	switch name {
+	case ":help":
+		printf(s.out, HELP)
+	case ":quit":
+		return false
+	case ":ast":
+		if s.lastProgram == nil {
+			printf(s.out, "no input yet\n")
+			return true
+		}
+		printf(s.out, "%s\n", s.lastProgram.String())
+	case ":bytecode":
+		s.printBytecode()
+	case ":globals":
+		s.printGlobals()
+	case ":reset":
+		s.reset()
+		printf(s.out, "state reset\n")
+	case ":load":
+		if len(args) != 1 {
+			printf(s.out, "usage: :load <file.mk>\n")
+			return true
+		}
+		path := args[0]
+		if s.caps != nil {
+			real, err := s.caps.Check(path, false)
+			if err != nil {
+				printf(s.out, "Woops! Loading file failed, error: %s\n", err)
+				return true
+			}
+			path = real
+		}
+		source, err := os.ReadFile(path)
+		if err != nil {
+			printf(s.out, "Woops! Loading file failed, error: %s\n", err)
+			return true
+		}
+		s.run(string(source))
+	case ":engine":
+		if len(args) == 0 {
+			printf(s.out, "engine: %s\n", s.engine)
+			return true
+		}
+		if args[0] != EngineVM && args[0] != EngineEval && args[0] != EngineBoth {
+			printf(s.out, "unknown engine %q, want %s, %s or %s\n",
+				args[0], EngineEval, EngineVM, EngineBoth)
+			return true
+		}
+		// 两个引擎的状态相互独立，切换后各自保留之前累积的绑定
+		s.engine = args[0]
+		printf(s.out, "engine: %s\n", s.engine)
+	case ":history":
+		for i, entry := range history.Entries() {
+			printf(s.out, "%4d  %s\n", i+1, strings.ReplaceAll(entry, "\n", "\n      "))
+		}
+	default:
+		printf(s.out, "unknown command %s, type :help for help\n", name)
+	}
+	return true
+}
+
+func (s *session) printBytecode() {
+	if s.engine == EngineEval {
+		printf(s.out, ":bytecode is only available with the vm engine\n")
+		return
+	}
+	if s.lastBytecode == nil {
+		printf(s.out, "no input yet\n")
+		return
+	}
+
+	printf(s.out, "instructions:\n%s", s.lastBytecode.Instructions.String())
+	printf(s.out, "constants:\n")
+	for i, constant := range s.lastBytecode.Constants {
+		printf(s.out, "%04d %s %s\n", i, constant.Type(), constant.Inspect())
+	}
+}
+
+func (s *session) printGlobals() {
+	if s.engine != EngineVM {
+		for _, name := range s.env.Names() {
+			value, _ := s.env.Get(name)
+			printf(s.out, "%s = %s\n", name, value.Inspect())
+		}
+		return
+	}
+
+	for _, sym := range s.symbolTable.Symbols() {
+		value := s.globals.Get(sym.Index)
+		if value == nil {
+			continue
+		}
+		printf(s.out, "%s = %s\n", sym.Name, value.Inspect())
+	}
+}
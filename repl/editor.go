@@ -0,0 +1,237 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// MaxLineSize 非终端输入中单行的最大字节数，超出时报告错误并结束REPL
+const MaxLineSize = 16 * 1024 * 1024
+
+// errInterrupted 在终端上按Ctrl-C放弃正在输入的内容
+var errInterrupted = errors.New("interrupted")
+
+// lineSource 逐行读取REPL的输入
+type lineSource interface {
+	// ReadLine 输出提示符后读取一行，不含行尾的换行符，输入结束时返回io.EOF
+	ReadLine(prompt string) (string, error)
+}
+
+// newLineSource 输入为终端时使用支持编辑和回溯历史记录的编辑器，否则逐行扫描输入
+func newLineSource(in io.Reader, out io.Writer, history *History) lineSource {
+	if f, ok := in.(*os.File); ok && isTerminal(f.Fd()) {
+		return &editor{
+			in:      bufio.NewReader(f),
+			out:     out,
+			history: history,
+			raw:     func() (func(), error) { return makeRaw(f.Fd()) },
+		}
+	}
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxLineSize)
+	return &scannerSource{scanner: scanner, out: out}
+}
+
+// scannerSource 从管道或文件中逐行读取输入
+type scannerSource struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (s *scannerSource) ReadLine(prompt string) (string, error) {
+	printf(s.out, prompt)
+	if !s.scanner.Scan() {
+		if err := s.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return s.scanner.Text(), nil
+}
+
+// 编辑器处理的控制键
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlH     = 8
+	keyCtrlK     = 11
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// editor 在终端上读取一行输入：左右方向键移动光标，上下方向键回溯历史记录，
+// 并支持Ctrl-A、Ctrl-E、Ctrl-K、Ctrl-U等常用的编辑键
+type editor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	history *History
+	raw     func() (func(), error) // 使终端进入逐键读取的模式，返回恢复终端的函数，为nil时不切换
+
+	line []rune // 正在编辑的内容，回溯的多行记录中包含换行符
+	pos  int    // 光标在line中的位置
+}
+
+func (e *editor) ReadLine(prompt string) (string, error) {
+	if e.raw != nil {
+		restore, err := e.raw()
+		if err != nil {
+			return "", err
+		}
+		defer restore()
+	}
+
+	printf(e.out, prompt)
+	e.line, e.pos = nil, 0
+	entries := e.history.Entries()
+	index := len(entries) // 正在浏览的历史记录，等于len(entries)时编辑的是新的输入
+	draft := ""           // 开始回溯之前输入的内容
+
+	recall := func(i int) {
+		if index == len(entries) {
+			draft = string(e.line)
+		}
+		index = i
+		if i == len(entries) {
+			e.line = []rune(draft)
+		} else {
+			e.line = []rune(entries[i])
+		}
+		e.pos = len(e.line)
+	}
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err == io.EOF && len(e.line) > 0 {
+			printf(e.out, "\r\n")
+			return string(e.line), nil
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			printf(e.out, "\r\n")
+			return string(e.line), nil
+		case keyCtrlC:
+			printf(e.out, "^C\r\n")
+			return "", errInterrupted
+		case keyCtrlD:
+			if len(e.line) == 0 {
+				printf(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.delete(e.pos)
+		case keyBackspace, keyCtrlH:
+			if e.pos > 0 {
+				e.pos--
+				e.delete(e.pos)
+			}
+		case keyCtrlA:
+			e.pos = 0
+		case keyCtrlE:
+			e.pos = len(e.line)
+		case keyCtrlB:
+			e.move(-1)
+		case keyCtrlF:
+			e.move(1)
+		case keyCtrlK:
+			e.line = e.line[:e.pos]
+		case keyCtrlU:
+			e.line = e.line[e.pos:]
+			e.pos = 0
+		case keyCtrlP:
+			if index > 0 {
+				recall(index - 1)
+			}
+		case keyCtrlN:
+			if index < len(entries) {
+				recall(index + 1)
+			}
+		case keyEscape:
+			switch e.escape() {
+			case 'A':
+				if index > 0 {
+					recall(index - 1)
+				}
+			case 'B':
+				if index < len(entries) {
+					recall(index + 1)
+				}
+			case 'C':
+				e.move(1)
+			case 'D':
+				e.move(-1)
+			case 'H':
+				e.pos = 0
+			case 'F':
+				e.pos = len(e.line)
+			case '~':
+				e.delete(e.pos)
+			}
+		default:
+			if unicode.IsPrint(r) {
+				e.line = append(e.line[:e.pos], append([]rune{r}, e.line[e.pos:]...)...)
+				e.pos++
+			}
+		}
+		e.refresh(prompt)
+	}
+}
+
+// escape 读取ESC之后的控制序列，返回方向键等按键的结束字符，Delete键返回'~'，无法识别时返回0
+func (e *editor) escape() rune {
+	r, _, err := e.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return 0
+	}
+
+	params := ""
+	for {
+		r, _, err = e.in.ReadRune()
+		if err != nil {
+			return 0
+		}
+		if (r < '0' || r > '9') && r != ';' {
+			break
+		}
+		params += string(r)
+	}
+	if r == '~' && params != "3" {
+		return 0
+	}
+	return r
+}
+
+func (e *editor) move(delta int) {
+	if pos := e.pos + delta; pos >= 0 && pos <= len(e.line) {
+		e.pos = pos
+	}
+}
+
+func (e *editor) delete(pos int) {
+	if pos < len(e.line) {
+		e.line = append(e.line[:pos], e.line[pos+1:]...)
+	}
+}
+
+// refresh 重新输出提示符和正在编辑的内容并移动光标，多行记录中的换行符显示为空格
+func (e *editor) refresh(prompt string) {
+	display := strings.ReplaceAll(string(e.line), "\n", " ")
+	printf(e.out, "\r%s%s\x1b[K", prompt, display)
+	if back := len(e.line) - e.pos; back > 0 {
+		printf(e.out, "\x1b[%dD", back)
+	}
+}
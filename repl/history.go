@@ -0,0 +1,114 @@
+package repl
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/nicolerobin/log"
+)
+
+// MaxHistory 最多保存的历史记录条数，超出时丢弃最早的记录
+const MaxHistory = 1000
+
+// History REPL输入历史，设置了文件路径时会持久化到文件中
+type History struct {
+	path    string
+	entries []string
+	max     int // 最多保存的条数
+}
+
+// NewHistory 创建输入历史，并从文件中加载之前会话的最近MaxHistory条记录
+func NewHistory(path string) *History {
+	h := &History{path: path, max: MaxHistory}
+	if path == "" {
+		return h
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Error("os.Open failed, error:%s", err)
+		}
+		return h
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxLineSize)
+	for scanner.Scan() {
+		h.entries = append(h.entries, unescapeEntry(scanner.Text()))
+	}
+	if err := scanner.Err(); err != nil {
+		log.Error("scanner.Scan failed, error:%s", err)
+	}
+	h.trim()
+	return h
+}
+
+// trim 只保留最近的max条记录，返回是否丢弃了记录
+func (h *History) trim() bool {
+	if len(h.entries) <= h.max {
+		return false
+	}
+	h.entries = append([]string(nil), h.entries[len(h.entries)-h.max:]...)
+	return true
+}
+
+// Add 添加一条历史记录，记录超过上限时丢弃最早的记录并重写文件，否则追加到文件末尾
+func (h *History) Add(entry string) {
+	h.entries = append(h.entries, entry)
+	if h.path == "" {
+		h.trim()
+		return
+	}
+
+	flag := os.O_APPEND | os.O_CREATE | os.O_WRONLY
+	lines := []string{entry}
+	if h.trim() {
+		flag = os.O_TRUNC | os.O_CREATE | os.O_WRONLY
+		lines = h.entries
+	}
+
+	f, err := os.OpenFile(h.path, flag, 0600)
+	if err != nil {
+		log.Error("os.OpenFile failed, error:%s", err)
+		return
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for _, line := range lines {
+		w.WriteString(escapeEntry(line) + "\n")
+	}
+	if err := w.Flush(); err != nil {
+		log.Error("w.Flush failed, error:%s", err)
+	}
+}
+
+// Entries 返回全部历史记录，最早的记录在前
+func (h *History) Entries() []string {
+	return h.entries
+}
+
+// escapeEntry 将多行输入转义为单行以便逐行保存
+func escapeEntry(entry string) string {
+	entry = strings.ReplaceAll(entry, `\`, `\\`)
+	return strings.ReplaceAll(entry, "\n", `\n`)
+}
+
+func unescapeEntry(line string) string {
+	var out strings.Builder
+
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' && i+1 < len(line) {
+			i++
+			if line[i] == 'n' {
+				out.WriteByte('\n')
+				continue
+			}
+		}
+		out.WriteByte(line[i])
+	}
+	return out.String()
+}
@@ -0,0 +1,45 @@
+package repl
+
+import "github.com/nicolerobin/monkey/object"
+
+// outcome 一次输入的执行结果，err非空时表示执行出错
+type outcome struct {
+	value object.Object
+	err   string
+}
+
+func (o outcome) String() string {
+	switch {
+	case o.err != "":
+		return o.err
+	case o.value == nil:
+		return "<no value>"
+	default:
+		return string(o.value.Type()) + " " + o.value.Inspect()
+	}
+}
+
+// agree 判断两个引擎的执行结果是否一致
+// 两个引擎的错误信息措辞不同，因此只比较是否出错；函数在两个引擎中的类型不同，
+// 因此比较Inspect给出的名称和参数列表
+func agree(a, b outcome) bool {
+	if a.err != "" || b.err != "" {
+		return a.err != "" && b.err != ""
+	}
+	if a.value == nil || b.value == nil {
+		return a.value == nil && b.value == nil
+	}
+	if isFunction(a.value) || isFunction(b.value) {
+		return isFunction(a.value) && isFunction(b.value) && a.value.Inspect() == b.value.Inspect()
+	}
+	return a.value.Type() == b.value.Type() && a.value.Inspect() == b.value.Inspect()
+}
+
+func isFunction(obj object.Object) bool {
+	switch obj.Type() {
+	case object.FUNCTION_OBJ, object.COMPILED_FUNCTION_OBJ, object.CLOSURE_OBJ, object.BUILTIN_OBJ:
+		return true
+	default:
+		return false
+	}
+}
@@ -1,21 +1,20 @@
 package repl
 
 import (
-	"bufio"
 	"fmt"
-	"github.com/nicolerobin/monkey/object"
 	"io"
+	"strings"
 
 	"github.com/nicolerobin/log"
-	"github.com/nicolerobin/monkey/compiler"
 	"github.com/nicolerobin/monkey/lexer"
-	"github.com/nicolerobin/monkey/parser"
-	"github.com/nicolerobin/monkey/vm"
+	"github.com/nicolerobin/monkey/stdlib"
+	"github.com/nicolerobin/monkey/token"
 )
 
 const (
-	PROMPT      = ">> "
-	MONKEY_FACE = `            __,__
+	PROMPT              = ">> "
+	CONTINUATION_PROMPT = ".. "
+	MONKEY_FACE         = `            __,__
    .--.  .-"     "-.  .--.
   / .. \/  .-. .-.  \/ .. \
  | |  '|  /   Y   \  |'  | |
@@ -29,131 +28,143 @@ const (
 `
 )
 
-func StartVM(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+const (
+	EngineVM   = "vm"   // 字节码虚拟机
+	EngineEval = "eval" // 树遍历解释器
+	EngineBoth = "both" // 差分模式，同时使用两个引擎执行并比较结果
+)
+
+// Config REPL配置
+type Config struct {
+	Engine      string   // 执行引擎，EngineVM、EngineEval或EngineBoth
+	HistoryFile string   // 历史记录文件，为空时不持久化历史记录
+	Dirs        []string // io模块允许访问的目录，为空时禁止访问文件
+	ReadOnly    bool     // io模块只允许读取文件
+}
+
+// Start 启动REPL，读取输入并交给会话执行，直到输入结束或退出。
+// 输入为终端时可以编辑当前行，并用上下方向键回溯历史记录
+func Start(in io.Reader, out io.Writer, config Config) {
+	history := NewHistory(config.HistoryFile)
+	lines := newLineSource(in, out, history)
+	s := newSession(out, config.Engine)
+	s.setInput(&lineReader{lines: lines})
+	s.grantIO(stdlib.Capabilities{Dirs: config.Dirs, ReadOnly: config.ReadOnly})
 
-	constants := []object.Object{}
-	globals := make([]object.Object, vm.GlobalSize)
-	symbolTable := compiler.NewSymbolTable()
 	for {
-		_, err := fmt.Fprintf(out, PROMPT)
-		if err != nil {
-			log.Info("fmt.Fprintf() failed, err:%s", err)
-			break
+		input, err := readInput(lines)
+		if err == errInterrupted {
+			continue
 		}
-		scanned := scanner.Scan()
-		if !scanned {
+		if err != nil {
+			if err != io.EOF {
+				printf(out, "Woops! Reading input failed, error: %s\n", err)
+			}
 			return
 		}
 
-		line := scanner.Text()
-		if len(line) <= 0 {
+		input = strings.TrimSpace(input)
+		if len(input) <= 0 {
 			continue
 		}
-		if line == "exit" {
+		if input == "exit" {
 			break
 		}
+		history.Add(input)
 
-		l := lexer.NewLexer(line)
-		p := parser.NewParser(l)
-		program := p.ParseProgram()
-		if len(p.Errors()) > 0 {
-			printParseErrors(out, p.Errors())
-			continue
-		}
-
-		comp := compiler.NewWithState(symbolTable, constants)
-		err = comp.Compile(program)
-		if err != nil {
-			_, err := fmt.Fprintf(out, "Woops! Compilation failed, error: %s\n", err)
-			if err != nil {
-				log.Error("fmt.Fprintf failed, error:%s", err)
+		if strings.HasPrefix(input, ":") {
+			if !s.runCommand(input, history) {
+				break
 			}
 			continue
 		}
+		s.run(input)
+	}
+}
 
-		code := comp.Bytecode()
-		constants = code.Constants
-		machine := vm.NewVmWithGlobalsStore(code, globals)
-		err = machine.Run()
-		if err != nil {
-			_, err := fmt.Fprintf(out, "Woops! Executing bytecode failed, error: %s\n", err)
-			if err != nil {
-				log.Error("fmt.Fprintf failed, error:%s", err)
-			}
-			continue
-		}
+// StartVM 启动基于字节码虚拟机的REPL
+func StartVM(in io.Reader, out io.Writer) {
+	Start(in, out, Config{Engine: EngineVM})
+}
 
-		// stackTop := machine.StackTop()
-		stackTop := machine.LastPoppedStackElem()
-		_, err = io.WriteString(out, stackTop.Inspect())
-		if err != nil {
-			log.Error("io.WriteString failed, error:%s", err)
+// StartRepl 启动基于树遍历解释器的REPL
+func StartRepl(in io.Reader, out io.Writer) {
+	Start(in, out, Config{Engine: EngineEval})
+}
+
+// readInput 读取一条完整的输入，括号未闭合时继续读取后续行
+func readInput(lines lineSource) (string, error) {
+	input, err := lines.ReadLine(PROMPT)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(strings.TrimSpace(input), ":") {
+		return input, nil
+	}
+
+	for !isComplete(input) {
+		line, err := lines.ReadLine(CONTINUATION_PROMPT)
+		if err == io.EOF {
+			break
 		}
-		_, err = io.WriteString(out, "\n")
 		if err != nil {
-			log.Error("io.WriteString failed, error:%s", err)
+			return "", err
 		}
+		input += "\n" + line
 	}
+	return input, nil
 }
 
-/*
-func StartRepl(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
-	for {
-		_, err := fmt.Fprintf(out, PROMPT)
+// lineReader 将REPL的输入适配为io.Reader，使脚本中的read_line与REPL读取同一份输入
+type lineReader struct {
+	lines lineSource
+	buf   []byte // 当前行尚未读取的部分
+}
+
+// Read 每次最多返回一行，避免读取超过脚本所需的输入
+func (r *lineReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		line, err := r.lines.ReadLine("")
 		if err != nil {
-			log.Info("fmt.Fprintf() failed, err:%s", err)
-			break
-		}
-		scanned := scanner.Scan()
-		if !scanned {
-			return
+			return 0, err
 		}
+		r.buf = append([]byte(line), '\n')
+	}
 
-		line := scanner.Text()
-		l := lexer.NewLexer(line)
-		p := parser.NewParser(l)
-		program := p.ParseProgram()
-		if len(p.Errors()) > 0 {
-			printParseErrors(out, p.Errors())
-			continue
-		}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
 
-		// 解释器求值
-		evaluated := evaluator.Eval(program, env)
-		if evaluated != nil {
-			_, err := io.WriteString(out, evaluated.Inspect())
-			if err != nil {
-				log.Error("io.WriteString failed, error:%s", err)
-			}
-			_, err = io.WriteString(out, "\n")
-			if err != nil {
-				log.Error("io.WriteString failed, error:%s", err)
-			}
+// isComplete 判断输入中的圆括号、花括号和方括号是否都已闭合
+func isComplete(input string) bool {
+	depth := 0
+
+	l := lexer.NewLexer(input)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			depth++
+		case token.RPAREN, token.RBRACE, token.RBRACKEY:
+			depth--
 		}
 	}
+	return depth <= 0
 }
-*/
 
 func printParseErrors(out io.Writer, errors []string) {
-	_, err := fmt.Fprintf(out, MONKEY_FACE)
-	if err != nil {
-		log.Error("fmt.Fprintf failed, error:%s", err)
-	}
-	_, err = fmt.Fprintf(out, "Woops! We ran into some monkey business here!\n")
-	if err != nil {
-		log.Error("fmt.Fprintf failed, error:%s", err)
+	printf(out, MONKEY_FACE)
+	printf(out, "Woops! We ran into some monkey business here!\n")
+	printf(out, " parser errors:\n")
+	for _, msg := range errors {
+		printf(out, "\t%s\n", msg)
 	}
-	_, err = fmt.Fprintf(out, " parser errors:\n")
+}
+
+// printf 格式化输出，输出失败时记录日志
+func printf(out io.Writer, format string, a ...interface{}) {
+	_, err := fmt.Fprintf(out, format, a...)
 	if err != nil {
 		log.Error("fmt.Fprintf failed, error:%s", err)
 	}
-	for _, msg := range errors {
-		_, err = fmt.Fprintf(out, "\t"+msg+"\n")
-		if err != nil {
-			log.Error("fmt.Fprintf failed, error:%s", err)
-		}
-	}
 }
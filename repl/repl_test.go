@@ -0,0 +1,410 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nicolerobin/monkey/ast"
+	"github.com/nicolerobin/monkey/object"
+)
+
+func TestIsComplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1 + 2", true},
+		{"let add = fn(a, b) {", false},
+		{"let add = fn(a, b) {\n a + b\n}", true},
+		{"[1, 2,", false},
+		{"add(1,", false},
+		{`"{"`, true},
+		{"}", true},
+	}
+
+	for _, tt := range tests {
+		if isComplete(tt.input) != tt.expected {
+			t.Errorf("isComplete(%q) wrong. want=%t", tt.input, tt.expected)
+		}
+	}
+}
+
+func runRepl(t *testing.T, input string, config Config) string {
+	t.Helper()
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out, config)
+	return out.String()
+}
+
+func TestMultiLineInput(t *testing.T) {
+	input := "let add = fn(a, b) {\n  a + b\n};\nadd(1, 2)\n"
+
+	for _, engine := range []string{EngineVM, EngineEval} {
+		out := runRepl(t, input, Config{Engine: engine})
+		if !strings.Contains(out, CONTINUATION_PROMPT) {
+			t.Errorf("[%s] no continuation prompt in output %q", engine, out)
+		}
+		if !strings.HasSuffix(out, "3\n"+PROMPT) {
+			t.Errorf("[%s] wrong output %q", engine, out)
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let a = 1;\n:globals\n", []string{"a = 1\n"}},
+		{":engine eval\nlet b = 2;\n:globals\n", []string{"engine: eval\n", "b = 2\n"}},
+		{"1 + 2\n:ast\n", []string{"(1 + 2)\n"}},
+		{"1 + 2\n:bytecode\n", []string{"0003 OpAddConst 1\n", "0000 INTEGER 1\n"}},
+		{"let a = 1;\n:reset\na\n", []string{"state reset\n", "undefined variable:a"}},
+		{":engine lua\n", []string{`unknown engine "lua"`}},
+		{":nope\n", []string{"unknown command :nope"}},
+		{":quit\n1 + 1\n", []string{}},
+	}
+
+	for _, tt := range tests {
+		out := runRepl(t, tt.input, Config{Engine: EngineVM})
+		for _, expected := range tt.expected {
+			if !strings.Contains(out, expected) {
+				t.Errorf("input %q: output %q does not contain %q", tt.input, out, expected)
+			}
+		}
+	}
+
+	if out := runRepl(t, ":quit\n1 + 1\n", Config{}); strings.Contains(out, "2\n") {
+		t.Errorf(":quit did not leave the REPL, output %q", out)
+	}
+}
+
+func TestLoadCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lib.mk")
+	err := os.WriteFile(path, []byte("let double = fn(x) {\n  x * 2\n};\n"), 0644)
+	if err != nil {
+		t.Fatalf("os.WriteFile() failed, error:%s", err)
+	}
+
+	for _, engine := range []string{EngineVM, EngineEval} {
+		out := runRepl(t, ":load "+path+"\ndouble(21)\n", Config{Engine: engine, Dirs: []string{filepath.Dir(path)}})
+		if !strings.HasSuffix(out, "42\n"+PROMPT) {
+			t.Errorf("[%s] wrong output %q", engine, out)
+		}
+	}
+
+	// 与io模块相同，只能加载允许访问的目录中的文件
+	out := runRepl(t, ":load "+path+"\n", Config{Dirs: []string{t.TempDir()}})
+	if !strings.Contains(out, "Woops! Loading file failed, error: permission denied") {
+		t.Errorf("file outside the allowed directories loaded, output %q", out)
+	}
+}
+
+func TestImportPermission(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lib.mk")
+	if err := os.WriteFile(path, []byte("export let a = 1;\n"), 0644); err != nil {
+		t.Fatalf("os.WriteFile() failed, error:%s", err)
+	}
+	input := "import \"" + path + "\" as lib;\nlib.a\n"
+
+	for _, engine := range []string{EngineVM, EngineEval, EngineBoth} {
+		out := runRepl(t, input, Config{Engine: engine})
+		if !strings.Contains(out, "permission denied") || strings.Contains(out, "1\n") {
+			t.Errorf("[%s] module outside the allowed directories imported, output %q", engine, out)
+		}
+		out = runRepl(t, input, Config{Engine: engine, Dirs: []string{filepath.Dir(path)}})
+		if !strings.HasSuffix(out, "1\n"+PROMPT) {
+			t.Errorf("[%s] wrong output %q", engine, out)
+		}
+	}
+}
+
+func TestImportMacroModule(t *testing.T) {
+	dir := t.TempDir()
+	source := "let unless = macro(c, a, b) { quote(if (!(unquote(c))) { unquote(a) } else { unquote(b) }) };\n" +
+		"export let pick = fn(c) { unless(c, \"no\", \"yes\") };\n"
+	if err := os.WriteFile(filepath.Join(dir, "lib.mk"), []byte(source), 0644); err != nil {
+		t.Fatalf("os.WriteFile() failed, error:%s", err)
+	}
+	input := "import \"" + filepath.Join(dir, "lib.mk") + "\" as lib;\nlib.pick(true)\n"
+
+	for _, engine := range []string{EngineVM, EngineEval, EngineBoth} {
+		out := runRepl(t, input, Config{Engine: engine, Dirs: []string{dir}})
+		if !strings.HasSuffix(out, "yes\n"+PROMPT) {
+			t.Errorf("[%s] wrong output %q", engine, out)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	runRepl(t, "let a = fn() {\n 1\n};\n1 + 1\n", Config{HistoryFile: path})
+	out := runRepl(t, ":history\n", Config{HistoryFile: path})
+
+	for _, expected := range []string{"   1  let a = fn() {\n", "   2  1 + 1\n", "   3  :history\n"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("output %q does not contain %q", out, expected)
+		}
+	}
+
+	h := NewHistory(path)
+	if len(h.Entries()) != 3 || h.Entries()[0] != "let a = fn() {\n 1\n};" {
+		t.Errorf("history not restored, got=%q", h.Entries())
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	h := NewHistory(path)
+	h.max = 3
+	for _, entry := range []string{"1", "2", "3", "4", "5"} {
+		h.Add(entry)
+	}
+	if got := strings.Join(h.Entries(), ","); got != "3,4,5" {
+		t.Errorf("wrong entries. want=%q, got=%q", "3,4,5", got)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("os.ReadFile failed, error:%s", err)
+	}
+	if string(data) != "3\n4\n5\n" {
+		t.Errorf("history file not truncated, got=%q", data)
+	}
+}
+
+func TestEditor(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"1 + 1\r", []string{"1 + 1"}},
+		// 上方向键和Ctrl-P回溯历史记录，下方向键回到新的输入
+		{"\x1b[A\r", []string{"let a = 1;"}},
+		{"\x10\x10\r", []string{"a + 1"}},
+		{"x\x1b[A\x1b[B\r", []string{"x"}},
+		// 左方向键、Ctrl-A和Ctrl-E移动光标，退格和Delete键删除字符
+		{"12\x1b[D3\r", []string{"132"}},
+		{"bc\x01a\x05d\r", []string{"abcd"}},
+		{"abc\x7f\x01\x1b[3~\r", []string{"b"}},
+		{"abc\x02\x0b\r", []string{"ab"}},
+		{"abc\x02\x15\r", []string{"c"}},
+		{"1\r2\n", []string{"1", "2"}},
+	}
+
+	for _, tt := range tests {
+		h := NewHistory("")
+		h.Add("a + 1")
+		h.Add("let a = 1;")
+		e := &editor{in: bufio.NewReader(strings.NewReader(tt.input)), out: io.Discard, history: h}
+
+		lines := []string{}
+		for {
+			line, err := e.ReadLine(">> ")
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("input %q: e.ReadLine failed, error:%s", tt.input, err)
+			}
+			lines = append(lines, line)
+		}
+		if strings.Join(lines, "|") != strings.Join(tt.expected, "|") {
+			t.Errorf("input %q: wrong lines. want=%q, got=%q", tt.input, tt.expected, lines)
+		}
+	}
+}
+
+func TestEditorInterrupt(t *testing.T) {
+	e := &editor{in: bufio.NewReader(strings.NewReader("1 +\x03")), out: io.Discard, history: NewHistory("")}
+	if _, err := e.ReadLine(">> "); err != errInterrupted {
+		t.Errorf("expected errInterrupted, got=%v", err)
+	}
+}
+
+func TestLongInput(t *testing.T) {
+	long := `"` + strings.Repeat("a", 100*1024) + `"`
+	out := runRepl(t, "len("+long+")\n", Config{})
+	if !strings.Contains(out, "102400\n") {
+		t.Errorf("long line not evaluated, output %q", out[:100])
+	}
+
+	out = runRepl(t, strings.Repeat("a", MaxLineSize+1)+"\n", Config{})
+	if !strings.Contains(out, "Woops! Reading input failed") {
+		t.Errorf("oversized line not reported")
+	}
+}
+
+func TestDifferentialMode(t *testing.T) {
+	tests := []struct {
+		input       string
+		disagree    bool
+		expectedOut string
+	}{
+		{"1 + 2\n", false, "3\n"},
+		{"let a = [1, 2];\na[1]\n", false, "2\n"},
+		{"fn(x) { x }\n", false, "fn(x)\n"},
+		{"fn add(a, ...rest) { a }\nadd\n", false, "fn add(a, ...rest)\n"},
+		{"5 + true\n", false, "Woops! Executing bytecode failed"},
+		// 解释器中空函数体的调用结果为nil，而虚拟机中为null
+		{"fn() {}()\n", true, "eval: <no value>"},
+		// 宏定义在后续输入中依然可用，两个引擎执行同一份展开后的程序
+		{"let unless = macro(c, a, b) { quote(if (!(unquote(c))) { unquote(a) } else { unquote(b) }) };\nunless(false, 1, 2)\n", false, "1\n"},
+		{"let m = macro() { 1 };\nm()\n", false, "Woops! Macro expansion failed"},
+		// 编译器拒绝的程序在解释器中也在求值之前报错
+		{"let f = fn() { const b = 1; let b = 2; b };\n", false, "cannot redefine constant b"},
+	}
+
+	for _, tt := range tests {
+		out := runRepl(t, tt.input, Config{Engine: EngineBoth})
+		if strings.Contains(out, "!! engines disagree") != tt.disagree {
+			t.Errorf("input %q: wrong disagreement report in output %q", tt.input, out)
+		}
+		if !strings.Contains(out, tt.expectedOut) {
+			t.Errorf("input %q: output %q does not contain %q", tt.input, out, tt.expectedOut)
+		}
+	}
+}
+
+func TestAgree(t *testing.T) {
+	param := func(name string) *ast.Identifier { return &ast.Identifier{Value: name} }
+	add := &object.Function{Name: "add", Parameters: []*ast.Identifier{param("a"), param("b")}}
+
+	tests := []struct {
+		a, b     object.Object
+		expected bool
+	}{
+		{add, &object.CompiledFunction{Name: "add", NumParameters: 2, Parameters: []string{"a", "b"}}, true},
+		{add, &object.Closure{Fn: &object.CompiledFunction{Name: "add", NumParameters: 2, Parameters: []string{"a", "b"}}}, true},
+		{add, &object.CompiledFunction{Name: "sub", NumParameters: 2, Parameters: []string{"a", "b"}}, false},
+		{add, &object.CompiledFunction{Name: "add", NumParameters: 1, Parameters: []string{"a"}}, false},
+		{add, &object.Integer{Value: 1}, false},
+	}
+
+	for i, tt := range tests {
+		if agree(outcome{value: tt.a}, outcome{value: tt.b}) != tt.expected {
+			t.Errorf("tests[%d]: agree(%s, %s) != %t", i, tt.a.Inspect(), tt.b.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestDifferentialSideEffects(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log.txt")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatalf("os.WriteFile() failed, error:%s", err)
+	}
+
+	// 副作用只发生一次：输出只写一次，输入只读一次，解释器引擎写入的文件被丢弃
+	input := "import \"io\" as io;\nputs(\"a\"); io.print(\"b\");\nlet name = io.read_line();\nworld\n" +
+		"io.write_file(\"" + path + "\", io.read_file(\"" + path + "\") + name)\nname\n"
+	out := runRepl(t, input, Config{Engine: EngineBoth, Dirs: []string{dir}})
+	if strings.Contains(out, "!! engines disagree") {
+		t.Errorf("engines disagree, output %q", out)
+	}
+	if strings.Count(out, "a\nb\n") != 1 || !strings.HasSuffix(out, "world\n"+PROMPT) {
+		t.Errorf("wrong output %q", out)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "oldworld" {
+		t.Errorf("file written more than once, content %q", data)
+	}
+
+	// 两个引擎的输出不一致时给出提示
+	var buf bytes.Buffer
+	s := newSession(&buf, EngineBoth)
+	s.evalCtx.Stdout = io.MultiWriter(&s.evalOut, &s.evalOut)
+	s.run(`puts("x"); 1`)
+	if !strings.Contains(buf.String(), "!! engines disagree") || !strings.Contains(buf.String(), `eval output: "x\nx\n"`) {
+		t.Errorf("output difference not reported, output %q", buf.String())
+	}
+}
+
+func TestFunctionDeclarations(t *testing.T) {
+	// 编译失败的函数声明不影响之后重新声明同名函数
+	input := "fn f(n) { g(n) }\nfn g(n) { n * 2 }\nfn f(n) { g(n) }\nf(3)\n"
+	out := runRepl(t, input, Config{Engine: EngineVM})
+	if !strings.Contains(out, "undefined variable:g") || !strings.HasSuffix(out, "6\n"+PROMPT) {
+		t.Errorf("wrong output %q", out)
+	}
+}
+
+func TestMatchWarning(t *testing.T) {
+	input := "match (2) { 1 => \"one\", 2 => \"two\" }\n"
+	for _, engine := range []string{EngineVM, EngineEval, EngineBoth} {
+		out := runRepl(t, input, Config{Engine: engine})
+		if strings.Count(out, "warning: 1:1: match is not exhaustive") != 1 || !strings.HasSuffix(out, "two\n"+PROMPT) {
+			t.Errorf("[%s] wrong output %q", engine, out)
+		}
+	}
+}
+
+func TestConstants(t *testing.T) {
+	input := "const x = 1;\nlet x = 2;\nlet y = 1;\nlet y = x;\ny\n"
+	for _, engine := range []string{EngineVM, EngineEval} {
+		out := runRepl(t, input, Config{Engine: engine})
+		if !strings.Contains(out, "cannot redefine constant x") || !strings.HasSuffix(out, "1\n"+PROMPT) {
+			t.Errorf("[%s] wrong output %q", engine, out)
+		}
+	}
+	for _, engine := range []string{EngineVM, EngineEval} {
+		out := runRepl(t, input, Config{Engine: engine})
+		if !strings.Contains(out, "warning: 1:5: y is already defined in this scope") || strings.Contains(out, "x is already defined") {
+			t.Errorf("[%s] wrong redefinition warnings in %q", engine, out)
+		}
+	}
+}
+
+func TestIOModule(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "name.txt")
+	if err := os.WriteFile(path, []byte("file"), 0644); err != nil {
+		t.Fatalf("os.WriteFile() failed, error:%s", err)
+	}
+	input := "import \"io\" as io;\nio.print(\"hello\", 1);\nlet name = io.read_line();\nworld\nname\n" +
+		"io.read_file(\"" + path + "\")\n"
+
+	for _, engine := range []string{EngineVM, EngineEval} {
+		out := runRepl(t, input, Config{Engine: engine, Dirs: []string{filepath.Dir(path)}})
+		for _, expected := range []string{"hello 1\n", "world\n", "file\n"} {
+			if !strings.Contains(out, expected) {
+				t.Errorf("[%s] output %q does not contain %q", engine, out, expected)
+			}
+		}
+
+		out = runRepl(t, input, Config{Engine: engine})
+		if !strings.Contains(out, "outside the allowed directories") {
+			t.Errorf("[%s] file access was not sandboxed, output %q", engine, out)
+		}
+	}
+}
+
+func TestScriptOutput(t *testing.T) {
+	for _, engine := range []string{EngineVM, EngineEval} {
+		out := runRepl(t, "let f = fn(x) { puts(x) };\nmap([1, 2], f);\n", Config{Engine: engine})
+		if !strings.Contains(out, PROMPT+"1\n2\n") {
+			t.Errorf("[%s] puts output not written to the REPL, output %q", engine, out)
+		}
+	}
+
+	var out bytes.Buffer
+	StartVM(strings.NewReader(`puts("hi")`+"\n"), &out)
+	if !strings.Contains(out.String(), "hi\nnull\n") {
+		t.Errorf("StartVM did not route puts output, output %q", out.String())
+	}
+}
+
+func TestStartRepl(t *testing.T) {
+	var out bytes.Buffer
+	StartRepl(strings.NewReader("let f = fn(x) { x * 2 };\nf(4)\n"), &out)
+
+	if !strings.HasSuffix(out.String(), "8\n"+PROMPT) {
+		t.Errorf("wrong output %q", out.String())
+	}
+}
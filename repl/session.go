@@ -0,0 +1,265 @@
+package repl
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/nicolerobin/monkey/ast"
+	"github.com/nicolerobin/monkey/compiler"
+	"github.com/nicolerobin/monkey/evaluator"
+	"github.com/nicolerobin/monkey/module"
+	"github.com/nicolerobin/monkey/object"
+	"github.com/nicolerobin/monkey/stdlib"
+	"github.com/nicolerobin/monkey/vm"
+)
+
+// session REPL会话，保存多次输入之间累积的状态
+type session struct {
+	out    io.Writer
+	engine string
+	io     *object.Module       // 执行import "io"时使用的io模块
+	caps   *stdlib.Capabilities // io模块的权限，import和:load读取文件时按同样的权限检查
+	ctx    *object.Context      // 执行上下文，脚本的输出写入REPL的输出
+
+	// 差分模式中只有虚拟机引擎产生副作用：记录它的输出和读取的输入，
+	// 解释器引擎重放这些输入，输出写入缓冲区后与之比较，写入的文件被丢弃
+	stdout  *recorder
+	stdin   *recorder
+	evalOut bytes.Buffer
+	evalIn  bytes.Buffer
+	evalCtx *object.Context
+	evalIO  *object.Module
+
+	// 虚拟机引擎的状态
+	constants   []object.Object
+	globals     *vm.Globals
+	symbolTable *compiler.SymbolTable
+
+	// 解释器引擎的状态
+	env *object.Environment
+
+	// 宏展开阶段的状态，两个引擎共用
+	macroEnv *object.Environment
+
+	lastProgram  *ast.Program       // 最近一次输入的语法树
+	lastBytecode *compiler.Bytecode // 最近一次输入编译得到的字节码
+}
+
+func newSession(out io.Writer, engine string) *session {
+	if engine != EngineEval && engine != EngineBoth {
+		engine = EngineVM
+	}
+
+	s := &session{out: out, engine: engine, stdout: &recorder{w: out}}
+	s.ctx = &object.Context{Stdout: s.stdout, Stderr: s.stdout}
+	s.evalCtx = &object.Context{Stdout: &s.evalOut, Stderr: &s.evalOut, Stdin: &s.evalIn}
+	s.reset()
+	return s
+}
+
+// setInput 设置脚本读取的输入
+func (s *session) setInput(in io.Reader) {
+	s.stdin = &recorder{r: in}
+	s.ctx.Stdin = s.stdin
+}
+
+// grantIO 按caps创建import "io"时使用的io模块，脚本的输入输出使用会话的输入输出。
+// 之后import的模块和:load的文件也要在caps允许访问的目录中
+func (s *session) grantIO(caps stdlib.Capabilities) {
+	s.caps = &stdlib.Capabilities{Dirs: caps.Dirs, ReadOnly: caps.ReadOnly}
+	caps.Stdout = s.stdout
+	if s.stdin != nil {
+		caps.Stdin = s.stdin
+	}
+	s.io = stdlib.NewIO(caps)
+
+	caps.Stdout, caps.DiscardWrites = &s.evalOut, true
+	if s.stdin != nil {
+		caps.Stdin = &s.evalIn
+	}
+	s.evalIO = stdlib.NewIO(caps)
+}
+
+// reset 清空两个引擎累积的全部状态
+func (s *session) reset() {
+	s.constants = []object.Object{}
+	s.globals = vm.NewGlobals()
+	s.symbolTable = compiler.NewSymbolTable()
+	s.env = object.NewEnvironment()
+	s.env.SetContext(s.ctx)
+	s.macroEnv = object.NewEnvironment()
+	s.macroEnv.SetContext(s.ctx)
+	s.lastProgram = nil
+	s.lastBytecode = nil
+}
+
+// run 解析并使用当前引擎执行输入
+func (s *session) run(input string) {
+	program, err := module.Parse(input, evaluator.MacroExpander(s.macroEnv))
+	if syntaxErr, ok := err.(*module.SyntaxError); ok {
+		printParseErrors(s.out, syntaxErr.Errors)
+		return
+	}
+	if err != nil {
+		printf(s.out, "Woops! Macro expansion failed, error: %s\n", err)
+		return
+	}
+	s.lastProgram = program
+
+	switch s.engine {
+	case EngineEval:
+		s.print(s.runEval(program, s.ctx, s.io))
+	case EngineBoth:
+		s.runBoth(program)
+	default:
+		s.print(s.runVM(program))
+	}
+}
+
+func (s *session) print(o outcome) {
+	switch {
+	case o.err != "":
+		printf(s.out, "%s\n", o.err)
+	case o.value != nil:
+		printf(s.out, "%s\n", o.value.Inspect())
+	}
+}
+
+// runBoth 差分模式：使用两个引擎分别执行输入，结果、错误或输出不一致时给出提示。
+// 虚拟机引擎先执行并产生全部副作用，解释器引擎重放其读取的输入，输出只用于比较
+func (s *session) runBoth(program *ast.Program) {
+	s.stdout.start()
+	s.stdin.start()
+	vmOutcome := s.runVM(program)
+	vmOut := s.stdout.stop()
+
+	s.evalOut.Reset()
+	s.evalIn.Reset()
+	s.evalIn.Write(s.stdin.stop())
+	evalOutcome := s.runEval(program, s.evalCtx, s.evalIO)
+
+	sameOutput := bytes.Equal(vmOut, s.evalOut.Bytes())
+	if agree(evalOutcome, vmOutcome) && sameOutput {
+		s.print(vmOutcome)
+		return
+	}
+
+	printf(s.out, "!! engines disagree\n")
+	printf(s.out, "   eval: %s\n", evalOutcome)
+	printf(s.out, "   vm:   %s\n", vmOutcome)
+	if !sameOutput {
+		printf(s.out, "   eval output: %q\n", s.evalOut.String())
+		printf(s.out, "   vm output:   %q\n", vmOut)
+	}
+}
+
+func (s *session) runVM(program *ast.Program) outcome {
+	comp := compiler.NewWithState(s.symbolTable, s.constants)
+	comp.SetLoader(s.newLoader(s.io))
+	err := comp.Compile(program)
+	if err != nil {
+		return outcome{err: "Woops! Compilation failed, error: " + err.Error()}
+	}
+	for _, w := range comp.Warnings() {
+		printf(s.out, "warning: %s\n", w)
+	}
+
+	code := comp.Bytecode()
+	s.constants = code.Constants
+	s.lastBytecode = code
+
+	machine := vm.NewVmWithGlobalsStore(code, s.globals)
+	machine.SetContext(s.ctx)
+	err = machine.Run()
+	if err != nil {
+		return outcome{err: "Woops! Executing bytecode failed, error: " + err.Error()}
+	}
+
+	// 只有最后一条语句是表达式语句时才有结果，否则栈上弹出的是let等语句的残留值
+	if !endsWithExpression(program) {
+		return outcome{}
+	}
+	return outcome{value: machine.LastPoppedStackElem()}
+}
+
+// runEval 使用解释器引擎执行，脚本的输入输出使用ctx，import "io"时使用ioModule
+func (s *session) runEval(program *ast.Program, ctx *object.Context, ioModule *object.Module) outcome {
+	// 与编译器一致，先给出警告并报告名称错误。差分模式中警告已由虚拟机引擎给出
+	warnings, err := evaluator.Check(program, s.env)
+	if s.engine == EngineEval {
+		for _, w := range warnings {
+			printf(s.out, "warning: %s\n", w)
+		}
+	}
+	if err != nil {
+		return outcome{err: (&object.Error{Message: err.Error()}).Inspect()}
+	}
+
+	s.env.SetContext(ctx)
+	s.env.SetLoader(s.newLoader(ioModule))
+	evaluated := evaluator.Eval(program, s.env)
+	if errObj, ok := evaluated.(*object.Error); ok {
+		return outcome{err: errObj.Inspect()}
+	}
+	return outcome{value: evaluated}
+}
+
+// newLoader 创建按io模块的权限检查模块文件的加载器，每次执行都重新读取模块文件，io模块则在整个会话中共享
+func (s *session) newLoader(ioModule *object.Module) *module.Loader {
+	l := evaluator.NewLoader()
+	l.Caps = s.caps
+	if ioModule != nil {
+		l.Register(ioModule)
+	}
+	return l
+}
+
+func endsWithExpression(program *ast.Program) bool {
+	if len(program.Statements) == 0 {
+		return false
+	}
+	_, ok := program.Statements[len(program.Statements)-1].(*ast.ExpressionStatement)
+	return ok
+}
+
+// recorder 包装脚本的输出或输入，开始记录后保存写入或读取的内容
+type recorder struct {
+	w         io.Writer
+	r         io.Reader
+	recording bool
+	record    []byte
+}
+
+// start 开始记录
+func (r *recorder) start() {
+	if r == nil {
+		return
+	}
+	r.recording = true
+	r.record = r.record[:0]
+}
+
+// stop 停止记录，返回记录的内容
+func (r *recorder) stop() []byte {
+	if r == nil {
+		return nil
+	}
+	r.recording = false
+	return r.record
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	n, err := r.w.Write(p)
+	if r.recording {
+		r.record = append(r.record, p[:n]...)
+	}
+	return n, err
+}
+
+func (r *recorder) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if r.recording {
+		r.record = append(r.record, p[:n]...)
+	}
+	return n, err
+}
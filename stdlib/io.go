@@ -0,0 +1,249 @@
+package stdlib
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nicolerobin/monkey/object"
+)
+
+// Capabilities 宿主授予io模块的权限，零值不授予任何权限，嵌入的脚本因此默认处于沙箱中
+type Capabilities struct {
+	Dirs     []string  // 允许访问的目录及其子目录，为空时禁止访问任何文件
+	ReadOnly bool      // 只允许读取，禁止write_file
+	Stdin    io.Reader // read_line读取的输入，为nil时禁止读取输入
+	Stdout   io.Writer // print写入的输出，为nil时禁止输出
+	// DiscardWrites write_file照常检查权限，但丢弃写入的内容，不修改任何文件。
+	// 用于再次执行已经执行过的脚本，例如REPL差分模式中的第二个引擎
+	DiscardWrites bool
+}
+
+// ioModule io模块的状态
+type ioModule struct {
+	caps  Capabilities
+	dirs  []string      // 解析符号链接后的允许访问的目录
+	stdin *bufio.Reader // 多次read_line之间共享缓冲区
+}
+
+// NewIO 创建按caps授权的io模块，导出read_file、write_file、read_line、list_dir和print
+func NewIO(caps Capabilities) *object.Module {
+	m := &ioModule{caps: caps, dirs: realDirs(caps.Dirs)}
+	if caps.Stdin != nil {
+		m.stdin = bufio.NewReader(caps.Stdin)
+	}
+
+	return &object.Module{
+		Name: "io",
+		Exports: map[string]object.Object{
+			"read_file":  &object.Builtin{Fn: m.readFile},
+			"write_file": &object.Builtin{Fn: m.writeFile},
+			"read_line":  &object.Builtin{Fn: m.readLine},
+			"list_dir":   &object.Builtin{Fn: m.listDir},
+			"print":      &object.Builtin{Fn: m.print},
+		},
+	}
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+// stringArguments 检查参数个数为want且都是字符串，返回字符串的值
+func stringArguments(name string, want int, args []object.Object) ([]string, *object.Error) {
+	if len(args) != want {
+		return nil, newError("wrong number of arguments. got=%d, want=%d",
+			len(args), want)
+	}
+
+	values := make([]string, len(args))
+	for i, arg := range args {
+		str, ok := arg.(*object.String)
+		if !ok {
+			return nil, newError("argument to `%s` must be STRING, got %s",
+				name, arg.Type())
+		}
+		values[i] = str.Value
+	}
+	return values, nil
+}
+
+// realDirs 返回允许访问的目录解析符号链接后的绝对路径
+func realDirs(dirs []string) []string {
+	reals := []string{}
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			continue
+		}
+		real, err := filepath.EvalSymlinks(abs)
+		if err != nil {
+			real = abs
+		}
+		reals = append(reals, real)
+	}
+	return reals
+}
+
+// Check 按照与io模块相同的规则检查是否允许访问path，write为true时检查写入权限，返回解析符号链接后的绝对路径。
+// 宿主在读取脚本文件之前用它检查权限，例如加载import的模块和REPL的:load
+func (c Capabilities) Check(path string, write bool) (string, error) {
+	m := &ioModule{caps: c, dirs: realDirs(c.Dirs)}
+	return m.check(path, write)
+}
+
+// check 检查path位于允许访问的目录之内，返回解析符号链接后的绝对路径。
+// 调用方打开的是检查过的路径，之后修改路径中的符号链接也无法指向允许访问的目录之外
+func (m *ioModule) check(path string, write bool) (string, error) {
+	if write && m.caps.ReadOnly {
+		return "", fmt.Errorf("permission denied: %s is read-only", path)
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	real, err := realPath(abs)
+	if err != nil {
+		return "", err
+	}
+
+	for _, dir := range m.dirs {
+		if within(real, dir) {
+			return real, nil
+		}
+	}
+	return "", fmt.Errorf("permission denied: %s is outside the allowed directories", path)
+}
+
+// realPath 解析路径中的符号链接，路径不存在时解析其父目录，以便检查将要新建的文件
+func realPath(path string) (string, error) {
+	real, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		return real, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	if _, err := os.Lstat(path); err == nil {
+		// 指向不存在目标的符号链接，无法确定写入的位置
+		return "", fmt.Errorf("cannot resolve symbolic link %s", path)
+	}
+
+	dir, err := realPath(filepath.Dir(path))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filepath.Base(path)), nil
+}
+
+// within 判断path是否为dir或位于dir之下
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (m *ioModule) readFile(_ object.Caller, args ...object.Object) object.Object {
+	values, errObj := stringArguments("read_file", 1, args)
+	if errObj != nil {
+		return errObj
+	}
+
+	path, err := m.check(values[0], false)
+	if err != nil {
+		return newError("read_file: %s", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return newError("read_file: %s", err)
+	}
+	return &object.String{Value: string(data)}
+}
+
+// writeFile 将内容写入文件，文件不存在时创建，存在时覆盖
+func (m *ioModule) writeFile(_ object.Caller, args ...object.Object) object.Object {
+	values, errObj := stringArguments("write_file", 2, args)
+	if errObj != nil {
+		return errObj
+	}
+
+	path, err := m.check(values[0], true)
+	if err != nil {
+		return newError("write_file: %s", err)
+	}
+	if m.caps.DiscardWrites {
+		return object.NULL
+	}
+	err = os.WriteFile(path, []byte(values[1]), 0644)
+	if err != nil {
+		return newError("write_file: %s", err)
+	}
+	return object.NULL
+}
+
+// readLine 读取一行输入，不包含行尾的换行符，输入结束时返回null
+func (m *ioModule) readLine(_ object.Caller, args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+	if m.stdin == nil {
+		return newError("read_line: permission denied: no input granted")
+	}
+
+	line, err := m.stdin.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return object.NULL
+	}
+	if err != nil && err != io.EOF {
+		return newError("read_line: %s", err)
+	}
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return &object.String{Value: line}
+}
+
+// listDir 返回目录下的文件名，按字典序排列
+func (m *ioModule) listDir(_ object.Caller, args ...object.Object) object.Object {
+	values, errObj := stringArguments("list_dir", 1, args)
+	if errObj != nil {
+		return errObj
+	}
+
+	path, err := m.check(values[0], false)
+	if err != nil {
+		return newError("list_dir: %s", err)
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return newError("list_dir: %s", err)
+	}
+
+	names := make([]object.Object, len(entries))
+	for i, entry := range entries {
+		names[i] = &object.String{Value: entry.Name()}
+	}
+	return object.NewArray(names)
+}
+
+// print 将参数以空格分隔写成一行
+func (m *ioModule) print(_ object.Caller, args ...object.Object) object.Object {
+	if m.caps.Stdout == nil {
+		return newError("print: permission denied: no output granted")
+	}
+
+	values := make([]string, len(args))
+	for i, arg := range args {
+		values[i] = arg.Inspect()
+	}
+	_, err := fmt.Fprintln(m.caps.Stdout, strings.Join(values, " "))
+	if err != nil {
+		return newError("print: %s", err)
+	}
+	return object.NULL
+}
@@ -0,0 +1,205 @@
+package stdlib
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nicolerobin/monkey/object"
+)
+
+func call(m *object.Module, name string, args ...object.Object) object.Object {
+	return m.Exports[name].(*object.Builtin).Fn(nil, args...)
+}
+
+func str(s string) object.Object {
+	return &object.String{Value: s}
+}
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0644)
+	if err != nil {
+		t.Fatalf("os.WriteFile() failed, error:%s", err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatalf("os.Mkdir() failed, error:%s", err)
+	}
+	m := NewIO(Capabilities{Dirs: []string{dir}})
+
+	result := call(m, "read_file", str(filepath.Join(dir, "a.txt")))
+	if result.Inspect() != "hello" {
+		t.Errorf("read_file wrong. got=%s", result.Inspect())
+	}
+
+	path := filepath.Join(dir, "sub", "b.txt")
+	if result := call(m, "write_file", str(path), str("world")); result != object.NULL {
+		t.Fatalf("write_file failed. got=%s", result.Inspect())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "world" {
+		t.Errorf("file content wrong. got=%q, error:%v", data, err)
+	}
+
+	result = call(m, "list_dir", str(dir))
+	if result.Inspect() != "[a.txt, sub]" {
+		t.Errorf("list_dir wrong. got=%s", result.Inspect())
+	}
+
+	// 丢弃写入时照常检查权限，但不修改文件
+	discard := NewIO(Capabilities{Dirs: []string{dir}, DiscardWrites: true})
+	if result := call(discard, "write_file", str(path), str("again")); result != object.NULL {
+		t.Fatalf("write_file failed. got=%s", result.Inspect())
+	}
+	if data, _ := os.ReadFile(path); string(data) != "world" {
+		t.Errorf("write_file was not discarded. got=%q", data)
+	}
+	if _, ok := call(discard, "write_file", str(filepath.Join(dir, "..", "c.txt")), str("x")).(*object.Error); !ok {
+		t.Errorf("write_file outside the allowed directories was not rejected")
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	dir := t.TempDir()
+	allowed := filepath.Join(dir, "allowed")
+	outside := filepath.Join(dir, "outside")
+	for _, d := range []string{allowed, outside} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatalf("os.Mkdir() failed, error:%s", err)
+		}
+	}
+	secret := filepath.Join(outside, "secret.txt")
+	if err := os.WriteFile(secret, []byte("secret"), 0644); err != nil {
+		t.Fatalf("os.WriteFile() failed, error:%s", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(allowed, "link")); err != nil {
+		t.Fatalf("os.Symlink() failed, error:%s", err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "new.txt"), filepath.Join(allowed, "dangling")); err != nil {
+		t.Fatalf("os.Symlink() failed, error:%s", err)
+	}
+
+	sandboxed := NewIO(Capabilities{})
+	readOnly := NewIO(Capabilities{Dirs: []string{allowed}, ReadOnly: true})
+	writable := NewIO(Capabilities{Dirs: []string{allowed}})
+
+	tests := []struct {
+		module   *object.Module
+		name     string
+		args     []object.Object
+		expected string
+	}{
+		{sandboxed, "read_file", []object.Object{str(secret)}, "outside the allowed directories"},
+		{sandboxed, "list_dir", []object.Object{str(allowed)}, "outside the allowed directories"},
+		{sandboxed, "read_line", nil, "read_line: permission denied: no input granted"},
+		{sandboxed, "print", []object.Object{str("x")}, "print: permission denied: no output granted"},
+		{writable, "read_file", []object.Object{str(secret)}, "outside the allowed directories"},
+		{writable, "read_file", []object.Object{str(filepath.Join(allowed, "..", "outside", "secret.txt"))},
+			"outside the allowed directories"},
+		{writable, "read_file", []object.Object{str(filepath.Join(allowed, "link", "secret.txt"))},
+			"outside the allowed directories"},
+		{writable, "write_file", []object.Object{str(filepath.Join(allowed, "dangling")), str("x")},
+			"cannot resolve symbolic link"},
+		{writable, "read_file", []object.Object{str(filepath.Join(allowed, "missing.txt"))},
+			"no such file or directory"},
+		{readOnly, "write_file", []object.Object{str(filepath.Join(allowed, "a.txt")), str("x")},
+			"is read-only"},
+		{writable, "read_file", []object.Object{&object.Integer{Value: 1}},
+			"argument to `read_file` must be STRING, got INTEGER"},
+		{writable, "write_file", []object.Object{str("a.txt")}, "wrong number of arguments. got=1, want=2"},
+		{writable, "read_line", []object.Object{str("x")}, "wrong number of arguments. got=1, want=0"},
+	}
+
+	for _, tt := range tests {
+		errObj, ok := call(tt.module, tt.name, tt.args...).(*object.Error)
+		if !ok {
+			t.Errorf("%s(%v) returned no error", tt.name, tt.args)
+			continue
+		}
+		if !strings.Contains(errObj.Message, tt.expected) {
+			t.Errorf("%s wrong error message. expected to contain %q, got=%q",
+				tt.name, tt.expected, errObj.Message)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(outside, "new.txt")); !os.IsNotExist(err) {
+		t.Errorf("write_file escaped the sandbox through a dangling link")
+	}
+}
+
+func TestCheckResolvesSymlinks(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("filepath.EvalSymlinks() failed, error:%s", err)
+	}
+	allowed := filepath.Join(dir, "allowed")
+	outside := filepath.Join(dir, "outside")
+	for _, d := range []string{allowed, outside} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatalf("os.Mkdir() failed, error:%s", err)
+		}
+	}
+	target := filepath.Join(allowed, "a.txt")
+	secret := filepath.Join(outside, "secret.txt")
+	for _, f := range []string{target, secret} {
+		if err := os.WriteFile(f, []byte(filepath.Base(f)), 0644); err != nil {
+			t.Fatalf("os.WriteFile() failed, error:%s", err)
+		}
+	}
+	link := filepath.Join(allowed, "link.txt")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatalf("os.Symlink() failed, error:%s", err)
+	}
+	escape := filepath.Join(allowed, "escape.txt")
+	if err := os.Symlink(secret, escape); err != nil {
+		t.Fatalf("os.Symlink() failed, error:%s", err)
+	}
+
+	m := &ioModule{caps: Capabilities{Dirs: []string{allowed}}, dirs: []string{allowed}}
+
+	// 返回符号链接的目标，之后将链接改为指向允许的目录之外也不影响打开的文件
+	path, err := m.check(link, false)
+	if err != nil || path != target {
+		t.Fatalf("check(%s) wrong. want=%s, got=%s, error:%v", link, target, path, err)
+	}
+	if err := os.Remove(link); err != nil {
+		t.Fatalf("os.Remove() failed, error:%s", err)
+	}
+	if err := os.Symlink(secret, link); err != nil {
+		t.Fatalf("os.Symlink() failed, error:%s", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "a.txt" {
+		t.Errorf("checked path escaped the sandbox. got=%q, error:%v", data, err)
+	}
+
+	if _, err := m.check(escape, false); err == nil || !strings.Contains(err.Error(), "outside the allowed directories") {
+		t.Errorf("check(%s) allowed a link pointing outside, error:%v", escape, err)
+	}
+}
+
+func TestConsole(t *testing.T) {
+	var out bytes.Buffer
+	m := NewIO(Capabilities{
+		Stdin:  strings.NewReader("first\r\nsecond\nlast"),
+		Stdout: &out,
+	})
+
+	for _, expected := range []string{"first", "second", "last"} {
+		result := call(m, "read_line")
+		if result.Inspect() != expected {
+			t.Errorf("read_line wrong. want=%q, got=%q", expected, result.Inspect())
+		}
+	}
+	if result := call(m, "read_line"); result != object.NULL {
+		t.Errorf("read_line at end of input should be null. got=%s", result.Inspect())
+	}
+
+	call(m, "print", str("a"), &object.Integer{Value: 1})
+	call(m, "print")
+	if out.String() != "a 1\n\n" {
+		t.Errorf("print output wrong. got=%q", out.String())
+	}
+}
@@ -0,0 +1,5 @@
+let squares = map(range(500), fn(x) { x * x });
+let evens = filter(squares, fn(x) { x / 2 * 2 == x });
+let sorted = sort(evens, fn(a, b) { b - a });
+let pairs = zip(sorted, reverse(sorted));
+reduce(flatten(pairs), 0, fn(acc, x) { acc + x }) + len(unique(map(squares, fn(x) { x / 100 })));
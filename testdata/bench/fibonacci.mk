@@ -0,0 +1,8 @@
+let fibonacci = fn(n) {
+    if (n < 2) {
+        n
+    } else {
+        fibonacci(n - 1) + fibonacci(n - 2)
+    }
+};
+fibonacci(20);
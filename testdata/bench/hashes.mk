@@ -0,0 +1,3 @@
+let table = reduce(range(300), {}, fn(acc, x) { merge(acc, {x: x * 2, "last": x}) });
+let trimmed = reduce(range(100), table, fn(acc, x) { delete(acc, x * 3) });
+reduce(keys(trimmed), 0, fn(acc, k) { if (k == "last") { acc } else { acc + trimmed[k] } });
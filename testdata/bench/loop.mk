@@ -0,0 +1,8 @@
+let sum = fn(i, acc) {
+    if (i == 0) {
+        acc
+    } else {
+        sum(i - 1, acc + i * 2)
+    }
+};
+reduce(range(100), 0, fn(acc, x) { acc + sum(200, x) });
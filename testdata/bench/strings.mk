@@ -0,0 +1,3 @@
+let words = ["ab", "cde", "f"];
+let joined = reduce(range(1000), "", fn(acc, x) { acc + words[x - x / 3 * 3] });
+len(joined) + len(reverse(joined));
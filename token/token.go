@@ -29,6 +29,9 @@ const (
 	COMMA     = ","
 	SEMICOLON = ";"
 	COLON     = ":"
+	DOT       = "."
+	ELLIPSIS  = "..."
+	ARROW     = "=>"
 
 	LPAREN   = "("
 	RPAREN   = ")"
@@ -40,28 +43,41 @@ const (
 	// keywords
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
+	CONST    = "const"
 	TRUE     = "true"
 	FALSE    = "false"
 	IF       = "if"
 	ELSE     = "else"
 	RETURN   = "return"
+	IMPORT   = "import"
+	AS       = "as"
+	EXPORT   = "export"
+	MACRO    = "MACRO"
+	MATCH    = "match"
 )
 
 type Token struct {
 	Type       TokenType
 	Literal    string
 	SourceFile string
-	LineNo     int
+	LineNo     int // 词法单元起始位置所在行，从1开始
+	Column     int // 词法单元起始位置所在列（字节偏移），从1开始
 }
 
 var keywords = map[string]TokenType{
 	"fn":     FUNCTION,
 	"let":    LET,
+	"const":  CONST,
 	"true":   TRUE,
 	"false":  FALSE,
 	"if":     IF,
 	"else":   ELSE,
 	"return": RETURN,
+	"import": IMPORT,
+	"as":     AS,
+	"export": EXPORT,
+	"macro":  MACRO,
+	"match":  MATCH,
 }
 
 func LookupIdent(ident string) TokenType {
@@ -0,0 +1,100 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/nicolerobin/monkey/compiler"
+	"github.com/nicolerobin/monkey/evaluator"
+	"github.com/nicolerobin/monkey/internal/benchcorpus"
+	"github.com/nicolerobin/monkey/object"
+)
+
+func BenchmarkRun(b *testing.B) {
+	for _, bench := range benchcorpus.Load(b) {
+		comp := compiler.NewCompiler()
+		if err := comp.Compile(parse(bench.Input)); err != nil {
+			b.Fatalf("comp.Compile() failed, error: %s", err)
+		}
+		bytecode := comp.Bytecode()
+
+		b.Run(bench.Name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := NewVm(bytecode).Run(); err != nil {
+					b.Fatalf("vm.Run() failed, error: %s", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkOptimize 对比编译器生成超级指令前后虚拟机的执行速度
+func BenchmarkOptimize(b *testing.B) {
+	for _, bench := range benchcorpus.Load(b) {
+		program := parse(bench.Input)
+
+		for _, optimize := range []bool{false, true} {
+			comp := compiler.NewCompiler()
+			comp.SetOptimize(optimize)
+			if err := comp.Compile(program); err != nil {
+				b.Fatalf("comp.Compile() failed, error: %s", err)
+			}
+			bytecode := comp.Bytecode()
+
+			name := bench.Name + "/plain"
+			if optimize {
+				name = bench.Name + "/optimized"
+			}
+			b.Run(name, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if err := NewVm(bytecode).Run(); err != nil {
+						b.Fatalf("vm.Run() failed, error: %s", err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkEngines 在同一组程序上对比解释器和虚拟机，虚拟机的耗时包括编译
+func BenchmarkEngines(b *testing.B) {
+	for _, bench := range benchcorpus.Load(b) {
+		program := parse(bench.Input)
+
+		b.Run(bench.Name+"/eval", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				result := evaluator.Eval(program, object.NewEnvironment())
+				if errObj, ok := result.(*object.Error); ok {
+					b.Fatalf("evaluator.Eval() failed, error: %s", errObj.Message)
+				}
+			}
+		})
+
+		b.Run(bench.Name+"/vm", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				comp := compiler.NewCompiler()
+				if err := comp.Compile(program); err != nil {
+					b.Fatalf("comp.Compile() failed, error: %s", err)
+				}
+				if err := NewVm(comp.Bytecode()).Run(); err != nil {
+					b.Fatalf("vm.Run() failed, error: %s", err)
+				}
+			}
+		})
+	}
+}
+
+// TestBenchmarkPrograms 确保基准测试程序在两个引擎上都能运行且结果一致
+func TestBenchmarkPrograms(t *testing.T) {
+	for _, bench := range benchcorpus.Load(t) {
+		evaluated := evaluator.Eval(parse(bench.Input), object.NewEnvironment())
+		if evaluated.Type() == object.ERROR_OBJ {
+			t.Errorf("%s: evaluator.Eval() failed, error: %s", bench.Name, evaluated.Inspect())
+			continue
+		}
+		runBothEngines(t, bench.Input)
+	}
+}
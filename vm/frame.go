@@ -8,6 +8,7 @@ import (
 // Frame 栈帧，保存与函数执行相关信息的数据结构
 type Frame struct {
 	fn          *object.CompiledFunction // 栈帧引用的已编译函数
+	closure     *object.Closure          // 栈帧执行的闭包，函数没有自由变量时为nil
 	ip          int                      // 栈帧的指令指针
 	basePointer int                      // 栈指针
 }
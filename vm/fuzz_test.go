@@ -0,0 +1,156 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/nicolerobin/monkey/compiler"
+	"github.com/nicolerobin/monkey/evaluator"
+	"github.com/nicolerobin/monkey/lexer"
+	"github.com/nicolerobin/monkey/object"
+	"github.com/nicolerobin/monkey/parser"
+)
+
+// runBothEngines 分别使用解释器和虚拟机执行程序，两者都出错或者结果的Inspect()相同时视为一致
+func runBothEngines(t *testing.T, input string) {
+	t.Helper()
+
+	p := parser.NewParser(lexer.NewLexer(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("generated program does not parse, input:\n%s\nerrors: %v", input, p.Errors())
+	}
+
+	evaluated := evaluator.Eval(program, object.NewEnvironment())
+	evalErr, evalFailed := evaluated.(*object.Error)
+
+	comp := compiler.NewCompiler()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("comp.Compile() failed, input:\n%s\nerror: %s", input, err)
+	}
+	vm := NewVm(comp.Bytecode())
+	err = vm.Run()
+
+	switch {
+	case evalFailed && err != nil:
+		return
+	case evalFailed:
+		t.Fatalf("engines disagree, input:\n%s\neval: %s\nvm: %s",
+			input, evalErr.Message, vm.LastPoppedStackElem().Inspect())
+	case err != nil:
+		t.Fatalf("engines disagree, input:\n%s\neval: %s\nvm: %s",
+			input, evaluated.Inspect(), err)
+	}
+
+	result := vm.LastPoppedStackElem()
+	if evaluated.Type() != result.Type() || evaluated.Inspect() != result.Inspect() {
+		t.Fatalf("engines disagree, input:\n%s\neval: %s %s\nvm: %s %s",
+			input, evaluated.Type(), evaluated.Inspect(), result.Type(), result.Inspect())
+	}
+}
+
+// TestComparisonEnginesAgree 对各种类型的值两两使用全部比较运算符，要求两个引擎的结果一致
+func TestComparisonEnginesAgree(t *testing.T) {
+	values := []struct {
+		input      string
+		structural bool // 分别求值两次得到的对象是否相等
+	}{
+		{"1", true},
+		{"-1", true},
+		{"2", true},
+		{"true", true},
+		{"false", true},
+		{`""`, true},
+		{`"a"`, true},
+		{`"b"`, true},
+		{"if (false) { 1 }", true},
+		{"[]", true},
+		{"[1]", true},
+		{"[1, 2]", true},
+		{"[1, 3]", true},
+		{`["a", [true]]`, true},
+		{"[fn(x) { x }]", false},
+		{"{}", true},
+		{"{1: 2}", true},
+		{"{1: 3}", true},
+		{`{"a": [1], [2]: "b"}`, true},
+		{"fn(x) { x }", false},
+		{"len", true},
+	}
+
+	for i, a := range values {
+		for j, b := range values {
+			for _, op := range []string{"==", "!=", "<", ">"} {
+				input := "let a = " + a.input + "; let b = " + b.input + "; a " + op + " b"
+				runBothEngines(t, input)
+			}
+
+			expected := i == j && a.structural
+			input := "let a = " + a.input + "; let b = " + b.input + "; a == b"
+			evaluated := evaluator.Eval(parse(input), object.NewEnvironment())
+			if evaluated != nativeBoolToBooleanObject(expected) {
+				t.Errorf("%s: expected %t, got %s", input, expected, evaluated.Inspect())
+			}
+
+			less := evaluator.Eval(parse("let a = "+a.input+"; let b = "+b.input+"; a < b"), object.NewEnvironment())
+			greater := evaluator.Eval(parse("let a = "+a.input+"; let b = "+b.input+"; b > a"), object.NewEnvironment())
+			if less.Type() != greater.Type() || (less.Type() != object.ERROR_OBJ && less != greater) {
+				t.Errorf("a=%s, b=%s: a < b is %s but b > a is %s", a.input, b.input, less.Inspect(), greater.Inspect())
+			}
+		}
+	}
+}
+
+// TestHigherOrderEnginesAgree 内置函数回调Monkey函数时两个引擎的结果一致
+func TestHigherOrderEnginesAgree(t *testing.T) {
+	inputs := []string{
+		`map([1, 2, 3], fn(x) { x * x })`,
+		`filter(range(10), fn(x) { x > 6 })`,
+		`reduce(range(5), [], fn(acc, x) { push(acc, x * 2) })`,
+		`sort([[2, "b"], [1, "c"], [2, "a"]])`,
+		`sort(range(6), fn(a, b) { (a - b) * (0 - 1) })`,
+		`map(zip(["a", "b"], [1, 2]), fn(pair) { pair[0] + "=" })`,
+		`unique(flatten([[1, 2], [2, 3], [[1]], [[1]]]))`,
+		`reverse(map(range(3), fn(x) { map(range(x), fn(y) { y }) }))`,
+		`let count = fn(xs) { reduce(xs, 0, fn(n, x) { n + 1 }) }; map([[1], [], [1, 2]], count)`,
+		`each([1], fn(x) { x })`,
+		`map([1], fn(x) { x + "a" })`,
+		`sort([1, fn(x) { x }])`,
+		`map([fn(x) { x + 1 }, fn(x) { x * 10 }], fn(f) { f(5) })`,
+		`map([1, 2], first)`,
+	}
+
+	for _, input := range inputs {
+		runBothEngines(t, input)
+	}
+}
+
+// TestClosureEnginesAgree 闭包与具名函数声明在两个引擎中的结果一致
+func TestClosureEnginesAgree(t *testing.T) {
+	inputs := []string{
+		`let adders = map([1, 2], fn(a) { fn(b) { a + b } }); map(adders, fn(f) { f(10) })`,
+		`let f = fn(a) { let b = a * 2; fn() { fn() { [a, b] } } }; f(3)()()`,
+		`fn fib(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } } map(range(8), fib)`,
+		`let f = fn(k) { fn even(n) { if (n == 0) { k } else { odd(n - 1) } } fn odd(n) { if (n == 0) { 0 - k } else { even(n - 1) } } [even(4), odd(4)] }; f(9)`,
+		`let f = fn(h) { fn g(x) { x + h } g }; f(1)(2)`,
+	}
+
+	for _, input := range inputs {
+		runBothEngines(t, input)
+	}
+}
+
+func TestEnginesAgree(t *testing.T) {
+	for seed := int64(0); seed < 500; seed++ {
+		runBothEngines(t, newGenerator(seed).program())
+	}
+}
+
+func FuzzEngines(f *testing.F) {
+	f.Add(int64(1))
+	f.Add(int64(42))
+
+	f.Fuzz(func(t *testing.T, seed int64) {
+		runBothEngines(t, newGenerator(seed).program())
+	})
+}
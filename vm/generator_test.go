@@ -0,0 +1,204 @@
+package vm
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// kind 随机程序生成器中表达式的静态类型
+type kind int
+
+const (
+	kindInt kind = iota
+	kindBool
+	kindString
+	kindArray
+	numKinds
+)
+
+// genFunction 已生成的全局函数签名
+type genFunction struct {
+	name   string
+	params []kind
+	result kind
+}
+
+// generator 按类型生成随机Monkey程序，生成的程序只使用两个引擎都支持的语言子集：
+// 函数只定义在顶层且不引用外层局部变量，函数体和if分支都以表达式结束，除法的除数是非零常量
+type generator struct {
+	r *rand.Rand
+
+	globals   map[kind][]string
+	locals    map[kind][]string
+	functions []genFunction
+	numNames  int
+}
+
+func newGenerator(seed int64) *generator {
+	return &generator{
+		r:       rand.New(rand.NewSource(seed)),
+		globals: make(map[kind][]string),
+	}
+}
+
+// program 生成若干全局let语句和函数定义，最后以一个表达式语句结束
+func (g *generator) program() string {
+	var out strings.Builder
+
+	for i := g.r.Intn(6); i > 0; i-- {
+		if g.r.Intn(3) == 0 {
+			out.WriteString(g.function())
+		} else {
+			k := kind(g.r.Intn(int(numKinds)))
+			value := g.expression(k, 3)
+			name := g.newName("g")
+			g.globals[k] = append(g.globals[k], name)
+			fmt.Fprintf(&out, "let %s = %s;\n", name, value)
+		}
+	}
+
+	out.WriteString(g.expression(kind(g.r.Intn(int(numKinds))), 4))
+	return out.String()
+}
+
+func (g *generator) function() string {
+	fn := genFunction{name: g.newName("f"), result: kind(g.r.Intn(int(numKinds)))}
+
+	g.locals = make(map[kind][]string)
+	params := []string{}
+	for i := g.r.Intn(4); i > 0; i-- {
+		k := kind(g.r.Intn(int(numKinds)))
+		name := g.newName("p")
+		fn.params = append(fn.params, k)
+		params = append(params, name)
+		g.locals[k] = append(g.locals[k], name)
+	}
+
+	var body strings.Builder
+	for i := g.r.Intn(3); i > 0; i-- {
+		k := kind(g.r.Intn(int(numKinds)))
+		value := g.expression(k, 2)
+		name := g.newName("l")
+		g.locals[k] = append(g.locals[k], name)
+		fmt.Fprintf(&body, "let %s = %s; ", name, value)
+	}
+	if g.r.Intn(3) == 0 {
+		fmt.Fprintf(&body, "if (%s) { return %s; }; ",
+			g.expression(kindBool, 2), g.expression(fn.result, 2))
+	}
+	body.WriteString(g.expression(fn.result, 3))
+	g.locals = nil
+
+	g.functions = append(g.functions, fn)
+	return fmt.Sprintf("let %s = fn(%s) { %s };\n", fn.name, strings.Join(params, ", "), body.String())
+}
+
+// newName 生成新的变量名，标识符中不能包含数字，因此编号以大写字母表示，同时避免与关键字冲突
+func (g *generator) newName(prefix string) string {
+	g.numNames++
+
+	name := []byte(prefix)
+	for n := g.numNames; n > 0; n /= 26 {
+		name = append(name, byte('A'+n%26))
+	}
+	return string(name)
+}
+
+// expression 生成类型为k的表达式，depth限制表达式的嵌套深度
+func (g *generator) expression(k kind, depth int) string {
+	if depth <= 0 || g.r.Intn(4) == 0 {
+		return g.leaf(k)
+	}
+	depth--
+
+	switch g.r.Intn(4) {
+	case 0:
+		if call, ok := g.call(k, depth); ok {
+			return call
+		}
+	case 1:
+		return fmt.Sprintf("if (%s) { %s } else { %s }",
+			g.expression(kindBool, depth), g.expression(k, depth), g.expression(k, depth))
+	}
+
+	switch k {
+	case kindInt:
+		switch g.r.Intn(6) {
+		case 0:
+			return fmt.Sprintf("(-%s)", g.expression(kindInt, depth))
+		case 1:
+			return fmt.Sprintf("(%s / %d)", g.expression(kindInt, depth), g.r.Intn(9)+1)
+		case 2:
+			return fmt.Sprintf("%s[%s]", g.expression(kindArray, depth), g.expression(kindInt, depth))
+		default:
+			op := []string{"+", "-", "*"}[g.r.Intn(3)]
+			return fmt.Sprintf("(%s %s %s)", g.expression(kindInt, depth), op, g.expression(kindInt, depth))
+		}
+	case kindBool:
+		switch g.r.Intn(4) {
+		case 0:
+			return fmt.Sprintf("(!%s)", g.expression(kind(g.r.Intn(int(numKinds))), depth))
+		case 1:
+			op := []string{"==", "!="}[g.r.Intn(2)]
+			return fmt.Sprintf("(%s %s %s)", g.expression(kindBool, depth), op, g.expression(kindBool, depth))
+		default:
+			op := []string{"<", ">", "==", "!="}[g.r.Intn(4)]
+			return fmt.Sprintf("(%s %s %s)", g.expression(kindInt, depth), op, g.expression(kindInt, depth))
+		}
+	case kindString:
+		return fmt.Sprintf("(%s + %s)", g.expression(kindString, depth), g.expression(kindString, depth))
+	default:
+		elements := []string{}
+		for i := g.r.Intn(4); i > 0; i-- {
+			elements = append(elements, g.expression(kindInt, depth))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	}
+}
+
+// leaf 生成类型为k的字面量或变量引用
+func (g *generator) leaf(k kind) string {
+	names := append(append([]string{}, g.locals[k]...), g.globals[k]...)
+	if len(names) > 0 && g.r.Intn(2) == 0 {
+		return names[g.r.Intn(len(names))]
+	}
+
+	switch k {
+	case kindInt:
+		if g.r.Intn(10) == 0 {
+			return fmt.Sprintf("%d", g.r.Int63())
+		}
+		return fmt.Sprintf("%d", g.r.Intn(100))
+	case kindBool:
+		return []string{"true", "false"}[g.r.Intn(2)]
+	case kindString:
+		return fmt.Sprintf("%q", []string{"", "a", "monkey", "hello world"}[g.r.Intn(4)])
+	default:
+		elements := []string{}
+		for i := g.r.Intn(4); i > 0; i-- {
+			elements = append(elements, fmt.Sprintf("%d", g.r.Intn(10)))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	}
+}
+
+// call 生成对已定义的、返回类型为k的函数的调用
+func (g *generator) call(k kind, depth int) (string, bool) {
+	candidates := []genFunction{}
+	for _, fn := range g.functions {
+		if fn.result == k {
+			candidates = append(candidates, fn)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", false
+	}
+
+	fn := candidates[g.r.Intn(len(candidates))]
+	args := []string{}
+	for _, param := range fn.params {
+		args = append(args, g.expression(param, depth))
+	}
+	return fmt.Sprintf("%s(%s)", fn.name, strings.Join(args, ", ")), true
+}
@@ -0,0 +1,99 @@
+package vm
+
+import "github.com/nicolerobin/monkey/object"
+
+type valueKind uint8
+
+const (
+	objectKind valueKind = iota
+	integerKind
+	booleanKind
+	nullKind
+)
+
+// value 虚拟机内部的值表示，整数、布尔值和null直接保存在结构体中，不需要在堆上分配，
+// 其余类型保存对应的object.Object。只在与外部交互(内置函数、常量、结果)时与object.Object互相转换
+type value struct {
+	kind valueKind
+	num  int64         // 整数的值，布尔值时1表示true
+	obj  object.Object // objectKind时的对象，零值的obj为nil
+}
+
+var (
+	trueValue  = value{kind: booleanKind, num: 1}
+	falseValue = value{kind: booleanKind}
+	nullValue  = value{kind: nullKind}
+)
+
+func integerValue(i int64) value {
+	return value{kind: integerKind, num: i}
+}
+
+func booleanValue(b bool) value {
+	if b {
+		return trueValue
+	}
+	return falseValue
+}
+
+// fromObject 将对象转换为虚拟机内部的值
+func fromObject(obj object.Object) value {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return integerValue(obj.Value)
+	case *object.Boolean:
+		return booleanValue(obj.Value)
+	case *object.Null:
+		return nullValue
+	default:
+		return value{obj: obj}
+	}
+}
+
+// Object 将值转换为对象，整数每次转换都会分配新的object.Integer
+func (v value) Object() object.Object {
+	switch v.kind {
+	case integerKind:
+		return &object.Integer{Value: v.num}
+	case booleanKind:
+		return nativeBoolToBooleanObject(v.num != 0)
+	case nullKind:
+		return Null
+	default:
+		return v.obj
+	}
+}
+
+// Type 返回值对应的对象类型
+func (v value) Type() object.ObjectType {
+	switch v.kind {
+	case integerKind:
+		return object.INTEGER_OBJ
+	case booleanKind:
+		return object.BOOLEAN_OBJ
+	case nullKind:
+		return object.NULL_OBJ
+	default:
+		return v.obj.Type()
+	}
+}
+
+func (v value) isTruthy() bool {
+	switch v.kind {
+	case booleanKind:
+		return v.num != 0
+	case nullKind:
+		return false
+	default:
+		return true
+	}
+}
+
+// toObjects 将栈上的一段值转换为对象切片
+func toObjects(values []value) []object.Object {
+	objects := make([]object.Object, len(values))
+	for i, v := range values {
+		objects[i] = v.Object()
+	}
+	return objects
+}
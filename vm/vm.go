@@ -14,84 +14,151 @@ const (
 )
 
 var (
-	True  = &object.Boolean{Value: true}
-	False = &object.Boolean{Value: false}
-	Null  = &object.Null{}
+	True  = object.TRUE
+	False = object.FALSE
+	Null  = object.NULL
 )
 
 type VM struct {
-	constants []object.Object // 常量池
+	constants []value // 常量池
 
-	stack []object.Object // 栈
-	sp    int             // 始终指向栈中的下一个空闲槽，栈顶的值是stack[sp-1]
+	stack []value // 栈
+	sp    int     // 始终指向栈中的下一个空闲槽，栈顶的值是stack[sp-1]
 
-	globals []object.Object // 存储全局变量
+	globals *Globals // 存储全局变量
 
-	frames     []*Frame // 用于保存帧的栈
-	frameIndex int      //
+	frames     []Frame // 用于保存帧的栈，按值保存以免每次调用都分配新的栈帧
+	frameIndex int     //
+
+	ctx *object.Context // 执行上下文，交给内置函数使用
+}
+
+// Globals 全局变量存储，按需增长。REPL在多次运行之间共享同一个Globals以保留全局变量
+type Globals struct {
+	values []value
+}
+
+// NewGlobals 创建空的全局变量存储
+func NewGlobals() *Globals {
+	return &Globals{}
+}
+
+// Get 返回下标为index的全局变量，尚未赋值时返回nil
+func (g *Globals) Get(index int) object.Object {
+	if !g.assigned(index) {
+		return nil
+	}
+	return g.values[index].Object()
+}
+
+// get 返回下标为index的全局变量，尚未赋值时返回null。
+// REPL中定义语句求值失败后，之后的输入仍可以引用该名称，此时得到null而不是零值
+func (g *Globals) get(index int) value {
+	if !g.assigned(index) {
+		return nullValue
+	}
+	return g.values[index]
+}
+
+// assigned 判断下标为index的全局变量是否已经赋值，未赋值的位置为value的零值
+func (g *Globals) assigned(index int) bool {
+	return index < len(g.values) && (g.values[index].kind != objectKind || g.values[index].obj != nil)
+}
+
+func (g *Globals) set(index int, v value) {
+	if index >= len(g.values) {
+		values := make([]value, index+1, 2*index+1)
+		copy(values, g.values)
+		g.values = values
+	}
+	g.values[index] = v
 }
 
 func NewVm(bytecode *compiler.Bytecode) *VM {
 	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
-	mainFrame := NewFrame(mainFn, 0)
 
-	frames := make([]*Frame, MaxFrame)
-	frames[0] = mainFrame
+	frames := make([]Frame, MaxFrame)
+	frames[0] = *NewFrame(mainFn, 0)
+
+	constants := make([]value, len(bytecode.Constants))
+	for i, constant := range bytecode.Constants {
+		constants[i] = fromObject(constant)
+	}
 
 	return &VM{
-		constants:  bytecode.Constants,
-		stack:      make([]object.Object, StackSize),
+		constants:  constants,
+		stack:      make([]value, StackSize),
 		sp:         0,
-		globals:    make([]object.Object, GlobalSize),
+		globals:    NewGlobals(),
 		frames:     frames,
 		frameIndex: 1,
 	}
 }
 
-func NewVmWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+func NewVmWithGlobalsStore(bytecode *compiler.Bytecode, s *Globals) *VM {
 	vm := NewVm(bytecode)
 	vm.globals = s
 	return vm
 }
 
+// SetContext 设置执行上下文，内置函数通过它访问输入输出，未设置时使用进程的标准输入输出
+func (vm *VM) SetContext(ctx *object.Context) {
+	vm.ctx = ctx
+}
+
+// Context 返回执行上下文
+func (vm *VM) Context() *object.Context {
+	return vm.ctx
+}
+
 // StackTop 获取栈顶指令
 func (vm *VM) StackTop() object.Object {
 	if vm.sp == 0 {
 		return nil
 	}
-	return vm.stack[vm.sp-1]
+	return vm.stack[vm.sp-1].Object()
 }
 
 func (vm *VM) LastPoppedStackElem() object.Object {
 	// log.Debug("vm.sp:%d", vm.sp)
-	return vm.stack[vm.sp]
+	return vm.stack[vm.sp].Object()
 }
 
 // Run 运行虚拟机主循环：取指令、解码、执行
 func (vm *VM) Run() error {
-	var ip int
-	var ins code.Instructions
-	var op code.Opcode
+	return vm.run(0)
+}
 
-	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
-		vm.currentFrame().ip++
+// run 执行指令直到帧栈深度回落到base，或当前帧的指令执行完毕。
+// 当前帧、指令序列和指令指针缓存在局部变量中，只在调用和返回切换栈帧时写回和重新读取
+func (vm *VM) run(base int) error {
+	frame, ins, ip := vm.loadFrame()
 
-		ip = vm.currentFrame().ip
-		ins = vm.currentFrame().Instructions()
-		op = code.Opcode(ins[ip])
+	for ip < len(ins)-1 {
+		ip++
+		op := code.Opcode(ins[ip])
 		// log.Debug("ip:%d, ins:%+v, op:%d", ip, ins, op)
 
 		switch op {
 		case code.OpConstant:
 			// 读取到引用指令
 			constIndex := code.ReadUint16(ins[ip+1:])
-			vm.currentFrame().ip += 2
-			err := vm.push(vm.constants[constIndex])
+			ip += 2
+			err := vm.pushValue(vm.constants[constIndex])
 			if err != nil {
 				return err
 			}
 		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
-			err := vm.executeBinaryOperation(op)
+			right := vm.pop()
+			left := vm.pop()
+			err := vm.executeBinaryOperation(op, left, right)
+			if err != nil {
+				return err
+			}
+		case code.OpAddConst:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			ip += 2
+			err := vm.executeBinaryOperation(code.OpAdd, vm.pop(), vm.constants[constIndex])
 			if err != nil {
 				return err
 			}
@@ -99,20 +166,40 @@ func (vm *VM) Run() error {
 			// 出栈指令
 			vm.pop()
 		case code.OpTrue:
-			err := vm.push(True)
+			err := vm.pushValue(trueValue)
 			if err != nil {
 				return err
 			}
 		case code.OpFalse:
-			err := vm.push(False)
+			err := vm.pushValue(falseValue)
 			if err != nil {
 				return err
 			}
 		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan:
-			err := vm.executeComparison(op)
+			right := vm.pop()
+			left := vm.pop()
+			result, err := vm.compare(op, left, right)
+			if err != nil {
+				return err
+			}
+			err = vm.pushValue(booleanValue(result))
+			if err != nil {
+				return err
+			}
+		case code.OpJumpIfFalseCompare:
+			comparison := code.Opcode(code.ReadUint8(ins[ip+1:]))
+			pos := int(code.ReadUint16(ins[ip+2:]))
+			ip += 3
+
+			right := vm.pop()
+			left := vm.pop()
+			result, err := vm.compare(comparison, left, right)
 			if err != nil {
 				return err
 			}
+			if !result {
+				ip = pos - 1
+			}
 		case code.OpMinus:
 			err := vm.executeMinusOperator()
 			if err != nil {
@@ -125,38 +212,38 @@ func (vm *VM) Run() error {
 			}
 		case code.OpJumpNotTruthy:
 			pos := int(code.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
+			ip += 2
 
 			condition := vm.pop()
-			if !isTruthy(condition) {
-				vm.currentFrame().ip = pos - 1
+			if !condition.isTruthy() {
+				ip = pos - 1
 			}
 		case code.OpJump:
 			pos := int(code.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip = pos - 1
+			ip = pos - 1
 		case code.OpNull:
-			err := vm.push(Null)
+			err := vm.pushValue(nullValue)
 			if err != nil {
 				return err
 			}
 		case code.OpSetGlobal:
 			globalIndex := code.ReadUint16(ins[ip+1:])
-			vm.currentFrame().ip += 2
+			ip += 2
 
 			// 获取绑定到名称的值，并将其存储到globals中
-			vm.globals[globalIndex] = vm.pop()
+			vm.globals.set(int(globalIndex), vm.pop())
 		case code.OpGetGlobal:
 			globalIndex := code.ReadUint16(ins[ip+1:])
-			vm.currentFrame().ip += 2
+			ip += 2
 
 			// 从globals中取出值并将其入栈
-			err := vm.push(vm.globals[globalIndex])
+			err := vm.pushValue(vm.globals.get(int(globalIndex)))
 			if err != nil {
 				return err
 			}
 		case code.OpArray:
 			arrayLen := int(code.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
+			ip += 2
 
 			array := vm.buildArray(vm.sp-arrayLen, vm.sp)
 			vm.sp = vm.sp - arrayLen
@@ -167,7 +254,7 @@ func (vm *VM) Run() error {
 			}
 		case code.OpHash:
 			hashLen := int(code.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
+			ip += 2
 
 			hash, err := vm.buildHash(vm.sp-hashLen, vm.sp)
 			if err != nil {
@@ -180,122 +267,349 @@ func (vm *VM) Run() error {
 				return err
 			}
 		case code.OpIndex:
-			index := vm.pop()
-			left := vm.pop()
+			index := vm.pop().Object()
+			left := vm.pop().Object()
 
 			err := vm.executeIndexExpression(left, index)
 			if err != nil {
 				return err
 			}
-		case code.OpCall:
-			// 跳过参数个数
-			numArgs := code.ReadUint8(ins[ip+1:])
-			vm.currentFrame().ip += 1
+		case code.OpCall, code.OpCall0, code.OpCall1, code.OpCall2, code.OpCall3:
+			var numArgs int
+			if op == code.OpCall {
+				// 跳过参数个数
+				numArgs = int(code.ReadUint8(ins[ip+1:]))
+				ip += 1
+			} else {
+				numArgs = int(op - code.OpCall0)
+			}
+
+			// 保存当前帧的指令指针，调用已编译函数时会切换到新的栈帧
+			frame.ip = ip
+			err := vm.callFunction(numArgs)
+			if err != nil {
+				return err
+			}
+			frame, ins, ip = vm.loadFrame()
+		case code.OpCallSpread:
+			numSegments := int(code.ReadUint8(ins[ip+1:]))
+			ip += 1
 
-			err := vm.callFunction(int(numArgs))
+			frame.ip = ip
+			err := vm.callSpread(numSegments)
 			if err != nil {
 				return err
 			}
+			frame, ins, ip = vm.loadFrame()
 		case code.OpReturnValue:
 			// 在函数栈帧中获取返回值
 			returnValue := vm.pop()
 
 			// 销毁函数栈帧
-			frame := vm.popFrame()
+			vm.popFrame()
 			vm.sp = frame.basePointer - 1
 
 			// 将返回值压入栈
-			err := vm.push(returnValue)
+			err := vm.pushValue(returnValue)
 			if err != nil {
 				return err
 			}
+			if vm.frameIndex <= base {
+				return nil
+			}
+			frame, ins, ip = vm.loadFrame()
 		case code.OpReturn:
-			frame := vm.popFrame()
+			vm.popFrame()
 			vm.sp = frame.basePointer - 1
 
-			err := vm.push(Null)
+			err := vm.pushValue(nullValue)
 			if err != nil {
 				return err
 			}
+			if vm.frameIndex <= base {
+				return nil
+			}
+			frame, ins, ip = vm.loadFrame()
 		case code.OpSetLocal:
 			// 设置局部变量
 			localIndex := code.ReadUint8(ins[ip+1:])
-			vm.currentFrame().ip += 1
-
-			frame := vm.currentFrame()
+			ip += 1
 
 			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
 		case code.OpGetLocal:
 			// 获取局部变量
 			localIndex := code.ReadUint8(ins[ip+1:])
-			vm.currentFrame().ip += 1
+			ip += 1
 
-			frame := vm.currentFrame()
+			err := vm.pushValue(vm.stack[frame.basePointer+int(localIndex)])
+			if err != nil {
+				return err
+			}
+		case code.OpGetLocal0, code.OpGetLocal1, code.OpGetLocal2, code.OpGetLocal3:
+			err := vm.pushValue(vm.stack[frame.basePointer+int(op-code.OpGetLocal0)])
+			if err != nil {
+				return err
+			}
+		case code.OpModule:
+			numExports := int(code.ReadUint16(ins[ip+1:]))
+			ip += 2
+
+			module := vm.buildModule(vm.sp-numExports-1, vm.sp)
+			vm.sp = vm.sp - numExports - 1
+
+			err := vm.push(module)
+			if err != nil {
+				return err
+			}
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			ip += 1
+
+			err := vm.push(object.Builtins[builtinIndex].Builtin)
+			if err != nil {
+				return err
+			}
+		case code.OpClosure:
+			constIndex := int(code.ReadUint16(ins[ip+1:]))
+			numFree := int(code.ReadUint8(ins[ip+3:]))
+			ip += 3
+
+			err := vm.pushClosure(constIndex, numFree)
+			if err != nil {
+				return err
+			}
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			ip += 1
+
+			err := vm.push(frame.closure.Free[freeIndex])
+			if err != nil {
+				return err
+			}
+		case code.OpCurrentClosure:
+			var err error
+			if frame.closure != nil {
+				err = vm.push(frame.closure)
+			} else {
+				err = vm.push(frame.fn)
+			}
+			if err != nil {
+				return err
+			}
+		case code.OpSetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			ip += 1
+
+			vm.setFree(int(freeIndex))
+		case code.OpDup:
+			err := vm.pushValue(vm.stack[vm.sp-1])
+			if err != nil {
+				return err
+			}
+		case code.OpDestructureArray:
+			count := int(code.ReadUint16(ins[ip+1:]))
+			variadic := code.ReadUint8(ins[ip+3:]) == 1
+			ip += 3
+
+			err := object.DestructureArray(vm.stack[vm.sp-1].Object(), count, variadic)
+			if err != nil {
+				return err
+			}
+		case code.OpDestructureHash:
+			constIndex := int(code.ReadUint16(ins[ip+1:]))
+			ip += 2
+
+			err := vm.destructureHash(constIndex)
+			if err != nil {
+				return err
+			}
+		case code.OpArrayRest:
+			start := int(code.ReadUint16(ins[ip+1:]))
+			ip += 2
+
+			err := vm.arrayRest(start)
+			if err != nil {
+				return err
+			}
+		case code.OpMatchArray:
+			count := int(code.ReadUint16(ins[ip+1:]))
+			variadic := code.ReadUint8(ins[ip+3:]) == 1
+			ip += 3
 
-			obj := vm.stack[frame.basePointer+int(localIndex)]
-			err := vm.push(obj)
+			err := vm.pushValue(booleanValue(object.MatchArray(vm.pop().Object(), count, variadic)))
 			if err != nil {
 				return err
 			}
+		case code.OpMatchHash:
+			constIndex := int(code.ReadUint16(ins[ip+1:]))
+			ip += 2
+
+			err := vm.matchHash(constIndex)
+			if err != nil {
+				return err
+			}
+		case code.OpJumpTable:
+			constIndex := int(code.ReadUint16(ins[ip+1:]))
+			defaultPos := int(code.ReadUint16(ins[ip+3:]))
+			ip = vm.jumpTable(constIndex, defaultPos) - 1
+		case code.OpWide:
+			// 宽操作数前缀：读取下一条指令及其4字节操作数，跳转和调用需要修改缓存的栈帧，其余交给executeWide
+			op = code.Opcode(ins[ip+1])
+			def, err := code.Lookup(byte(op))
+			if err != nil {
+				return err
+			}
+			operands, read := code.ReadWideOperands(def, ins[ip+2:])
+			ip += 1 + read
+
+			switch op {
+			case code.OpJump:
+				ip = operands[0] - 1
+			case code.OpJumpTable:
+				ip = vm.jumpTable(operands[0], operands[1]) - 1
+			case code.OpJumpNotTruthy:
+				if !vm.pop().isTruthy() {
+					ip = operands[0] - 1
+				}
+			case code.OpJumpIfFalseCompare:
+				right := vm.pop()
+				left := vm.pop()
+				result, err := vm.compare(code.Opcode(operands[0]), left, right)
+				if err != nil {
+					return err
+				}
+				if !result {
+					ip = operands[1] - 1
+				}
+			case code.OpCall, code.OpCallSpread:
+				frame.ip = ip
+				call := vm.callFunction
+				if op == code.OpCallSpread {
+					call = vm.callSpread
+				}
+				err := call(operands[0])
+				if err != nil {
+					return err
+				}
+				frame, ins, ip = vm.loadFrame()
+			default:
+				err := vm.executeWide(frame, op, operands)
+				if err != nil {
+					return err
+				}
+			}
 		default:
 			return fmt.Errorf("unknown opcode:%d", op)
 		}
 	}
+
+	frame.ip = ip
 	return nil
 }
 
-func isTruthy(condition object.Object) bool {
-	switch obj := condition.(type) {
-	case *object.Boolean:
-		return obj.Value
-	case *object.Null:
-		return false
+// executeWide 执行带OpWide前缀的指令，语义与对应的普通指令相同
+func (vm *VM) executeWide(frame *Frame, op code.Opcode, operands []int) error {
+	switch op {
+	case code.OpConstant:
+		return vm.pushValue(vm.constants[operands[0]])
+	case code.OpAddConst:
+		return vm.executeBinaryOperation(code.OpAdd, vm.pop(), vm.constants[operands[0]])
+	case code.OpSetGlobal:
+		vm.globals.set(operands[0], vm.pop())
+		return nil
+	case code.OpGetGlobal:
+		return vm.pushValue(vm.globals.get(operands[0]))
+	case code.OpSetLocal:
+		vm.stack[frame.basePointer+operands[0]] = vm.pop()
+		return nil
+	case code.OpGetLocal:
+		return vm.pushValue(vm.stack[frame.basePointer+operands[0]])
+	case code.OpArray:
+		arrayLen := operands[0]
+		array := vm.buildArray(vm.sp-arrayLen, vm.sp)
+		vm.sp = vm.sp - arrayLen
+		return vm.push(array)
+	case code.OpHash:
+		hashLen := operands[0]
+		hash, err := vm.buildHash(vm.sp-hashLen, vm.sp)
+		if err != nil {
+			return err
+		}
+		vm.sp = vm.sp - hashLen
+		return vm.push(hash)
+	case code.OpModule:
+		numExports := operands[0]
+		module := vm.buildModule(vm.sp-numExports-1, vm.sp)
+		vm.sp = vm.sp - numExports - 1
+		return vm.push(module)
+	case code.OpGetBuiltin:
+		return vm.push(object.Builtins[operands[0]].Builtin)
+	case code.OpClosure:
+		return vm.pushClosure(operands[0], operands[1])
+	case code.OpGetFree:
+		return vm.push(frame.closure.Free[operands[0]])
+	case code.OpSetFree:
+		vm.setFree(operands[0])
+		return nil
+	case code.OpDestructureArray:
+		return object.DestructureArray(vm.stack[vm.sp-1].Object(), operands[0], operands[1] == 1)
+	case code.OpDestructureHash:
+		return vm.destructureHash(operands[0])
+	case code.OpArrayRest:
+		return vm.arrayRest(operands[0])
+	case code.OpMatchArray:
+		return vm.pushValue(booleanValue(object.MatchArray(vm.pop().Object(), operands[0], operands[1] == 1)))
+	case code.OpMatchHash:
+		return vm.matchHash(operands[0])
 	default:
-		return true
+		return fmt.Errorf("opcode %d does not take wide operands", op)
 	}
 }
 
+// loadFrame 返回当前帧及其指令序列和指令指针，供run缓存
+func (vm *VM) loadFrame() (*Frame, code.Instructions, int) {
+	frame := vm.currentFrame()
+	return frame, frame.Instructions(), frame.ip
+}
+
 func (vm *VM) executeMinusOperator() error {
 	operand := vm.pop()
 
-	if operand.Type() != object.INTEGER_OBJ {
+	if operand.kind != integerKind {
 		return fmt.Errorf("unsupported type for negation:%s", operand.Type())
 	}
 
-	value := operand.(*object.Integer).Value
-	return vm.push(&object.Integer{Value: -value})
+	return vm.pushValue(integerValue(-operand.num))
 }
 
 func (vm *VM) executeBangOperator() error {
 	operand := vm.pop()
-
-	switch operand {
-	case True:
-		return vm.push(False)
-	case False:
-		return vm.push(True)
-	case Null:
-		return vm.push(True)
-	default:
-		return vm.push(False)
-	}
+	return vm.pushValue(booleanValue(!operand.isTruthy()))
 }
 
-func (vm *VM) executeComparison(op code.Opcode) error {
-	right := vm.pop()
-	left := vm.pop()
-
-	if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ {
-		return vm.executeIntegerComparison(op, left, right)
+// compare 执行比较运算，整数直接比较，其余类型通过object.Equal和object.Compare比较
+func (vm *VM) compare(op code.Opcode, leftValue, rightValue value) (bool, error) {
+	if leftValue.kind == integerKind && rightValue.kind == integerKind {
+		return executeIntegerComparison(op, leftValue.num, rightValue.num)
 	}
 
+	left := leftValue.Object()
+	right := rightValue.Object()
+
 	switch op {
 	case code.OpEqual:
-		return vm.push(nativeBoolToBooleanObject(right == left))
+		return object.Equal(left, right), nil
 	case code.OpNotEqual:
-		return vm.push(nativeBoolToBooleanObject(right != left))
+		return !object.Equal(left, right), nil
+	case code.OpGreaterThan:
+		result, err := object.Compare(left, right)
+		if err != nil {
+			return false, fmt.Errorf("unknown operator: %d (%s %s)",
+				op, left.Type(), right.Type())
+		}
+		return result > 0, nil
 	default:
-		return fmt.Errorf("unknown operator: %d (%s %s)",
+		return false, fmt.Errorf("unknown operator: %d (%s %s)",
 			op, left.Type(), right.Type())
 	}
 }
@@ -307,25 +621,24 @@ func nativeBoolToBooleanObject(result bool) object.Object {
 	return False
 }
 
-func (vm *VM) executeIntegerComparison(op code.Opcode, left, right object.Object) error {
-	leftValue := left.(*object.Integer).Value
-	rightValue := right.(*object.Integer).Value
-
+func executeIntegerComparison(op code.Opcode, leftValue, rightValue int64) (bool, error) {
 	switch op {
 	case code.OpEqual:
-		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+		return leftValue == rightValue, nil
 	case code.OpNotEqual:
-		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+		return leftValue != rightValue, nil
 	case code.OpGreaterThan:
-		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+		return leftValue > rightValue, nil
 	default:
-		return fmt.Errorf("unknown operator:%d", op)
+		return false, fmt.Errorf("unknown operator:%d", op)
 	}
 }
 
-func (vm *VM) executeBinaryOperation(op code.Opcode) error {
-	right := vm.pop()
-	left := vm.pop()
+func (vm *VM) executeBinaryOperation(op code.Opcode, left, right value) error {
+	if left.kind == integerKind && right.kind == integerKind {
+		return vm.executeBinaryIntegerOperation(op, left.num, right.num)
+	}
+
 	leftType := left.Type()
 	rightType := right.Type()
 
@@ -334,20 +647,15 @@ func (vm *VM) executeBinaryOperation(op code.Opcode) error {
 	}
 
 	switch leftType {
-	case object.INTEGER_OBJ:
-		return vm.executeBinaryIntegerOperation(op, left, right)
 	case object.STRING_OBJ:
-		return vm.executeBinaryStringOperation(op, left, right)
+		return vm.executeBinaryStringOperation(op, left.obj, right.obj)
 	default:
 		return fmt.Errorf("unsupported types for binary operation: %s %d %s",
 			leftType, op, rightType)
 	}
 }
 
-func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.Object) error {
-	leftValue := left.(*object.Integer).Value
-	rightValue := right.(*object.Integer).Value
-
+func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, leftValue, rightValue int64) error {
 	var result int64 = 0
 	switch op {
 	case code.OpAdd:
@@ -361,7 +669,7 @@ func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.O
 	default:
 		return fmt.Errorf("unknown integer operator: %d", op)
 	}
-	return vm.push(&object.Integer{Value: result})
+	return vm.pushValue(integerValue(result))
 }
 
 func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Object) error {
@@ -375,58 +683,104 @@ func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Ob
 	return vm.push(&object.String{Value: leftValue + rightValue})
 }
 
-// push 将obj入栈
+// push 将obj转换为值后入栈
 func (vm *VM) push(o object.Object) error {
-	// log.Debug("vm.sp:%d, o:%+v", vm.sp, o)
+	return vm.pushValue(fromObject(o))
+}
+
+// pushValue 将v入栈
+func (vm *VM) pushValue(v value) error {
+	// log.Debug("vm.sp:%d, v:%+v", vm.sp, v)
 	if vm.sp >= StackSize {
 		return fmt.Errorf("stack overflow")
 	}
 
-	vm.stack[vm.sp] = o
+	vm.stack[vm.sp] = v
 	vm.sp++
 
 	return nil
 }
 
-func (vm *VM) pop() object.Object {
+func (vm *VM) pop() value {
 	// log.Debug("vm.sp:%d", vm.sp)
-	o := vm.stack[vm.sp-1]
+	v := vm.stack[vm.sp-1]
 	vm.sp--
-	return o
+	return v
 }
 
-// buildArray 构建数组
-func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
-	elements := make([]object.Object, endIndex-startIndex)
+// destructureHash 检查栈顶的值是否为包含constIndex处的数组常量中全部键的哈希表
+func (vm *VM) destructureHash(constIndex int) error {
+	return object.DestructureHash(vm.stack[vm.sp-1].Object(), vm.patternKeys(constIndex))
+}
+
+// matchHash 弹出栈顶的值，压入其是否为包含constIndex处的数组常量中全部键的哈希表
+func (vm *VM) matchHash(constIndex int) error {
+	return vm.pushValue(booleanValue(object.MatchHash(vm.pop().Object(), vm.patternKeys(constIndex))))
+}
+
+// patternKeys 返回constIndex处的数组常量中哈希表模式的全部键
+func (vm *VM) patternKeys(constIndex int) []string {
+	keys := []string{}
+	for _, key := range vm.constants[constIndex].Object().(*object.Array).Elements() {
+		keys = append(keys, key.(*object.String).Value)
+	}
+	return keys
+}
 
-	for i := startIndex; i < endIndex; i++ {
-		elements[i-startIndex] = vm.stack[i]
+// jumpTable 弹出栈顶的值，返回其在constIndex处的跳转表中对应的跳转目标，不在表中时返回defaultPos
+func (vm *VM) jumpTable(constIndex, defaultPos int) int {
+	table := vm.constants[constIndex].Object().(*object.Hash)
+	pair, ok := table.Get(vm.pop().Object())
+	if !ok {
+		return defaultPos
 	}
+	return int(pair.Value.(*object.Integer).Value)
+}
 
-	return &object.Array{Elements: elements}
+// arrayRest 弹出栈顶的数组，压入从start开始的剩余元素组成的数组
+func (vm *VM) arrayRest(start int) error {
+	arr := vm.pop().Object().(*object.Array)
+	return vm.push(arr.Drop(start))
+}
+
+// buildArray 构建数组
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	return object.NewArray(toObjects(vm.stack[startIndex:endIndex]))
 }
 
 func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
-	hashPairs := make(map[object.HashKey]object.HashPair)
+	hash := object.NewHash()
 
 	for i := startIndex; i < endIndex; i += 2 {
-		key := vm.stack[i]
-		value := vm.stack[i+1]
+		key := vm.stack[i].Object()
+		value := vm.stack[i+1].Object()
 
-		pair := object.HashPair{Key: key, Value: value}
-		hashKey, ok := key.(object.Hashable)
-		if !ok {
+		if !object.IsHashable(key) {
 			return nil, fmt.Errorf("unusable as hash key:%s", key.Type())
 		}
 
-		hashPairs[hashKey.HashKey()] = pair
+		hash.Set(key, value)
+	}
+
+	return hash, nil
+}
+
+// buildModule 构建模块对象，startIndex处为模块名，其后依次为导出名称与值
+func (vm *VM) buildModule(startIndex, endIndex int) object.Object {
+	name := vm.stack[startIndex].obj.(*object.String).Value
+	exports := make(map[string]object.Object)
+
+	for i := startIndex + 1; i < endIndex; i += 2 {
+		exports[vm.stack[i].obj.(*object.String).Value] = vm.stack[i+1].Object()
 	}
 
-	return &object.Hash{Pairs: hashPairs}, nil
+	return &object.Module{Name: name, Exports: exports}
 }
 
 func (vm *VM) executeIndexExpression(left, index object.Object) error {
 	switch {
+	case left.Type() == object.MODULE_OBJ && index.Type() == object.STRING_OBJ:
+		return vm.executeModuleMember(left, index)
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return vm.executeArrayIndex(left, index)
 	case left.Type() == object.HASH_OBJ:
@@ -439,59 +793,193 @@ func (vm *VM) executeIndexExpression(left, index object.Object) error {
 func (vm *VM) executeArrayIndex(left, index object.Object) error {
 	arrayObj := left.(*object.Array)
 	i := index.(*object.Integer).Value
-	max := int64(len(arrayObj.Elements) - 1)
+	max := int64(arrayObj.Len() - 1)
 
 	if i < 0 || i > max {
 		return vm.push(Null)
 	}
 
-	return vm.push(arrayObj.Elements[i])
+	return vm.push(arrayObj.At(int(i)))
 }
 
 func (vm *VM) executeHashIndex(left, index object.Object) error {
 	hashObj := left.(*object.Hash)
 
-	key, ok := index.(object.Hashable)
+	pair, ok := hashObj.Get(index)
 	if !ok {
 		return vm.push(Null)
 	}
+	return vm.push(pair.Value)
+}
 
-	pair, ok := hashObj.Pairs[key.HashKey()]
+func (vm *VM) executeModuleMember(left, index object.Object) error {
+	moduleObj := left.(*object.Module)
+	name := index.(*object.String).Value
+
+	value, ok := moduleObj.Exports[name]
 	if !ok {
-		return vm.push(Null)
+		return fmt.Errorf("module %s has no exported member %s", moduleObj.Name, name)
 	}
-	return vm.push(pair.Value)
+	return vm.push(value)
 }
 
 func (vm *VM) currentFrame() *Frame {
-	return vm.frames[vm.frameIndex-1]
+	return &vm.frames[vm.frameIndex-1]
 }
 
-func (vm *VM) pushFrame(f *Frame) {
+// pushFrame 压入栈帧，帧栈已满时返回栈溢出错误
+func (vm *VM) pushFrame(f Frame) error {
+	if vm.frameIndex >= MaxFrame {
+		return fmt.Errorf("stack overflow")
+	}
 	vm.frames[vm.frameIndex] = f
 	vm.frameIndex++
+	return nil
 }
 
 func (vm *VM) popFrame() *Frame {
 	vm.frameIndex--
-	return vm.frames[vm.frameIndex]
+	return &vm.frames[vm.frameIndex]
 }
 
 func (vm *VM) callFunction(numArgs int) error {
-	fn, ok := vm.stack[vm.sp-1-numArgs].(*object.CompiledFunction)
-	if !ok {
+	switch callee := vm.stack[vm.sp-1-numArgs].obj.(type) {
+	case *object.CompiledFunction:
+		return vm.callCompiledFunction(callee, nil, numArgs)
+	case *object.Closure:
+		return vm.callCompiledFunction(callee.Fn, callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	case *object.Hoisted:
+		return callee.CallError()
+	default:
 		return fmt.Errorf("calling non-function")
 	}
+}
+
+// pushClosure 以栈顶的numFree个值为自由变量，创建常量池中第constIndex个函数的闭包
+func (vm *VM) pushClosure(constIndex, numFree int) error {
+	fn, ok := vm.constants[constIndex].obj.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", vm.constants[constIndex].Object())
+	}
+
+	free := toObjects(vm.stack[vm.sp-numFree : vm.sp])
+	vm.sp = vm.sp - numFree
+	return vm.push(&object.Closure{Fn: fn, Free: free})
+}
+
+// setFree 弹出值和闭包，将值回填为闭包的第freeIndex个自由变量
+func (vm *VM) setFree(freeIndex int) {
+	v := vm.pop()
+	closure := vm.pop().obj.(*object.Closure)
+	closure.Free[freeIndex] = v.Object()
+}
+
+// callSpread 拼接栈顶的numSegments个实参数组，以拼接结果为实参调用它们之下的函数
+func (vm *VM) callSpread(numSegments int) error {
+	var args []object.Object
+	for _, segment := range vm.stack[vm.sp-numSegments : vm.sp] {
+		arr, ok := segment.Object().(*object.Array)
+		if !ok {
+			return fmt.Errorf("spread argument must be ARRAY, got %s", segment.Type())
+		}
+		args = append(args, arr.Elements()...)
+	}
+	vm.sp -= numSegments
+
+	for _, arg := range args {
+		if err := vm.push(arg); err != nil {
+			return err
+		}
+	}
+	return vm.callFunction(len(args))
+}
+
+// callBuiltin 调用内置函数，内置函数返回的错误对象作为运行时错误返回
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := toObjects(vm.stack[vm.sp-numArgs : vm.sp])
+
+	result := builtin.Fn(vm, args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	if errObj, ok := result.(*object.Error); ok {
+		return fmt.Errorf("%s", errObj.Message)
+	}
+	if result == nil {
+		result = Null
+	}
+	return vm.push(result)
+}
+
+// callCompiledFunction 调用已编译函数，closure为函数所属的闭包，可以为nil。多余的实参收集为数组作为rest参数，
+// 缺少带默认值的参数时从对应的入口开始执行，先求值缺少的默认值
+func (vm *VM) callCompiledFunction(fn *object.CompiledFunction, closure *object.Closure, numArgs int) error {
+	required := fn.NumRequired()
+	err := object.CheckArity(fn.Name, required, fn.NumParameters, fn.Variadic, numArgs)
+	if err != nil {
+		return err
+	}
+
+	basePointer := vm.sp - numArgs
+	if fn.Variadic {
+		rest := []object.Object{}
+		if numArgs > fn.NumParameters {
+			rest = toObjects(vm.stack[basePointer+fn.NumParameters : vm.sp])
+		}
+		vm.stack[basePointer+fn.NumParameters] = fromObject(object.NewArray(rest))
+	}
+
+	ip := -1
+	if fn.Entries != nil {
+		provided := numArgs
+		if provided > fn.NumParameters {
+			provided = fn.NumParameters
+		}
+		ip = fn.Entries[provided-required] - 1
+	}
+	// 局部变量超出栈的范围时同样是栈溢出
+	if basePointer+fn.NumLocals > StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+	err = vm.pushFrame(Frame{fn: fn, closure: closure, ip: ip, basePointer: basePointer})
+	if err != nil {
+		return err
+	}
+
+	vm.sp = basePointer + fn.NumLocals
+	return nil
+}
+
+// Call 供内置函数回调Monkey函数：在当前栈顶之上调用fn，执行到其栈帧返回为止，出错时恢复栈并返回*object.Error
+func (vm *VM) Call(fn object.Object, args ...object.Object) object.Object {
+	sp, frameIndex := vm.sp, vm.frameIndex
 
-	// 检查实参是否等于形参
-	if fn.NumParameters != numArgs {
-		return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
-			fn.NumParameters, numArgs)
+	err := vm.call(fn, args)
+	if err != nil {
+		vm.sp, vm.frameIndex = sp, frameIndex
+		return &object.Error{Message: err.Error()}
 	}
+	return vm.pop().Object()
+}
 
-	frame := NewFrame(fn, vm.sp-numArgs)
-	vm.pushFrame(frame)
+func (vm *VM) call(fn object.Object, args []object.Object) error {
+	if err := vm.push(fn); err != nil {
+		return err
+	}
+	for _, arg := range args {
+		if err := vm.push(arg); err != nil {
+			return err
+		}
+	}
 
-	vm.sp = frame.basePointer + fn.NumLocals
+	frameIndex := vm.frameIndex
+	if err := vm.callFunction(len(args)); err != nil {
+		return err
+	}
+	// 内置函数直接将结果入栈，已编译函数则需要执行新压入的栈帧
+	if vm.frameIndex > frameIndex {
+		return vm.run(frameIndex)
+	}
 	return nil
 }
@@ -1,14 +1,21 @@
 package vm
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/nicolerobin/monkey/compiler"
+	"github.com/nicolerobin/monkey/evaluator"
+	"github.com/nicolerobin/monkey/module"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/nicolerobin/monkey/ast"
 	"github.com/nicolerobin/monkey/lexer"
 	"github.com/nicolerobin/monkey/object"
 	"github.com/nicolerobin/monkey/parser"
+	"github.com/nicolerobin/monkey/stdlib"
 )
 
 type vmTestCase struct {
@@ -60,6 +67,24 @@ func TestBooleanExpressions(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
+		{`"a" == "a"`, true},
+		{`"a" != "b"`, true},
+		{"[1, 2] == [1, 2]", true},
+		{"[1, 2] == [2, 1]", false},
+		{"[1, [2]] != [1, [2]]", false},
+		{"{1: 2, 3: 4} == {3: 4, 1: 2}", true},
+		{"{1: 2} == {1: 3}", false},
+		{"1 == true", false},
+		{"[] == {}", false},
+		{`"a" < "b"`, true},
+		{`"b" < "a"`, false},
+		{`"ab" > "a"`, true},
+		{"[1, 2] < [1, 3]", true},
+		{"[1, 2] > [1]", true},
+		{"[] < [0]", true},
+		{"false < true", true},
+		{"true > true", false},
+		{"if (false) { 1 } == if (false) { 2 }", true},
 		// ! 前缀运算符
 		{"!true", false},
 		{"!false", true},
@@ -96,10 +121,69 @@ func TestGlobalLetStatement(t *testing.T) {
 		{"let one = 1; one", 1},
 		{"let one = 1; let two = 2; one + two", 3},
 		{"let one = 1; let two = one + one; one + two", 3},
+		{"let x = 1; let x = x + 1; x", 2},
+		{"let countdown = fn(x) { if (x == 0) { 0 } else { countdown(x - 1) } }; countdown(3)", 0},
+		{"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)", 610},
 	}
 	runVmTests(t, tests)
 }
 
+func TestGlobalsStore(t *testing.T) {
+	globals := NewGlobals()
+
+	comp := compiler.NewCompiler()
+	if err := comp.Compile(parse("let a = 7; let b = [a, true, if (false) { 1 }];")); err != nil {
+		t.Fatalf("comp.Compile() failed, error: %s", err)
+	}
+	if err := NewVmWithGlobalsStore(comp.Bytecode(), globals).Run(); err != nil {
+		t.Fatalf("vm.Run() failed, error: %s", err)
+	}
+
+	if err := testIntegerObject(7, globals.Get(0)); err != nil {
+		t.Errorf("wrong global a: %s", err)
+	}
+	if globals.Get(1).Inspect() != "[7, true, null]" {
+		t.Errorf("wrong global b. got=%s", globals.Get(1).Inspect())
+	}
+	if globals.Get(2) != nil {
+		t.Errorf("unassigned global is not nil. got=%s", globals.Get(2).Inspect())
+	}
+}
+
+func TestUnassignedGlobal(t *testing.T) {
+	globals := NewGlobals()
+	symbolTable := compiler.NewSymbolTable()
+	constants := []object.Object{}
+
+	// 与REPL相同，每次输入共享符号表和全局变量，第一次输入中的定义在赋值之前失败
+	run := func(input string) (object.Object, error) {
+		comp := compiler.NewWithState(symbolTable, constants)
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("comp.Compile() failed, error: %s", err)
+		}
+		constants = comp.Bytecode().Constants
+		machine := NewVmWithGlobalsStore(comp.Bytecode(), globals)
+		err := machine.Run()
+		return machine.LastPoppedStackElem(), err
+	}
+
+	if _, err := run("let y = 1; let x = len(1);"); err == nil {
+		t.Fatalf("expected an error")
+	}
+	if globals.Get(1) != nil {
+		t.Errorf("failed definition assigned a value. got=%s", globals.Get(1).Inspect())
+	}
+
+	result, err := run("x")
+	if err != nil || result != Null {
+		t.Errorf("unassigned global is not null. got=%v, error: %v", result, err)
+	}
+	_, err = run("x + 1")
+	if err == nil || err.Error() != "leftType:NULL and rightType:INTEGER not equal" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
+
 func TestStringExpression(t *testing.T) {
 	tests := []vmTestCase{
 		{`"monkey"`, "monkey"},
@@ -121,15 +205,15 @@ func TestArrayLiteral(t *testing.T) {
 
 func TestHashLiteral(t *testing.T) {
 	tests := []vmTestCase{
-		{"{}", map[object.HashKey]int64{}},
-		{"{1: 2, 3: 4, 5: 6}", map[object.HashKey]int64{
-			(&object.Integer{Value: 1}).HashKey(): 2,
-			(&object.Integer{Value: 3}).HashKey(): 4,
-			(&object.Integer{Value: 5}).HashKey(): 6,
+		{"{}", map[object.Object]int64{}},
+		{"{1: 2, 3: 4, 5: 6}", map[object.Object]int64{
+			&object.Integer{Value: 1}: 2,
+			&object.Integer{Value: 3}: 4,
+			&object.Integer{Value: 5}: 6,
 		}},
-		{"{1 + 1: 2 * 2, 3 + 3: 4 * 4}", map[object.HashKey]int64{
-			(&object.Integer{Value: 2}).HashKey(): 4,
-			(&object.Integer{Value: 6}).HashKey(): 16,
+		{"{1 + 1: 2 * 2, 3 + 3: 4 * 4}", map[object.Object]int64{
+			&object.Integer{Value: 2}: 4,
+			&object.Integer{Value: 6}: 16,
 		}},
 	}
 
@@ -148,6 +232,11 @@ func TestIndexExpression(t *testing.T) {
 		{"{1: 1, 2: 2}[2]", 2},
 		{"{1: 1}[0]", Null},
 		{"{}[0]", Null},
+		{"{[1, 2]: 5}[[1, 2]]", 5},
+		{"{[1, 2]: 5}[[2, 1]]", Null},
+		{`{{"a": 1, "b": 2}: 5}[{"b": 2, "a": 1}]`, 5},
+		{"{[1, 2]: 5, [1, 2]: 6}[[1, 2]]", 6},
+		{"len({[1]: 1, [1]: 2})", 1},
 	}
 
 	runVmTests(t, tests)
@@ -230,6 +319,110 @@ func TestFirstClassFunction(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{`let newAdder = fn(a) { fn(b) { a + b } }; let addTwo = newAdder(2); addTwo(3)`, 5},
+		{`let newAdder = fn(a, b) { fn(c) { a + b + c } }; newAdder(1, 2)(8)`, 11},
+		{`let outer = fn(a) { let b = 2; fn(c) { fn(d) { a + b + c + d } } }; outer(1)(3)(4)`, 10},
+		{`let g = 10; let f = fn(a) { fn() { a + g } }; f(1)()`, 11},
+		{`let counter = fn(start) { fn() { start } }; let a = counter(1); let b = counter(2); [a(), b()]`, []int{1, 2}},
+		{`let f = fn(k) { map([1, 2], fn(x) { x * k }) }; f(3)`, []int{3, 6}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`fn fact(n) { if (n == 0) { 1 } else { n * fact(n - 1) } } fact(5)`, 120},
+		{`let f = fn() { let fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } }; fact(5) }; f()`, 120},
+		{`let f = fn() { fn fact(n) { if (n == 0) { 1 } else { n * fact(n - 1) } } fact(4) }; f()`, 24},
+		{`let f = fn(k) { fn down(n) { if (n == 0) { k } else { down(n - 1) } } down(3) }; f(7)`, 7},
+		{`fn isEven(n) { if (n == 0) { true } else { isOdd(n - 1) } }
+		  fn isOdd(n) { if (n == 0) { false } else { isEven(n - 1) } }
+		  isOdd(7)`, true},
+		{`let f = fn() {
+		    fn isEven(n) { if (n == 0) { true } else { isOdd(n - 1) } }
+		    fn isOdd(n) { if (n == 0) { false } else { isEven(n - 1) } }
+		    isEven(10)
+		  }; f()`, true},
+		{`let f = fn() {
+		    fn a(n) { if (n == 0) { 0 } else { b(n - 1) } }
+		    fn b(n) { if (n == 0) { 1 } else { c(n - 1) } }
+		    fn c(n) { if (n == 0) { 2 } else { a(n - 1) } }
+		    [a(3), a(4), a(5)]
+		  }; f()`, []int{0, 1, 2}},
+		{`let f = fn() { fn fib(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } } map([5, 10], fib) }; f()`, []int{5, 55}},
+	}
+
+	runVmTests(t, tests)
+
+	// 调用尚未执行到声明处的函数时报告函数名
+	for _, input := range []string{
+		`fn g() { h() } g(); fn h() { 1 }`,
+		`let f = fn() { fn g() { h() } g() fn h() { 1 } }; f()`,
+		`let f = fn() { let g = fn() { h() }; g(); fn h() { 1 } }; f()`,
+	} {
+		comp := compiler.NewCompiler()
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error:%s", err)
+		}
+		if err := NewVm(comp.Bytecode()).Run(); err == nil || err.Error() != "function h called before its declaration" {
+			t.Errorf("wrong VM error for %q: %v", input, err)
+		}
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	tests := []string{
+		`let f = fn() { f() }; f()`,
+		`fn f() { f() } f()`,
+		`fn f(n) { 1 + f(n + 1) } f(0)`,
+		`let f = fn() { let a = 1; let b = 2; let c = 3; let d = 4; f() }; f()`,
+		`fn f(x) { map([x], f) } f(1)`,
+	}
+
+	for _, input := range tests {
+		comp := compiler.NewCompiler()
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error:%s", err)
+		}
+		err = NewVm(comp.Bytecode()).Run()
+		if err == nil || err.Error() != "stack overflow" {
+			t.Errorf("wrong VM error for %q: want=%q, got=%v", input, "stack overflow", err)
+		}
+	}
+}
+
+func TestFunctionNames(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fn add(a, b) { a + b } add`, "fn add(a, b)"},
+		{`let f = fn(k) { fn scale(x) { x * k } scale }; f(2)`, "fn scale(x)"},
+		{`let f = fn() { let inner = fn() { 1 }; inner }; f()`, "fn inner()"},
+		{`let f = fn(a, b = 1, ...rest) { a }; f`, "fn f(a, b, ...rest)"},
+		{`fn(x) { x }`, "fn(x)"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.NewCompiler()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error:%s", err)
+		}
+		vm := NewVm(comp.Bytecode())
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error:%s", err)
+		}
+		if result := vm.LastPoppedStackElem().Inspect(); result != tt.expected {
+			t.Errorf("wrong function for %q. want=%q, got=%q", tt.input, tt.expected, result)
+		}
+	}
+}
+
 func TestCallingFunctionsWithBandings(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -354,6 +547,34 @@ func TestCallingFunctionsWithWrongArguments(t *testing.T) {
 			input:    `fn(a, b) { a + b }(1);`,
 			expected: `wrong number of arguments: want=2, got=1`,
 		},
+		{
+			input:    `let add = fn(a, b) { a + b }; add(1);`,
+			expected: "wrong number of arguments to `add`: want=2, got=1",
+		},
+		{
+			input:    `fn() { let inc = fn(a, b = 1) { a + b }; inc(1, 2, 3) }();`,
+			expected: "wrong number of arguments to `inc`: want=1 to 2, got=3",
+		},
+		{
+			input:    `let f = fn(a, ...rest) { a }; f();`,
+			expected: "wrong number of arguments to `f`: want=at least 1, got=0",
+		},
+		{
+			input:    `let f = fn(a, b) { a }; f(...[1, 2, 3]);`,
+			expected: "wrong number of arguments to `f`: want=2, got=3",
+		},
+		{
+			input:    `fn(a) { a }(...1);`,
+			expected: `spread argument must be ARRAY, got INTEGER`,
+		},
+		{
+			input:    `fn add(a, b) { a + b } add(1);`,
+			expected: "wrong number of arguments to `add`: want=2, got=1",
+		},
+		{
+			input:    `let f = fn(k) { fn scale(x) { x * k } scale() }; f(2);`,
+			expected: "wrong number of arguments to `scale`: want=1, got=0",
+		},
 	}
 
 	for _, tt := range tests {
@@ -377,6 +598,448 @@ func TestCallingFunctionsWithWrongArguments(t *testing.T) {
 	}
 }
 
+func TestDefaultRestAndSpread(t *testing.T) {
+	tests := []vmTestCase{
+		{`let f = fn(a, b = 2) { a + b }; f(1)`, 3},
+		{`let f = fn(a, b = 2) { a + b }; f(1, 5)`, 6},
+		{`let f = fn(a = 1, b = a * 10) { a + b }; f()`, 11},
+		{`let f = fn(a = 1, b = a * 10) { a + b }; f(2)`, 22},
+		{`let f = fn(a = 1, b = a * 10) { a + b }; f(2, 3)`, 5},
+		{`let base = 10; let f = fn(a = base) { a }; f()`, 10},
+		{`let f = fn(a, b = if (a > 1) { 10 } else { 20 }) { b }; f(2)`, 10},
+		{`let f = fn(a, b = if (a > 1) { 10 } else { 20 }) { b }; f(0)`, 20},
+		{`let f = fn(a, b = if (a > 1) { 10 } else { 20 }) { b }; f(0, 5)`, 5},
+		{`fn() { let g = fn(a, b = 3) { a * b }; g(2) }()`, 6},
+		{`let sum = fn(n, acc = 0) { if (n == 0) { acc } else { sum(n - 1, acc + n) } }; sum(4)`, 10},
+		{`let f = fn(a, ...rest) { rest }; f(1, 2, 3)`, []int{2, 3}},
+		{`let f = fn(a, ...rest) { len(rest) }; f(1)`, 0},
+		{`let f = fn(a, b = 5, ...rest) { b + len(rest) }; f(1)`, 5},
+		{`let f = fn(a, b = 5, ...rest) { b + len(rest) }; f(1, 2, 3, 4)`, 4},
+		{`let add = fn(a, b, c) { a + b + c }; add(...[1, 2, 3])`, 6},
+		{`let add = fn(a, b, c) { a + b + c }; add(1, ...[2], 3)`, 6},
+		{`let add = fn(a, b, c) { a + b + c }; let xs = [2, 3]; add(...xs, 1)`, 6},
+		{`let f = fn(...args) { args }; f(...[], ...[1], 2)`, []int{1, 2}},
+		{`len(...["abc"])`, 3},
+		{`push(...[[1], 2])`, []int{1, 2}},
+		{`map([1, 2], fn(x, y = 10) { x + y })`, []int{11, 12}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []vmTestCase{
+		{`let [a, b] = [1, 2]; a * 10 + b`, 12},
+		{`let [head, ...tail] = [1, 2, 3]; tail`, []int{2, 3}},
+		{`let [a, ...rest] = [1]; len(rest)`, 0},
+		{`let {name, age: years} = {"name": "ann", "age": 3}; len(name) * years`, 9},
+		{`let {pos: [x, y]} = {"pos": [3, 4], "id": 1}; x * y`, 12},
+		{`let [{a}, [b]] = [{"a": 1}, [2]]; a + b`, 3},
+		{`let f = fn(pair) { let [a, b] = pair; b - a }; f([1, 5])`, 4},
+		{`let a = 1; let g = fn() { let [a] = [2]; a }; g() + a`, 3},
+		{`let f = fn(k) { let {v} = {"v": k}; fn() { v } }; f(7)()`, 7},
+	}
+
+	runVmTests(t, tests)
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`let [a, b] = [1];`, "cannot destructure array of length 1 into 2 elements"},
+		{`let [a, b, ...c] = [1];`, "cannot destructure array of length 1 into at least 2 elements"},
+		{`fn() { let [a] = 1; a }();`, "cannot destructure INTEGER as array"},
+		{`let {a} = [1];`, "cannot destructure ARRAY as hash"},
+		{`let {a, b} = {"a": 1};`, `cannot destructure hash without key "b"`},
+		{`let {p: [x]} = {"p": 1};`, "cannot destructure INTEGER as array"},
+	}
+
+	for _, tt := range errorTests {
+		comp := compiler.NewCompiler()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error:%s", err)
+		}
+
+		err = NewVm(comp.Bytecode()).Run()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong VM error for %q: want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	describe := `let describe = fn(v) {
+		match (v) {
+			0 => "zero",
+			1 => "one",
+			"x" => "ex",
+			[a, b] => a + b,
+			[h, ...t] if len(t) > 1 => len(t),
+			{type: "point", pos: [x, y]} => x * y,
+			true => "yes",
+			n if n == -3 => "negative",
+			_ => "other"
+		}
+	};`
+	tests := []vmTestCase{
+		{describe + `describe(0)`, "zero"},
+		{describe + `describe(1)`, "one"},
+		{describe + `describe("x")`, "ex"},
+		{describe + `describe([3, 4])`, 7},
+		{describe + `describe([1, 2, 3])`, 2},
+		{describe + `describe([1])`, "other"},
+		{describe + `describe({"type": "point", "pos": [2, 5]})`, 10},
+		{describe + `describe({"type": "line", "pos": [2, 5]})`, "other"},
+		{describe + `describe(true)`, "yes"},
+		{describe + `describe(-3)`, "negative"},
+		{describe + `describe(false)`, "other"},
+		{`match (1) { 2 => "two" }`, Null},
+		{`match (3) { 1 => "a", 2 => "b" }`, Null},
+		{`match (1) { 1 => "first", 1 => "second", 2 => "two" }`, "first"},
+		{`match ([1]) { 1 => "int", "1" => "string", _ => "other" }`, "other"},
+		{`match (5) { x => { let y = x * 2; y } }`, 10},
+		{`match (5) { _ => { let [a] = [1]; } }`, Null},
+		{`match ([1, [2, 3]]) { [1, [2, 4]] => "a", [1, [2, z]] => z }`, 3},
+		{`let f = fn(x) { match (x) { 1 => { return "early"; } } "late" }; f(1) + f(2)`, "earlylate"},
+		{`let f = fn(x) { let g = fn() { x }; match (g()) { 1 => "a", 2 => "b", _ => "c" } }; f(2)`, "b"},
+		// 分支中的变量遮蔽外层的同名变量，分支结束后不再可见
+		{`let x = 10; match (2) { x => x }`, 2},
+		{`let x = 10; match (2) { x => x }; x`, 10},
+		{`const x = 10; match (2) { x => x, _ => 0 }`, 2},
+		{`let f = fn() { let x = 1; let y = match (2) { x => x }; [x, y] }; f()`, []int{1, 2}},
+		{`let g = match (1) { y => fn() { y } }; let z = 5; g()`, 1},
+		{`match ([1, 2]) { [a, b] => match (b) { a => a + 10 } }`, 12},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len([1, 2, 3])`, 3},
+		{`len({1: 2, 3: 4})`, 2},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, Null},
+		{`last([1, 2, 3])`, 3},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`push([], 1)`, []int{1}},
+		{`let a = push([1], 2); let b = push(a, 3); let c = push(a, 4); [len(a), b[2], c[2]]`, []int{2, 3, 4}},
+		{`rest(rest(push(push([1], 2), 3)))`, []int{3}},
+		{`puts("hello", "world!")`, Null},
+		{`let len = fn(x) { 42 }; len("a")`, 42},
+		{`fn(xs) { len(xs) }([1, 2])`, 2},
+		{`has({"a": 1}, "a") == true`, true},
+		{`has({"a": 1}, "b")`, false},
+		{`keys({3: 1, 1: 2, 2: 3})`, []int{3, 1, 2}},
+		{`values({3: 1, 1: 2, 2: 3})`, []int{1, 2, 3}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestHigherOrderBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, []int{2, 4, 6}},
+		{`map([], fn(x) { x })`, []int{}},
+		{`let base = 10; map([1, 2], fn(x) { x + base })`, []int{11, 12}},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, []int{3, 4}},
+		{`reduce([1, 2, 3, 4], 0, fn(acc, x) { acc + x })`, 10},
+		{`reduce([], 7, fn(acc, x) { acc + x })`, 7},
+		{`each([1, 2], fn(x) { x })`, Null},
+		{`sort([3, 1, 2])`, []int{1, 2, 3}},
+		{`sort([3, 1, 2], fn(a, b) { b - a })`, []int{3, 2, 1}},
+		{`range(3)`, []int{0, 1, 2}},
+		{`range(1, 7, 2)`, []int{1, 3, 5}},
+		{`range(3, 0, -1)`, []int{3, 2, 1}},
+		{`len(zip([1, 2, 3], [4, 5]))`, 2},
+		{`zip([1, 2], [3, 4])[1]`, []int{2, 4}},
+		{`reverse([1, 2, 3])`, []int{3, 2, 1}},
+		{`reverse("abc")`, "cba"},
+		{`flatten([[1], 2, [3, 4]])`, []int{1, 2, 3, 4}},
+		{`unique([1, 2, 1, 3, 2])`, []int{1, 2, 3}},
+		{`map([[1], [2, 3]], len)`, []int{1, 2}},
+		{`map([1, 2], fn(x) { reduce(range(x + 1), 0, fn(a, b) { a + b }) })`, []int{1, 3}},
+		{`let add = fn(a, b) { a + b }; fn() { let x = map([1], fn(x) { add(x, 1) }); x[0] + 1 }()`, 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestJSONBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`json_parse("[1, -2, 3]")`, []int{1, -2, 3}},
+		{`json_parse("true")`, true},
+		{`json_parse("null")`, Null},
+		{`json_stringify([1, "a", true, first([])])`, `[1,"a",true,null]`},
+		{`json_stringify({"b": [1], "a": {}})`, `{"a":{},"b":[1]}`},
+		{`json_stringify([1, [2]], 2)`, "[\n  1,\n  [\n    2\n  ]\n]"},
+		{`json_parse(json_stringify({"k": [1, 2]}))["k"][1]`, 2},
+		{`let config = json_parse(json_stringify({"port": 80, "debug": false})); config["port"] + 1`, 81},
+		{`map(json_parse("[1, 2]"), fn(x) { json_stringify([x]) })[1]`, "[2]"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestHashOrder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b": 1, "a": 2, "c": 3}`, `{b: 1, a: 2, c: 3}`},
+		{`{3: 1, 1: 2, 3: 4}`, `{3: 4, 1: 2}`},
+		{`entries({"b": 1, true: 2})`, `[[b, 1], [true, 2]]`},
+		{`delete({"b": 1, "a": 2, "c": 3}, "a")`, `{b: 1, c: 3}`},
+		{`delete({"b": 1}, "x")`, `{b: 1}`},
+		{`let h = {"a": 1}; delete(h, "a"); h`, `{a: 1}`},
+		{`merge({"b": 1, "a": 2}, {"c": 3, "b": 4})`, `{b: 4, a: 2, c: 3}`},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.NewCompiler()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("comp.Compile() failed, input:%s, error: %s", tt.input, err)
+		}
+
+		vm := NewVm(comp.Bytecode())
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm.Run() failed, input:%s, error: %s", tt.input, err)
+		}
+
+		result := vm.LastPoppedStackElem().Inspect()
+		if result != tt.expected {
+			t.Errorf("wrong result, input:%s, want=%s, got=%s", tt.input, tt.expected, result)
+		}
+	}
+}
+
+func TestBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`keys([1])`, "argument to `keys` must be HASH, got ARRAY"},
+		{`has({}, fn() {})`, "unusable as hash key: COMPILED_FUNCTION"},
+		{`merge({}, 1)`, "argument to `merge` must be HASH, got INTEGER"},
+		{`map([1], 1)`, "argument to `map` must be FUNCTION, got INTEGER"},
+		{`map([1], fn(a, b) { a })`, "wrong number of arguments: want=2, got=1"},
+		{`map([1], fn(x) { x + "a" })`, "leftType:INTEGER and rightType:STRING not equal"},
+		{`sort([1, "a"])`, "cannot compare STRING and INTEGER"},
+		{`sort([2, 1], fn(a, b) { true })`, "comparator passed to `sort` must return INTEGER, got BOOLEAN"},
+		{`range(1, 2, 0)`, "`range` step must not be zero"},
+		{`json_parse(1)`, "argument to `json_parse` must be STRING, got INTEGER"},
+		{`json_parse("[1.5]")`, "json_parse: number 1.5 is not a 64-bit integer"},
+		{`json_stringify(fn(x) { x })`, "json_stringify: cannot encode COMPILED_FUNCTION as JSON"},
+		{`json_stringify({1: 2})`, "json_stringify: hash key must be STRING, got INTEGER"},
+		{`json_stringify([], 17)`, "`json_stringify` indent must be between 0 and 16, got 17"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.NewCompiler()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("comp.Compile() failed, input:%s, error: %s", tt.input, err)
+		}
+
+		vm := NewVm(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none, input:%s", tt.input)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error, want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestMacroExpansion(t *testing.T) {
+	tests := []vmTestCase{
+		{`let unless = macro(cond, cons, alt) { quote(if (!(unquote(cond))) { unquote(cons) } else { unquote(alt) }) };
+		unless(1 > 2, 10, 20)`, 10},
+		{`let square = macro(x) { quote(unquote(x) * unquote(x)) };
+		let f = fn(n) { square(n + 1) };
+		f(2)`, 9},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		env := object.NewEnvironment()
+		evaluator.DefineMacros(program, env)
+		expanded, err := evaluator.ExpandMacros(program, env)
+		if err != nil {
+			t.Fatalf("ExpandMacros failed, input:%s, error: %s", tt.input, err)
+		}
+
+		comp := compiler.NewCompiler()
+		err = comp.Compile(expanded)
+		if err != nil {
+			t.Fatalf("comp.Compile() failed, input:%s, error: %s", tt.input, err)
+		}
+
+		vm := NewVm(comp.Bytecode())
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm.Run() failed, input:%s, error: %s", tt.input, err)
+		}
+		testExpectedObject(t, tt.input, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
+func TestImportModule(t *testing.T) {
+	dir := t.TempDir()
+	modules := map[string]string{
+		"math.mk": `
+			let base = 10;
+			export let add = fn(a, b) { a + b };
+			export let addBase = fn(a) { add(a, base) };
+			export fn mul(a, b) { a * b }`,
+		"lib/twice.mk": `
+			import "math.mk" as m;
+			let base = 100;
+			export let twice = fn(a) { m.add(a, a) + base };
+			export let base = base;`,
+	}
+	for name, source := range modules {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("os.MkdirAll() failed, error:%s", err)
+		}
+		if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+			t.Fatalf("os.WriteFile() failed, error:%s", err)
+		}
+	}
+
+	tests := []vmTestCase{
+		{`import "math.mk" as math; math.add(1, 2)`, 3},
+		{`import "math.mk" as math; math.addBase(1)`, 11},
+		{`let base = 5; import "math.mk" as math; math.addBase(base)`, 15},
+		{`import "lib/twice.mk" as t; t.twice(2)`, 104},
+		{`import "lib/twice.mk" as t; import "math.mk" as m; m.add(t.base, 1)`, 101},
+		{`import "math.mk" as a; import "math.mk" as b; a.add == b.add`, true},
+		{`import "math.mk" as math; math.mul(2, 3)`, 6},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.NewCompiler()
+		comp.SetLoader(module.NewLoader(dir))
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("comp.Compile() failed, input:%s, error: %s", tt.input, err)
+		}
+
+		vm := NewVm(comp.Bytecode())
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm.Run() failed, input:%s, error: %s", tt.input, err)
+		}
+		testExpectedObject(t, tt.input, tt.expected, vm.LastPoppedStackElem())
+	}
+
+	comp := compiler.NewCompiler()
+	comp.SetLoader(module.NewLoader(dir))
+	err := comp.Compile(parse(`import "math.mk" as math; math.base`))
+	if err != nil {
+		t.Fatalf("comp.Compile() failed, error: %s", err)
+	}
+	err = NewVm(comp.Bytecode()).Run()
+	expected := "module " + filepath.Join(dir, "math.mk") + " has no exported member base"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("wrong VM error: want=%q, got=%v", expected, err)
+	}
+}
+
+func TestImportNativeModule(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatalf("os.WriteFile() failed, error:%s", err)
+	}
+	input := `import "io" as io; io.read_file("` + filepath.Join(dir, "a.txt") + `")`
+
+	run := func(l *module.Loader) (object.Object, error) {
+		comp := compiler.NewCompiler()
+		comp.SetLoader(l)
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("comp.Compile() failed, error: %s", err)
+		}
+		vm := NewVm(comp.Bytecode())
+		err := vm.Run()
+		return vm.LastPoppedStackElem(), err
+	}
+
+	_, err := run(module.NewLoader())
+	if err == nil || !strings.Contains(err.Error(), "outside the allowed directories") {
+		t.Errorf("io module is not sandboxed by default, got=%v", err)
+	}
+
+	l := module.NewLoader()
+	l.Register(stdlib.NewIO(stdlib.Capabilities{Dirs: []string{dir}}))
+	result, err := run(l)
+	if err != nil {
+		t.Fatalf("vm.Run() failed, error: %s", err)
+	}
+	testExpectedObject(t, input, "hello", result)
+}
+
+func TestContext(t *testing.T) {
+	var out bytes.Buffer
+	comp := compiler.NewCompiler()
+	err := comp.Compile(parse(`let show = fn(x) { puts(x) }; puts("a", 1); map([2, 3], show);`))
+	if err != nil {
+		t.Fatalf("comp.Compile() failed, error: %s", err)
+	}
+
+	vm := NewVm(comp.Bytecode())
+	vm.SetContext(&object.Context{Stdout: &out})
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm.Run() failed, error: %s", err)
+	}
+	if out.String() != "a\n1\n2\n3\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+}
+
+func TestWideOperands(t *testing.T) {
+	var locals, params, args, constants []string
+	for i := 0; i < 300; i++ {
+		locals = append(locals, fmt.Sprintf("let %s = %d", identifier(i), i))
+		params = append(params, identifier(i))
+		args = append(args, fmt.Sprint(i))
+	}
+	for i := 0; i < 70000; i++ {
+		constants = append(constants, fmt.Sprint(i))
+	}
+	padding := strings.TrimSuffix(strings.Repeat("true; ", 40000), " ")
+
+	tests := []vmTestCase{
+		{fmt.Sprintf("fn() { %s; %s + %s }()", strings.Join(locals, "; "), identifier(0), identifier(299)), 299},
+		{fmt.Sprintf("fn(%s) { %s - %s }(%s)", strings.Join(params, ", "), identifier(299), identifier(1), strings.Join(args, ", ")), 298},
+		{strings.Join(constants, "; "), 69999},
+		{fmt.Sprintf("[%s][299]", strings.Join(args, ", ")), 299},
+		{fmt.Sprintf("if (false) { %s } else { 1 }", padding), 1},
+		{fmt.Sprintf("if (true) { %s } else { 1 }", padding), true},
+		{fmt.Sprintf("let x = 3; if (x > 2) { %s } else { x }", padding), true},
+		{fmt.Sprintf("let x = 1; if (x > 2) { %s } else { x }", padding), 1},
+	}
+
+	runVmTests(t, tests)
+}
+
+// identifier 返回第i个只由字母组成的标识符，前缀x避免与关键字冲突
+func identifier(i int) string {
+	name := string(rune('a' + i%26))
+	for i /= 26; i > 0; i /= 26 {
+		name = string(rune('a'+i%26)) + name
+	}
+	return "x" + name
+}
+
 func parse(input string) *ast.Program {
 	l := lexer.NewLexer(input)
 	p := parser.NewParser(l)
@@ -396,31 +1059,35 @@ func testIntegerObject(expected int64, actual object.Object) error {
 	return nil
 }
 
+// runVmTests 分别在开启和关闭指令优化时运行测试用例
 func runVmTests(t *testing.T, tests []vmTestCase) {
 	t.Helper()
 
 	for _, tt := range tests {
 		program := parse(tt.input)
 
-		comp := compiler.NewCompiler()
-		err := comp.Compile(program)
-		if err != nil {
-			t.Fatalf("comp.Compile() failed, input:%s, error: %s",
-				tt.input, err)
-		}
+		for _, optimize := range []bool{true, false} {
+			comp := compiler.NewCompiler()
+			comp.SetOptimize(optimize)
+			err := comp.Compile(program)
+			if err != nil {
+				t.Fatalf("comp.Compile() failed, input:%s, error: %s",
+					tt.input, err)
+			}
 
-		// t.Logf("bytecode:%+v\n", comp.Bytecode())
-		vm := NewVm(comp.Bytecode())
-		err = vm.Run()
-		if err != nil {
-			t.Fatalf("vm.Run() failed, input:%s, error: %s",
-				tt.input, err)
-		}
+			// t.Logf("bytecode:%+v\n", comp.Bytecode())
+			vm := NewVm(comp.Bytecode())
+			err = vm.Run()
+			if err != nil {
+				t.Fatalf("vm.Run() failed, input:%s, optimize:%t, error: %s",
+					tt.input, optimize, err)
+			}
 
-		// stackElem := vm.StackTop()
-		stackElem := vm.LastPoppedStackElem()
-		// t.Logf("stackElem:%+v", stackElem)
-		testExpectedObject(t, tt.input, tt.expected, stackElem)
+			// stackElem := vm.StackTop()
+			stackElem := vm.LastPoppedStackElem()
+			// t.Logf("stackElem:%+v", stackElem)
+			testExpectedObject(t, tt.input, tt.expected, stackElem)
+		}
 	}
 }
 
@@ -453,31 +1120,31 @@ func testExpectedObject(t *testing.T, input string, expected interface{}, actual
 			t.Errorf("object not Array: %T (%+v)", actual, actual)
 			return
 		}
-		if len(array.Elements) != len(expected) {
+		if array.Len() != len(expected) {
 			t.Errorf("wrong num of elements. want=%d, got=%d",
-				len(expected), len(array.Elements))
+				len(expected), array.Len())
 			return
 		}
 
 		for i, expectedElem := range expected {
-			err := testIntegerObject(int64(expectedElem), array.Elements[i])
+			err := testIntegerObject(int64(expectedElem), array.At(i))
 			if err != nil {
 				t.Errorf("testIntegerObject() failed, error:%s", err)
 			}
 		}
-	case map[object.HashKey]int64:
+	case map[object.Object]int64:
 		hash, ok := actual.(*object.Hash)
 		if !ok {
 			t.Errorf("object is not Hash. got=%T (%+v)", actual, actual)
 		}
 
-		if len(hash.Pairs) != len(expected) {
+		if hash.Len() != len(expected) {
 			t.Errorf("hash has wrong number of Pairs. want=%d, got=%d",
-				len(expected), len(hash.Pairs))
+				len(expected), hash.Len())
 		}
 
 		for expectedKey, expectedValue := range expected {
-			pair, ok := hash.Pairs[expectedKey]
+			pair, ok := hash.Get(expectedKey)
 			if !ok {
 				t.Errorf("no pair for given key in Pairs")
 			}